@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/codegangsta/cli"
+)
+
+// giantKillerGap is how much higher an opponent must be rated for a win
+// against them to earn the giant killer achievement.
+const giantKillerGap = 300
+
+// achievement is an achievement earned by a player.
+type achievement struct {
+	// Name identifies the achievement, e.g. "giant-killer".
+	Name string `json:"name"`
+
+	// ResultID is the result that earned the achievement.
+	ResultID string `json:"result_id"`
+
+	// Date is when the achievement was earned.
+	Date time.Time `json:"date"`
+}
+
+// achievementDef describes an achievement and how it is earned.
+type achievementDef struct {
+	name        string
+	title       string
+	description string
+
+	// earned reports whether m, the latest result in h, earns the
+	// achievement for m.Player. before holds the ratings prior to m.
+	earned func(h *gobeatHistory, m *matchResult, before ratings) bool
+}
+
+// achievementDefs are every achievement that can be earned.
+var achievementDefs = []achievementDef{
+	achievementDef{
+		name:        "first-win",
+		title:       "First Win",
+		description: "won a match for the first time",
+		earned: func(h *gobeatHistory, m *matchResult, before ratings) bool {
+			return m.Won
+		},
+	},
+	achievementDef{
+		name:        "streak-10",
+		title:       "Unstoppable",
+		description: "won 10 matches in a row",
+		earned: func(h *gobeatHistory, m *matchResult, before ratings) bool {
+			return h.streak(m.Player) >= 10
+		},
+	},
+	achievementDef{
+		name:        "giant-killer",
+		title:       "Giant Killer",
+		description: fmt.Sprintf("beat someone rated %d Elo higher", giantKillerGap),
+		earned: func(h *gobeatHistory, m *matchResult, before ratings) bool {
+			return m.Won &&
+				before.get(m.Opponent)-before.get(m.Player) >= giantKillerGap
+		},
+	},
+}
+
+// lookupAchievement returns the definition of the achievement called name.
+func lookupAchievement(name string) (achievementDef, bool) {
+	for _, def := range achievementDefs {
+		if def.name == name {
+			return def, true
+		}
+	}
+	return achievementDef{}, false
+}
+
+// hasAchievement reports whether player has earned the achievement called
+// name.
+func (h *gobeatHistory) hasAchievement(player, name string) bool {
+	for _, a := range h.Achievements[player] {
+		if a.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluateAchievements records and returns any achievements m.Player newly
+// earned with m, which must already be the latest result in h.
+func (h *gobeatHistory) evaluateAchievements(m *matchResult) []*achievement {
+	before := h.ratingsBefore(m)
+
+	var earned []*achievement
+	for _, def := range achievementDefs {
+		if h.hasAchievement(m.Player, def.name) || !def.earned(h, m, before) {
+			continue
+		}
+		a := &achievement{Name: def.name, ResultID: m.ID, Date: m.Date}
+		earned = append(earned, a)
+
+		if h.Achievements == nil {
+			h.Achievements = make(map[string][]*achievement)
+		}
+		h.Achievements[m.Player] = append(h.Achievements[m.Player], a)
+	}
+	return earned
+}
+
+// achievementTitles returns the titles of achievements, joined by commas.
+func achievementTitles(achievements []*achievement) string {
+	var titles []string
+	for _, a := range achievements {
+		if def, ok := lookupAchievement(a.Name); ok {
+			titles = append(titles, def.title)
+		}
+	}
+	return strings.Join(titles, ", ")
+}
+
+// formatAchievement formats the celebratory post for an achievement.
+func formatAchievement(player string, a *achievement) string {
+	def, _ := lookupAchievement(a.Name)
+	return fmt.Sprintf("%s unlocked the %s achievement: %s!", player,
+		def.title, def.description)
+}
+
+// achievementsCommand returns the 'gobeat achievements' command.
+func achievementsCommand() cli.Command {
+	return cli.Command{
+		Name:        "achievements",
+		ShortName:   "a",
+		Description: "`achievements` lists the achievements a player has earned.",
+		Usage:       "achievements [player]",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "celebrate",
+				Usage: "'on' to post newly earned achievements, 'off' to stop",
+			},
+		},
+		Action: func(c *cli.Context) {
+			switch c.String("celebrate") {
+			case "":
+			case "on", "off":
+				settings.CelebrateAchievements = c.String("celebrate") == "on"
+				fmt.Printf("Set achievement posts to %s\n", c.String("celebrate"))
+				if err := settings.save(); err != nil {
+					printError(err)
+				}
+				return
+			default:
+				printError(fmt.Errorf("--celebrate must be 'on' or 'off'."))
+			}
+
+			player := settings.User
+			if len(c.Args()) > 0 {
+				player = c.Args().First()
+			}
+
+			h, err := retrieveHistory()
+			if err != nil {
+				printError(err)
+			}
+			if len(h.Achievements[player]) == 0 {
+				fmt.Printf("%s has no achievements yet.\n", player)
+				return
+			}
+			for _, a := range h.Achievements[player] {
+				def, _ := lookupAchievement(a.Name)
+				fmt.Printf("%s  %s: %s\n", a.Date.Format("2006-01-02"), def.title,
+					def.description)
+			}
+		},
+	}
+}
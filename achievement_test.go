@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestEvaluateAchievements(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	h := mockHistoryFile(t)
+
+	loss := &matchResult{ID: "1", Player: "alex", Opponent: "oleg"}
+	h.add(loss)
+	if earned := h.evaluateAchievements(loss); len(earned) != 0 {
+		t.Fatalf("Expected no achievements for a loss, got %v", earned)
+	}
+
+	win := &matchResult{ID: "2", Player: "alex", Opponent: "oleg", Won: true}
+	h.add(win)
+	earned := h.evaluateAchievements(win)
+	if len(earned) != 1 || earned[0].Name != "first-win" {
+		t.Fatalf("Expected the first win achievement, got %v", earned)
+	}
+
+	again := &matchResult{ID: "3", Player: "alex", Opponent: "oleg", Won: true}
+	h.add(again)
+	if earned := h.evaluateAchievements(again); len(earned) != 0 {
+		t.Fatal("Expected achievements to only be earned once.")
+	}
+}
+
+func TestGiantKillerAchievement(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	h := mockHistoryFile(t)
+	// Oleg climbs to ~1830 beating newcomers while Alex stays at 1500.
+	for i := 0; i < 40; i++ {
+		h.add(&matchResult{Player: "oleg", Opponent: fmt.Sprint(i), Won: true})
+	}
+
+	upset := &matchResult{ID: "upset", Player: "alex", Opponent: "oleg", Won: true}
+	h.add(upset)
+	h.evaluateAchievements(upset)
+	if !h.hasAchievement("alex", "giant-killer") {
+		t.Fatal("Expected beating a much higher rated player to be giant killing.")
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/codegangsta/cli"
+)
+
+// backupFile is a file gobeat keeps state in, as stored in a backup.
+type backupFile struct {
+	// name is the file's name inside the backup.
+	name string
+
+	// path is where the file lives.
+	path string
+
+	// perm is the permissions it is restored with.
+	perm os.FileMode
+}
+
+// backupFiles returns the files a backup holds: the settings (including the
+// roster), history, queued results, drafts, results awaiting approval, how far
+// the history has been synced and the Telegram bot has read, and the progress
+// of an import, plus the credential store if credentials is set.
+func backupFiles(credentials bool) []backupFile {
+	files := []backupFile{
+		{name: settingsFile, path: gobeatPath, perm: 0644},
+		{name: historyFile, path: historyPath, perm: 0644},
+		{name: pendingFile, path: pendingPath, perm: 0644},
+		{name: outboxFile, path: outboxPath, perm: 0644},
+		{name: awaitingFile, path: awaitingPath, perm: 0644},
+		{name: syncFile, path: syncPath, perm: 0644},
+		{name: telegramFile, path: telegramPath, perm: 0644},
+		{name: importCheckpointFile, path: importCheckpointPath, perm: 0644},
+	}
+	if credentials {
+		files = append(files, backupFile{name: credentialsFile, path: credentialsPath, perm: 0600})
+	}
+	return files
+}
+
+// createBackup writes a gzipped tar of files to w, skipping any that don't
+// exist. It returns the names of the files backed up.
+func createBackup(w io.Writer, files []backupFile) ([]string, error) {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	var names []string
+	for _, f := range files {
+		b, err := ioutil.ReadFile(f.path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		hdr := &tar.Header{
+			Name:    f.name,
+			Mode:    int64(f.perm),
+			Size:    int64(len(b)),
+			ModTime: time.Now(),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(b); err != nil {
+			return nil, err
+		}
+		names = append(names, f.name)
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return names, gz.Close()
+}
+
+// restoreBackup restores files from the gzipped tar in r. Existing files are
+// only replaced if force is set. It returns the names of the files restored.
+func restoreBackup(r io.Reader, files []backupFile, force bool) ([]string, error) {
+	byName := map[string]backupFile{}
+	for _, f := range files {
+		byName[f.name] = f
+	}
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	// Read everything before writing anything, so that a bad backup leaves
+	// the current state alone.
+	contents := map[string][]byte{}
+	var names []string
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		f, ok := byName[hdr.Name]
+		if !ok {
+			return nil, fmt.Errorf("unexpected %s in backup", hdr.Name)
+		}
+		b, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(f.path); err == nil && !force {
+			return nil, fmt.Errorf("%s already exists; use --force to replace it.", f.path)
+		}
+		contents[f.name] = b
+		names = append(names, f.name)
+	}
+
+	for _, name := range names {
+		f := byName[name]
+		if err := writeFileAtomic(f.path, contents[name], f.perm); err != nil {
+			return nil, err
+		}
+	}
+	return names, nil
+}
+
+// backupCommand returns the 'gobeat backup' command.
+func backupCommand() cli.Command {
+	return cli.Command{
+		Name: "backup",
+		Description: "`backup` saves gobeat's settings, roster, history, queued " +
+			"results and sync, import and Telegram bot progress to an archive, or " +
+			"restores them from one.",
+		Usage: "backup [create|restore] [file]",
+		Subcommands: []cli.Command{
+			cli.Command{
+				Name:        "create",
+				Description: "`backup create` writes a gzipped tar backup.",
+				Usage:       "backup create [--credentials] [file]",
+				Flags: []cli.Flag{
+					cli.BoolFlag{
+						Name:  "credentials",
+						Usage: "include stored passwords and secrets",
+					},
+				},
+				Action: func(c *cli.Context) {
+					if len(c.Args()) == 0 {
+						printError(fmt.Errorf("missing backup file."))
+					}
+					f, err := os.OpenFile(c.Args().First(), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+					if err != nil {
+						printError(err)
+					}
+					names, err := createBackup(f, backupFiles(c.Bool("credentials")))
+					if err != nil {
+						f.Close()
+						printError(err)
+					}
+					if err := f.Close(); err != nil {
+						printError(err)
+					}
+					fmt.Printf("Backed up %d files to %s\n", len(names), c.Args().First())
+				},
+			},
+			cli.Command{
+				Name:        "restore",
+				Description: "`backup restore` restores files from a backup.",
+				Usage:       "backup restore [--force] [file]",
+				Flags: []cli.Flag{
+					cli.BoolFlag{
+						Name:  "force",
+						Usage: "replace existing settings and history",
+					},
+				},
+				Action: func(c *cli.Context) {
+					if len(c.Args()) == 0 {
+						printError(fmt.Errorf("missing backup file."))
+					}
+					f, err := os.Open(c.Args().First())
+					if err != nil {
+						printError(err)
+					}
+					defer f.Close()
+					names, err := restoreBackup(f, backupFiles(true), c.Bool("force"))
+					if err != nil {
+						printError(err)
+					}
+					for _, name := range names {
+						fmt.Printf("Restored %s\n", name)
+					}
+				},
+			},
+		},
+	}
+}
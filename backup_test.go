@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestBackup(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	h := mockHistoryFile(t)
+	r, err := newMatchResult("oleg", "21-15", true)
+	if err != nil {
+		t.Fatalf("Could not create result: %s", err)
+	}
+	h.add(r)
+	if err := h.save(); err != nil {
+		t.Fatalf("Could not save history: %s", err)
+	}
+	if err := storeCredential(credentialSigning, "s3cret"); err != nil {
+		t.Fatalf("Could not store secret: %s", err)
+	}
+	if err := saveSyncState(&syncState{Pulled: r.Date}); err != nil {
+		t.Fatalf("Could not save sync state: %s", err)
+	}
+
+	var buf bytes.Buffer
+	names, err := createBackup(&buf, backupFiles(false))
+	if err != nil {
+		t.Fatalf("Expected a clean backup: %s", err)
+	}
+	if len(names) != 3 || names[2] != syncFile {
+		t.Fatalf("Expected settings, history and sync state without credentials, got %v", names)
+	}
+
+	backup := buf.Bytes()
+	if _, err := restoreBackup(bytes.NewReader(backup), backupFiles(true), false); err == nil {
+		t.Fatal("Expected restore to refuse to replace existing files.")
+	}
+
+	os.Remove(historyPath)
+	os.Remove(gobeatPath)
+	os.Remove(syncPath)
+	if _, err := restoreBackup(bytes.NewReader(backup), backupFiles(true), false); err != nil {
+		t.Fatalf("Expected a clean restore: %s", err)
+	}
+	restored, err := retrieveHistory()
+	if err != nil {
+		t.Fatalf("Could not retrieve history: %s", err)
+	}
+	if len(restored.Results) != 1 || restored.Results[0].ID != r.ID {
+		t.Fatal("Expected the history to be restored.")
+	}
+	if _, err := os.Stat(gobeatPath); err != nil {
+		t.Fatalf("Expected the settings to be restored: %s", err)
+	}
+	if state, err := retrieveSyncState(); err != nil || !state.Pulled.Equal(r.Date) {
+		t.Fatal("Expected the sync state to be restored.")
+	}
+}
+
+func TestRestoreCredentialsPrivately(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	mockHistoryFile(t)
+	if err := storeCredential(credentialSigning, "s3cret"); err != nil {
+		t.Fatalf("Could not store secret: %s", err)
+	}
+	var buf bytes.Buffer
+	if _, err := createBackup(&buf, backupFiles(true)); err != nil {
+		t.Fatalf("Expected a clean backup: %s", err)
+	}
+
+	// A readable file already in the way must not leak the secrets.
+	if err := os.Chmod(credentialsPath, 0644); err != nil {
+		t.Fatalf("Could not change permissions: %s", err)
+	}
+	if _, err := restoreBackup(&buf, backupFiles(true), true); err != nil {
+		t.Fatalf("Expected a clean restore: %s", err)
+	}
+	fi, err := os.Stat(credentialsPath)
+	if err != nil {
+		t.Fatalf("Expected the credential store to be restored: %s", err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Fatalf("Expected the credential store to be private, got %v", fi.Mode().Perm())
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/codegangsta/cli"
+)
+
+// botLeaderboardSize is how many players the bots' leaderboard lists.
+const botLeaderboardSize = 10
+
+// botPlayer returns the player behind a chat username: whoever has the
+// matching handle on the roster, or the username itself.
+func botPlayer(username string) string {
+	handle := normalizeHandle(username)
+	for _, name := range settings.rosterNames() {
+		if strings.EqualFold(settings.Roster[name].Handle, handle) {
+			return name
+		}
+	}
+	return username
+}
+
+// handleBotCommand runs a chat command sent by player, such as
+// "!result oleg 21-15", and returns the reply. Commands start with prefix.
+// It returns false if text is not a command the bots understand.
+func handleBotCommand(player, text, prefix string) (string, bool) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], prefix) {
+		return "", false
+	}
+
+	switch strings.TrimPrefix(fields[0], prefix) {
+	case "result":
+		if len(fields) < 3 {
+			return fmt.Sprintf("Usage: %sresult [opponent] [score] [lost]", prefix), true
+		}
+		r, err := newMatchResult(fields[1], fields[2],
+			len(fields) < 4 || fields[3] != "lost")
+		if err != nil {
+			return "Error: " + err.Error(), true
+		}
+		r.Player = player
+
+		rec, err := recordResult(r, resultHashtags(""))
+		if err != nil {
+			return "Error: " + err.Error(), true
+		}
+		return rec.Message, true
+
+	case "leaderboard":
+		h, err := retrieveHistory()
+		if err != nil {
+			return "Error: " + err.Error(), true
+		}
+		return formatLeaderboard(h.standings(settings.Game, time.Now()).ratings(),
+			botLeaderboardSize), true
+	}
+	return "", false
+}
+
+// formatLeaderboard formats the top n of r for chat, naming players as in
+// announcements.
+func formatLeaderboard(r ratings, n int) string {
+	standings := sortedStandings(r)
+	if len(standings) == 0 {
+		return "No results recorded yet."
+	}
+	if len(standings) > n {
+		standings = standings[:n]
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s leaderboard:", settings.Game)
+	for i, s := range standings {
+		fmt.Fprintf(&buf, "\n%d. %s (%.0f)", i+1, settings.publicPlayer(s.Player), s.Rating)
+	}
+	return buf.String()
+}
+
+// botCommand returns the 'gobeat bot' command and its subcommands.
+func botCommand() cli.Command {
+	return cli.Command{
+		Name:        "bot",
+		ShortName:   "b",
+		Description: "`bot` runs gobeat as a chat bot accepting results and leaderboard requests.",
+		Usage:       "bot [discord|telegram]",
+		Subcommands: []cli.Command{
+			discordBotCommand(),
+			telegramBotCommand(),
+		},
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHandleBotCommandResult(t *testing.T) {
+	ts, posted := mockTarget(t)
+	defer ts.Close()
+	mockHistoryFile(t)
+
+	reply, ok := handleBotCommand("oleg", "!result alex 21-19", "!")
+	if !ok {
+		t.Fatal("Expected !result to be handled.")
+	}
+	if reply != "🏓 oleg beat alex at ping pong with score 21-19 #OfficePong" ||
+		len(posted()) != 1 {
+		t.Fatalf("Expected the result to be posted and echoed, got %q", reply)
+	}
+
+	h, err := retrieveHistory()
+	if err != nil {
+		t.Fatalf("Could not retrieve history: %s", err)
+	}
+	if h.Results[0].Player != "oleg" {
+		t.Fatal("Expected the result to be recorded for the sender.")
+	}
+}
+
+func TestHandleBotCommandLeaderboard(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	h := mockHistoryFile(t)
+	h.add(&matchResult{Player: "alex", Opponent: "oleg", Game: "ping pong", Won: true})
+	if err := h.save(); err != nil {
+		t.Fatalf("Could not save history: %s", err)
+	}
+
+	reply, ok := handleBotCommand("alex", "/leaderboard", "/")
+	if !ok || !strings.HasPrefix(reply, "ping pong leaderboard:\n1. alex (1516)") {
+		t.Fatalf("Expected a leaderboard, got %q", reply)
+	}
+	settings.OpponentNames = opponentNamesInitials
+	reply, _ = handleBotCommand("alex", "/leaderboard", "/")
+	if !strings.Contains(reply, "\n2. O. (") || strings.Contains(reply, "oleg") {
+		t.Fatalf("Expected opponents to be named as in announcements, got %q", reply)
+	}
+	settings.OpponentNames = ""
+
+	if _, ok := handleBotCommand("alex", "nice game!", "/"); ok {
+		t.Fatal("Expected chatter to be ignored.")
+	}
+}
+
+func TestBotPlayer(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	settings.rosterEntry("oleg").Handle = "@OlegK"
+
+	if botPlayer("olegk") != "oleg" || botPlayer("ivan") != "ivan" {
+		t.Fatal("Expected chat usernames to map to roster players by handle.")
+	}
+}
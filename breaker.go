@@ -0,0 +1,386 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/codegangsta/cli"
+)
+
+const breakerFile = ".gobeat_breaker"
+
+// breakerPath is the full path to where the target's circuit breaker state
+// resides, so that it persists between runs.
+var breakerPath = filepath.Join(os.Getenv("HOME"), breakerFile)
+
+// breakerThreshold is how many consecutive failures open the breaker.
+const breakerThreshold = 3
+
+// breakerCooldown is how long the breaker stays open after the last failure
+// before the target is tried again.
+const breakerCooldown = 5 * time.Minute
+
+// breaker tracks consecutive failures posting to the target. Once open, posts
+// are queued without waiting on the target until the cooldown has passed.
+type breaker struct {
+	// Target is the target URL the failures were against.
+	Target string `json:"target"`
+
+	// Failures is how many posts in a row have failed.
+	Failures int `json:"failures"`
+
+	// Since is when the first of those failures happened.
+	Since time.Time `json:"since"`
+
+	// Last is when the latest failure happened.
+	Last time.Time `json:"last"`
+
+	// RetryAfter is when the target last asked to be left alone until, after
+	// rate limiting a post.
+	RetryAfter time.Time `json:"retry_after,omitempty"`
+}
+
+// errBreakerOpen is returned instead of posting while the breaker is open.
+type errBreakerOpen struct {
+	since time.Time
+
+	// until is when the target asked to be tried again, if it did.
+	until time.Time
+}
+
+func (e *errBreakerOpen) Error() string {
+	if !e.until.IsZero() {
+		return fmt.Sprintf("server asked to wait until %s", e.until.Format("15:04:05"))
+	}
+	return fmt.Sprintf("server appears down since %s", e.since.Format("15:04"))
+}
+
+// retrieveBreaker loads the breaker state for target.
+func retrieveBreaker(target string) (*breaker, error) {
+	b, err := ioutil.ReadFile(breakerPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &breaker{Target: target}, nil
+		}
+		return nil, err
+	}
+	br := new(breaker)
+	if err := json.Unmarshal(b, br); err != nil {
+		return nil, err
+	}
+	// Failures against a previous target say nothing about this one.
+	if br.Target != target {
+		return &breaker{Target: target}, nil
+	}
+	return br, nil
+}
+
+// open reports whether posts should be short-circuited at now: either the
+// target is rate limiting, or it has failed too often recently. A target that
+// said when to come back is tried again then rather than after the cooldown.
+func (br *breaker) open(now time.Time) bool {
+	if !br.RetryAfter.IsZero() {
+		return now.Before(br.RetryAfter)
+	}
+	return br.Failures >= breakerThreshold && now.Sub(br.Last) < breakerCooldown
+}
+
+// err returns the error for posts short-circuited by the breaker.
+func (br *breaker) err() error {
+	return &errBreakerOpen{since: br.Since, until: br.RetryAfter}
+}
+
+// record updates the breaker with the outcome of a post at now.
+func (br *breaker) record(err error, now time.Time) {
+	if err == nil {
+		br.Failures = 0
+		br.Since, br.Last, br.RetryAfter = time.Time{}, time.Time{}, time.Time{}
+		return
+	}
+	if br.Failures == 0 {
+		br.Since = now
+	}
+	br.Failures++
+	br.Last = now
+	br.RetryAfter = time.Time{}
+	if rl, ok := err.(*errRateLimited); ok {
+		br.RetryAfter = now.Add(rl.wait)
+	}
+}
+
+// save saves to disk the breaker state in '~/.gobeat_breaker'.
+func (br *breaker) save() error {
+	b, err := json.Marshal(br)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(breakerPath, b, 0644)
+}
+
+// breakerMu serializes reading and saving the breaker state between posts
+// made concurrently.
+var breakerMu sync.Mutex
+
+// guardedPost posts msg for result id to u unless the breaker is open,
+// recording the outcome in the breaker. The target only announces it if
+// announce is true. It is safe to call concurrently.
+func guardedPost(u *url.URL, id, msg string, announce bool) error {
+	breakerMu.Lock()
+	br, err := retrieveBreaker(u.String())
+	breakerMu.Unlock()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if br.open(now) {
+		return br.err()
+	}
+
+	postErr := postResult(u, id, msg, announce)
+	breakerMu.Lock()
+	defer breakerMu.Unlock()
+	// Reloaded, as other posts may have finished in the meantime.
+	if br, err = retrieveBreaker(u.String()); err != nil {
+		return err
+	}
+	if postErr == errAwaitingApproval {
+		// The target is up; it is only holding the result.
+		br.record(nil, now)
+	} else {
+		br.record(postErr, now)
+	}
+	if postErr != nil && br.Failures == breakerThreshold {
+		logger.Warn("target appears down; queueing results", "target", u.String(),
+			"since", br.Since.Format("15:04"), "failures", br.Failures)
+	}
+	if err := br.save(); err != nil {
+		return err
+	}
+	if _, ok := postErr.(*errRateLimited); ok {
+		// Left as is so that retries can wait as long as the target asked.
+		return postErr
+	}
+	if postErr != nil && br.open(now) {
+		return fmt.Errorf("%s (%s)", br.err(), postErr)
+	}
+	return postErr
+}
+
+const pendingFile = ".gobeat_pending"
+
+// pendingPath is the full path to where announcements waiting to be posted
+// to the target reside.
+var pendingPath = filepath.Join(os.Getenv("HOME"), pendingFile)
+
+// pendingPost is an announcement that could not be posted to the target.
+type pendingPost struct {
+	// ResultID is the result the announcement is for.
+	ResultID string `json:"result_id"`
+
+	// Message is the announcement.
+	Message string `json:"message"`
+
+	// Opponent is who the result was against, which flushes keep the order
+	// of announcements for.
+	Opponent string `json:"opponent,omitempty"`
+
+	// Unannounced is whether the target should only record the result.
+	Unannounced bool `json:"unannounced,omitempty"`
+
+	// Queued is when posting first failed.
+	Queued time.Time `json:"queued"`
+}
+
+// retrievePending loads the announcements waiting to be posted, oldest first.
+func retrievePending() ([]*pendingPost, error) {
+	b, err := ioutil.ReadFile(pendingPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var out []*pendingPost
+	if err := json.Unmarshal(b, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// savePending saves to disk the announcements in '~/.gobeat_pending'.
+func savePending(p []*pendingPost) error {
+	if len(p) == 0 {
+		if err := os.Remove(pendingPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(pendingPath, b, 0644)
+}
+
+// queuePost adds msg for result id against opponent to the announcements
+// waiting to be posted, to be announced by the target if announce is true.
+func queuePost(id, opponent, msg string, announce bool) error {
+	p, err := retrievePending()
+	if err != nil {
+		return err
+	}
+	return savePending(append(p, &pendingPost{
+		ResultID:    id,
+		Message:     msg,
+		Opponent:    opponent,
+		Unannounced: !announce,
+		Queued:      time.Now(),
+	}))
+}
+
+// requeuePost replaces the announcement waiting to be posted for result id
+// with msg. It returns false if nothing was waiting for id.
+func requeuePost(id, msg string) (bool, error) {
+	p, err := retrievePending()
+	if err != nil {
+		return false, err
+	}
+	found := false
+	for _, post := range p {
+		if post.ResultID == id {
+			post.Message = msg
+			found = true
+		}
+	}
+	if !found {
+		return false, nil
+	}
+	return true, savePending(p)
+}
+
+// flushPending posts waiting announcements to u, returning how many were
+// posted. With one worker they are posted in order, stopping at the first
+// failure. With more, announcements against different opponents are posted
+// concurrently by up to workers at a time, but those against the same
+// opponent are still posted in order, stopping at their first failure, so that
+// each matchup reads sensibly. The first failure is returned.
+func flushPending(u *url.URL, workers int) (int, error) {
+	p, err := retrievePending()
+	if err != nil {
+		return 0, err
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	// Each lane is posted in order by a single worker.
+	var lanes [][]int
+	lane := make(map[string]int)
+	for i, post := range p {
+		key := post.Opponent
+		if workers == 1 {
+			key = ""
+		}
+		l, ok := lane[key]
+		if !ok {
+			l = len(lanes)
+			lane[key] = l
+			lanes = append(lanes, nil)
+		}
+		lanes[l] = append(lanes[l], i)
+	}
+
+	posted := make([]bool, len(p))
+	errs := make([]error, len(lanes))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < len(lanes); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for l := range jobs {
+				for _, i := range lanes[l] {
+					errs[l] = guardedPost(u, p[i].ResultID, p[i].Message, !p[i].Unannounced)
+					if errs[l] == errAwaitingApproval {
+						errs[l] = awaitApproval(p[i].ResultID)
+					}
+					if errs[l] != nil {
+						break
+					}
+					posted[i] = true
+				}
+			}
+		}()
+	}
+	for l := range lanes {
+		jobs <- l
+	}
+	close(jobs)
+	wg.Wait()
+
+	n := 0
+	var left []*pendingPost
+	for i, post := range p {
+		if posted[i] {
+			n++
+		} else {
+			left = append(left, post)
+		}
+	}
+	if n > 0 {
+		if err := savePending(left); err != nil {
+			return n, err
+		}
+	}
+	for _, err := range errs {
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// flushCommand returns the 'gobeat flush' command.
+func flushCommand() cli.Command {
+	return cli.Command{
+		Name: "flush",
+		Description: "`flush` posts announcements that were queued while the " +
+			"target was down, oldest first, and drops results a moderator rejected " +
+			"from the history.",
+		Usage: "flush [--workers n]",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "workers",
+				Usage: "how many announcements to post at once, keeping each opponent's in order",
+			},
+		},
+		Action: func(c *cli.Context) {
+			workers := 1
+			if w := c.String("workers"); w != "" {
+				var err error
+				if workers, err = strconv.Atoi(w); err != nil || workers < 1 {
+					printError(fmt.Errorf("workers must be a positive number."))
+				}
+			}
+			u, err := settings.URL()
+			if err != nil {
+				printError(err)
+			}
+			n, err := flushPending(u, workers)
+			fmt.Printf("Posted %d queued results\n", n)
+			if err != nil {
+				printError(err)
+			}
+			reportRejections()
+		},
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Date(2014, 6, 1, 10, 32, 0, 0, time.UTC)
+	br := &breaker{}
+	for i := 0; i < breakerThreshold; i++ {
+		if br.open(now) {
+			t.Fatalf("Expected the breaker to stay closed after %d failures.", i)
+		}
+		br.record(fmt.Errorf("down"), now.Add(time.Duration(i)*time.Second))
+	}
+	if !br.open(now.Add(time.Minute)) {
+		t.Fatal("Expected repeated failures to open the breaker.")
+	}
+	if !br.Since.Equal(now) {
+		t.Fatalf("Expected the breaker to remember the first failure, got %s", br.Since)
+	}
+	if br.open(now.Add(breakerCooldown + time.Minute)) {
+		t.Fatal("Expected the breaker to let a post through after the cooldown.")
+	}
+	br.record(nil, now)
+	if br.Failures != 0 {
+		t.Fatal("Expected a success to reset the breaker.")
+	}
+}
+
+func TestRecordResultQueued(t *testing.T) {
+	var mu sync.Mutex
+	up, posted := false, 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !up {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		posted++
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer ts.Close()
+	mockSettingsFile(t, ts.URL)
+	mockHistoryFile(t)
+
+	for i := 0; i < 2; i++ {
+		r, err := newMatchResult("oleg", "21-15", true)
+		if err != nil {
+			t.Fatalf("Could not create result: %s", err)
+		}
+		rec, err := recordResult(r, nil)
+		if err != nil {
+			t.Fatalf("Expected a queued result not to fail: %s", err)
+		}
+		if !rec.Deliveries[0].Queued {
+			t.Fatal("Expected the result to be queued for the target.")
+		}
+	}
+	if _, ok := guardedPost(mustParse(t, ts.URL), "", "x", true).(*errBreakerOpen); !ok {
+		t.Fatal("Expected the breaker to be open after repeated failures.")
+	}
+	p, err := retrievePending()
+	if err != nil || len(p) != 2 {
+		t.Fatalf("Expected both results queued, got %v (%v)", p, err)
+	}
+
+	// Once the server is back and the cooldown is over, flushing posts them.
+	mu.Lock()
+	up = true
+	mu.Unlock()
+	br, err := retrieveBreaker(ts.URL)
+	if err != nil {
+		t.Fatalf("Could not retrieve breaker: %s", err)
+	}
+	br.Last = br.Last.Add(-breakerCooldown)
+	if err := br.save(); err != nil {
+		t.Fatalf("Could not save breaker: %s", err)
+	}
+	n, err := flushPending(mustParse(t, ts.URL), 1)
+	if err != nil || n != 2 {
+		t.Fatalf("Expected both results to be posted, got %d (%v)", n, err)
+	}
+	if p, _ := retrievePending(); len(p) != 0 || posted != 2 {
+		t.Fatal("Expected nothing left queued.")
+	}
+}
+
+// mustParse parses s as a URL.
+func mustParse(t *testing.T, s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		t.Fatalf("Could not parse URL: %s", err)
+	}
+	return u
+}
+
+func TestBreakerRetryAfter(t *testing.T) {
+	now := time.Date(2014, 6, 1, 10, 32, 0, 0, time.UTC)
+	br := &breaker{}
+	br.record(&errRateLimited{op: "request", code: 429, wait: 10 * time.Minute}, now)
+	if !br.open(now.Add(time.Minute)) {
+		t.Fatal("Expected a rate limit to open the breaker.")
+	}
+	if br.open(now.Add(10 * time.Minute)) {
+		t.Fatal("Expected the breaker to close once the wait is over.")
+	}
+	if err := br.err().Error(); err != "server asked to wait until 10:42:00" {
+		t.Fatalf("Expected the wait in the error, got %q", err)
+	}
+}
+
+func TestFlushPendingWorkers(t *testing.T) {
+	var mu sync.Mutex
+	var got []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		if string(b) == "alex beat ivan 2" {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		got = append(got, string(b))
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer ts.Close()
+	mockSettingsFile(t, ts.URL)
+
+	for i := 1; i <= 3; i++ {
+		for _, opponent := range []string{"oleg", "ivan"} {
+			if err := queuePost("", opponent, fmt.Sprintf("alex beat %s %d", opponent, i), true); err != nil {
+				t.Fatalf("Could not queue post: %s", err)
+			}
+		}
+	}
+	n, err := flushPending(mustParse(t, ts.URL), 4)
+	if err == nil || n != 4 {
+		t.Fatalf("Expected four posts and the failure, got %d (%v)", n, err)
+	}
+
+	var oleg []string
+	for _, msg := range got {
+		if strings.Contains(msg, "oleg") {
+			oleg = append(oleg, msg)
+		}
+	}
+	if strings.Join(oleg, ",") != "alex beat oleg 1,alex beat oleg 2,alex beat oleg 3" {
+		t.Fatalf("Expected oleg's results in order, got %v", oleg)
+	}
+	p, _ := retrievePending()
+	if len(p) != 2 || p[0].Message != "alex beat ivan 2" || p[1].Message != "alex beat ivan 3" {
+		t.Fatalf("Expected ivan's results from the failure on to stay queued, got %v", p)
+	}
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/codegangsta/cli"
+)
+
+const (
+	// cardWidth and cardHeight are the size of scorecards, in pixels, matching
+	// the aspect ratio of link previews.
+	cardWidth  = 800
+	cardHeight = 420
+
+	// cardMargin is the blank border around a scorecard's text.
+	cardMargin = 40
+
+	// glyphWidth and glyphHeight are the size of a character in the scorecard
+	// font at scale 1, excluding the one pixel gap after each character.
+	glyphWidth  = 5
+	glyphHeight = 7
+)
+
+// cardTheme is the colors a scorecard is drawn in.
+type cardTheme struct {
+	Background color.RGBA
+	Text       color.RGBA
+	Muted      color.RGBA
+
+	// Accent highlights the winners and the score.
+	Accent color.RGBA
+}
+
+// cardThemes are the themes scorecards can be drawn in, by name.
+var cardThemes = map[string]*cardTheme{
+	"light": {
+		Background: color.RGBA{0xff, 0xff, 0xff, 0xff},
+		Text:       color.RGBA{0x22, 0x22, 0x22, 0xff},
+		Muted:      color.RGBA{0x88, 0x88, 0x88, 0xff},
+		Accent:     color.RGBA{0x1d, 0xa1, 0xf2, 0xff},
+	},
+	"dark": {
+		Background: color.RGBA{0x15, 0x20, 0x2b, 0xff},
+		Text:       color.RGBA{0xff, 0xff, 0xff, 0xff},
+		Muted:      color.RGBA{0x8b, 0x98, 0xa5, 0xff},
+		Accent:     color.RGBA{0x1d, 0xa1, 0xf2, 0xff},
+	},
+	"table": {
+		Background: color.RGBA{0x1b, 0x5e, 0x20, 0xff},
+		Text:       color.RGBA{0xff, 0xff, 0xff, 0xff},
+		Muted:      color.RGBA{0xa5, 0xd6, 0xa7, 0xff},
+		Accent:     color.RGBA{0xff, 0xeb, 0x3b, 0xff},
+	},
+}
+
+// defaultCardTheme is the theme used when none has been chosen.
+const defaultCardTheme = "light"
+
+// themeNames returns the names of the scorecard themes, sorted.
+func themeNames() []string {
+	var names []string
+	for name := range cardThemes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// cardTheme returns the scorecard theme chosen with 'gobeat card --theme'.
+func (g *gobeatSettings) cardTheme() *cardTheme {
+	if t, ok := cardThemes[g.CardTheme]; ok {
+		return t
+	}
+	return cardThemes[defaultCardTheme]
+}
+
+// glyphs is the scorecard font: each character is glyphHeight rows, with the
+// leftmost of glyphWidth pixels in the highest bit. Letters are drawn in
+// upper case, and characters without a glyph as '?'.
+var glyphs = map[rune][glyphHeight]uint8{
+	'A':  {0x0e, 0x11, 0x11, 0x1f, 0x11, 0x11, 0x11},
+	'B':  {0x1e, 0x11, 0x11, 0x1e, 0x11, 0x11, 0x1e},
+	'C':  {0x0e, 0x11, 0x10, 0x10, 0x10, 0x11, 0x0e},
+	'D':  {0x1e, 0x11, 0x11, 0x11, 0x11, 0x11, 0x1e},
+	'E':  {0x1f, 0x10, 0x10, 0x1e, 0x10, 0x10, 0x1f},
+	'F':  {0x1f, 0x10, 0x10, 0x1e, 0x10, 0x10, 0x10},
+	'G':  {0x0e, 0x11, 0x10, 0x17, 0x11, 0x11, 0x0f},
+	'H':  {0x11, 0x11, 0x11, 0x1f, 0x11, 0x11, 0x11},
+	'I':  {0x0e, 0x04, 0x04, 0x04, 0x04, 0x04, 0x0e},
+	'J':  {0x07, 0x02, 0x02, 0x02, 0x02, 0x12, 0x0c},
+	'K':  {0x11, 0x12, 0x14, 0x18, 0x14, 0x12, 0x11},
+	'L':  {0x10, 0x10, 0x10, 0x10, 0x10, 0x10, 0x1f},
+	'M':  {0x11, 0x1b, 0x15, 0x15, 0x11, 0x11, 0x11},
+	'N':  {0x11, 0x11, 0x19, 0x15, 0x13, 0x11, 0x11},
+	'O':  {0x0e, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0e},
+	'P':  {0x1e, 0x11, 0x11, 0x1e, 0x10, 0x10, 0x10},
+	'Q':  {0x0e, 0x11, 0x11, 0x11, 0x15, 0x12, 0x0d},
+	'R':  {0x1e, 0x11, 0x11, 0x1e, 0x14, 0x12, 0x11},
+	'S':  {0x0f, 0x10, 0x10, 0x0e, 0x01, 0x01, 0x1e},
+	'T':  {0x1f, 0x04, 0x04, 0x04, 0x04, 0x04, 0x04},
+	'U':  {0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0e},
+	'V':  {0x11, 0x11, 0x11, 0x11, 0x11, 0x0a, 0x04},
+	'W':  {0x11, 0x11, 0x11, 0x15, 0x15, 0x15, 0x0a},
+	'X':  {0x11, 0x11, 0x0a, 0x04, 0x0a, 0x11, 0x11},
+	'Y':  {0x11, 0x11, 0x11, 0x0a, 0x04, 0x04, 0x04},
+	'Z':  {0x1f, 0x01, 0x02, 0x04, 0x08, 0x10, 0x1f},
+	'0':  {0x0e, 0x11, 0x13, 0x15, 0x19, 0x11, 0x0e},
+	'1':  {0x04, 0x0c, 0x04, 0x04, 0x04, 0x04, 0x0e},
+	'2':  {0x0e, 0x11, 0x01, 0x02, 0x04, 0x08, 0x1f},
+	'3':  {0x1f, 0x02, 0x04, 0x02, 0x01, 0x11, 0x0e},
+	'4':  {0x02, 0x06, 0x0a, 0x12, 0x1f, 0x02, 0x02},
+	'5':  {0x1f, 0x10, 0x1e, 0x01, 0x01, 0x11, 0x0e},
+	'6':  {0x06, 0x08, 0x10, 0x1e, 0x11, 0x11, 0x0e},
+	'7':  {0x1f, 0x01, 0x02, 0x04, 0x08, 0x08, 0x08},
+	'8':  {0x0e, 0x11, 0x11, 0x0e, 0x11, 0x11, 0x0e},
+	'9':  {0x0e, 0x11, 0x11, 0x0f, 0x01, 0x02, 0x0c},
+	' ':  {},
+	'-':  {0x00, 0x00, 0x00, 0x1f, 0x00, 0x00, 0x00},
+	'_':  {0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x1f},
+	'.':  {0x00, 0x00, 0x00, 0x00, 0x00, 0x0c, 0x0c},
+	',':  {0x00, 0x00, 0x00, 0x00, 0x0c, 0x04, 0x08},
+	':':  {0x00, 0x0c, 0x0c, 0x00, 0x0c, 0x0c, 0x00},
+	'(':  {0x02, 0x04, 0x08, 0x08, 0x08, 0x04, 0x02},
+	')':  {0x08, 0x04, 0x02, 0x02, 0x02, 0x04, 0x08},
+	'&':  {0x0c, 0x12, 0x14, 0x08, 0x15, 0x12, 0x0d},
+	'\'': {0x0c, 0x04, 0x08, 0x00, 0x00, 0x00, 0x00},
+	'+':  {0x00, 0x04, 0x04, 0x1f, 0x04, 0x04, 0x00},
+	'/':  {0x00, 0x01, 0x02, 0x04, 0x08, 0x10, 0x00},
+	'>':  {0x08, 0x04, 0x02, 0x01, 0x02, 0x04, 0x08},
+	'#':  {0x0a, 0x0a, 0x1f, 0x0a, 0x1f, 0x0a, 0x0a},
+	'%':  {0x18, 0x19, 0x02, 0x04, 0x08, 0x13, 0x03},
+	'!':  {0x04, 0x04, 0x04, 0x04, 0x04, 0x00, 0x04},
+	'?':  {0x0e, 0x11, 0x01, 0x02, 0x04, 0x00, 0x04},
+}
+
+// textWidth returns the width in pixels of s drawn at scale.
+func textWidth(s string, scale int) int {
+	n := len([]rune(s))
+	if n == 0 {
+		return 0
+	}
+	return (n*(glyphWidth+1) - 1) * scale
+}
+
+// fitText shortens s with a trailing "..." until it is at most width pixels
+// wide at scale.
+func fitText(s string, scale, width int) string {
+	runes := []rune(s)
+	if textWidth(s, scale) <= width {
+		return s
+	}
+	for len(runes) > 0 && textWidth(string(runes)+"...", scale) > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "..."
+}
+
+// drawText draws s with its top left corner at (x, y), each font pixel scaled
+// to a scale by scale square.
+func drawText(img *image.RGBA, x, y, scale int, s string, c color.Color) {
+	for _, ch := range s {
+		g, ok := glyphs[unicode.ToUpper(ch)]
+		if !ok {
+			g = glyphs['?']
+		}
+		for row, bits := range g {
+			for col := 0; col < glyphWidth; col++ {
+				if bits&(1<<uint(glyphWidth-1-col)) == 0 {
+					continue
+				}
+				fill(img, image.Rect(x+col*scale, y+row*scale,
+					x+(col+1)*scale, y+(row+1)*scale), c)
+			}
+		}
+		x += (glyphWidth + 1) * scale
+	}
+}
+
+// fill paints the rectangle r of img in c.
+func fill(img *image.RGBA, r image.Rectangle, c color.Color) {
+	r = r.Intersect(img.Bounds())
+	for x := r.Min.X; x < r.Max.X; x++ {
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			img.Set(x, y, c)
+		}
+	}
+}
+
+// ratingsAround returns the singles ratings in m's game just before and just
+// after m was applied. Both are nil for doubles results.
+func (h *gobeatHistory) ratingsAround(m *matchResult) (before, after ratings) {
+	h.replayInto(ratingSystemFor(m.Game), m.Game, false,
+		func(cur *matchResult, rs ratingSystem) {
+			if cur == m {
+				before = rs.ratings()
+			}
+		},
+		func(cur *matchResult, rs ratingSystem) {
+			if cur == m {
+				after = rs.ratings()
+			}
+		})
+	return before, after
+}
+
+// scorecard is what a scorecard image shows about a result, with the winners
+// first.
+type scorecard struct {
+	Game    string
+	Date    string
+	Winners string
+	Losers  string
+	Score   string
+
+	// Ratings describes each player's rating change, e.g. "ALEX 1500 > 1516
+	// (+16)". It is empty for doubles.
+	Ratings []string
+}
+
+// newScorecard returns the scorecard for r, one of the results in h.
+func (h *gobeatHistory) newScorecard(r *matchResult) *scorecard {
+	game := r.Game
+	if game == "" {
+		game = settings.Game
+	}
+	winners, losers, score := r.winners()
+	s := &scorecard{
+		Game:    game,
+		Date:    r.Date.Format("Jan 2 2006"),
+		Winners: strings.Join(winners, " & "),
+		Losers:  strings.Join(losers, " & "),
+		Score:   score,
+	}
+
+	before, after := h.ratingsAround(r)
+	if after != nil {
+		names := []string{r.Player, r.Opponent}
+		if !r.Won {
+			names[0], names[1] = names[1], names[0]
+		}
+		for _, name := range names {
+			s.Ratings = append(s.Ratings, fmt.Sprintf("%s %.0f > %.0f (%+.0f)", name,
+				before.get(name), after.get(name), after.get(name)-before.get(name)))
+		}
+	}
+	return s
+}
+
+// render draws the scorecard in theme t.
+func (s *scorecard) render(t *cardTheme) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, cardWidth, cardHeight))
+	fill(img, img.Bounds(), t.Background)
+	width := cardWidth - 2*cardMargin
+
+	drawText(img, cardMargin, cardMargin, 3, fitText(s.Game+" - "+s.Date, 3, width), t.Muted)
+	drawText(img, cardMargin, 100, 6, fitText(s.Winners, 6, width), t.Accent)
+	drawText(img, cardMargin, 160, 3, "beat", t.Muted)
+	drawText(img, cardMargin, 200, 6, fitText(s.Losers, 6, width), t.Text)
+	if s.Score != "" {
+		score := fitText(s.Score, 8, width)
+		drawText(img, cardWidth-cardMargin-textWidth(score, 8), 270, 8, score, t.Accent)
+	}
+	for i, line := range s.Ratings {
+		drawText(img, cardMargin, 280+i*24, 2, fitText(line, 2, width/2), t.Muted)
+	}
+	fill(img, image.Rect(0, cardHeight-8, cardWidth, cardHeight), t.Accent)
+	return img
+}
+
+// writeScorecard writes the scorecard for r, drawn in theme t, to path as a
+// PNG.
+func (h *gobeatHistory) writeScorecard(path string, r *matchResult, t *cardTheme) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, h.newScorecard(r).render(t)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// cardCommand returns the 'gobeat card' command.
+func cardCommand() cli.Command {
+	return cli.Command{
+		Name: "card",
+		Description: "`card` renders a shareable scorecard image of a result, with the " +
+			"players, score, game and rating changes. Themes: " +
+			strings.Join(themeNames(), ", ") + ".",
+		Usage: "card [--theme name] [--out file] <result-id>",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "theme",
+				Usage: "theme to draw the card in, saved for next time",
+			},
+			cli.StringFlag{
+				Name:  "out",
+				Usage: "file to write the PNG to (default card-<result-id>.png)",
+			},
+		},
+		Action: func(c *cli.Context) {
+			if len(c.Args()) == 0 {
+				printError(fmt.Errorf("missing result id; see 'gobeat history'."))
+			}
+			id := c.Args().First()
+
+			if theme := c.String("theme"); theme != "" {
+				if cardThemes[theme] == nil {
+					printError(fmt.Errorf("unknown theme %q; use one of %s.", theme,
+						strings.Join(themeNames(), ", ")))
+				}
+				settings.CardTheme = theme
+				if err := settings.save(); err != nil {
+					printError(err)
+				}
+			}
+
+			h, err := retrieveHistory()
+			if err != nil {
+				printError(err)
+			}
+			r := h.find(id)
+			if r == nil {
+				printError(fmt.Errorf("no result with ID %s.", id))
+			}
+			out := c.String("out")
+			if out == "" {
+				out = "card-" + id + ".png"
+			}
+			if err := h.writeScorecard(out, r, settings.cardTheme()); err != nil {
+				printError(err)
+			}
+			fmt.Printf("Wrote scorecard to %s\n", out)
+		},
+	}
+}
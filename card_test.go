@@ -0,0 +1,56 @@
+package main
+
+import (
+	"image/color"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFitText(t *testing.T) {
+	if s := fitText("alex", 2, 100); s != "alex" {
+		t.Fatalf("Expected short text to be left alone, got %q", s)
+	}
+	s := fitText("alexander the great", 2, 100)
+	if !strings.HasSuffix(s, "...") || textWidth(s, 2) > 100 {
+		t.Fatalf("Expected long text to be shortened to fit, got %q", s)
+	}
+}
+
+func TestNewScorecard(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	h := mockHistoryFile(t)
+	r := &matchResult{Player: "alex", Opponent: "oleg", Game: "ping pong", Won: false,
+		Score: "15-21", Date: time.Now()}
+	h.add(r)
+
+	s := h.newScorecard(r)
+	if s.Winners != "oleg" || s.Losers != "alex" || s.Score != "21-15" {
+		t.Fatalf("Expected the winner first, got %+v", s)
+	}
+	if len(s.Ratings) != 2 || !strings.HasPrefix(s.Ratings[0], "oleg 1500 > ") {
+		t.Fatalf("Expected rating changes, got %v", s.Ratings)
+	}
+}
+
+func TestScorecardRender(t *testing.T) {
+	theme := cardThemes["dark"]
+	img := (&scorecard{Game: "ping pong", Winners: "oleg", Losers: "alex", Score: "21-15"}).render(theme)
+	if img.At(0, 0) != color.Color(theme.Background) {
+		t.Fatal("Expected the card to be drawn in the theme's background.")
+	}
+	if img.At(0, cardHeight-1) != color.Color(theme.Accent) {
+		t.Fatal("Expected an accent bar along the bottom.")
+	}
+}
+
+func TestCardTheme(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	if settings.cardTheme() != cardThemes[defaultCardTheme] {
+		t.Fatal("Expected the default theme.")
+	}
+	settings.CardTheme = "table"
+	if settings.cardTheme() != cardThemes["table"] {
+		t.Fatal("Expected the chosen theme.")
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"strings"
+)
+
+const (
+	// chartWidth and chartHeight are the size of terminal charts, in
+	// characters, excluding the axis labels.
+	chartWidth  = 60
+	chartHeight = 12
+
+	// pngWidth and pngHeight are the size of PNG charts, in pixels.
+	pngWidth  = 640
+	pngHeight = 320
+
+	// pngMargin is the blank border around the plot in PNG charts.
+	pngMargin = 20
+)
+
+// resample reduces points to at most n evenly spaced points, always keeping the
+// last one.
+func resample(points []ratingPoint, n int) []ratingPoint {
+	if len(points) <= n {
+		return points
+	}
+	out := make([]ratingPoint, n)
+	for i := range out {
+		out[i] = points[i*(len(points)-1)/(n-1)]
+	}
+	return out
+}
+
+// ratingRange returns the lowest and highest rating in points, padded so a
+// flat line still has some height.
+func ratingRange(points []ratingPoint) (lo, hi float64) {
+	lo, hi = math.Inf(1), math.Inf(-1)
+	for _, p := range points {
+		lo = math.Min(lo, p.Rating)
+		hi = math.Max(hi, p.Rating)
+	}
+	if hi-lo < 1 {
+		lo, hi = lo-1, hi+1
+	}
+	return lo, hi
+}
+
+// renderASCIIChart draws points as a line chart in a width by height grid of
+// characters, with the rating scale on the left and dates along the bottom.
+func renderASCIIChart(points []ratingPoint, width, height int) string {
+	points = resample(points, width)
+	lo, hi := ratingRange(points)
+
+	grid := make([][]byte, height)
+	for i := range grid {
+		grid[i] = bytes.Repeat([]byte{' '}, len(points))
+	}
+	row := func(rating float64) int {
+		return int(math.Round((hi - rating) / (hi - lo) * float64(height-1)))
+	}
+	for x, p := range points {
+		y := row(p.Rating)
+		grid[y][x] = '*'
+		if x == 0 {
+			continue
+		}
+		// Join to the previous point so steep changes read as a line.
+		prev := row(points[x-1].Rating)
+		for between := prev + 1; between < y; between++ {
+			grid[between][x] = '|'
+		}
+		for between := y + 1; between < prev; between++ {
+			grid[between][x] = '|'
+		}
+	}
+
+	var buf bytes.Buffer
+	for y, line := range grid {
+		label := hi - (hi-lo)*float64(y)/float64(height-1)
+		fmt.Fprintf(&buf, "%6.0f |%s\n", label, line)
+	}
+	fmt.Fprintf(&buf, "       +%s\n", strings.Repeat("-", len(points)))
+
+	first := points[0].Date.Format("2006-01-02")
+	last := points[len(points)-1].Date.Format("2006-01-02")
+	gap := len(points) - len(first) - len(last)
+	if gap < 1 {
+		gap = 1
+	}
+	fmt.Fprintf(&buf, "        %s%s%s\n", first, strings.Repeat(" ", gap), last)
+	return buf.String()
+}
+
+// renderPNGChart draws points as a line chart image.
+func renderPNGChart(points []ratingPoint) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, pngWidth, pngHeight))
+	white := color.RGBA{0xff, 0xff, 0xff, 0xff}
+	grey := color.RGBA{0xcc, 0xcc, 0xcc, 0xff}
+	blue := color.RGBA{0x1d, 0xa1, 0xf2, 0xff}
+
+	for x := 0; x < pngWidth; x++ {
+		for y := 0; y < pngHeight; y++ {
+			img.Set(x, y, white)
+		}
+	}
+	drawLine(img, pngMargin, pngMargin, pngMargin, pngHeight-pngMargin, grey)
+	drawLine(img, pngMargin, pngHeight-pngMargin, pngWidth-pngMargin,
+		pngHeight-pngMargin, grey)
+
+	points = resample(points, pngWidth-2*pngMargin)
+	lo, hi := ratingRange(points)
+	pos := func(i int) (int, int) {
+		x := pngMargin
+		if len(points) > 1 {
+			x += i * (pngWidth - 2*pngMargin) / (len(points) - 1)
+		}
+		y := pngMargin + int((hi-points[i].Rating)/(hi-lo)*
+			float64(pngHeight-2*pngMargin))
+		return x, y
+	}
+	for i := 1; i < len(points); i++ {
+		x0, y0 := pos(i - 1)
+		x1, y1 := pos(i)
+		drawLine(img, x0, y0, x1, y1, blue)
+	}
+	if len(points) == 1 {
+		x, y := pos(0)
+		img.Set(x, y, blue)
+	}
+	return img
+}
+
+// drawLine draws a line from (x0, y0) to (x1, y1) using Bresenham's
+// algorithm.
+func drawLine(img *image.RGBA, x0, y0, x1, y1 int, c color.Color) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	e := dx + dy
+	for {
+		img.Set(x0, y0, c)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		if 2*e >= dy {
+			e += dy
+			x0 += sx
+		}
+		if 2*e <= dx {
+			e += dx
+			y0 += sy
+		}
+	}
+}
+
+// abs returns the absolute value of n.
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// writePNGChart writes the PNG chart of points to path.
+func writePNGChart(path string, points []ratingPoint) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return png.Encode(f, renderPNGChart(points))
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"image/color"
+	"strings"
+	"testing"
+	"time"
+)
+
+func mockRatingPoints(ratings ...float64) []ratingPoint {
+	start := time.Date(2014, 4, 24, 12, 0, 0, 0, time.UTC)
+	points := make([]ratingPoint, len(ratings))
+	for i, r := range ratings {
+		points[i] = ratingPoint{start.AddDate(0, 0, i), r}
+	}
+	return points
+}
+
+func TestRenderASCIIChart(t *testing.T) {
+	chart := renderASCIIChart(mockRatingPoints(1500, 1516, 1490, 1530), 10, 5)
+	lines := strings.Split(strings.TrimRight(chart, "\n"), "\n")
+	if len(lines) != 7 {
+		t.Fatalf("Expected 5 rows plus axis and dates, got:\n%s", chart)
+	}
+	if !strings.HasPrefix(lines[0], "  1530 |") || !strings.HasSuffix(lines[0], "*") {
+		t.Fatalf("Expected the top row to hold the highest rating, got %q", lines[0])
+	}
+	if !strings.Contains(lines[6], "2014-04-24") || !strings.Contains(lines[6], "2014-04-27") {
+		t.Fatalf("Expected the date range below the chart, got %q", lines[6])
+	}
+}
+
+func TestResample(t *testing.T) {
+	points := resample(mockRatingPoints(1, 2, 3, 4, 5, 6, 7), 3)
+	if len(points) != 3 || points[0].Rating != 1 || points[2].Rating != 7 {
+		t.Fatalf("Expected the first and last points to be kept, got %v", points)
+	}
+}
+
+func TestRenderPNGChart(t *testing.T) {
+	img := renderPNGChart(mockRatingPoints(1500, 1600))
+	if img.At(pngMargin, pngHeight-pngMargin) == (color.RGBA{0xff, 0xff, 0xff, 0xff}) {
+		t.Fatal("Expected the chart to start at the bottom left of the plot.")
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// clipboardCommands are the commands that can put text on the clipboard,
+// tried in order, by operating system.
+var clipboardCommands = map[string][][]string{
+	"darwin":  {{"pbcopy"}},
+	"windows": {{"clip"}},
+	"linux": {
+		{"wl-copy"},
+		{"xclip", "-selection", "clipboard"},
+		{"xsel", "--clipboard", "--input"},
+	},
+}
+
+// copyToClipboard puts text on the system clipboard using the first available
+// clipboard command.
+func copyToClipboard(text string) error {
+	cmds := clipboardCommands[runtime.GOOS]
+	if runtime.GOOS != "darwin" && runtime.GOOS != "windows" {
+		cmds = clipboardCommands["linux"]
+	}
+	for _, args := range cmds {
+		path, err := exec.LookPath(args[0])
+		if err != nil {
+			continue
+		}
+		cmd := exec.Command(path, args[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("could not copy to the clipboard with %s: %s %s", args[0], err,
+				strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+	return fmt.Errorf("no clipboard command found; install %s.", clipboardNames(cmds))
+}
+
+// clipboardNames lists the programs in cmds, e.g. "wl-copy, xclip or xsel".
+func clipboardNames(cmds [][]string) string {
+	var names []string
+	for _, args := range cmds {
+		names = append(names, args[0])
+	}
+	if len(names) < 2 {
+		return strings.Join(names, "")
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " or " + names[len(names)-1]
+}
+
+// copyAnnouncement copies msg to the clipboard for the --copy flag, warning
+// rather than failing since the result has already been posted.
+func copyAnnouncement(msg string) {
+	if err := copyToClipboard(msg); err != nil {
+		logger.Warn("result posted, but " + err.Error())
+		return
+	}
+	fmt.Println("Copied the announcement to the clipboard")
+}
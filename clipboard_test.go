@@ -0,0 +1,48 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestClipboardNames(t *testing.T) {
+	if s := clipboardNames(clipboardCommands["linux"]); s != "wl-copy, xclip or xsel" {
+		t.Fatalf("Expected the commands to be listed, got %q", s)
+	}
+	if s := clipboardNames(clipboardCommands["darwin"]); s != "pbcopy" {
+		t.Fatalf("Expected a single command, got %q", s)
+	}
+}
+
+func TestCopyToClipboard(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("fake clipboard command is a shell script")
+	}
+	dir, err := ioutil.TempDir("", "gobeatclipboard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	copied := filepath.Join(dir, "copied")
+	script := "#!/bin/sh\ncat > " + copied + "\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "wl-copy"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	if err := copyToClipboard("alex beat oleg"); err != nil {
+		t.Fatalf("Expected the text to be copied, got %s", err)
+	}
+	if b, _ := ioutil.ReadFile(copied); string(b) != "alex beat oleg" {
+		t.Fatalf("Expected the text on the clipboard, got %q", b)
+	}
+
+	os.Setenv("PATH", filepath.Join(dir, "missing"))
+	if err := copyToClipboard("alex beat oleg"); err == nil {
+		t.Fatal("Expected an error without a clipboard command.")
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import "os"
+
+// ANSI escape codes used to color output.
+const (
+	ansiReset = "\x1b[0m"
+	ansiBold  = "\x1b[1m"
+	ansiRed   = "\x1b[31m"
+	ansiGreen = "\x1b[32m"
+)
+
+// colorEnabled reports whether output should be colored: only when stdout is
+// a terminal and NO_COLOR (https://no-color.org) is not set.
+func colorEnabled() bool {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+	return isTerminal(os.Stdout)
+}
+
+// isTerminal reports whether f is a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// colorize wraps s in code if output is colored.
+func colorize(code, s string) string {
+	if !colorEnabled() {
+		return s
+	}
+	return code + s + ansiReset
+}
+
+// bold formats s as a header.
+func bold(s string) string { return colorize(ansiBold, s) }
+
+// outcome colors s green for a win or red for a loss.
+func outcome(won bool, s string) string {
+	if won {
+		return colorize(ansiGreen, s)
+	}
+	return colorize(ansiRed, s)
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestColorize(t *testing.T) {
+	// Test output is not a terminal, so nothing is colored.
+	if s := outcome(true, "W"); s != "W" {
+		t.Fatalf("Expected no color off a terminal, got %q", s)
+	}
+
+	defer os.Unsetenv("NO_COLOR")
+	os.Setenv("NO_COLOR", "")
+	if colorEnabled() {
+		t.Fatal("Expected NO_COLOR to disable color even when empty.")
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+const credentialsFile = ".gobeat_credentials"
+
+// credentialsPath is the full path to the credential store. Unlike the
+// settings, it is only readable by its owner.
+var credentialsPath = filepath.Join(os.Getenv("HOME"), credentialsFile)
+
+// credentialTarget names the target's basic auth password in the store.
+const credentialTarget = "target"
+
+// retrieveCredentials loads the credential store, keyed by name.
+func retrieveCredentials() (map[string]string, error) {
+	b, err := ioutil.ReadFile(credentialsPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]string{}, nil
+		}
+		return nil, err
+	}
+	creds := map[string]string{}
+	if err := json.Unmarshal(b, &creds); err != nil {
+		return nil, err
+	}
+	return creds, nil
+}
+
+// credential returns the secret stored as name, or "" if there is none.
+func credential(name string) (string, error) {
+	creds, err := retrieveCredentials()
+	if err != nil {
+		return "", err
+	}
+	return creds[name], nil
+}
+
+// storeCredential stores secret as name, removing it if secret is empty.
+func storeCredential(name, secret string) error {
+	creds, err := retrieveCredentials()
+	if err != nil {
+		return err
+	}
+	if secret == "" {
+		delete(creds, name)
+	} else {
+		creds[name] = secret
+	}
+	b, err := json.Marshal(creds)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(credentialsPath, b, 0600)
+}
+
+// migrateSecrets moves to the credential store the secrets older versions
+// saved with the settings in b, then saves the settings without them.
+func (g *gobeatSettings) migrateSecrets(b []byte) error {
+	var old struct {
+		PseudonymKey string `json:"pseudonym_key"`
+	}
+	if err := json.Unmarshal(b, &old); err != nil || old.PseudonymKey == "" {
+		return err
+	}
+	// Keep a key already in the store, so pseudonyms don't change.
+	key, err := credential(credentialPseudonym)
+	if err != nil {
+		return err
+	}
+	if key == "" {
+		if err := storeCredential(credentialPseudonym, old.PseudonymKey); err != nil {
+			return err
+		}
+	}
+	return g.save()
+}
+
+// loadSecrets fills in the secrets in the settings that are kept in the
+// credential store rather than saved with them.
+func (g *gobeatSettings) loadSecrets() error {
+	if g.Discord != nil {
+		token, err := credential(credentialDiscord)
+		if err != nil {
+			return err
+		}
+		g.Discord.Token = token
+	}
+	if g.IRC != nil {
+		pass, err := credential(credentialIRC)
+		if err != nil {
+			return err
+		}
+		g.IRC.SASLPassword = pass
+	}
+	if g.Telegram != nil {
+		token, err := credential(credentialTelegram)
+		if err != nil {
+			return err
+		}
+		g.Telegram.Token = token
+	}
+	if g.Matrix != nil {
+		token, err := credential(credentialMatrix)
+		if err != nil {
+			return err
+		}
+		g.Matrix.AccessToken = token
+	}
+	if g.OpponentNames == opponentNamesPseudonyms {
+		key, err := credential(credentialPseudonym)
+		if err != nil {
+			return err
+		}
+		g.PseudonymKey = key
+	}
+	return nil
+}
+
+// setBasicAuth configures basic auth for the target from "user:password",
+// keeping the password in the credential store. An empty userinfo removes
+// basic auth.
+func (g *gobeatSettings) setBasicAuth(userinfo string) error {
+	if userinfo == "" {
+		g.BasicAuthUser = ""
+		return storeCredential(credentialTarget, "")
+	}
+	parts := strings.SplitN(userinfo, ":", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return fmt.Errorf("basic auth must be user:password.")
+	}
+	g.BasicAuthUser = parts[0]
+	return storeCredential(credentialTarget, parts[1])
+}
+
+// setTarget sets the target to target. Credentials in the URL are moved to
+// the credential store, so that they are never saved with the settings.
+func (g *gobeatSettings) setTarget(target string) (*url.URL, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	if u.User != nil {
+		pass, _ := u.User.Password()
+		if err := g.setBasicAuth(u.User.Username() + ":" + pass); err != nil {
+			return nil, err
+		}
+		u.User = nil
+	}
+	g.TargetURL = u.String()
+	return u, nil
+}
+
+// userAgent identifies gobeat's version and platform to servers.
+var userAgent = fmt.Sprintf("gobeat/%s (%s/%s)", version, runtime.GOOS, runtime.GOARCH)
+
+// targetHeader returns the headers every request to the target carries: who
+// is making it, the configured headers and basic auth, or else the API token
+// set with 'gobeat token use'.
+func targetHeader() (http.Header, error) {
+	h := http.Header{}
+	h.Set("User-Agent", userAgent)
+	if settings.ClientID != "" {
+		h.Set("X-Gobeat-Client", settings.ClientID)
+	}
+	for name, value := range settings.Headers {
+		h.Set(name, value)
+	}
+	if settings.BasicAuthUser == "" {
+		token, err := credential(credentialToken)
+		if err != nil {
+			return nil, err
+		}
+		if token != "" {
+			h.Set("Authorization", "Bearer "+token)
+		}
+		return h, nil
+	}
+	pass, err := credential(credentialTarget)
+	if err != nil {
+		return nil, err
+	}
+	req := &http.Request{Header: h}
+	req.SetBasicAuth(settings.BasicAuthUser, pass)
+	return h, nil
+}
+
+// authorizeTarget adds the headers every request to the target carries to
+// req.
+func authorizeTarget(req *http.Request) error {
+	h, err := targetHeader()
+	if err != nil {
+		return err
+	}
+	for k, v := range h {
+		req.Header[k] = v
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/codegangsta/cli"
+)
+
+// deepLinkScheme is the URI scheme of links that prefill a result, like
+// gobeat://result?opponent=oleg&score=21-15.
+const deepLinkScheme = "gobeat"
+
+// deepLinkDesktopFile is the desktop entry registering gobeat as the handler
+// of deep links on Linux, relative to the user's applications directory.
+const deepLinkDesktopFile = "gobeat-open.desktop"
+
+// parseDeepLink returns the result and hashtags a deep link describes. Its
+// query takes the same names as the result command's flags, along with the
+// opponent and score:
+//
+//	gobeat://result?opponent=oleg&score=21-15&lost=true&note=rematch
+func parseDeepLink(uri string) (*matchResult, []string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid link: %s", err)
+	}
+	if u.Scheme != deepLinkScheme {
+		return nil, nil, fmt.Errorf("not a %s:// link.", deepLinkScheme)
+	}
+	if u.Host != "result" {
+		return nil, nil, fmt.Errorf("unknown link %q; only %s://result links are supported.",
+			u.Host, deepLinkScheme)
+	}
+
+	q := u.Query()
+	if q.Get("opponent") == "" {
+		return nil, nil, fmt.Errorf("link is missing the opponent.")
+	}
+	r, err := newMatchResult(q.Get("opponent"), q.Get("score"), q.Get("lost") != "true")
+	if err != nil {
+		return nil, nil, err
+	}
+	r.Partner = q.Get("partner")
+	r.OpponentPartner = q.Get("opponent-partner")
+	r.Note = q.Get("note")
+	if q.Get("duration") != "" {
+		d, err := time.ParseDuration(q.Get("duration"))
+		if err != nil || d <= 0 {
+			return nil, nil, fmt.Errorf("invalid duration %q.", q.Get("duration"))
+		}
+		r.setDuration(d)
+	}
+	return r, resultHashtags(q.Get("tags")), nil
+}
+
+// describeLinkedResult describes r for confirmation, e.g. "a win against
+// oleg, 21-15".
+func describeLinkedResult(r *matchResult) string {
+	outcome := "a win against"
+	if !r.Won {
+		outcome = "a loss to"
+	}
+	s := fmt.Sprintf("%s %s", outcome, strings.Join(r.opponentTeam(), " & "))
+	if r.doubles() {
+		s += " with " + r.Partner
+	}
+	if r.Score != "" {
+		s += ", " + r.Score
+	}
+	return s
+}
+
+// confirm asks question on out and reads the answer from in. Anything but yes
+// counts as no.
+func confirm(in io.Reader, out io.Writer, question string) (bool, error) {
+	fmt.Fprintf(out, "%s [y/N] ", question)
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+// registerDeepLinks makes gobeat the handler of deep links on Linux, by
+// installing a desktop entry that runs 'gobeat open' in a terminal.
+func registerDeepLinks() error {
+	if runtime.GOOS != "linux" {
+		return fmt.Errorf("registering %s:// links is only supported on Linux; "+
+			"point your system's URL handler at 'gobeat open'.", deepLinkScheme)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(os.Getenv("HOME"), ".local", "share", "applications")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	entry := fmt.Sprintf("[Desktop Entry]\nType=Application\nName=gobeat\n"+
+		"Exec=%s open %%u\nTerminal=true\nNoDisplay=true\n"+
+		"MimeType=x-scheme-handler/%s;\n", exe, deepLinkScheme)
+	if err := ioutil.WriteFile(filepath.Join(dir, deepLinkDesktopFile), []byte(entry), 0644); err != nil {
+		return err
+	}
+	out, err := exec.Command("xdg-mime", "default", deepLinkDesktopFile,
+		"x-scheme-handler/"+deepLinkScheme).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("could not register with xdg-mime: %s %s", err,
+			strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// openCommand returns the 'gobeat open' command.
+func openCommand() cli.Command {
+	return cli.Command{
+		Name: "open",
+		Description: "`open` handles a gobeat:// link, such as one shared in chat, " +
+			"showing the result it describes and posting it once confirmed.",
+		Usage: "open [--yes] <gobeat://result?opponent=oleg&score=21-15> | open --register",
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "yes",
+				Usage: "post without asking for confirmation",
+			},
+			cli.BoolFlag{
+				Name:  "register",
+				Usage: "make gobeat the handler of gobeat:// links (Linux only)",
+			},
+			cli.BoolFlag{
+				Name:  "copy",
+				Usage: "copy the announcement to the clipboard once posted",
+			},
+		},
+		Action: func(c *cli.Context) {
+			if c.Bool("register") {
+				if err := registerDeepLinks(); err != nil {
+					printError(err)
+				}
+				fmt.Printf("Registered gobeat as the handler of %s:// links\n", deepLinkScheme)
+				return
+			}
+			if len(c.Args()) == 0 {
+				printError(fmt.Errorf("missing link."))
+			}
+
+			r, tags, err := parseDeepLink(c.Args().First())
+			if err != nil {
+				printError(err)
+			}
+			if err := r.applyHandicap(); err != nil {
+				printError(err)
+			}
+			if !c.Bool("yes") {
+				ok, err := confirm(os.Stdin, os.Stdout,
+					fmt.Sprintf("Post %s?", describeLinkedResult(r)))
+				if err != nil {
+					printError(err)
+				}
+				if !ok {
+					fmt.Println("Not posted")
+					return
+				}
+			}
+			rec := postRecordedResult(r, tags)
+			if c.Bool("copy") {
+				copyAnnouncement(rec.Message)
+			}
+		},
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestParseDeepLink(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	r, tags, err := parseDeepLink("gobeat://result?opponent=oleg&score=15-21&lost=true&note=rematch&tags=league")
+	if err != nil {
+		t.Fatalf("Expected the link to parse, got %s", err)
+	}
+	if r.Opponent != "oleg" || r.Score != "15-21" || r.Won || r.Note != "rematch" {
+		t.Fatalf("Expected a loss to oleg, got %+v", r)
+	}
+	if len(tags) != 1 || tags[0] != "#league" {
+		t.Fatalf("Expected the link's hashtags, got %v", tags)
+	}
+	if s := describeLinkedResult(r); s != "a loss to oleg, 15-21" {
+		t.Fatalf("Expected the result to be described, got %q", s)
+	}
+
+	for _, uri := range []string{
+		"https://result?opponent=oleg",
+		"gobeat://challenge?opponent=oleg",
+		"gobeat://result?score=21-15",
+	} {
+		if _, _, err := parseDeepLink(uri); err == nil {
+			t.Fatalf("Expected %s to be rejected.", uri)
+		}
+	}
+}
+
+func TestConfirm(t *testing.T) {
+	var out bytes.Buffer
+	if ok, _ := confirm(strings.NewReader("Y\n"), &out, "Post?"); !ok {
+		t.Fatal("Expected yes to confirm.")
+	}
+	if out.String() != "Post? [y/N] " {
+		t.Fatalf("Expected the question to be asked, got %q", out.String())
+	}
+	if ok, _ := confirm(strings.NewReader(""), &out, "Post?"); ok {
+		t.Fatal("Expected no answer not to confirm.")
+	}
+}
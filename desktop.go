@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// windowsNotifyScript shows a balloon notification from the system tray on
+// Windows, which has no notification command of its own. The title and body
+// are passed as arguments.
+const windowsNotifyScript = `Add-Type -AssemblyName System.Windows.Forms
+$n = New-Object System.Windows.Forms.NotifyIcon
+$n.Icon = [System.Drawing.SystemIcons]::Information
+$n.Visible = $true
+$n.ShowBalloonTip(10000, $args[0], $args[1], 'Info')
+Start-Sleep -Seconds 10
+$n.Dispose()`
+
+// desktopNotifyCommand returns the command showing a desktop notification on
+// the current platform.
+func desktopNotifyCommand(title, body string) *exec.Cmd {
+	switch runtime.GOOS {
+	case "darwin":
+		script := fmt.Sprintf("display notification %s with title %s",
+			strconv.Quote(body), strconv.Quote(title))
+		return exec.Command("osascript", "-e", script)
+	case "windows":
+		return exec.Command("powershell", "-NoProfile", "-Command",
+			"& {"+windowsNotifyScript+"}", title, body)
+	default:
+		return exec.Command("notify-send", "--app-name=gobeat", title, body)
+	}
+}
+
+// desktopNotify shows a native desktop notification.
+func desktopNotify(title, body string) error {
+	cmd := desktopNotifyCommand(title, body)
+	if runtime.GOOS == "windows" {
+		// The balloon has to stay up for a while; don't wait for it.
+		return cmd.Start()
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("could not show notification with %s: %s %s", cmd.Args[0], err,
+			strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// resultNotification returns the desktop notification for a result from the
+// feed: the current user hears that their result was confirmed, and of
+// everyone else's as they come in.
+func resultNotification(r *matchResult) (title, body string) {
+	winners, losers, score := r.winners()
+	body = strings.Join(winners, " & ") + " beat " + strings.Join(losers, " & ")
+	if score != "" {
+		body += " " + score
+	}
+	for _, name := range r.players() {
+		if name == settings.User {
+			return "Your " + r.Game + " result was confirmed", body
+		}
+	}
+	return "New " + r.Game + " result", body
+}
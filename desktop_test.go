@@ -0,0 +1,21 @@
+package main
+
+import "testing"
+
+func TestResultNotification(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	r := &matchResult{Player: settings.User, Opponent: "oleg", Game: "ping pong",
+		Score: "15-21"}
+	title, body := resultNotification(r)
+	if title != "Your ping pong result was confirmed" {
+		t.Fatalf("Expected the user's result to be confirmed, got %q", title)
+	}
+	if body != "oleg beat "+settings.User+" 21-15" {
+		t.Fatalf("Expected the winner first, got %q", body)
+	}
+
+	r.Player = "ivan"
+	if title, _ := resultNotification(r); title != "New ping pong result" {
+		t.Fatalf("Expected someone else's result to be new, got %q", title)
+	}
+}
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/codegangsta/cli"
+)
+
+// discordAPIURL is the base of Discord's REST API.
+var discordAPIURL = "https://discord.com/api/v10"
+
+// Discord gateway opcodes.
+const (
+	discordDispatch     = 0
+	discordHeartbeat    = 1
+	discordIdentify     = 2
+	discordResume       = 6
+	discordReconnect    = 7
+	discordInvalid      = 9
+	discordHello        = 10
+	discordHeartbeatAck = 11
+)
+
+// discordIntents are the gateway intents the bot needs: guild messages and
+// their content.
+const discordIntents = 1<<9 | 1<<15
+
+// discordMaxBackoff is the longest the bot waits between attempts to
+// reconnect to the gateway.
+const discordMaxBackoff = 2 * time.Minute
+
+// credentialDiscord names the Discord bot's token in the credential store.
+const credentialDiscord = "discord"
+
+// discordSettings configures the Discord bot.
+type discordSettings struct {
+	// Token is the bot's token. It is kept in the credential store, not with
+	// the settings.
+	Token string `json:"-"`
+
+	// ChannelID is the channel the bot listens and announces in.
+	ChannelID string `json:"channel_id"`
+}
+
+// discordPayload is a message sent over the Discord gateway.
+type discordPayload struct {
+	Op       int             `json:"op"`
+	Data     json.RawMessage `json:"d,omitempty"`
+	Sequence *int            `json:"s,omitempty"`
+	Type     string          `json:"t,omitempty"`
+}
+
+// discordMessage is the part of a MESSAGE_CREATE event the bot uses.
+type discordMessage struct {
+	ChannelID string `json:"channel_id"`
+	Content   string `json:"content"`
+	Author    struct {
+		Username string `json:"username"`
+		Bot      bool   `json:"bot"`
+	} `json:"author"`
+}
+
+// discordBot connects to the Discord gateway and answers commands in a
+// single channel.
+type discordBot struct {
+	cfg  *discordSettings
+	conn *wsConn
+
+	// mu guards seq, which heartbeats read while payloads are received.
+	mu  sync.Mutex
+	seq *int
+
+	// sessionID and resumeURL come from READY, and let the bot resume its
+	// session after a dropped connection rather than miss the messages sent
+	// meanwhile.
+	sessionID string
+	resumeURL string
+}
+
+// discordRequest makes an authenticated request to the Discord REST API.
+func (b *discordBot) discordRequest(method, path string, body interface{}) (*http.Response, error) {
+	var r io.Reader
+	if body != nil {
+		j, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(j)
+	}
+	req, err := http.NewRequest(method, discordAPIURL+path, r)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bot "+b.cfg.Token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("on discord request: got code %d", resp.StatusCode)
+	}
+	return resp, nil
+}
+
+// say posts content to the bot's channel.
+func (b *discordBot) say(content string) error {
+	resp, err := b.discordRequest("POST", "/channels/"+b.cfg.ChannelID+"/messages",
+		map[string]string{"content": content})
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// send writes a payload to the gateway.
+func (b *discordBot) send(op int, data interface{}) error {
+	j, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	msg, err := json.Marshal(discordPayload{Op: op, Data: j})
+	if err != nil {
+		return err
+	}
+	return b.conn.writeMessage(msg)
+}
+
+// receive reads the next payload from the gateway.
+func (b *discordBot) receive() (*discordPayload, error) {
+	msg, err := b.conn.readMessage()
+	if err != nil {
+		return nil, err
+	}
+	p := new(discordPayload)
+	if err := json.Unmarshal(msg, p); err != nil {
+		return nil, err
+	}
+	if p.Sequence != nil {
+		b.mu.Lock()
+		b.seq = p.Sequence
+		b.mu.Unlock()
+	}
+	return p, nil
+}
+
+// heartbeat sends a heartbeat with the last sequence number received. It is
+// safe to call while payloads are being received.
+func (b *discordBot) heartbeat() error {
+	b.mu.Lock()
+	seq := b.seq
+	b.mu.Unlock()
+	return b.send(discordHeartbeat, seq)
+}
+
+// gatewayURL returns the URL to connect to the gateway at: the one READY
+// gave for resuming the session if there is one, or else the one the REST API
+// gives.
+func (b *discordBot) gatewayURL() (*url.URL, error) {
+	raw := b.resumeURL
+	if b.sessionID == "" || raw == "" {
+		resp, err := b.discordRequest("GET", "/gateway/bot", nil)
+		if err != nil {
+			return nil, err
+		}
+		var gateway struct {
+			URL string `json:"url"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&gateway)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		raw = gateway.URL
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	u.RawQuery = "v=10&encoding=json"
+	return u, nil
+}
+
+// connect connects to the gateway and, once it has said hello, resumes the
+// last session if there is one or else identifies. It returns the heartbeat
+// interval.
+func (b *discordBot) connect() (time.Duration, error) {
+	b.conn = nil
+	u, err := b.gatewayURL()
+	if err != nil {
+		return 0, err
+	}
+	if b.conn, err = dialWebsocket(http.DefaultClient, u, nil); err != nil {
+		return 0, err
+	}
+
+	hello, err := b.receive()
+	if err != nil {
+		return 0, err
+	}
+	if hello.Op != discordHello {
+		return 0, fmt.Errorf("expected discord hello, got opcode %d", hello.Op)
+	}
+	var h struct {
+		Interval int `json:"heartbeat_interval"`
+	}
+	if err := json.Unmarshal(hello.Data, &h); err != nil {
+		return 0, err
+	}
+	interval := time.Duration(h.Interval) * time.Millisecond
+
+	if b.sessionID != "" {
+		b.mu.Lock()
+		seq := b.seq
+		b.mu.Unlock()
+		resume := map[string]interface{}{
+			"token":      b.cfg.Token,
+			"session_id": b.sessionID,
+			"seq":        seq,
+		}
+		return interval, b.send(discordResume, resume)
+	}
+	identify := map[string]interface{}{
+		"token":   b.cfg.Token,
+		"intents": discordIntents,
+		"properties": map[string]string{
+			"os":      runtime.GOOS,
+			"browser": "gobeat",
+			"device":  "gobeat",
+		},
+	}
+	return interval, b.send(discordIdentify, identify)
+}
+
+// run answers commands until stop is closed, reconnecting with exponential
+// backoff whenever the connection drops or the gateway asks the bot to. A
+// command being answered when stop is closed is finished first.
+func (b *discordBot) run(stop <-chan struct{}) error {
+	wait := settings.backoff()
+	for {
+		ready, err := b.session(stop)
+		select {
+		case <-stop:
+			return nil
+		default:
+		}
+		if ready {
+			wait = settings.backoff()
+		}
+		logger.Warn("discord connection lost, reconnecting", "err", err, "wait", wait)
+		select {
+		case <-stop:
+			return nil
+		case <-time.After(wait):
+		}
+		if wait *= 2; wait > discordMaxBackoff {
+			wait = discordMaxBackoff
+		}
+	}
+}
+
+// session connects and answers commands until the connection drops, the
+// gateway asks the bot to reconnect or stop is closed. It returns whether the
+// session got going, so that a connection that drops can be told from one
+// that can't be made.
+func (b *discordBot) session(stop <-chan struct{}) (bool, error) {
+	interval, err := b.connect()
+	conn := b.conn
+	if conn != nil {
+		defer conn.Close()
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// Closing the connection interrupts the wait for the next message.
+	stopping, finished := make(chan struct{}), make(chan struct{})
+	defer close(finished)
+	go func() {
+		select {
+		case <-stop:
+			close(stopping)
+			conn.Close()
+		case <-finished:
+		}
+	}()
+
+	// Heartbeats stop before the next session replaces the connection.
+	done, beating := make(chan struct{}), make(chan struct{})
+	defer func() {
+		close(done)
+		<-beating
+	}()
+	go func() {
+		defer close(beating)
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				b.heartbeat()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	ready := false
+	for {
+		p, err := b.receive()
+		select {
+		case <-stopping:
+			return ready, nil
+		default:
+		}
+		if err == io.EOF {
+			return ready, fmt.Errorf("discord gateway closed the connection")
+		}
+		if err != nil {
+			return ready, err
+		}
+
+		switch p.Op {
+		case discordHeartbeat:
+			if err := b.heartbeat(); err != nil {
+				return ready, err
+			}
+		case discordReconnect:
+			return ready, fmt.Errorf("discord gateway asked the bot to reconnect")
+		case discordInvalid:
+			// The session can't be resumed unless the gateway says so, so
+			// the bot identifies again.
+			var resumable bool
+			json.Unmarshal(p.Data, &resumable)
+			if !resumable {
+				b.sessionID = ""
+				b.mu.Lock()
+				b.seq = nil
+				b.mu.Unlock()
+			}
+			return ready, fmt.Errorf("discord gateway invalidated the session")
+		case discordDispatch:
+			switch p.Type {
+			case "READY":
+				var r struct {
+					SessionID string `json:"session_id"`
+					ResumeURL string `json:"resume_gateway_url"`
+				}
+				if err := json.Unmarshal(p.Data, &r); err != nil {
+					return ready, err
+				}
+				b.sessionID, b.resumeURL = r.SessionID, r.ResumeURL
+				ready = true
+			case "RESUMED":
+				ready = true
+			case "MESSAGE_CREATE":
+				m := new(discordMessage)
+				if err := json.Unmarshal(p.Data, m); err != nil {
+					return ready, err
+				}
+				if m.ChannelID != b.cfg.ChannelID || m.Author.Bot {
+					continue
+				}
+				reply, ok := handleBotCommand(botPlayer(m.Author.Username), m.Content, "!")
+				if !ok {
+					continue
+				}
+				if err := b.say(reply); err != nil {
+					logger.Warn("could not answer on discord", "err", err)
+				}
+			}
+		}
+	}
+}
+
+// discordBotCommand returns the 'gobeat bot discord' command.
+func discordBotCommand() cli.Command {
+	return cli.Command{
+		Name: "discord",
+		Description: "`bot discord` connects as a Discord bot that accepts !result and " +
+			"!leaderboard in a channel and posts announcements there.",
+		Usage: "bot discord [--token token] [--channel id] [--grace duration]",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "token",
+				Usage: "bot token, saved for next time",
+			},
+			cli.StringFlag{
+				Name:  "channel",
+				Usage: "channel ID to listen in, saved for next time",
+			},
+			graceFlag(),
+		},
+		Action: func(c *cli.Context) {
+			if settings.Discord == nil {
+				settings.Discord = new(discordSettings)
+			}
+			if c.String("token") != "" || c.String("channel") != "" {
+				if c.String("token") != "" {
+					if err := storeCredential(credentialDiscord, c.String("token")); err != nil {
+						printError(err)
+					}
+					settings.Discord.Token = c.String("token")
+				}
+				if c.String("channel") != "" {
+					settings.Discord.ChannelID = c.String("channel")
+				}
+				if err := settings.save(); err != nil {
+					printError(err)
+				}
+			}
+			if settings.Discord.Token == "" || settings.Discord.ChannelID == "" {
+				printError(fmt.Errorf("missing discord token and channel."))
+			}
+
+			bot := &discordBot{cfg: settings.Discord}
+			logger.Info("Starting Discord bot...", "channel", settings.Discord.ChannelID)
+			if err := runUntilShutdown(shutdownSignals(), graceDuration(c), bot.run); err != nil {
+				printError(err)
+			}
+		},
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiscordBot(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	mockHistoryFile(t)
+
+	said := make(chan string, 1)
+	mux := http.NewServeMux()
+	var ts *httptest.Server
+	mux.HandleFunc("/gateway/bot", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bot secret" {
+			t.Fatal("Expected the bot token to be sent.")
+		}
+		w.Write([]byte(`{"url": "ws://` + ts.Listener.Addr().String() + `/ws"}`))
+	})
+	mux.HandleFunc("/channels/123/messages", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatalf("Expected a JSON message: %s", err)
+		}
+		said <- body["content"]
+	})
+	identified := make(chan struct{})
+	connections := 0
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Fatalf("Could not hijack connection: %s", err)
+		}
+		defer conn.Close()
+		buf.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+			"Upgrade: websocket\r\nConnection: Upgrade\r\n" +
+			"Sec-WebSocket-Accept: " +
+			websocketAccept(r.Header.Get("Sec-WebSocket-Key")) + "\r\n\r\n")
+		// Heartbeats, with the last sequence number, are sent while payloads
+		// are received.
+		mockServerFrame(buf, wsText, `{"op": 10, "d": {"heartbeat_interval": 1}}`)
+
+		ws := &wsConn{r: buf.Reader, rw: conn}
+		msg, err := ws.readMessage()
+		if err != nil {
+			t.Fatalf("Expected identify: %s", err)
+		}
+		connections++
+		switch connections {
+		case 1:
+			if !strings.Contains(string(msg), `"op":2`) {
+				t.Fatalf("Expected identify, got %s", msg)
+			}
+			mockServerFrame(buf, wsText, `{"op": 0, "s": 1, "t": "READY",
+				"d": {"session_id": "abc", "resume_gateway_url": "ws://`+
+				ts.Listener.Addr().String()+`/ws"}}`)
+			mockServerFrame(buf, wsText, `{"op": 0, "s": 2, "t": "MESSAGE_CREATE",
+				"d": {"channel_id": "999", "content": "!leaderboard",
+				"author": {"username": "oleg"}}}`)
+			mockServerFrame(buf, wsText, `{"op": 0, "s": 3, "t": "MESSAGE_CREATE",
+				"d": {"channel_id": "123", "content": "!leaderboard",
+				"author": {"username": "oleg"}}}`)
+			select {
+			case <-said:
+			case <-time.After(5 * time.Second):
+				t.Fatal("Expected the bot to answer in its channel.")
+			}
+			for {
+				msg, err := ws.readMessage()
+				if err != nil {
+					t.Fatalf("Expected a heartbeat: %s", err)
+				}
+				if string(msg) == `{"op":1,"d":3}` {
+					break
+				}
+			}
+			// Asked to reconnect, the bot resumes its session.
+			mockServerFrame(buf, wsText, `{"op": 7}`)
+		case 2:
+			if !strings.Contains(string(msg), `"op":6`) ||
+				!strings.Contains(string(msg), `"session_id":"abc"`) ||
+				!strings.Contains(string(msg), `"seq":3`) {
+				t.Fatalf("Expected the session to be resumed, got %s", msg)
+			}
+			// A session that can't be resumed is started again.
+			mockServerFrame(buf, wsText, `{"op": 9, "d": false}`)
+		default:
+			if !strings.Contains(string(msg), `"op":2`) {
+				t.Fatalf("Expected the bot to identify again, got %s", msg)
+			}
+			close(identified)
+		}
+		ioutil.ReadAll(buf)
+	})
+	ts = httptest.NewServer(mux)
+	defer ts.Close()
+	discordAPIURL = ts.URL
+
+	bot := &discordBot{cfg: &discordSettings{Token: "secret", ChannelID: "123"}}
+	stop, done := make(chan struct{}), make(chan error)
+	go func() { done <- bot.run(stop) }()
+	select {
+	case <-identified:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the bot to reconnect.")
+	}
+	close(stop)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Expected the bot to run cleanly: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the bot to stop.")
+	}
+}
+
+// mockServerFrame writes an unmasked frame, as servers send them.
+func mockServerFrame(buf *bufio.ReadWriter, opcode byte, payload string) {
+	frame := []byte{0x80 | opcode}
+	if len(payload) < 126 {
+		frame = append(frame, byte(len(payload)))
+	} else {
+		frame = append(frame, 126, 0, 0)
+		binary.BigEndian.PutUint16(frame[2:], uint16(len(payload)))
+	}
+	buf.Write(append(frame, payload...))
+	buf.Flush()
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/codegangsta/cli"
+)
+
+// maxClockSkew is how far the local clock may drift from the target's before
+// doctor complains. Results are dated locally, and signatures are timestamped.
+const maxClockSkew = time.Minute
+
+// diagnosis is the outcome of one of doctor's checks.
+type diagnosis struct {
+	// Check is what was checked.
+	Check string
+
+	// Err is why the check failed, or nil if it passed.
+	Err error
+
+	// Fix suggests how to make a failed check pass.
+	Fix string
+}
+
+// checkSettings checks that the settings make sense.
+func checkSettings() diagnosis {
+	d := diagnosis{Check: "settings", Fix: "see 'gobeat help target' and 'gobeat help rating'"}
+	if settings.TargetURL == "" {
+		d.Err, d.Fix = fmt.Errorf("no target set"), "run 'gobeat target <url>'"
+		return d
+	}
+	if _, err := settings.URL(); err != nil {
+		d.Err = err
+		return d
+	}
+	for opt, v := range map[string]string{"timeout": settings.Timeout, "backoff": settings.Backoff} {
+		if _, err := time.ParseDuration(v); v != "" && err != nil {
+			d.Err = fmt.Errorf("invalid %s %q", opt, v)
+			return d
+		}
+	}
+	for game, name := range settings.RatingSystems {
+		if _, err := newRatingSystem(name); err != nil {
+			d.Err = fmt.Errorf("%s: %s", game, err)
+			return d
+		}
+	}
+	return d
+}
+
+// checkFile checks that path, if it exists, is a readable and writable file
+// with no more than perm permissions.
+func checkFile(name, path string, perm os.FileMode) diagnosis {
+	d := diagnosis{Check: name + " file " + path}
+	fi, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return d
+	}
+	if err != nil {
+		d.Err, d.Fix = err, "check the permissions of its directory"
+		return d
+	}
+	if fi.Mode().Perm()&^perm != 0 {
+		d.Err = fmt.Errorf("permissions are %s", fi.Mode().Perm())
+		d.Fix = fmt.Sprintf("run 'chmod %o %s'", perm, path)
+		return d
+	}
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		d.Err, d.Fix = err, fmt.Sprintf("make sure you own %s", path)
+		return d
+	}
+	f.Close()
+	return d
+}
+
+// checkTarget checks that the target answers, accepts gobeat's credentials
+// and agrees with the local clock at now.
+func checkTarget(now time.Time) []diagnosis {
+	reach := diagnosis{Check: "target reachable", Fix: "check the target URL and your network"}
+	auth := diagnosis{Check: "target credentials", Fix: "run 'gobeat target --basic-auth user:password'"}
+	clock := diagnosis{Check: "clock skew", Fix: "sync your clock, e.g. with NTP"}
+
+	u, err := settings.URL()
+	if err != nil || settings.TargetURL == "" {
+		reach.Err = fmt.Errorf("no target set")
+		return []diagnosis{reach}
+	}
+	client, target := targetClient(u)
+	req, err := http.NewRequest("GET", target, nil)
+	if err != nil {
+		reach.Err = err
+		return []diagnosis{reach}
+	}
+	if err := authorizeTarget(req); err != nil {
+		auth.Err = err
+		return []diagnosis{reach, auth}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		reach.Err = err
+		return []diagnosis{reach}
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 500 {
+		reach.Err = fmt.Errorf("got code %d", resp.StatusCode)
+	}
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		auth.Err = fmt.Errorf("got code %d", resp.StatusCode)
+	}
+	if date, err := http.ParseTime(resp.Header.Get("Date")); err == nil {
+		skew := now.Sub(date)
+		if skew < 0 {
+			skew = -skew
+		}
+		if skew > maxClockSkew {
+			clock.Err = fmt.Errorf("local clock is %s off the target's", skew)
+		}
+	}
+	return []diagnosis{reach, auth, clock}
+}
+
+// checkQueue checks that nothing has been waiting long to be posted, and that
+// the target's circuit breaker is closed.
+func checkQueue(now time.Time) diagnosis {
+	d := diagnosis{Check: "queued results", Fix: "run 'gobeat flush' once the target is up"}
+	p, err := retrievePending()
+	if err != nil {
+		d.Err, d.Fix = err, fmt.Sprintf("move %s aside", pendingPath)
+		return d
+	}
+	if len(p) > 0 {
+		d.Err = fmt.Errorf("%d results queued since %s", len(p),
+			p[0].Queued.Format("2006-01-02 15:04"))
+		return d
+	}
+	br, err := retrieveBreaker(settings.TargetURL)
+	if err != nil {
+		d.Err, d.Fix = err, fmt.Sprintf("move %s aside", breakerPath)
+		return d
+	}
+	if br.open(now) {
+		d.Err = br.err()
+	}
+	return d
+}
+
+// diagnose runs every check at now.
+func diagnose(now time.Time) []diagnosis {
+	out := []diagnosis{
+		checkSettings(),
+		checkFile("settings", gobeatPath, 0644),
+		checkFile("history", historyPath, 0644),
+		checkFile("credentials", credentialsPath, 0600),
+	}
+	out = append(out, checkTarget(now)...)
+	return append(out, checkQueue(now))
+}
+
+// doctorCommand returns the 'gobeat doctor' command.
+func doctorCommand() cli.Command {
+	return cli.Command{
+		Name: "doctor",
+		Description: "`doctor` checks the settings, files, target and queued results, " +
+			"and suggests fixes for anything wrong.",
+		Usage: "doctor",
+		Action: func(c *cli.Context) {
+			failed := 0
+			for _, d := range diagnose(time.Now()) {
+				if d.Err == nil {
+					fmt.Printf("%s  %s\n", outcome(true, "PASS"), d.Check)
+					continue
+				}
+				failed++
+				fmt.Printf("%s  %s: %s\n", outcome(false, "FAIL"), d.Check, d.Err)
+				fmt.Printf("      fix: %s\n", d.Fix)
+			}
+			if failed > 0 {
+				printError(fmt.Errorf("%d checks failed.", failed))
+			}
+		},
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckSettings(t *testing.T) {
+	mockSettingsFile(t, "")
+	if d := checkSettings(); d.Err == nil {
+		t.Fatal("Expected a missing target to fail.")
+	}
+	settings.TargetURL = "http://foo.gov"
+	settings.RatingSystems = map[string]string{"ping pong": "trueskill"}
+	if d := checkSettings(); d.Err == nil {
+		t.Fatal("Expected an unknown rating system to fail.")
+	}
+	settings.RatingSystems = nil
+	if d := checkSettings(); d.Err != nil {
+		t.Fatalf("Expected valid settings to pass: %s", d.Err)
+	}
+}
+
+func TestCheckFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gobeat_doctor")
+	if err != nil {
+		t.Fatalf("Could not create directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	p := filepath.Join(dir, "credentials")
+	if d := checkFile("credentials", p, 0600); d.Err != nil {
+		t.Fatalf("Expected a missing file to pass: %s", d.Err)
+	}
+	if err := ioutil.WriteFile(p, []byte("{}"), 0644); err != nil {
+		t.Fatalf("Could not write file: %s", err)
+	}
+	if d := checkFile("credentials", p, 0600); d.Err == nil || d.Fix == "" {
+		t.Fatal("Expected readable credentials to fail with a fix.")
+	}
+}
+
+func TestCheckTarget(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer ts.Close()
+	mockSettingsFile(t, ts.URL)
+
+	ds := checkTarget(time.Now())
+	if len(ds) != 3 || ds[0].Err != nil {
+		t.Fatalf("Expected the target to be reachable, got %v", ds)
+	}
+	if ds[1].Err == nil {
+		t.Fatal("Expected rejected credentials to fail.")
+	}
+	if ds[2].Err != nil {
+		t.Fatalf("Expected the clocks to agree: %s", ds[2].Err)
+	}
+	if ds := checkTarget(time.Now().Add(time.Hour)); ds[2].Err == nil {
+		t.Fatal("Expected an hour of skew to fail.")
+	}
+}
+
+func TestCheckQueue(t *testing.T) {
+	mockSettingsFile(t, "http://foo.gov")
+	if d := checkQueue(time.Now()); d.Err != nil {
+		t.Fatalf("Expected an empty queue to pass: %s", d.Err)
+	}
+	if err := queuePost("0123abcd", "oleg", "alex beat oleg", true); err != nil {
+		t.Fatalf("Could not queue post: %s", err)
+	}
+	if d := checkQueue(time.Now()); d.Err == nil {
+		t.Fatal("Expected queued results to fail.")
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// eloK is the maximum change in Elo rating from a single match.
+const eloK = 32
+
+// eloSystem is the classic Elo rating system.
+type eloSystem struct {
+	r ratings
+}
+
+// newEloSystem returns an Elo rating system with no players.
+func newEloSystem() *eloSystem {
+	return &eloSystem{r: make(ratings)}
+}
+
+func (e *eloSystem) get(name string) float64 {
+	return e.r.get(name)
+}
+
+func (e *eloSystem) apply(m *matchResult) {
+	winner, loser := m.Player, m.Opponent
+	bonus := handicapBonus(m)
+	if !m.Won {
+		winner, loser = loser, winner
+		bonus = -bonus
+	}
+	rw, rl := e.get(winner), e.get(loser)
+	delta := eloK * (1 - eloExpected(rw+bonus, rl))
+	e.r[winner] = rw + delta
+	e.r[loser] = rl - delta
+}
+
+func (e *eloSystem) idle(name string, d time.Duration, decay *ratingDecay) {
+	e.r[name] = decay.decay(e.get(name), d)
+}
+
+func (e *eloSystem) describe(name string) string {
+	return fmt.Sprintf("%.0f", e.get(name))
+}
+
+func (e *eloSystem) seed(name string, rating float64) {
+	e.r[name] = rating
+}
+
+func (e *eloSystem) states() map[string]*ratingState {
+	out := make(map[string]*ratingState, len(e.r))
+	for k, v := range e.r {
+		out[k] = &ratingState{Mu: v}
+	}
+	return out
+}
+
+func (e *eloSystem) restore(name string, s *ratingState) {
+	e.r[name] = s.Mu
+}
+
+func (e *eloSystem) ratings() ratings {
+	out := make(ratings, len(e.r))
+	for k, v := range e.r {
+		out[k] = v
+	}
+	return out
+}
+
+// eloExpected returns the expected score of a player rated a against one rated
+// b.
+func eloExpected(a, b float64) float64 {
+	return 1 / (1 + math.Pow(10, (b-a)/400))
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"github.com/codegangsta/cli"
+)
+
+// externalPrefix prefixes the names of external subcommand executables, so
+// that 'gobeat foo' runs 'gobeat-foo' from the PATH.
+const externalPrefix = "gobeat-"
+
+// externalCommand returns the path of the executable implementing the
+// external subcommand args[1], or "" if args[1] is a built-in command, a flag
+// or has no executable on the PATH.
+func externalCommand(app *cli.App, args []string) string {
+	if len(args) < 2 {
+		return ""
+	}
+	name := args[1]
+	if name == "" || name == "help" || name == "h" ||
+		strings.HasPrefix(name, "-") || strings.ContainsRune(name, os.PathSeparator) {
+		return ""
+	}
+	for _, c := range app.Commands {
+		if c.HasName(name) {
+			return ""
+		}
+	}
+	p, err := exec.LookPath(externalPrefix + name)
+	if err != nil {
+		return ""
+	}
+	return p
+}
+
+// externalEnv returns the environment an external subcommand runs with: the
+// current environment plus the resolved settings.
+func externalEnv() []string {
+	return append(os.Environ(),
+		"GOBEAT_SETTINGS="+gobeatPath,
+		"GOBEAT_HISTORY="+historyPath,
+		"GOBEAT_TARGET_URL="+settings.TargetURL,
+		"GOBEAT_USER="+settings.User,
+		"GOBEAT_GAME="+settings.Game,
+	)
+}
+
+// runExternal runs the external subcommand at path with the remaining args,
+// returning its exit status.
+func runExternal(path string, args []string) (int, error) {
+	cmd := exec.Command(path, args...)
+	cmd.Env = externalEnv()
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		if exit, ok := err.(*exec.ExitError); ok {
+			if status, ok := exit.Sys().(syscall.WaitStatus); ok {
+				return status.ExitStatus(), nil
+			}
+			return 1, nil
+		}
+		return 0, err
+	}
+	return 0, nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExternalCommand(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	dir, err := ioutil.TempDir("", "gobeat_path")
+	if err != nil {
+		t.Fatalf("Could not create directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "out")
+	script := "#!/bin/sh\necho \"$GOBEAT_USER $@\" > " + out + "\nexit 3\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "gobeat-foo"), []byte(script), 0755); err != nil {
+		t.Fatalf("Could not write command: %s", err)
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	app := setupCliApp()
+	if p := externalCommand(app, []string{"gobeat", "result", "oleg"}); p != "" {
+		t.Fatalf("Expected built-in commands to win, got %s", p)
+	}
+	if p := externalCommand(app, []string{"gobeat", "bar"}); p != "" {
+		t.Fatalf("Expected no command for bar, got %s", p)
+	}
+	p := externalCommand(app, []string{"gobeat", "foo", "--x", "y"})
+	if p == "" {
+		t.Fatal("Expected gobeat-foo to be found on the PATH.")
+	}
+
+	status, err := runExternal(p, []string{"--x", "y"})
+	if err != nil {
+		t.Fatalf("Expected the command to run: %s", err)
+	}
+	if status != 3 {
+		t.Fatalf("Expected the command's exit status, got %d", status)
+	}
+	b, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatalf("Expected the command to write output: %s", err)
+	}
+	if strings.TrimSpace(string(b)) != "alex --x y" {
+		t.Fatalf("Expected settings and args to be passed, got %q", b)
+	}
+}
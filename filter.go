@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/codegangsta/cli"
+)
+
+// filterDateFormat is the format of dates given to --since and --until.
+const filterDateFormat = "2006-01-02"
+
+// resultFilter selects results by opponent, game, date and outcome. Its zero
+// value matches every result.
+type resultFilter struct {
+	Opponent string
+	Game     string
+
+	// Since and Until bound the dates of matching results; Until is
+	// exclusive. Either may be zero for no bound.
+	Since time.Time
+	Until time.Time
+
+	// WinsOnly and LossesOnly keep only matches won or lost.
+	WinsOnly   bool
+	LossesOnly bool
+
+	// Search keeps results mentioning every one of its words, ignoring case,
+	// in their note, announcement, players, score or game.
+	Search string
+}
+
+// filterFlags are the flags shared by commands that list or summarize
+// results, parsed by parseFilter.
+func filterFlags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{Name: "opponent", Usage: "only results against this player"},
+		cli.StringFlag{Name: "game", Usage: "only results in this game"},
+		cli.StringFlag{Name: "since", Usage: "only results on or after this date, e.g. 2024-01-01"},
+		cli.StringFlag{Name: "until", Usage: "only results on or before this date"},
+		cli.BoolFlag{Name: "wins-only", Usage: "only matches won"},
+		cli.BoolFlag{Name: "losses-only", Usage: "only matches lost"},
+		cli.StringFlag{Name: "search", Usage: "only results whose notes or announcement mention these words"},
+	}
+}
+
+// parseFilter builds a filter from the flags in filterFlags.
+func parseFilter(c *cli.Context) (*resultFilter, error) {
+	f := &resultFilter{
+		Opponent:   c.String("opponent"),
+		Game:       c.String("game"),
+		WinsOnly:   c.Bool("wins-only"),
+		LossesOnly: c.Bool("losses-only"),
+		Search:     c.String("search"),
+	}
+	if f.WinsOnly && f.LossesOnly {
+		return nil, fmt.Errorf("--wins-only and --losses-only together match nothing.")
+	}
+	for flag, t := range map[string]*time.Time{"since": &f.Since, "until": &f.Until} {
+		if c.String(flag) == "" {
+			continue
+		}
+		d, err := time.ParseInLocation(filterDateFormat, c.String(flag), time.Local)
+		if err != nil {
+			return nil, fmt.Errorf("--%s must be a date like 2024-01-01.", flag)
+		}
+		*t = d
+	}
+	if !f.Until.IsZero() {
+		// Include the whole of the last day.
+		f.Until = f.Until.AddDate(0, 0, 1)
+	}
+	return f, nil
+}
+
+// empty reports whether f matches every result.
+func (f *resultFilter) empty() bool {
+	return *f == resultFilter{}
+}
+
+// match reports whether r passes f.
+func (f *resultFilter) match(r *matchResult) bool {
+	switch {
+	case f.Opponent != "" && r.Opponent != f.Opponent && r.OpponentPartner != f.Opponent:
+		return false
+	case f.Game != "" && r.Game != f.Game:
+		return false
+	case !f.Since.IsZero() && r.Date.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && !r.Date.Before(f.Until):
+		return false
+	case f.WinsOnly && !r.Won, f.LossesOnly && r.Won:
+		return false
+	}
+	if f.Search != "" {
+		text := strings.ToLower(strings.Join(append(r.players(), r.Note, r.Message,
+			r.Score, r.Game), " "))
+		for _, word := range strings.Fields(strings.ToLower(f.Search)) {
+			if !strings.Contains(text, word) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// filter returns a copy of h holding only the results that pass f. Ratings
+// computed from the copy still come from all of h, since a rating replayed
+// from some of the results would mean nothing.
+func (h *gobeatHistory) filter(f *resultFilter) *gobeatHistory {
+	if f.empty() {
+		return h
+	}
+	out := &gobeatHistory{Achievements: h.Achievements, full: h.unfiltered()}
+	for _, r := range h.Results {
+		if f.match(r) {
+			out.add(r)
+		}
+	}
+	return out
+}
+
+// unfiltered returns the history h was filtered from, or h itself.
+func (h *gobeatHistory) unfiltered() *gobeatHistory {
+	if h.full != nil {
+		return h.full
+	}
+	return h
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFilter(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	h := mockHistoryFile(t)
+	jan := time.Date(2024, 1, 15, 12, 0, 0, 0, time.Local)
+	h.add(&matchResult{ID: "1", Player: "alex", Opponent: "oleg", Game: "ping pong",
+		Won: true, Date: jan})
+	h.add(&matchResult{ID: "2", Player: "alex", Opponent: "oleg", Game: "foosball",
+		Won: false, Date: jan.AddDate(0, 1, 0)})
+	h.add(&matchResult{ID: "3", Player: "alex", Opponent: "ivan", Game: "ping pong",
+		Won: false, Date: jan.AddDate(0, 2, 0)})
+
+	ids := func(f *resultFilter) string {
+		var s string
+		for _, r := range h.filter(f).Results {
+			s += r.ID
+		}
+		return s
+	}
+	if got := ids(&resultFilter{}); got != "123" {
+		t.Fatalf("Expected an empty filter to match everything, got %s", got)
+	}
+	if got := ids(&resultFilter{Opponent: "oleg", LossesOnly: true}); got != "2" {
+		t.Fatalf("Expected losses to oleg, got %s", got)
+	}
+	if got := ids(&resultFilter{Game: "ping pong", WinsOnly: true}); got != "1" {
+		t.Fatalf("Expected ping pong wins, got %s", got)
+	}
+	feb := jan.AddDate(0, 1, 0)
+	if got := ids(&resultFilter{Since: feb.Add(-time.Hour), Until: feb.Add(time.Hour)}); got != "2" {
+		t.Fatalf("Expected results in the date range, got %s", got)
+	}
+
+	h.Results[0].Note = "Epic comeback from 5-15"
+	h.Results[2].Message = "ivan beat alex at ping pong"
+	if got := ids(&resultFilter{Search: "COMEBACK epic"}); got != "1" {
+		t.Fatalf("Expected notes to be searched, got %s", got)
+	}
+	if got := ids(&resultFilter{Search: "ivan beat"}); got != "3" {
+		t.Fatalf("Expected announcements to be searched, got %s", got)
+	}
+	if got := ids(&resultFilter{Search: "comeback ivan"}); got != "" {
+		t.Fatalf("Expected every word to have to match, got %s", got)
+	}
+
+	// Ratings still come from every result.
+	f := h.filter(&resultFilter{Opponent: "ivan"})
+	if f.stats("alex").Rating != h.stats("alex").Rating {
+		t.Fatal("Expected filtered stats to keep the full rating.")
+	}
+	if s := f.stats("alex"); s.Wins != 0 || s.Losses != 1 {
+		t.Fatalf("Expected a filtered record, got %d-%d", s.Wins, s.Losses)
+	}
+}
+
+func BenchmarkFilter(b *testing.B) {
+	mockSettingsFile(b, "foo.gov")
+	h := mockLargeHistory(b, benchmarkHistorySize)
+	f := &resultFilter{Opponent: "player3", Search: "rematch"}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.filter(f).page(1, historyPageSize)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+
+	"github.com/codegangsta/cli"
+)
+
+// flipCoin returns heads or tails, drawn from crypto/rand so that nobody can
+// predict or replay the outcome.
+func flipCoin() (bool, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(2))
+	if err != nil {
+		return false, err
+	}
+	return n.Int64() == 0, nil
+}
+
+// describeFlip describes a coin flip. With two players, heads picks the first
+// to serve first.
+func describeFlip(heads bool, players []string) string {
+	side := "tails"
+	if heads {
+		side = "heads"
+	}
+	if len(players) < 2 {
+		return fmt.Sprintf("Coin flip: %s", side)
+	}
+	winner := players[1]
+	if heads {
+		winner = players[0]
+	}
+	return fmt.Sprintf("Coin flip between %s and %s: %s, %s serves first",
+		players[0], players[1], side, winner)
+}
+
+// flipCommand returns the 'gobeat flip' command.
+func flipCommand() cli.Command {
+	return cli.Command{
+		Name:      "flip",
+		ShortName: "fl",
+		Description: "`flip` flips a fair coin, or with two players (or an opponent and " +
+			"you) decides who serves first.",
+		Usage: "flip [player1] [player2]",
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "announce",
+				Usage: "announce the outcome to every destination, for the record",
+			},
+		},
+		Action: func(c *cli.Context) {
+			players := []string(c.Args())
+			if len(players) == 1 {
+				players = []string{settings.User, players[0]}
+			}
+			if len(players) > 2 {
+				printError(fmt.Errorf("a coin only has two sides."))
+			}
+
+			heads, err := flipCoin()
+			if err != nil {
+				printError(err)
+			}
+			msg := describeFlip(heads, players)
+			fmt.Println(msg)
+
+			if c.Bool("announce") {
+				notifiers, err := settings.notifiers()
+				if err != nil {
+					printError(err)
+				}
+				// Players are named as in result announcements.
+				public := make([]string, len(players))
+				for i, p := range players {
+					public[i] = settings.publicPlayer(p)
+				}
+				deliveries := deliver(notifiers, describeFlip(heads, public))
+				printDeliveries(deliveries)
+				if !delivered(deliveries) {
+					printError(fmt.Errorf("could not announce the flip to any destination."))
+				}
+			}
+		},
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestFlipCoin(t *testing.T) {
+	seen := map[bool]bool{}
+	for i := 0; i < 100 && len(seen) < 2; i++ {
+		heads, err := flipCoin()
+		if err != nil {
+			t.Fatalf("Could not flip: %s", err)
+		}
+		seen[heads] = true
+	}
+	if len(seen) != 2 {
+		t.Fatal("Expected both sides of the coin in 100 flips.")
+	}
+}
+
+func TestDescribeFlip(t *testing.T) {
+	if d := describeFlip(false, nil); d != "Coin flip: tails" {
+		t.Fatalf("Expected a plain flip, got %q", d)
+	}
+	d := describeFlip(false, []string{"alex", "oleg"})
+	if d != "Coin flip between alex and oleg: tails, oleg serves first" {
+		t.Fatalf("Expected tails to pick the second player, got %q", d)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/codegangsta/cli"
+)
+
+// follower renders results from a live feed along with how each one moved
+// the standings, keeping its own copy of the history up to date as they
+// arrive.
+type follower struct {
+	h   *gobeatHistory
+	out io.Writer
+
+	// seen holds the IDs of results already in h, which are not counted
+	// twice.
+	seen map[string]bool
+
+	// notify, if set, is called with a desktop notification of each new
+	// result.
+	notify func(title, body string) error
+}
+
+// newFollower returns a follower starting from the results in h.
+func newFollower(h *gobeatHistory, out io.Writer) *follower {
+	f := &follower{h: h, out: out, seen: make(map[string]bool)}
+	for _, r := range h.Results {
+		if r.ID != "" {
+			f.seen[r.ID] = true
+		}
+	}
+	return f
+}
+
+// standings returns the standings r counts toward.
+func (f *follower) standings(r *matchResult, now time.Time) []standing {
+	if r.doubles() {
+		return sortedStandings(f.h.doublesStandings(r.Game, now).ratings())
+	}
+	return sortedStandings(f.h.standings(r.Game, now).ratings())
+}
+
+// show prints a JSON encoded result from the feed and the movement of each
+// player in it.
+func (f *follower) show(msg []byte) error {
+	r := new(matchResult)
+	if err := json.Unmarshal(msg, r); err != nil {
+		return err
+	}
+	if r.Game == "" {
+		r.Game = settings.Game
+	}
+	if _, err := fmt.Fprintln(f.out, formatHistoryLine(r)); err != nil {
+		return err
+	}
+	if r.ID != "" && f.seen[r.ID] {
+		return nil
+	}
+	f.seen[r.ID] = true
+	if f.notify != nil {
+		if err := f.notify(resultNotification(r)); err != nil {
+			logger.Warn(err.Error())
+		}
+	}
+
+	now := time.Now()
+	before := f.standings(r, now)
+	f.h.add(r)
+	after := f.standings(r, now)
+	for _, name := range r.players() {
+		if _, err := fmt.Fprintln(f.out, "  "+describeMovement(name, before, after)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rank returns name's 1-based position in s and their rating, or 0 if they
+// are not in it.
+func rank(s []standing, name string) (int, float64) {
+	for i, st := range s {
+		if st.Player == name {
+			return i + 1, st.Rating
+		}
+	}
+	return 0, ratingMean
+}
+
+// describeMovement describes how name's position and rating changed between
+// the before and after standings, e.g. "oleg ▲ 2nd (from 4th), 1516 (+16)".
+func describeMovement(name string, before, after []standing) string {
+	was, old := rank(before, name)
+	now, rating := rank(after, name)
+	delta := fmt.Sprintf("%+.0f", rating-old)
+	if rating >= old {
+		delta = outcome(true, delta)
+	} else {
+		delta = outcome(false, delta)
+	}
+
+	var move string
+	switch {
+	case was == 0:
+		move = fmt.Sprintf("new at %s", ordinal(now))
+	case now < was:
+		move = outcome(true, "▲") + fmt.Sprintf(" %s (from %s)", ordinal(now), ordinal(was))
+	case now > was:
+		move = outcome(false, "▼") + fmt.Sprintf(" %s (from %s)", ordinal(now), ordinal(was))
+	default:
+		move = fmt.Sprintf("= %s", ordinal(now))
+	}
+	return fmt.Sprintf("%s %s, %.0f (%s)", name, move, rating, delta)
+}
+
+// followCommand returns the 'gobeat follow' command.
+func followCommand() cli.Command {
+	return cli.Command{
+		Name:      "follow",
+		ShortName: "f",
+		Description: "`follow` prints results live as the server accepts them, like " +
+			"'gobeat watch', along with how each moved the standings. Meant for a " +
+			"terminal left open near the table.",
+		Usage: "follow [--sse] [--notify]",
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "sse",
+				Usage: "use Server-Sent Events instead of a WebSocket",
+			},
+			cli.BoolFlag{
+				Name:  "notify",
+				Usage: "show a desktop notification of each new result",
+			},
+		},
+		Action: func(c *cli.Context) {
+			u, err := settings.URL()
+			if err != nil {
+				printError(err)
+			}
+			if u.String() == "" {
+				printError(fmt.Errorf("no target set."))
+			}
+			h, err := retrieveHistory()
+			if err != nil {
+				printError(err)
+			}
+
+			f := newFollower(h, os.Stdout)
+			if c.Bool("notify") {
+				f.notify = desktopNotify
+			}
+			fmt.Println(bold("Following results from " + u.Host))
+			if c.Bool("sse") {
+				err = streamEvents(u, f.show)
+			} else {
+				err = streamResults(u, f.show)
+			}
+			if err != nil {
+				printError(err)
+			}
+		},
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestFollowerShow(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	h := mockHistoryFile(t)
+	h.add(&matchResult{ID: "1", Player: "ivan", Opponent: "oleg", Game: "ping pong",
+		Won: true})
+
+	var out bytes.Buffer
+	f := newFollower(h, &out)
+	msg := `{"id":"2","player":"oleg","opponent":"ivan","game":"ping pong",` +
+		`"score":"21-15","won":true}`
+	if err := f.show([]byte(msg)); err != nil {
+		t.Fatalf("Expected the result to be shown: %s", err)
+	}
+	if !strings.Contains(out.String(), "oleg vs ivan  21-15") {
+		t.Fatalf("Expected the result line, got %q", out.String())
+	}
+	if !strings.Contains(out.String(), "oleg ▲ 1st (from 2nd)") ||
+		!strings.Contains(out.String(), "ivan ▼ 2nd (from 1st)") {
+		t.Fatalf("Expected the standings movement, got %q", out.String())
+	}
+
+	// A result already in the history is not counted again.
+	out.Reset()
+	if err := f.show([]byte(msg)); err != nil {
+		t.Fatalf("Expected the result to be shown: %s", err)
+	}
+	if len(h.Results) != 2 || strings.Contains(out.String(), "▲") {
+		t.Fatalf("Expected a repeated result to be ignored, got %q", out.String())
+	}
+}
+
+func TestFollowerNotify(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	h := mockHistoryFile(t)
+	h.add(&matchResult{ID: "1", Player: "ivan", Opponent: "oleg", Game: "ping pong",
+		Won: true})
+
+	var out bytes.Buffer
+	var titles []string
+	f := newFollower(h, &out)
+	f.notify = func(title, body string) error {
+		titles = append(titles, title)
+		return nil
+	}
+	for _, msg := range []string{
+		`{"id":"1","player":"ivan","opponent":"oleg","game":"ping pong","won":true}`,
+		`{"id":"2","player":"oleg","opponent":"ivan","game":"ping pong","won":true}`,
+	} {
+		if err := f.show([]byte(msg)); err != nil {
+			t.Fatalf("Expected the result to be shown: %s", err)
+		}
+	}
+	if len(titles) != 1 || titles[0] != "New ping pong result" {
+		t.Fatalf("Expected a notification of the new result only, got %v", titles)
+	}
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/codegangsta/cli"
+)
+
+// playersPath is where the server serves each player by name, relative to the
+// target.
+const playersPath = "/players"
+
+// How a forgotten player's results are dealt with.
+const (
+	forgetPseudonymize = "pseudonymize"
+	forgetDelete       = "delete"
+)
+
+// newPseudonym returns a random name to replace a forgotten player's with.
+// It is random rather than derived from their name so it can't be reversed.
+func newPseudonym() (string, error) {
+	id, err := newResultID()
+	if err != nil {
+		return "", err
+	}
+	return "former-player-" + id, nil
+}
+
+// forgetRemotePlayer asks the target to forget name, pseudonymizing or
+// deleting their results as mode says. Only league admins may do so. A player
+// the target has never heard of counts as forgotten.
+func forgetRemotePlayer(u *url.URL, name, mode string) error {
+	resp, err := sendTargetRequest(u, "DELETE", playersPath+"/"+url.PathEscape(name),
+		url.Values{"mode": {mode}}, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusAccepted, http.StatusNoContent, http.StatusNotFound:
+		return nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("only league admins can forget players on the server.")
+	}
+	return fmt.Errorf("on forget: got code %d", resp.StatusCode)
+}
+
+// isWordByte reports whether b can be part of a name, for telling mentions of
+// a name apart from longer words containing it.
+func isWordByte(b byte) bool {
+	return b == '_' || b == '-' || b >= '0' && b <= '9' || b >= 'a' && b <= 'z' ||
+		b >= 'A' && b <= 'Z' || b >= 0x80
+}
+
+// scrub replaces whole-word mentions of any of names in free text, such as
+// notes and announcements, with alias.
+func scrub(s string, names []string, alias string) string {
+	var out strings.Builder
+	for i := 0; i < len(s); {
+		matched := ""
+		if i == 0 || !isWordByte(s[i-1]) {
+			for _, name := range names {
+				end := i + len(name)
+				if name != "" && len(name) > len(matched) && strings.HasPrefix(s[i:], name) &&
+					(end == len(s) || !isWordByte(s[end])) {
+					matched = name
+				}
+			}
+		}
+		if matched != "" {
+			out.WriteString(alias)
+			i += len(matched)
+			continue
+		}
+		out.WriteByte(s[i])
+		i++
+	}
+	return out.String()
+}
+
+// involves reports whether name played in r.
+func (r *matchResult) involves(name string) bool {
+	for _, player := range r.players() {
+		if player == name {
+			return true
+		}
+	}
+	return false
+}
+
+// pseudonymize replaces name with alias in r, including in its note and
+// announcement wherever they mention name or handle.
+func (r *matchResult) pseudonymize(name, handle, alias string) {
+	for _, s := range []*string{&r.Player, &r.Opponent, &r.Partner, &r.OpponentPartner} {
+		if *s == name {
+			*s = alias
+		}
+	}
+	names := []string{name, handle}
+	r.Note = scrub(r.Note, names, alias)
+	r.Message = scrub(r.Message, names, alias)
+}
+
+// forget removes name from the history: their results are deleted if remove
+// is true, or otherwise kept with alias in their place, including in notes
+// and announcements that mention them or their handle. The pruned summary is
+// always pseudonymized, since other players' aggregates depend on it. It
+// returns the IDs of the results affected.
+func (h *gobeatHistory) forget(name, handle, alias string, remove bool) []string {
+	var ids []string
+	results := h.Results[:0]
+	for _, r := range h.Results {
+		if !r.involves(name) {
+			results = append(results, r)
+			continue
+		}
+		ids = append(ids, r.ID)
+		if remove {
+			continue
+		}
+		r.pseudonymize(name, handle, alias)
+		results = append(results, r)
+	}
+	h.Results = results
+
+	if achievements, ok := h.Achievements[name]; ok {
+		delete(h.Achievements, name)
+		if !remove {
+			h.Achievements[alias] = achievements
+		}
+	}
+	if remove {
+		gone := make(map[string]bool)
+		for _, id := range ids {
+			gone[id] = true
+		}
+		for player, achievements := range h.Achievements {
+			var keep []*achievement
+			for _, a := range achievements {
+				if !gone[a.ResultID] {
+					keep = append(keep, a)
+				}
+			}
+			h.Achievements[player] = keep
+		}
+	}
+	h.Pruned.rename(name, alias)
+	return ids
+}
+
+// rename replaces name with alias throughout the summary.
+func (s *historySummary) rename(name, alias string) {
+	if s == nil {
+		return
+	}
+	if st, ok := s.Streaks[name]; ok {
+		delete(s.Streaks, name)
+		s.Streaks[alias] = st
+	}
+	for _, g := range s.Games {
+		for _, m := range []map[string]*record{g.Records, g.Singles} {
+			if r, ok := m[name]; ok {
+				delete(m, name)
+				m[alias] = r
+			}
+		}
+		if n, ok := g.Runs[name]; ok {
+			delete(g.Runs, name)
+			g.Runs[alias] = n
+		}
+		for _, pairs := range []map[string]map[string]*record{g.HeadToHead, g.Series} {
+			if opponents, ok := pairs[name]; ok {
+				delete(pairs, name)
+				pairs[alias] = opponents
+			}
+			for _, opponents := range pairs {
+				if r, ok := opponents[name]; ok {
+					delete(opponents, name)
+					opponents[alias] = r
+				}
+			}
+		}
+		for _, r := range []ratings{g.Ratings, g.DoublesRatings} {
+			if v, ok := r[name]; ok {
+				delete(r, name)
+				r[alias] = v
+			}
+		}
+		for _, m := range []map[string]*ratingState{g.RatingStates, g.DoublesRatingStates} {
+			if st, ok := m[name]; ok {
+				delete(m, name)
+				m[alias] = st
+			}
+		}
+		for _, m := range []map[string]time.Time{g.LastPlayed, g.LastPlayedDoubles} {
+			if d, ok := m[name]; ok {
+				delete(m, name)
+				m[alias] = d
+			}
+		}
+	}
+}
+
+// forgetSummary reports what forgetPlayer did.
+type forgetSummary struct {
+	// Alias is the name that replaced the player's, if their results were
+	// kept.
+	Alias string
+
+	// Results, Queued, Drafts and Remote are how many local results were
+	// affected, how many queued announcements and outbox drafts were dropped
+	// or scrubbed, and whether the target was asked to forget the player too.
+	Results int
+	Queued  int
+	Drafts  int
+	Remote  bool
+}
+
+// forgetPlayer removes name from the target (if remote is true and one is
+// set), the local history, the queue of announcements, the outbox and the
+// roster, as forget describes. Local data is only changed once the target has agreed.
+func forgetPlayer(name string, remove, remote bool) (*forgetSummary, error) {
+	if name == settings.User {
+		return nil, fmt.Errorf("can't forget the current user; set another user first.")
+	}
+	mode := forgetPseudonymize
+	if remove {
+		mode = forgetDelete
+	}
+	alias, err := newPseudonym()
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := retrieveHistory()
+	if err != nil {
+		return nil, err
+	}
+	p, err := retrievePending()
+	if err != nil {
+		return nil, err
+	}
+	drafts, err := retrieveOutbox()
+	if err != nil {
+		return nil, err
+	}
+
+	sum := &forgetSummary{}
+	if remote && settings.TargetURL != "" {
+		u, err := settings.URL()
+		if err != nil {
+			return nil, err
+		}
+		if err := forgetRemotePlayer(u, name, mode); err != nil {
+			return nil, err
+		}
+		sum.Remote = true
+	}
+
+	handle := ""
+	if e, ok := settings.Roster[name]; ok {
+		handle = e.Handle
+	}
+	ids := h.forget(name, handle, alias, remove)
+	sum.Results = len(ids)
+	if !remove {
+		sum.Alias = alias
+	}
+
+	affected := make(map[string]bool)
+	for _, id := range ids {
+		affected[id] = true
+	}
+	var kept []*pendingPost
+	for _, post := range p {
+		if !affected[post.ResultID] {
+			kept = append(kept, post)
+			continue
+		}
+		sum.Queued++
+		if remove {
+			continue
+		}
+		post.Message = scrub(post.Message, []string{name, handle}, alias)
+		if post.Opponent == name {
+			post.Opponent = alias
+		}
+		kept = append(kept, post)
+	}
+	if sum.Queued > 0 {
+		if err := savePending(kept); err != nil {
+			return nil, err
+		}
+	}
+
+	var keptDrafts []*draft
+	for _, d := range drafts {
+		if !d.Result.involves(name) {
+			keptDrafts = append(keptDrafts, d)
+			continue
+		}
+		sum.Drafts++
+		if remove {
+			continue
+		}
+		d.Result.pseudonymize(name, handle, alias)
+		d.Message = scrub(d.Message, []string{name, handle}, alias)
+		keptDrafts = append(keptDrafts, d)
+	}
+	if sum.Drafts > 0 {
+		if err := saveOutbox(keptDrafts); err != nil {
+			return nil, err
+		}
+	}
+	if err := h.save(); err != nil {
+		return nil, err
+	}
+
+	if _, ok := settings.Roster[name]; ok {
+		delete(settings.Roster, name)
+		if err := settings.save(); err != nil {
+			return nil, err
+		}
+	}
+	return sum, nil
+}
+
+// forgetCommand returns the 'gobeat forget' command.
+func forgetCommand() cli.Command {
+	return cli.Command{
+		Name: "forget",
+		Description: "`forget` removes a player's data, such as when they leave: their " +
+			"results are pseudonymized (or deleted) on the server, which only admins " +
+			"may ask, and locally, including in queued announcements and drafts, and " +
+			"they are taken off the roster.",
+		Usage: "forget --user name [--delete] [--local] [--yes]",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "user",
+				Usage: "the player to forget",
+			},
+			cli.BoolFlag{
+				Name:  "delete",
+				Usage: "delete their results instead of replacing their name with a pseudonym",
+			},
+			cli.BoolFlag{
+				Name:  "local",
+				Usage: "only forget them locally, leaving the server alone",
+			},
+			cli.BoolFlag{
+				Name:  "yes",
+				Usage: "don't ask for confirmation",
+			},
+		},
+		Action: func(c *cli.Context) {
+			name := c.String("user")
+			if name == "" {
+				printError(fmt.Errorf("missing --user."))
+			}
+			if !c.Bool("yes") {
+				what := "pseudonymize"
+				if c.Bool("delete") {
+					what = "delete"
+				}
+				ok, err := confirm(os.Stdin, os.Stdout,
+					fmt.Sprintf("Forget %s and %s their results? This can't be undone.", name, what))
+				if err != nil {
+					printError(err)
+				}
+				if !ok {
+					fmt.Println("Nothing forgotten")
+					return
+				}
+			}
+
+			sum, err := forgetPlayer(name, c.Bool("delete"), !c.Bool("local"))
+			if err != nil {
+				printError(err)
+			}
+			if sum.Remote {
+				fmt.Printf("The server has forgotten %s\n", name)
+			}
+			if sum.Alias != "" {
+				fmt.Printf("Renamed %s to %s in %d results\n", name, sum.Alias, sum.Results)
+			} else {
+				fmt.Printf("Deleted %d results with %s\n", sum.Results, name)
+			}
+			if sum.Queued > 0 {
+				fmt.Printf("Updated %d queued announcements\n", sum.Queued)
+			}
+			if sum.Drafts > 0 {
+				fmt.Printf("Updated %d drafts in the outbox\n", sum.Drafts)
+			}
+		},
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestScrub(t *testing.T) {
+	names := []string{"oleg", "@oleg"}
+	for in, want := range map[string]string{
+		"alex beat oleg 21-15":  "alex beat X 21-15",
+		"oleg, oleg and @oleg!": "X, X and X!",
+		"olegovich and oleg-b":  "olegovich and oleg-b",
+		"rematch with oleg.":    "rematch with X.",
+		"":                      "",
+	} {
+		if got := scrub(in, names, "X"); got != want {
+			t.Fatalf("Expected %q to be scrubbed to %q, got %q", in, want, got)
+		}
+	}
+}
+
+func TestForgetPlayer(t *testing.T) {
+	var forgot string
+	status := http.StatusNoContent
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" {
+			t.Fatalf("Expected a DELETE, got %s", r.Method)
+		}
+		forgot = r.URL.Path + "?" + r.URL.RawQuery
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+	mockSettingsFile(t, ts.URL)
+	settings.Roster = map[string]*rosterEntry{"oleg": {Handle: "@oleg_p"}}
+	h := mockHistoryFile(t)
+	h.add(&matchResult{ID: "1", Player: "alex", Opponent: "oleg", Won: true,
+		Message: "alex beat @oleg_p 21-15", Note: "oleg wants a rematch"})
+	h.add(&matchResult{ID: "2", Player: "alex", Opponent: "dana", Won: true})
+	h.add(&matchResult{ID: "3", Player: "alex", Partner: "dana", Opponent: "sam",
+		OpponentPartner: "oleg"})
+	h.Achievements = map[string][]*achievement{"oleg": {{Name: "first-win", ResultID: "1"}}}
+	if err := h.save(); err != nil {
+		t.Fatalf("Could not save history: %s", err)
+	}
+	if err := queuePost("3", "sam", "alex & dana lost to sam & oleg", true); err != nil {
+		t.Fatalf("Could not queue post: %s", err)
+	}
+
+	// The server refusing leaves everything alone.
+	status = http.StatusForbidden
+	if _, err := forgetPlayer("oleg", false, true); err == nil ||
+		!strings.Contains(err.Error(), "admins") {
+		t.Fatalf("Expected only admins to be allowed, got %v", err)
+	}
+	if h, _ := retrieveHistory(); h.Results[0].Opponent != "oleg" {
+		t.Fatal("Expected the history to be unchanged when the server refuses.")
+	}
+
+	status = http.StatusNoContent
+	sum, err := forgetPlayer("oleg", false, true)
+	if err != nil {
+		t.Fatalf("Expected oleg to be forgotten: %s", err)
+	}
+	if forgot != playersPath+"/oleg?mode=pseudonymize" {
+		t.Fatalf("Expected the server to be asked to forget oleg, got %q", forgot)
+	}
+	if !sum.Remote || sum.Results != 2 || sum.Queued != 1 || sum.Alias == "" {
+		t.Fatalf("Unexpected summary %+v", sum)
+	}
+
+	h, err = retrieveHistory()
+	if err != nil {
+		t.Fatalf("Could not retrieve history: %s", err)
+	}
+	if len(h.Results) != 3 || h.Results[0].Opponent != sum.Alias ||
+		h.Results[2].OpponentPartner != sum.Alias {
+		t.Fatal("Expected oleg to be replaced by the pseudonym.")
+	}
+	if h.Results[0].Message != "alex beat "+sum.Alias+" 21-15" ||
+		h.Results[0].Note != sum.Alias+" wants a rematch" {
+		t.Fatalf("Expected mentions of oleg to be scrubbed, got %q and %q",
+			h.Results[0].Message, h.Results[0].Note)
+	}
+	if h.Achievements["oleg"] != nil || len(h.Achievements[sum.Alias]) != 1 {
+		t.Fatal("Expected oleg's achievements to move to the pseudonym.")
+	}
+	p, err := retrievePending()
+	if err != nil {
+		t.Fatalf("Could not retrieve queue: %s", err)
+	}
+	if len(p) != 1 || strings.Contains(p[0].Message, "oleg") {
+		t.Fatalf("Expected the queued announcement to be scrubbed, got %q", p[0].Message)
+	}
+	if _, ok := settings.Roster["oleg"]; ok {
+		t.Fatal("Expected oleg to be taken off the roster.")
+	}
+}
+
+func TestForgetDelete(t *testing.T) {
+	mockSettingsFile(t, "")
+	h := mockHistoryFile(t)
+	h.add(&matchResult{ID: "1", Player: "alex", Opponent: "oleg", Won: true})
+	h.add(&matchResult{ID: "2", Player: "alex", Opponent: "dana", Won: true})
+	h.Achievements = map[string][]*achievement{"alex": {{Name: "first-win", ResultID: "1"}}}
+
+	if ids := h.forget("oleg", "", "X", true); len(ids) != 1 || ids[0] != "1" {
+		t.Fatalf("Expected result 1 to be deleted, got %v", ids)
+	}
+	if len(h.Results) != 1 || h.Results[0].ID != "2" {
+		t.Fatal("Expected only the result without oleg to be kept.")
+	}
+	if len(h.Achievements["alex"]) != 0 {
+		t.Fatal("Expected achievements from deleted results to be removed.")
+	}
+
+	if _, err := forgetPlayer(settings.User, true, false); err == nil {
+		t.Fatal("Expected the current user not to be forgettable.")
+	}
+}
+
+func TestForgetDrafts(t *testing.T) {
+	mockSettingsFile(t, "")
+	mockHistoryFile(t)
+	settings.Roster = map[string]*rosterEntry{"oleg": {Handle: "@oleg_p"}}
+	drafts := []*draft{
+		{Result: &matchResult{Player: "alex", Opponent: "oleg", Won: true,
+			Note: "oleg wants a rematch"}, Message: "alex beat @oleg_p 21-15"},
+		{Result: &matchResult{Player: "alex", Opponent: "dana", Won: true},
+			Message: "alex beat dana 21-15"},
+	}
+	if err := saveOutbox(drafts); err != nil {
+		t.Fatalf("Could not save outbox: %s", err)
+	}
+
+	sum, err := forgetPlayer("oleg", false, false)
+	if err != nil {
+		t.Fatalf("Expected oleg to be forgotten: %s", err)
+	}
+	if sum.Drafts != 1 {
+		t.Fatalf("Expected one draft to be scrubbed, got %d", sum.Drafts)
+	}
+	out, err := retrieveOutbox()
+	if err != nil || len(out) != 2 {
+		t.Fatalf("Expected both drafts to be kept, got %d (%v)", len(out), err)
+	}
+	d := out[0]
+	if d.Result.Opponent != sum.Alias || d.Result.Note != sum.Alias+" wants a rematch" ||
+		d.Message != "alex beat "+sum.Alias+" 21-15" {
+		t.Fatalf("Expected oleg to be scrubbed from the draft, got %+v and %q", d.Result, d.Message)
+	}
+
+	if sum, err = forgetPlayer(sum.Alias, true, false); err != nil || sum.Drafts != 1 {
+		t.Fatalf("Expected the draft to be deleted, got %+v (%v)", sum, err)
+	}
+	if out, _ := retrieveOutbox(); len(out) != 1 || out[0].Result.Opponent != "dana" {
+		t.Fatal("Expected only the draft without oleg to be kept.")
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/codegangsta/cli"
+)
+
+// Win conditions, deciding which score wins a game.
+const (
+	winHigher = "higher"
+	winLower  = "lower"
+	winAny    = "any"
+)
+
+// gameDef describes the rules of a game, so that scores can be validated and
+// announcements dressed up without gobeat knowing the game in advance.
+type gameDef struct {
+	// ScorePattern is a regular expression scores must match. Empty allows
+	// any score.
+	ScorePattern string `json:"score_pattern,omitempty"`
+
+	// DrawAllowed is whether a score like "2-2" may be recorded.
+	DrawAllowed bool `json:"draw_allowed,omitempty"`
+
+	// WinCondition is whether the "higher" or "lower" score wins, or "any" to
+	// trust the result as entered. Only checked for scores like "21-15".
+	WinCondition string `json:"win_condition,omitempty"`
+
+	// Emoji leads the default announcements and is available to custom
+	// templates as {{.Emoji}}.
+	Emoji string `json:"emoji,omitempty"`
+
+	// Hashtag is appended to announcements when no hashtags are configured.
+	Hashtag string `json:"hashtag,omitempty"`
+
+	// Points is how many points win a game, for scoring it live. Zero if the
+	// game is not played to a points target.
+	Points int `json:"points,omitempty"`
+
+	// WinBy is the lead needed to win once Points is reached; zero or one
+	// means any lead.
+	WinBy int `json:"win_by,omitempty"`
+}
+
+// defaultGames are the games gobeat knows out of the box. They accept any
+// score, as gobeat always has.
+var defaultGames = map[string]*gameDef{
+	"ping pong": &gameDef{WinCondition: winAny, DrawAllowed: true, Emoji: "🏓", Hashtag: "#OfficePong",
+		Points: 11, WinBy: 2},
+	"foosball": &gameDef{WinCondition: winAny, DrawAllowed: true, Emoji: "⚽", Hashtag: "#OfficeFoosball",
+		Points: 10},
+	"pool": &gameDef{WinCondition: winAny, DrawAllowed: true, Emoji: "🎱", Hashtag: "#OfficePool"},
+}
+
+// gameDef returns the definition of the game called name: a custom one if
+// configured, then a default one, then one accepting anything.
+func (g *gobeatSettings) gameDef(name string) *gameDef {
+	if def, ok := g.Games[name]; ok {
+		return def
+	}
+	if def, ok := defaultGames[name]; ok {
+		return def
+	}
+	return &gameDef{WinCondition: winAny, DrawAllowed: true}
+}
+
+// parsePoints parses a score that is two point totals, e.g. "21-15". It is
+// called for every result by stats and sorting, so it avoids regular
+// expressions.
+func parsePoints(score string) (a, b int, ok bool) {
+	isSpace := func(c byte) bool { return c == ' ' || c == '\t' || c == '\n' || c == '\f' || c == '\r' }
+	i := 0
+	number := func() (int, bool) {
+		for i < len(score) && isSpace(score[i]) {
+			i++
+		}
+		start := i
+		for i < len(score) && score[i] >= '0' && score[i] <= '9' {
+			i++
+		}
+		if i == start {
+			return 0, false
+		}
+		n, _ := strconv.Atoi(score[start:i])
+		for i < len(score) && isSpace(score[i]) {
+			i++
+		}
+		return n, true
+	}
+	if a, ok = number(); !ok || i == len(score) || score[i] != '-' {
+		return 0, 0, false
+	}
+	i++
+	if b, ok = number(); !ok || i != len(score) {
+		return 0, 0, false
+	}
+	return a, b, true
+}
+
+// validate checks that score, from the recording player's point of view, is a
+// valid score for def and agrees with whether they won.
+func (def *gameDef) validate(score string, won bool) error {
+	if def.ScorePattern != "" {
+		re, err := regexp.Compile(def.ScorePattern)
+		if err != nil {
+			return fmt.Errorf("invalid score pattern %q: %s", def.ScorePattern, err)
+		}
+		if !re.MatchString(score) {
+			return fmt.Errorf("score %q does not match %s.", score, def.ScorePattern)
+		}
+	}
+
+	mine, theirs, ok := parsePoints(score)
+	if !ok {
+		return nil
+	}
+	if mine == theirs {
+		if !def.DrawAllowed {
+			return fmt.Errorf("draws are not allowed.")
+		}
+		return nil
+	}
+	var higherWon bool
+	switch def.WinCondition {
+	case winAny:
+		return nil
+	case winLower:
+		higherWon = !won
+	default:
+		higherWon = won
+	}
+	if higherWon != (mine > theirs) {
+		if won {
+			return fmt.Errorf("score %s is a loss; use --lost or swap the score.", score)
+		}
+		return fmt.Errorf("score %s is a win; drop --lost or swap the score.", score)
+	}
+	return nil
+}
+
+// gameCommand returns the 'gobeat game' command.
+func gameCommand() cli.Command {
+	return cli.Command{
+		Name:        "game",
+		ShortName:   "g",
+		Description: "`game` sets the game results are recorded for.",
+		Usage:       "game [name]",
+		Action: func(c *cli.Context) {
+			if len(c.Args()) == 0 {
+				fmt.Printf("Current game: %s\n", settings.Game)
+				return
+			}
+			settings.Game = strings.Join(c.Args(), " ")
+			fmt.Printf("Set game to %s\n", settings.Game)
+
+			if err := settings.save(); err != nil {
+				printError(err)
+			}
+		},
+		Subcommands: []cli.Command{
+			cli.Command{
+				Name:        "list",
+				Description: "`game list` lists the known games and their rules.",
+				Usage:       "game list",
+				Action: func(c *cli.Context) {
+					names := map[string]bool{}
+					for name := range defaultGames {
+						names[name] = true
+					}
+					for name := range settings.Games {
+						names[name] = true
+					}
+					var sorted []string
+					for name := range names {
+						sorted = append(sorted, name)
+					}
+					sort.Strings(sorted)
+					for _, name := range sorted {
+						def := settings.gameDef(name)
+						draws := "no draws"
+						if def.DrawAllowed {
+							draws = "draws allowed"
+						}
+						target := ""
+						if def.Points > 0 {
+							target = fmt.Sprintf("first to %d", def.Points)
+							if def.WinBy > 1 {
+								target += fmt.Sprintf(" by %d", def.WinBy)
+							}
+						}
+						fmt.Printf("%s %s\t%s wins, %s\t%s\t%s\t%s\n", def.Emoji, name,
+							def.WinCondition, draws, target, def.ScorePattern, def.Hashtag)
+					}
+				},
+			},
+			cli.Command{
+				Name:        "define",
+				Description: "`game define` adds or replaces a custom game.",
+				Usage: "game define [--pattern regexp] [--draws] [--win higher|lower|any] " +
+					"[--points n] [--win-by n] [--emoji emoji] [--hashtag tag] [name]",
+				Flags: []cli.Flag{
+					cli.StringFlag{Name: "pattern", Usage: "regular expression scores must match"},
+					cli.BoolFlag{Name: "draws", Usage: "allow drawn scores"},
+					cli.StringFlag{Name: "win", Value: winHigher, Usage: "which score wins: higher, lower or any"},
+					cli.StringFlag{Name: "points", Usage: "points that win a game, for 'gobeat live'"},
+					cli.StringFlag{Name: "win-by", Usage: "lead needed to win at the points target"},
+					cli.StringFlag{Name: "emoji", Usage: "emoji for announcements"},
+					cli.StringFlag{Name: "hashtag", Usage: "hashtag for announcements"},
+				},
+				Action: func(c *cli.Context) {
+					if len(c.Args()) == 0 {
+						printError(fmt.Errorf("missing game name."))
+					}
+					name := strings.Join(c.Args(), " ")
+					def := &gameDef{
+						ScorePattern: c.String("pattern"),
+						DrawAllowed:  c.Bool("draws"),
+						WinCondition: c.String("win"),
+						Emoji:        c.String("emoji"),
+					}
+					if tags := normalizeHashtags([]string{c.String("hashtag")}); len(tags) > 0 {
+						def.Hashtag = tags[0]
+					}
+					switch def.WinCondition {
+					case winHigher, winLower, winAny:
+					default:
+						printError(fmt.Errorf("unknown win condition %q.", def.WinCondition))
+					}
+					if _, err := regexp.Compile(def.ScorePattern); err != nil {
+						printError(err)
+					}
+					for flag, v := range map[string]*int{"points": &def.Points, "win-by": &def.WinBy} {
+						if c.String(flag) == "" {
+							continue
+						}
+						n, err := strconv.Atoi(c.String(flag))
+						if err != nil || n < 0 {
+							printError(fmt.Errorf("--%s must be a positive integer.", flag))
+						}
+						*v = n
+					}
+
+					if settings.Games == nil {
+						settings.Games = map[string]*gameDef{}
+					}
+					settings.Games[name] = def
+					fmt.Printf("Defined %s\n", name)
+
+					if err := settings.save(); err != nil {
+						printError(err)
+					}
+				},
+			},
+			cli.Command{
+				Name:        "remove",
+				Description: "`game remove` removes a custom game.",
+				Usage:       "game remove [name]",
+				Action: func(c *cli.Context) {
+					name := strings.Join(c.Args(), " ")
+					if _, ok := settings.Games[name]; !ok {
+						printError(fmt.Errorf("%s is not a custom game.", name))
+					}
+					delete(settings.Games, name)
+					fmt.Printf("Removed %s\n", name)
+
+					if err := settings.save(); err != nil {
+						printError(err)
+					}
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import "testing"
+
+func TestGameDefValidate(t *testing.T) {
+	golf := &gameDef{ScorePattern: `^\d+-\d+$`, WinCondition: winLower}
+	if err := golf.validate("72-75", true); err != nil {
+		t.Fatalf("Expected the lower score to win at golf: %s", err)
+	}
+	if err := golf.validate("75-72", true); err == nil {
+		t.Fatal("Expected a win with the higher golf score to be rejected.")
+	}
+	if err := golf.validate("72-72", true); err == nil {
+		t.Fatal("Expected a draw to be rejected.")
+	}
+	if err := golf.validate("even", true); err == nil {
+		t.Fatal("Expected a score not matching the pattern to be rejected.")
+	}
+
+	chess := &gameDef{ScorePattern: `^(1-0|0-1|½-½)$`, DrawAllowed: true}
+	if err := chess.validate("½-½", false); err != nil {
+		t.Fatalf("Expected a chess draw to be valid: %s", err)
+	}
+	if err := chess.validate("0-1", true); err == nil {
+		t.Fatal("Expected a win recorded as 0-1 to be rejected.")
+	}
+}
+
+func TestCustomGame(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	if def := settings.gameDef("ping pong"); def.Hashtag != "#OfficePong" {
+		t.Fatalf("Expected the default ping pong rules, got %v", def)
+	}
+	if _, err := newMatchResult("oleg", "15-21", true); err != nil {
+		t.Fatalf("Expected default games to trust the result: %s", err)
+	}
+
+	settings.Game = "darts"
+	settings.Games = map[string]*gameDef{
+		"darts": &gameDef{WinCondition: winHigher, Emoji: "🎯", Hashtag: "#OfficeDarts"},
+	}
+	if _, err := newMatchResult("oleg", "1-3", true); err == nil {
+		t.Fatal("Expected a custom game's win condition to be enforced.")
+	}
+	r, err := newMatchResult("oleg", "3-1", true)
+	if err != nil {
+		t.Fatalf("Could not create result: %s", err)
+	}
+	if tags := resultHashtags(""); len(tags) != 1 || tags[0] != "#OfficeDarts" {
+		t.Fatalf("Expected the game's hashtag, got %v", tags)
+	}
+	if a := newAnnouncement(r, nil); a.Emoji != "🎯" {
+		t.Fatalf("Expected the game's emoji, got %q", a.Emoji)
+	}
+}
+
+func TestParsePoints(t *testing.T) {
+	for score, want := range map[string][2]int{"21-15": {21, 15}, " 3 - 11 ": {3, 11}} {
+		a, b, ok := parsePoints(score)
+		if !ok || a != want[0] || b != want[1] {
+			t.Fatalf("Expected %q to parse as %v, got %d-%d", score, want, a, b)
+		}
+	}
+	for _, score := range []string{"", "21", "21-", "-15", "21-15-3", "6-4 6-3", "W"} {
+		if _, _, ok := parsePoints(score); ok {
+			t.Fatalf("Expected %q not to parse as points.", score)
+		}
+	}
+}
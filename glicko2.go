@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	// glicko2Scale converts between the Glicko and Glicko-2 rating scales.
+	glicko2Scale = 173.7178
+
+	// glicko2InitialRD is the rating deviation of a new player.
+	glicko2InitialRD = 350
+
+	// glicko2InitialVolatility is the volatility of a new player.
+	glicko2InitialVolatility = 0.06
+
+	// glicko2Tau constrains how quickly volatility changes.
+	glicko2Tau = 0.5
+
+	// glicko2Epsilon is the convergence tolerance of the volatility update.
+	glicko2Epsilon = 0.000001
+)
+
+// glicko2Player is a player's state on the Glicko-2 scale.
+type glicko2Player struct {
+	mu    float64
+	phi   float64
+	sigma float64
+}
+
+// glicko2System is Mark Glickman's Glicko-2 rating system. Every match is
+// treated as its own rating period, and each idle week is an empty period
+// that grows the player's rating deviation.
+type glicko2System struct {
+	players map[string]*glicko2Player
+}
+
+// newGlicko2System returns a Glicko-2 rating system with no players.
+func newGlicko2System() *glicko2System {
+	return &glicko2System{players: make(map[string]*glicko2Player)}
+}
+
+// player returns name's state, creating it if necessary.
+func (g *glicko2System) player(name string) *glicko2Player {
+	p, ok := g.players[name]
+	if !ok {
+		p = &glicko2Player{
+			phi:   glicko2InitialRD / glicko2Scale,
+			sigma: glicko2InitialVolatility,
+		}
+		g.players[name] = p
+	}
+	return p
+}
+
+func (g *glicko2System) get(name string) float64 {
+	if p, ok := g.players[name]; ok {
+		return p.rating()
+	}
+	return ratingMean
+}
+
+func (g *glicko2System) apply(m *matchResult) {
+	p, o := g.player(m.Player), g.player(m.Opponent)
+	score := 0.0
+	if m.Won {
+		score = 1
+	}
+	// A handicapped player is rated as if they were that much stronger.
+	shift := handicapBonus(m) / glicko2Scale
+	sp, so := *p, *o
+	sp.mu += shift
+	np, no := sp.update(so, score), so.update(sp, 1-score)
+	np.mu -= shift
+	*p, *o = np, no
+}
+
+func (g *glicko2System) idle(name string, d time.Duration, decay *ratingDecay) {
+	p := g.player(name)
+	maxPhi := glicko2InitialRD / glicko2Scale
+	for i := 0; i < int(d/week) && p.phi < maxPhi; i++ {
+		p.phi = math.Min(math.Sqrt(p.phi*p.phi+p.sigma*p.sigma), maxPhi)
+	}
+	p.mu = (decay.decay(p.rating(), d) - ratingMean) / glicko2Scale
+}
+
+func (g *glicko2System) describe(name string) string {
+	p := g.player(name)
+	return fmt.Sprintf("%.0f (RD %.0f, volatility %.3f)", p.rating(),
+		p.phi*glicko2Scale, p.sigma)
+}
+
+// seed only carries over the rating; name's deviation and volatility start
+// afresh.
+func (g *glicko2System) seed(name string, rating float64) {
+	g.player(name).mu = (rating - ratingMean) / glicko2Scale
+}
+
+func (g *glicko2System) states() map[string]*ratingState {
+	out := make(map[string]*ratingState, len(g.players))
+	for name, p := range g.players {
+		out[name] = &ratingState{Mu: p.mu, Phi: p.phi, Sigma: p.sigma}
+	}
+	return out
+}
+
+func (g *glicko2System) restore(name string, s *ratingState) {
+	*g.player(name) = glicko2Player{mu: s.Mu, phi: s.Phi, sigma: s.Sigma}
+}
+
+func (g *glicko2System) ratings() ratings {
+	out := make(ratings, len(g.players))
+	for name, p := range g.players {
+		out[name] = p.rating()
+	}
+	return out
+}
+
+// rating returns p's rating on the Glicko scale.
+func (p *glicko2Player) rating() float64 {
+	return p.mu*glicko2Scale + ratingMean
+}
+
+// update returns p's state after a single match against o with the given
+// score (1 for a win, 0 for a loss).
+func (p glicko2Player) update(o glicko2Player, score float64) glicko2Player {
+	g := glicko2G(o.phi)
+	e := 1 / (1 + math.Exp(-g*(p.mu-o.mu)))
+	v := 1 / (g * g * e * (1 - e))
+	delta := v * g * (score - e)
+
+	sigma := p.volatility(delta, v)
+	phiStar := math.Sqrt(p.phi*p.phi + sigma*sigma)
+	phi := 1 / math.Sqrt(1/(phiStar*phiStar)+1/v)
+	return glicko2Player{
+		mu:    p.mu + phi*phi*g*(score-e),
+		phi:   phi,
+		sigma: sigma,
+	}
+}
+
+// volatility computes p's new volatility using the Illinois algorithm from
+// step 5 of the Glicko-2 paper.
+func (p glicko2Player) volatility(delta, v float64) float64 {
+	phi2, delta2 := p.phi*p.phi, delta*delta
+	a := math.Log(p.sigma * p.sigma)
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		return ex*(delta2-phi2-v-ex)/(2*(phi2+v+ex)*(phi2+v+ex)) -
+			(x-a)/(glicko2Tau*glicko2Tau)
+	}
+
+	A := a
+	var B float64
+	if delta2 > phi2+v {
+		B = math.Log(delta2 - phi2 - v)
+	} else {
+		k := 1.0
+		for f(a-k*glicko2Tau) < 0 {
+			k++
+		}
+		B = a - k*glicko2Tau
+	}
+
+	fA, fB := f(A), f(B)
+	for math.Abs(B-A) > glicko2Epsilon {
+		C := A + (A-B)*fA/(fB-fA)
+		fC := f(C)
+		if fC*fB <= 0 {
+			A, fA = B, fB
+		} else {
+			fA /= 2
+		}
+		B, fB = C, fC
+	}
+	return math.Exp(A / 2)
+}
+
+// glicko2G reduces the impact of a match according to the opponent's rating
+// deviation.
+func glicko2G(phi float64) float64 {
+	return 1 / math.Sqrt(1+3*phi*phi/(math.Pi*math.Pi))
+}
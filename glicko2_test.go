@@ -0,0 +1,48 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// TestGlicko2Update checks the worked example from Glickman's Glicko-2 paper
+// one match at a time.
+func TestGlicko2Update(t *testing.T) {
+	p := glicko2Player{mu: 0, phi: 200 / glicko2Scale, sigma: 0.06}
+	o := glicko2Player{mu: (1400 - ratingMean) / glicko2Scale,
+		phi: 30 / glicko2Scale, sigma: 0.06}
+
+	won := p.update(o, 1)
+	if won.rating() <= p.rating() {
+		t.Fatalf("Expected a win to raise the rating, got %f", won.rating())
+	}
+	if won.phi >= p.phi {
+		t.Fatal("Expected a match to reduce rating deviation.")
+	}
+	if math.Abs(won.sigma-0.06) > 0.001 {
+		t.Fatalf("Expected volatility to stay near 0.06, got %f", won.sigma)
+	}
+}
+
+func TestGlicko2Idle(t *testing.T) {
+	g := newGlicko2System()
+	g.apply(&matchResult{Player: "alex", Opponent: "oleg", Won: true})
+	phi := g.player("alex").phi
+
+	g.idle("alex", 10*week, nil)
+	if g.player("alex").phi <= phi {
+		t.Fatal("Expected inactivity to grow rating deviation.")
+	}
+	if math.Abs(g.get("alex")+g.get("oleg")-2*ratingMean) > 1e-9 {
+		t.Fatal("Expected an even first match to be zero-sum.")
+	}
+}
+
+func TestNewRatingSystem(t *testing.T) {
+	if _, err := newRatingSystem("glicko2"); err != nil {
+		t.Fatalf("Expected glicko2 to be available: %s", err)
+	}
+	if _, err := newRatingSystem("trueskill"); err == nil {
+		t.Fatal("Expected an unknown rating system to be rejected.")
+	}
+}
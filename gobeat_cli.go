@@ -1,6 +1,8 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -10,10 +12,14 @@ import (
 	"os/user"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/codegangsta/cli"
 )
 
+// version is the version of gobeat, reported to servers in the User-Agent.
+const version = "0.1.0"
+
 // settings manages global state from the application. It is either retrieved or
 // created before command invocation, and saved to disk after execution.
 var settings *gobeatSettings
@@ -27,6 +33,15 @@ func main() {
 
 	app := setupCliApp()
 
+	// Commands gobeat doesn't know may be provided by gobeat-<name> on the PATH.
+	if p := externalCommand(app, os.Args); p != "" {
+		status, err := runExternal(p, os.Args[2:])
+		if err != nil {
+			printError(err)
+		}
+		os.Exit(status)
+	}
+
 	if err := app.Run(os.Args); err != nil {
 		printError(err)
 	}
@@ -36,7 +51,7 @@ func main() {
 // op if error is nil.
 func printError(err error) {
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: "+err.Error())
+		logger.Error(err.Error())
 		os.Exit(1)
 	}
 }
@@ -48,11 +63,52 @@ func setupCliApp() *cli.App {
 	app.Usage = `gobeat Tweets scores of game matches from an account configured
 	    server-side.`
 	app.Author = "Alex Toombs"
+	app.Version = version
+	app.Flags = []cli.Flag{
+		cli.BoolFlag{
+			Name:  "quiet, q",
+			Usage: "print nothing but errors, and rely on the exit code",
+		},
+		cli.StringFlag{
+			Name:  "log-level",
+			Value: "info",
+			Usage: "least severe diagnostics to print: debug, info, warn or error",
+		},
+		cli.StringFlag{
+			Name:  "log-format",
+			Value: "text",
+			Usage: "how to print diagnostics: text or json",
+		},
+	}
+	app.Before = func(c *cli.Context) error {
+		level := c.GlobalString("log-level")
+		if c.GlobalBool("quiet") {
+			level = "error"
+		}
+		if err := configureLogger(os.Stderr, level, c.GlobalString("log-format")); err != nil {
+			return err
+		}
+		if c.GlobalBool("quiet") {
+			return silenceOutput()
+		}
+		return nil
+	}
 
 	populateCommands(app)
 	return app
 }
 
+// silenceOutput discards everything subsequently written to stdout. Errors are
+// still written to stderr.
+func silenceOutput() error {
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	os.Stdout = devNull
+	return nil
+}
+
 // populateCommands sets up all commands on the new command line application.
 func populateCommands(app *cli.App) {
 	app.Commands = []cli.Command{
@@ -60,15 +116,65 @@ func populateCommands(app *cli.App) {
 			Name:        "target",
 			ShortName:   "t",
 			Description: "`target` sets the URL of the server that gobeat talks to.",
-			Usage:       "target [url]",
+			Usage: "target [--timeout duration] [--retries n] [--backoff duration] " +
+				"[--header 'Name: value'...] [--basic-auth user:password] " +
+				"[--signing-secret secret] [url]",
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:  "basic-auth",
+					Usage: "user:password for a server behind basic auth; the password is kept in ~/.gobeat_credentials",
+				},
+				cli.BoolFlag{
+					Name:  "no-basic-auth",
+					Usage: "stop sending basic auth",
+				},
+				cli.StringFlag{
+					Name:  "signing-secret",
+					Usage: "secret shared with the server to sign results with HMAC-SHA256",
+				},
+				cli.BoolFlag{
+					Name:  "no-signing",
+					Usage: "stop signing results",
+				},
+			}, requestFlags()...),
 			Action: func(c *cli.Context) {
+				changed, err := applyRequestFlags(c)
+				if err != nil {
+					printError(err)
+				}
+				if c.Bool("no-basic-auth") || c.String("basic-auth") != "" {
+					if err := settings.setBasicAuth(c.String("basic-auth")); err != nil {
+						printError(err)
+					}
+					changed = true
+				}
+				if c.Bool("no-signing") || c.String("signing-secret") != "" {
+					if err := storeCredential(credentialSigning,
+						c.String("signing-secret")); err != nil {
+						printError(err)
+					}
+					changed = true
+				}
+				if changed {
+					fmt.Printf("Requests time out after %s and are retried %d times, "+
+						"backing off from %s\n", settings.timeout(), settings.retries(),
+						settings.backoff())
+					for name, value := range settings.Headers {
+						fmt.Printf("  %s: %s\n", name, value)
+					}
+					if len(c.Args()) == 0 {
+						if err := settings.save(); err != nil {
+							printError(err)
+						}
+						return
+					}
+				}
+
 				if len(c.Args()) == 0 {
-					fmt.Printf("Current target: %s\n", settings.TargetURL)
+					fmt.Printf("Current target: %s (timeout %s)\n", settings.TargetURL,
+						settings.timeout())
 				} else {
-					settings.TargetURL = c.Args().First()
-
-					// Attempt to parse.
-					u, err := settings.URL()
+					u, err := settings.setTarget(c.Args().First())
 					if err != nil {
 						printError(err)
 					}
@@ -99,11 +205,87 @@ func populateCommands(app *cli.App) {
 			},
 		},
 		cli.Command{
-			Name:        "result",
-			ShortName:   "r",
-			Description: "`result` sends a result to be tweeted.",
-			Usage:       "result [opponent] [score]",
+			Name:        "hashtags",
+			ShortName:   "ht",
+			Description: "`hashtags` sets the hashtags appended to announcements.",
+			Usage:       "hashtags [tag...]",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "reset",
+					Usage: "clear configured hashtags and use the game's defaults",
+				},
+			},
 			Action: func(c *cli.Context) {
+				if c.Bool("reset") {
+					settings.Hashtags = nil
+				} else if len(c.Args()) == 0 {
+					fmt.Printf("Current hashtags: %s\n",
+						strings.Join(resultHashtags(""), " "))
+					return
+				} else {
+					settings.Hashtags = normalizeHashtags(c.Args())
+				}
+				fmt.Printf("Set hashtags to %s\n",
+					strings.Join(resultHashtags(""), " "))
+
+				if err := settings.save(); err != nil {
+					printError(err)
+				}
+			},
+		},
+		cli.Command{
+			Name:      "result",
+			ShortName: "r",
+			Description: "`result` sends a result to be tweeted. Use 'gobeat edit' and " +
+				"'gobeat delete' to change or remove one.",
+			Usage: "result [opponent] [score]",
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:  "tags",
+					Usage: "comma-separated hashtags overriding the configured ones",
+				},
+				cli.BoolFlag{
+					Name:  "lost",
+					Usage: "record a loss to the opponent instead of a win",
+				},
+				cli.StringFlag{
+					Name:  "partner",
+					Usage: "your teammate, for a doubles match",
+				},
+				cli.StringFlag{
+					Name:  "opponent-partner",
+					Usage: "the opponent's teammate, for a doubles match",
+				},
+				cli.StringFlag{
+					Name:  "duration",
+					Usage: "how long the match took, e.g. 48m",
+				},
+				cli.StringFlag{
+					Name:  "note",
+					Usage: "a note to remember the match by, searchable with 'gobeat history --search'",
+				},
+				cli.BoolFlag{
+					Name:  "copy",
+					Usage: "copy the announcement to the clipboard once posted",
+				},
+				cli.BoolFlag{
+					Name:  "no-post",
+					Usage: "record the result on the target without announcing it",
+				},
+				cli.BoolFlag{
+					Name:  "post",
+					Usage: "announce the result even if not posting is the default",
+				},
+				cli.BoolFlag{
+					Name:  "draft",
+					Usage: "keep the result in the outbox for review instead of sending it",
+				},
+			}, requestFlags()...),
+			Action: func(c *cli.Context) {
+				// Not saved: request flags only apply to this result.
+				if _, err := applyRequestFlags(c); err != nil {
+					printError(err)
+				}
 				if len(c.Args()) == 0 {
 					printError(fmt.Errorf("missing opponent name and score."))
 				} else if len(c.Args()) == 1 {
@@ -112,55 +294,150 @@ func populateCommands(app *cli.App) {
 				opponent := c.Args().First()
 				score := c.Args().Get(1)
 
-				u, err := settings.URL()
+				r, err := newMatchResult(opponent, score, !c.Bool("lost"))
 				if err != nil {
 					printError(err)
 				}
-
-				if err := postResult(u, opponent, score); err != nil {
+				r.Partner = c.String("partner")
+				r.OpponentPartner = c.String("opponent-partner")
+				r.Note = c.String("note")
+				if c.Bool("no-post") && c.Bool("post") {
+					printError(fmt.Errorf("--no-post and --post cannot be used together."))
+				}
+				if c.Bool("no-post") || c.Bool("post") {
+					r.Unannounced = c.Bool("no-post")
+				}
+				if err := r.applyHandicap(); err != nil {
 					printError(err)
 				}
+				if c.String("duration") != "" {
+					d, err := time.ParseDuration(c.String("duration"))
+					if err != nil || d <= 0 {
+						printError(fmt.Errorf("invalid duration %q.", c.String("duration")))
+					}
+					r.setDuration(d)
+				}
 
-				fmt.Println("Successfully posted result. Congratulations!")
+				if c.Bool("draft") {
+					d, err := saveDraft(r, resultHashtags(c.String("tags")))
+					if err != nil {
+						printError(err)
+					}
+					fmt.Printf("Drafted: %s\n", d.Message)
+					fmt.Printf("Send it with 'gobeat outbox send %s'\n", r.ID)
+					return
+				}
+				rec := postRecordedResult(r, resultHashtags(c.String("tags")))
+				if c.Bool("copy") {
+					copyAnnouncement(rec.Message)
+				}
 			},
 		},
+		editCommand(),
+		deleteCommand(),
+		rosterCommand(),
+		templateCommand(),
+		historyCommand(),
+		milestonesCommand(),
+		rivalryCommand(),
+		achievementsCommand(),
+		statsCommand(),
+		standingsCommand(),
+		decayCommand(),
+		ratingCommand(),
+		versusCommand(),
+		importCommand(),
+		watchCommand(),
+		botCommand(),
+		ircCommand(),
+		telegramCommand(),
+		matrixCommand(),
+		pluginsCommand(),
+		hooksCommand(),
+		manCommand(),
+		flushCommand(),
+		doctorCommand(),
+		backupCommand(),
+		gameCommand(),
+		liveCommand(),
+		followCommand(),
+		predictCommand(),
+		matchmakeCommand(),
+		flipCommand(),
+		wrappedCommand(),
+		reportCommand(),
+		cardCommand(),
+		openCommand(),
+		forgetCommand(),
+		privacyCommand(),
+		outboxCommand(),
+		approveCommand(),
+		rejectCommand(),
+		tokenCommand(),
+		syncCommand(),
 	}
 }
 
-// postResult posts a match result to the configured target.
-func postResult(u *url.URL, opponent, score string) error {
+// announceHeader tells the target whether to announce a result it is sent,
+// or only record it.
+const announceHeader = "X-Gobeat-Announce"
+
+// resultIDHeader carries the ID of the result being posted, which the target
+// keys its record of the result by.
+const resultIDHeader = "X-Gobeat-Result-Id"
+
+// postResult posts a formatted match result to the configured target, which
+// only records it without announcing it unless announce is true. The target
+// is told the result's id, if it is not empty, so it can later be corrected
+// or deleted.
+func postResult(u *url.URL, id, msg string, announce bool) error {
 	if u == nil || u.String() == "" {
 		return fmt.Errorf("cannot post with empty URL")
 	}
 
-	client := http.Client{}
-	req, err := http.NewRequest("POST", u.String(), formatResult(opponent, score))
+	resp, err := doTargetRequest(u, func() (*http.Client, *http.Request, error) {
+		client, target := targetClient(u)
+		req, err := http.NewRequest("POST", target, strings.NewReader(msg))
+		if err != nil {
+			return nil, nil, err
+		}
+		if !announce {
+			req.Header.Set(announceHeader, "false")
+		}
+		if id != "" {
+			req.Header.Set(resultIDHeader, id)
+		}
+		if err := authorizeTarget(req); err != nil {
+			return nil, nil, err
+		}
+		if err := signRequest(req, []byte(msg), time.Now()); err != nil {
+			return nil, nil, err
+		}
+		return client, req, nil
+	})
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
 
-	resp, err := client.Do(req)
-	if err != nil {
+	if err := rateLimited("request", resp); err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-
 	errStr := "on request: got code %d"
 	switch resp.StatusCode {
 	case http.StatusOK:
 	case http.StatusCreated:
+	case http.StatusConflict:
+		// Already recorded under this ID, as when a post is retried.
+	case http.StatusAccepted:
+		// Held until a moderator approves it with 'gobeat approve'.
+		return errAwaitingApproval
 	default:
 		return fmt.Errorf(errStr, resp.StatusCode)
 	}
 	return nil
 }
 
-// formatResult formats the body posted to the server.
-func formatResult(opponent, score string) *strings.Reader {
-	return strings.NewReader(fmt.Sprintf("%s beat %s at %s with score %s",
-		settings.User, opponent, settings.Game, score))
-}
-
 // retrieveSettings attempts to locate the settings of the app, contained in
 // '~/.gobeat' by default.
 func retrieveSettings() (*gobeatSettings, error) {
@@ -191,6 +468,12 @@ func retrieveSettings() (*gobeatSettings, error) {
 	if err := settings.assignDefaults(); err != nil {
 		return nil, err
 	}
+	if err := settings.migrateSecrets(b); err != nil {
+		return nil, err
+	}
+	if err := settings.loadSecrets(); err != nil {
+		return nil, err
+	}
 	return settings, nil
 }
 
@@ -202,16 +485,126 @@ var gobeatPath = filepath.Join(os.Getenv("HOME"), settingsFile)
 // gobeatSettings is marshalled to disk to set configuration about target.
 type gobeatSettings struct {
 	// TargetURL is the URL that the gobeat server is serving at. Set with the
-	// 'gobeat target' command.
+	// 'gobeat target' command. A unix:// URL names a Unix domain socket the
+	// server listens on, e.g. "unix:///var/run/gobeat.sock".
 	TargetURL string `json:"target_url"`
 
 	// User is the command line user's ID. Populated from os/user.Current().
 	User string `json:"user"`
 
+	// ClientID identifies this installation to servers. Generated the first
+	// time gobeat runs.
+	ClientID string `json:"client_id"`
+
 	// Game is the type of game (e.g., ping pong) played. Defaults to "ping
-	// pong".
-	// TODO(alex): allow users to modify this.
+	// pong". Set with the 'gobeat game' command.
 	Game string `json:"game"`
+
+	// Games are custom game definitions, keyed by name, which override the
+	// defaults. Managed with 'gobeat game define'.
+	Games map[string]*gameDef `json:"games,omitempty"`
+
+	// Hashtags are appended to every announcement. When empty, the defaults
+	// for Game are used instead. Set with the 'gobeat hashtags' command.
+	Hashtags []string `json:"hashtags,omitempty"`
+
+	// Roster maps player names to what gobeat knows about them, such as their
+	// social handle. Managed with the 'gobeat roster' command.
+	Roster map[string]*rosterEntry `json:"roster,omitempty"`
+
+	// Templates override the default announcement templates, keyed by name.
+	// Set with the 'gobeat template' command.
+	Templates map[string]string `json:"templates,omitempty"`
+
+	// Milestones is how milestones are announced: "append", "substitute" or
+	// "off". Defaults to "append". Set with the 'gobeat milestones' command.
+	Milestones string `json:"milestones,omitempty"`
+
+	// CelebrateAchievements is whether newly earned achievements are posted.
+	// Set with 'gobeat achievements --celebrate'.
+	CelebrateAchievements bool `json:"celebrate_achievements,omitempty"`
+
+	// Decay configures rating decay for inactive players, keyed by game (each
+	// game is its own league). Games without an entry do not decay. Set with
+	// the 'gobeat decay' command.
+	Decay map[string]*ratingDecay `json:"decay,omitempty"`
+
+	// RatingSystems selects the rating system ("elo" or "glicko2") used for
+	// each game. Games without an entry use Elo. Set with 'gobeat rating
+	// --system'.
+	RatingSystems map[string]string `json:"rating_systems,omitempty"`
+
+	// HandicapRatings is whether handicaps are accounted for in ratings, so
+	// that a player given a head start gains less for winning. Set with
+	// 'gobeat rating --handicaps'.
+	HandicapRatings bool `json:"handicap_ratings,omitempty"`
+
+	// UpsetAlerts is whether announcements call out wins by big underdogs.
+	// Set with 'gobeat predict --upsets'.
+	UpsetAlerts bool `json:"upset_alerts,omitempty"`
+
+	// AutoSync is whether results are pulled from the target before each
+	// one is recorded. Set with 'gobeat sync --auto'.
+	AutoSync bool `json:"auto_sync,omitempty"`
+
+	// CardTheme names the theme scorecards are drawn in. Set with 'gobeat
+	// card --theme'.
+	CardTheme string `json:"card_theme,omitempty"`
+
+	// OpponentNames is how opponents are named in announcements: in full
+	// (the default), by initials, or by pseudonym. Set with the 'gobeat
+	// privacy' command.
+	OpponentNames string `json:"opponent_names,omitempty"`
+
+	// PseudonymKey is the secret pseudonyms are derived from, so each
+	// opponent keeps theirs without anyone else being able to work it out.
+	// It is kept in the credential store.
+	PseudonymKey string `json:"-"`
+
+	// NoPost is whether results are recorded without being announced unless
+	// 'gobeat result --post' is given. Set with 'gobeat privacy --no-post'.
+	NoPost bool `json:"no_post,omitempty"`
+
+	// Discord configures 'gobeat bot discord'.
+	Discord *discordSettings `json:"discord,omitempty"`
+
+	// IRC, if set, announces results to an IRC channel as well as the target.
+	// Set with the 'gobeat irc' command.
+	IRC *ircSettings `json:"irc,omitempty"`
+
+	// Telegram, if set, announces results to a Telegram group. Set with the
+	// 'gobeat telegram' command.
+	Telegram *telegramSettings `json:"telegram,omitempty"`
+
+	// Matrix, if set, announces results to a Matrix room. Set with the
+	// 'gobeat matrix' command.
+	Matrix *matrixSettings `json:"matrix,omitempty"`
+
+	// Timeout is how long requests to the target and other destinations may
+	// take, e.g. "10s". Defaults to 30 seconds. Set with 'gobeat target
+	// --timeout', or for a single result with 'gobeat result --timeout'.
+	Timeout string `json:"timeout,omitempty"`
+
+	// BasicAuthUser, if set, is the user requests to the target authenticate
+	// as. The password is kept in the credential store. Set with 'gobeat
+	// target --basic-auth' or a target URL with user info.
+	BasicAuthUser string `json:"basic_auth_user,omitempty"`
+
+	// Headers are sent with every request to the target, e.g. for a reverse
+	// proxy. Set like Timeout, with --header.
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// Retries is how many times a failed delivery is retried. Defaults to 2;
+	// 0 disables retries. Set like Timeout, with --retries.
+	Retries *int `json:"retries,omitempty"`
+
+	// Backoff is how long to wait before the first retry, e.g. "1s". Each
+	// further retry waits twice as long. Set like Timeout, with --backoff.
+	Backoff string `json:"backoff,omitempty"`
+
+	// Hooks are shell commands run around recording a result. Set with the
+	// 'gobeat hooks' command.
+	Hooks *hookSettings `json:"hooks,omitempty"`
 }
 
 // assignDefaults populates the settings object with default values.
@@ -229,23 +622,59 @@ func (g *gobeatSettings) assignDefaults() error {
 	if g.Game == "" {
 		g.Game = "ping pong"
 	}
+
+	if g.Milestones == "" {
+		g.Milestones = milestonesAppend
+	}
+
+	// The client ID must not change between runs, so it is saved as soon as
+	// it is made.
+	if g.ClientID == "" {
+		b := make([]byte, 8)
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+		g.ClientID = hex.EncodeToString(b)
+		return g.save()
+	}
 	return nil
 }
 
-// save saves to disk a settings file in '~/.gobeat'.
-func (g *gobeatSettings) save() error {
-	b, err := json.Marshal(g)
+// writeFileAtomic replaces the file at path with b, with permissions perm. It
+// is written to a new temporary file beside path and renamed into place, so
+// that readers never see it half written, concurrent writers never share a
+// temporary file, no one else can get at it on the way and the rename stays
+// on one filesystem.
+func writeFileAtomic(path string, b []byte, perm os.FileMode) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path))
 	if err != nil {
 		return err
 	}
-
-	tmpPath := filepath.Join(os.TempDir(), "temp_gobeat")
-	if err := ioutil.WriteFile(tmpPath, b, 0644); err != nil {
+	defer os.Remove(f.Name())
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
 		return err
 	}
 
 	// Move into correct path.
-	return os.Rename(tmpPath, gobeatPath)
+	return os.Rename(f.Name(), path)
+}
+
+// save saves to disk a settings file in '~/.gobeat'.
+func (g *gobeatSettings) save() error {
+	b, err := json.Marshal(g)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(gobeatPath, b, 0644)
 }
 
 // URL returns the fully-resolved URL from the gobeat settings.
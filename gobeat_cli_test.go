@@ -8,6 +8,7 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -17,8 +18,55 @@ func TestSetupCliApp(t *testing.T) {
 		t.Fatal("Expected setup to set name.")
 	}
 
-	if len(app.Commands) != 3 {
-		t.Fatal("Expected setup to initialize three commands.")
+	if len(app.Commands) != 46 {
+		t.Fatal("Expected setup to initialize forty-six commands.")
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	if settings.timeout() != defaultTimeout {
+		t.Fatalf("Expected the default timeout, got %s", settings.timeout())
+	}
+
+	// A slow server fails the post rather than hanging it.
+	done := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer ts.Close()
+	defer close(done)
+	settings.Timeout = "50ms"
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Could not parse URL: %s", err)
+	}
+	if err := postResult(u, "", "alex beat oleg", true); err == nil {
+		t.Fatal("Expected the post to time out.")
+	}
+}
+
+func TestQuiet(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	stdout := os.Stdout
+	defer func() { os.Stdout = stdout }()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Could not create pipe: %s", err)
+	}
+	os.Stdout = w
+	if err := setupCliApp().Run([]string{"gobeat", "--quiet", "user"}); err != nil {
+		t.Fatalf("Expected the command to run: %s", err)
+	}
+	w.Close()
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("Could not read output: %s", err)
+	}
+	if len(b) != 0 {
+		t.Fatalf("Expected no output in quiet mode, got %q", b)
 	}
 }
 
@@ -33,7 +81,7 @@ func TestPostResult(t *testing.T) {
 		if err != nil {
 			t.Fatalf("Expected body to read cleanly: %s", err)
 		}
-		if string(b) != fmt.Sprintf("alex beat %s at ping pong with score %s",
+		if string(b) != fmt.Sprintf("🏓 alex beat %s at ping pong with score %s",
 			opponent, score) {
 			t.Fatalf("Oleg definitely didn't beat Alex.")
 		}
@@ -49,7 +97,17 @@ func TestPostResult(t *testing.T) {
 
 	mockSettingsFile(t, u.String())
 
-	if err := postResult(u, opponent, score); err != nil {
+	msg, err := formatResult(newAnnouncement(&matchResult{
+		Player:   settings.User,
+		Opponent: opponent,
+		Game:     settings.Game,
+		Score:    score,
+		Won:      true,
+	}, nil), nil)
+	if err != nil {
+		t.Fatalf("Expected result to format cleanly: %s", err)
+	}
+	if err := postResult(u, "", msg, true); err != nil {
 		t.Fatalf("Expected a clean post: %s", err)
 	}
 }
@@ -65,16 +123,99 @@ func TestRetrieveSettings(t *testing.T) {
 	if settings.TargetURL != uStr {
 		t.Fatal("Did not retrieve correct settings.")
 	}
+
+	// The client ID is made once and then kept.
+	id := settings.ClientID
+	if id == "" {
+		t.Fatal("Expected a client ID to be generated.")
+	}
+	settings, err = retrieveSettings()
+	if err != nil {
+		t.Fatalf("Could not retrieve settings: %s", err)
+	}
+	if settings.ClientID != id {
+		t.Fatal("Expected the client ID to be stable between runs.")
+	}
 }
 
-func mockSettingsFile(t *testing.T, url string) {
+func mockSettingsFile(t testing.TB, url string) {
 	gobeatPath = filepath.Join(os.TempDir(), "mockgobeatsettings")
 	settings = &gobeatSettings{
 		User:      "alex",
 		TargetURL: url,
 		Game:      "ping pong",
+		// Retry failed deliveries without slowing the tests down.
+		Backoff: "1ms",
 	}
 	if err := settings.save(); err != nil {
 		t.Fatalf("Could not save settings: %s", err)
 	}
+
+	// Start with a closed breaker, nothing queued, drafted or awaiting
+	// approval, no interrupted import, nothing synced or read by the
+	// Telegram bot and no credentials for the target.
+	breakerPath = filepath.Join(os.TempDir(), "mockgobeatbreaker")
+	pendingPath = filepath.Join(os.TempDir(), "mockgobeatpending")
+	importCheckpointPath = filepath.Join(os.TempDir(), "mockgobeatimport")
+	outboxPath = filepath.Join(os.TempDir(), "mockgobeatoutbox")
+	awaitingPath = filepath.Join(os.TempDir(), "mockgobeatawaiting")
+	syncPath = filepath.Join(os.TempDir(), "mockgobeatsync")
+	telegramPath = filepath.Join(os.TempDir(), "mockgobeattelegram")
+	os.Remove(breakerPath)
+	os.Remove(pendingPath)
+	os.Remove(importCheckpointPath)
+	os.Remove(outboxPath)
+	os.Remove(awaitingPath)
+	os.Remove(syncPath)
+	os.Remove(telegramPath)
+
+	credentialsPath = filepath.Join(os.TempDir(), "mockgobeatcredentials")
+	os.Remove(credentialsPath)
+}
+
+func TestResultFlagsAfterArgs(t *testing.T) {
+	ts, posted := mockTarget(t)
+	defer ts.Close()
+	mockHistoryFile(t)
+	stdout := os.Stdout
+	defer func() { os.Stdout = stdout }()
+
+	args := []string{"gobeat", "--quiet", "result", "oleg", "21-15", "--tags", "zzz", "--lost"}
+	if err := setupCliApp().Run(args); err != nil {
+		t.Fatalf("Expected the result to be recorded: %s", err)
+	}
+	if got := posted(); len(got) != 1 || !strings.Contains(got[0], "#zzz") {
+		t.Fatalf("Expected the post to carry the tags given after the score, got %v", got)
+	}
+	h, err := retrieveHistory()
+	if err != nil {
+		t.Fatalf("Could not retrieve history: %s", err)
+	}
+	if len(h.Results) != 1 || h.Results[0].Won {
+		t.Fatal("Expected --lost after the score to record a loss.")
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".gobeat_secret")
+	if err := ioutil.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatalf("Could not write file: %s", err)
+	}
+	if err := writeFileAtomic(path, []byte("new"), 0600); err != nil {
+		t.Fatalf("Expected a clean write: %s", err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Could not stat file: %s", err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Fatalf("Expected the new permissions to apply, got %v", fi.Mode().Perm())
+	}
+	if b, _ := ioutil.ReadFile(path); string(b) != "new" {
+		t.Fatalf("Expected the file to be replaced, got %q", b)
+	}
+	if entries, _ := ioutil.ReadDir(dir); len(entries) != 1 {
+		t.Fatalf("Expected no temporary file left behind, got %d files", len(entries))
+	}
 }
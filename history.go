@@ -0,0 +1,469 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codegangsta/cli"
+)
+
+const historyFile = ".gobeat_history"
+
+// historyPath is the full path to where the gobeat match history resides.
+var historyPath = filepath.Join(os.Getenv("HOME"), historyFile)
+
+// matchResult is a single recorded match.
+type matchResult struct {
+	// ID uniquely identifies the result.
+	ID string `json:"id"`
+
+	// Player is the user who recorded the result.
+	Player string `json:"player"`
+
+	// Opponent is who Player played against.
+	Opponent string `json:"opponent"`
+
+	// Partner is Player's teammate in a doubles match.
+	Partner string `json:"partner,omitempty"`
+
+	// OpponentPartner is Opponent's teammate in a doubles match.
+	OpponentPartner string `json:"opponent_partner,omitempty"`
+
+	// Game is the game that was played.
+	Game string `json:"game"`
+
+	// Score is the score as entered, from Player's point of view.
+	Score string `json:"score"`
+
+	// Won is whether Player won the match.
+	Won bool `json:"won"`
+
+	// Handicap is how many points Opponent spotted Player, or if negative, how
+	// many Player spotted Opponent.
+	Handicap int `json:"handicap,omitempty"`
+
+	// DurationSeconds is how long the match took, if known.
+	DurationSeconds int `json:"duration_seconds,omitempty"`
+
+	// Note is anything worth remembering about the match, as given with
+	// 'gobeat result --note'.
+	Note string `json:"note,omitempty"`
+
+	// Message is the announcement delivered for the match.
+	Message string `json:"message,omitempty"`
+
+	// Unannounced is whether the result was recorded on the target without
+	// being announced, as with 'gobeat result --no-post'.
+	Unannounced bool `json:"unannounced,omitempty"`
+
+	// Identified is whether the result was posted to the target along with
+	// its ID, which the target needs to correct or delete it.
+	Identified bool `json:"identified,omitempty"`
+
+	// Unsynced is whether the result never reached the target, as for one
+	// imported or recorded with no target set, so 'gobeat sync' pushes it.
+	Unsynced bool `json:"unsynced,omitempty"`
+
+	// Date is when the result was recorded.
+	Date time.Time `json:"date"`
+
+	// Updated is when the result was last corrected, if it has been, for
+	// settling which copy of it is newest when syncing.
+	Updated *time.Time `json:"updated_at,omitempty"`
+}
+
+// lastChanged returns when r was last recorded or corrected.
+func (r *matchResult) lastChanged() time.Time {
+	if r.Updated != nil {
+		return *r.Updated
+	}
+	return r.Date
+}
+
+// sameMatch reports whether r and other describe the same match in the same
+// way, ignoring how and where they were delivered.
+func (r *matchResult) sameMatch(other *matchResult) bool {
+	return r.Player == other.Player && r.Opponent == other.Opponent &&
+		r.Partner == other.Partner && r.OpponentPartner == other.OpponentPartner &&
+		r.Game == other.Game && r.Score == other.Score && r.Won == other.Won &&
+		r.Handicap == other.Handicap && r.DurationSeconds == other.DurationSeconds &&
+		r.Note == other.Note && r.Date.Equal(other.Date)
+}
+
+// newMatchResult creates a result for the current user against opponent,
+// checking score against the rules of the current game. It is left
+// unannounced if that is the configured default.
+func newMatchResult(opponent, score string, won bool) (*matchResult, error) {
+	if err := settings.gameDef(settings.Game).validate(score, won); err != nil {
+		return nil, err
+	}
+	id, err := newResultID()
+	if err != nil {
+		return nil, err
+	}
+	return &matchResult{
+		ID:       id,
+		Player:   settings.User,
+		Opponent: opponent,
+		Game:     settings.Game,
+		Score:    score,
+		Won:      won,
+		Date:     time.Now(),
+
+		Unannounced: settings.NoPost,
+	}, nil
+}
+
+// duration returns how long r took, or zero if unknown.
+func (r *matchResult) duration() time.Duration {
+	return time.Duration(r.DurationSeconds) * time.Second
+}
+
+// setDuration records how long r took, to the second.
+func (r *matchResult) setDuration(d time.Duration) {
+	r.DurationSeconds = int((d + time.Second/2) / time.Second)
+}
+
+// doubles reports whether r was a doubles match.
+func (r *matchResult) doubles() bool {
+	return r.Partner != "" || r.OpponentPartner != ""
+}
+
+// team returns Player and their partner, if any.
+func (r *matchResult) team() []string {
+	if r.Partner == "" {
+		return []string{r.Player}
+	}
+	return []string{r.Player, r.Partner}
+}
+
+// opponentTeam returns Opponent and their partner, if any.
+func (r *matchResult) opponentTeam() []string {
+	if r.OpponentPartner == "" {
+		return []string{r.Opponent}
+	}
+	return []string{r.Opponent, r.OpponentPartner}
+}
+
+// winners returns the winning and losing teams of r, and its score ordered to
+// match, e.g. "21-15" for a loss recorded as "15-21".
+func (r *matchResult) winners() (winners, losers []string, score string) {
+	if r.Won {
+		return r.team(), r.opponentTeam(), r.Score
+	}
+	score = r.Score
+	if a, b, ok := parsePoints(r.Score); ok {
+		score = strconv.Itoa(b) + "-" + strconv.Itoa(a)
+	}
+	return r.opponentTeam(), r.team(), score
+}
+
+// players returns everyone who played in r.
+func (r *matchResult) players() []string {
+	return append(r.team(), r.opponentTeam()...)
+}
+
+// newResultID returns a random identifier for a result, long enough that
+// results recorded on different machines and merged by sync don't collide.
+func newResultID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// gobeatHistory is marshalled to disk to keep a record of every result.
+type gobeatHistory struct {
+	// Results are ordered from oldest to newest.
+	Results []*matchResult `json:"results"`
+
+	// Achievements are the achievements earned by each player.
+	Achievements map[string][]*achievement `json:"achievements,omitempty"`
+
+	// Pruned summarizes the results removed by 'gobeat history prune'. It is
+	// nil if none have been.
+	Pruned *historySummary `json:"pruned,omitempty"`
+
+	// full is the history this one was filtered from, if any; see filter.
+	full *gobeatHistory
+}
+
+// retrieveHistory attempts to load the match history, contained in
+// '~/.gobeat_history' by default. A missing file yields an empty history.
+func retrieveHistory() (*gobeatHistory, error) {
+	h := new(gobeatHistory)
+	b, err := ioutil.ReadFile(historyPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return h, nil
+		}
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, h); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// add appends a result to the history.
+func (h *gobeatHistory) add(r *matchResult) {
+	h.Results = append(h.Results, r)
+}
+
+// find returns the result with id, or nil if there is none.
+func (h *gobeatHistory) find(id string) *matchResult {
+	for _, r := range h.Results {
+		if r.ID == id {
+			return r
+		}
+	}
+	return nil
+}
+
+// remove removes the result with id from the history, along with any
+// achievements earned with it.
+func (h *gobeatHistory) remove(id string) {
+	results := h.Results[:0]
+	for _, cur := range h.Results {
+		if cur.ID != id {
+			results = append(results, cur)
+		}
+	}
+	h.Results = results
+	for player, achievements := range h.Achievements {
+		var keep []*achievement
+		for _, a := range achievements {
+			if a.ResultID != id {
+				keep = append(keep, a)
+			}
+		}
+		h.Achievements[player] = keep
+	}
+}
+
+// playedDoubles reports whether player has any doubles results.
+func (h *gobeatHistory) playedDoubles(player string) bool {
+	for _, r := range h.Results {
+		if r.doubles() && r.Player == player {
+			return true
+		}
+	}
+	return h.Pruned.playedDoubles(player)
+}
+
+// streak returns the number of consecutive wins player has going into their
+// most recent result. It is zero if their last result was a loss.
+func (h *gobeatHistory) streak(player string) int {
+	n := 0
+	for i := len(h.Results) - 1; i >= 0; i-- {
+		r := h.Results[i]
+		if r.Player != player {
+			continue
+		}
+		if !r.Won {
+			return n
+		}
+		n++
+	}
+	return n + h.Pruned.streak(player).Current
+}
+
+// save saves to disk the history file in '~/.gobeat_history'.
+func (h *gobeatHistory) save() error {
+	b, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(historyPath, b, 0644)
+}
+
+// historyPageSize is how many results a page of history holds by default.
+const historyPageSize = 20
+
+// historySortKeys are the orders the history can be listed in.
+var historySortKeys = []sortKey{
+	{name: "date"},
+	{name: "opponent", asc: true},
+	{name: "margin"},
+}
+
+// sorted returns the results newest first, or ordered by key if it is not
+// "date", most recent first among ties.
+func (h *gobeatHistory) sorted(key string, asc bool) []*matchResult {
+	out := make([]*matchResult, 0, len(h.Results))
+	for i := len(h.Results) - 1; i >= 0; i-- {
+		out = append(out, h.Results[i])
+	}
+	switch key {
+	case "date":
+		sortBy(out, asc, func(i, j int) bool { return out[i].Date.Before(out[j].Date) })
+	case "opponent":
+		sortBy(out, asc, func(i, j int) bool { return out[i].Opponent < out[j].Opponent })
+	case "margin":
+		// Parsed once up front rather than on every comparison.
+		margins := make(map[*matchResult]int, len(out))
+		for _, r := range out {
+			margins[r], _ = r.margin()
+		}
+		sortBy(out, asc, func(i, j int) bool { return margins[out[i]] < margins[out[j]] })
+	}
+	return out
+}
+
+// page returns page (counting from 1) of the results, newest first, with
+// limit results to a page. It is empty past the last page.
+func (h *gobeatHistory) page(page, limit int) []*matchResult {
+	return pageOf(h.sorted("date", false), page, limit)
+}
+
+// pageOf returns page (counting from 1) of results with limit results to a
+// page. It is empty past the last page.
+func pageOf(results []*matchResult, page, limit int) []*matchResult {
+	start := (page - 1) * limit
+	if page < 1 || start >= len(results) {
+		return nil
+	}
+	end := start + limit
+	if end > len(results) {
+		end = len(results)
+	}
+	return results[start:end]
+}
+
+// pages returns how many pages of limit results the history fills.
+func (h *gobeatHistory) pages(limit int) int {
+	return (len(h.Results) + limit - 1) / limit
+}
+
+// pageHistory shows results a page at a time on out, reading a key from in
+// after each page: q stops, anything else shows the next page.
+func pageHistory(results []*matchResult, in io.Reader, out io.Writer, limit int) error {
+	r := bufio.NewReader(in)
+	pages := (len(results) + limit - 1) / limit
+	for page := 1; page <= pages; page++ {
+		for _, m := range pageOf(results, page, limit) {
+			fmt.Fprintln(out, formatHistoryLine(m))
+		}
+		if page == pages {
+			break
+		}
+		fmt.Fprintf(out, "-- page %d of %d, q to quit, any other key for more --",
+			page, pages)
+		b, err := r.ReadByte()
+		fmt.Fprint(out, "\r\x1b[K")
+		if err == io.EOF || b == 'q' {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// historyCommand returns the 'gobeat history' command.
+func historyCommand() cli.Command {
+	return cli.Command{
+		Name:      "history",
+		ShortName: "hi",
+		Description: "`history` lists recorded results, newest first, a page at a time " +
+			"in a terminal, or prunes old results into an archive.",
+		Usage: "history [--page n] [--limit n] [--sort key] [--order asc|desc] [filters]",
+		Flags: append(append([]cli.Flag{
+			cli.StringFlag{Name: "page", Usage: "only list this page, counting from 1"},
+			cli.StringFlag{
+				Name:  "limit",
+				Usage: fmt.Sprintf("results to a page (default %d)", historyPageSize),
+			},
+		}, sortFlags(historySortKeys)...), filterFlags()...),
+		Action: func(c *cli.Context) {
+			key, asc, err := parseSort(c, historySortKeys)
+			if err != nil {
+				printError(err)
+			}
+			f, err := parseFilter(c)
+			if err != nil {
+				printError(err)
+			}
+			h, err := retrieveHistory()
+			if err != nil {
+				printError(err)
+			}
+			if len(h.Results) == 0 {
+				fmt.Println("No results recorded yet.")
+				return
+			}
+			if h = h.filter(f); len(h.Results) == 0 {
+				fmt.Println("No matching results.")
+				return
+			}
+			results := h.sorted(key, asc)
+
+			limit := historyPageSize
+			if c.String("limit") != "" {
+				if limit, err = strconv.Atoi(c.String("limit")); err != nil || limit < 1 {
+					printError(fmt.Errorf("--limit must be a positive integer."))
+				}
+			}
+			if c.String("page") != "" || c.String("limit") != "" {
+				page := 1
+				if c.String("page") != "" {
+					if page, err = strconv.Atoi(c.String("page")); err != nil || page < 1 {
+						printError(fmt.Errorf("--page must be a positive integer."))
+					}
+				}
+				if page > h.pages(limit) {
+					printError(fmt.Errorf("there are only %d pages.", h.pages(limit)))
+				}
+				for _, r := range pageOf(results, page, limit) {
+					fmt.Println(formatHistoryLine(r))
+				}
+				fmt.Printf("Page %d of %d\n", page, h.pages(limit))
+				return
+			}
+
+			if !isTerminal(os.Stdout) || !isTerminal(os.Stdin) {
+				for _, r := range results {
+					fmt.Println(formatHistoryLine(r))
+				}
+				return
+			}
+			restore, err := rawInput(os.Stdin)
+			if err != nil {
+				printError(err)
+			}
+			err = pageHistory(results, os.Stdin, os.Stdout, limit)
+			restore()
+			if err != nil {
+				printError(err)
+			}
+		},
+		Subcommands: []cli.Command{
+			historyPruneCommand(),
+		},
+	}
+}
+
+// formatHistoryLine formats a result for the history listing.
+func formatHistoryLine(r *matchResult) string {
+	wl := "W"
+	if !r.Won {
+		wl = "L"
+	}
+	return fmt.Sprintf("%s  %s  %s  %s vs %s  %s  (%s)", r.ID,
+		r.Date.Format("2006-01-02"), outcome(r.Won, wl), strings.Join(r.team(), " & "),
+		strings.Join(r.opponentTeam(), " & "), r.Score, r.Game)
+}
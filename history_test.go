@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistoryRoundTrip(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	h := mockHistoryFile(t)
+
+	r, err := newMatchResult("oleg", "21-15", true)
+	if err != nil {
+		t.Fatalf("Could not create result: %s", err)
+	}
+	h.add(r)
+	if err := h.save(); err != nil {
+		t.Fatalf("Could not save history: %s", err)
+	}
+
+	h, err = retrieveHistory()
+	if err != nil {
+		t.Fatalf("Could not retrieve history: %s", err)
+	}
+	if len(h.Results) != 1 || h.Results[0].ID != r.ID {
+		t.Fatal("Did not retrieve saved result.")
+	}
+}
+
+func TestStreak(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	h := mockHistoryFile(t)
+
+	for _, won := range []bool{true, false, true, true, true} {
+		r, err := newMatchResult("oleg", "21-15", won)
+		if err != nil {
+			t.Fatalf("Could not create result: %s", err)
+		}
+		h.add(r)
+	}
+	h.add(&matchResult{Player: "oleg", Opponent: "alex"})
+
+	if n := h.streak("alex"); n != 3 {
+		t.Fatalf("Expected a streak of 3, got %d", n)
+	}
+	if n := h.streak("oleg"); n != 0 {
+		t.Fatalf("Expected oleg to have no streak, got %d", n)
+	}
+}
+
+func TestHistoryPages(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	h := mockHistoryFile(t)
+	for i := 1; i <= 5; i++ {
+		h.add(&matchResult{ID: strconv.Itoa(i), Player: "alex", Opponent: "oleg"})
+	}
+
+	if h.pages(2) != 3 {
+		t.Fatalf("Expected 3 pages of 2, got %d", h.pages(2))
+	}
+	if p := h.page(1, 2); len(p) != 2 || p[0].ID != "5" || p[1].ID != "4" {
+		t.Fatalf("Expected the newest results first, got %v", p)
+	}
+	if p := h.page(3, 2); len(p) != 1 || p[0].ID != "1" {
+		t.Fatalf("Expected a short last page, got %v", p)
+	}
+	if p := h.page(4, 2); len(p) != 0 {
+		t.Fatalf("Expected nothing past the last page, got %v", p)
+	}
+
+	var out bytes.Buffer
+	if err := pageHistory(h.sorted("date", false), strings.NewReader(" q"), &out, 2); err != nil {
+		t.Fatalf("Expected clean paging: %s", err)
+	}
+	if !strings.Contains(out.String(), "page 2 of 3") || strings.Contains(out.String(), "  1  ") {
+		t.Fatalf("Expected paging to stop after two pages, got %q", out.String())
+	}
+}
+
+func TestHistorySorted(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	h := mockHistoryFile(t)
+	start := time.Date(2014, 4, 24, 12, 0, 0, 0, time.UTC)
+	h.add(&matchResult{ID: "1", Opponent: "oleg", Score: "21-19", Date: start})
+	h.add(&matchResult{ID: "2", Opponent: "ivan", Score: "21-5", Date: start.Add(time.Hour)})
+	h.add(&matchResult{ID: "3", Opponent: "oleg", Score: "21-10", Date: start.Add(2 * time.Hour)})
+
+	ids := func(results []*matchResult) string {
+		var s string
+		for _, r := range results {
+			s += r.ID
+		}
+		return s
+	}
+	if got := ids(h.sorted("date", false)); got != "321" {
+		t.Fatalf("Expected newest first, got %s", got)
+	}
+	if got := ids(h.sorted("date", true)); got != "123" {
+		t.Fatalf("Expected oldest first, got %s", got)
+	}
+	if got := ids(h.sorted("opponent", true)); got != "231" {
+		t.Fatalf("Expected by opponent, newest first among ties, got %s", got)
+	}
+	if got := ids(h.sorted("margin", false)); got != "231" {
+		t.Fatalf("Expected biggest margins first, got %s", got)
+	}
+}
+
+func mockHistoryFile(t testing.TB) *gobeatHistory {
+	historyPath = filepath.Join(os.TempDir(), "mockgobeathistory")
+	if err := os.Remove(historyPath); err != nil && !os.IsNotExist(err) {
+		t.Fatalf("Could not remove history: %s", err)
+	}
+	return new(gobeatHistory)
+}
+
+func TestWinners(t *testing.T) {
+	r := &matchResult{Player: "alex", Partner: "ivan", Opponent: "oleg", Score: "15-21"}
+	winners, losers, score := r.winners()
+	if len(winners) != 1 || winners[0] != "oleg" || len(losers) != 2 || score != "21-15" {
+		t.Fatalf("Expected oleg to win 21-15, got %v %v %s", winners, losers, score)
+	}
+	r.Won = true
+	if winners, _, score := r.winners(); winners[0] != "alex" || score != "15-21" {
+		t.Fatalf("Expected alex's team to win as recorded, got %v %s", winners, score)
+	}
+}
+
+// benchmarkHistorySize is the number of results in histories for benchmarks,
+// the size of a busy league after a few years.
+const benchmarkHistorySize = 20000
+
+// mockLargeHistory returns a history of n singles results between the
+// current user and 40 opponents, an hour apart.
+func mockLargeHistory(t testing.TB, n int) *gobeatHistory {
+	h := mockHistoryFile(t)
+	start := time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < n; i++ {
+		h.add(&matchResult{
+			ID:       strconv.Itoa(i),
+			Player:   settings.User,
+			Opponent: "player" + strconv.Itoa(i%40),
+			Game:     settings.Game,
+			Won:      i%3 != 0,
+			Score:    "21-" + strconv.Itoa(i%20),
+			Date:     start.Add(time.Duration(i) * time.Hour),
+		})
+	}
+	return h
+}
+
+func BenchmarkRetrieveHistory(b *testing.B) {
+	mockSettingsFile(b, "foo.gov")
+	if err := mockLargeHistory(b, benchmarkHistorySize).save(); err != nil {
+		b.Fatalf("Could not save history: %s", err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := retrieveHistory(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkHistorySorted(b *testing.B) {
+	mockSettingsFile(b, "foo.gov")
+	h := mockLargeHistory(b, benchmarkHistorySize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pageOf(h.sorted("margin", false), 1, historyPageSize)
+	}
+}
+
+func TestNewResultID(t *testing.T) {
+	a, err := newResultID()
+	if err != nil {
+		t.Fatalf("Could not make an ID: %s", err)
+	}
+	b, _ := newResultID()
+	if len(a) != 32 || a == b {
+		t.Fatalf("Expected distinct 128-bit IDs, got %q and %q", a, b)
+	}
+}
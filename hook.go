@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+
+	"github.com/codegangsta/cli"
+)
+
+// hookSettings holds shell commands run around recording a result.
+type hookSettings struct {
+	// PreResult runs before a result is delivered. If it fails, the result is
+	// not recorded.
+	PreResult string `json:"pre_result,omitempty"`
+
+	// PostResult runs once a result has been recorded.
+	PostResult string `json:"post_result,omitempty"`
+}
+
+// hookEnv returns the environment a hook runs with: the current environment
+// plus the details of r.
+func hookEnv(r *matchResult, msg string) []string {
+	return append(os.Environ(),
+		"GOBEAT_RESULT_ID="+r.ID,
+		"GOBEAT_PLAYER="+r.Player,
+		"GOBEAT_OPPONENT="+r.Opponent,
+		"GOBEAT_PARTNER="+r.Partner,
+		"GOBEAT_OPPONENT_PARTNER="+r.OpponentPartner,
+		"GOBEAT_GAME="+r.Game,
+		"GOBEAT_SCORE="+r.Score,
+		"GOBEAT_WON="+strconv.FormatBool(r.Won),
+		"GOBEAT_MESSAGE="+msg,
+	)
+}
+
+// runHook runs command with sh, if it is set, with the details of r in its
+// environment.
+func runHook(name, command string, r *matchResult, msg string) error {
+	if command == "" {
+		return nil
+	}
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Env = hookEnv(r, msg)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s hook failed: %s", name, err)
+	}
+	return nil
+}
+
+// pre runs the pre_result hook, if configured. h may be nil.
+func (h *hookSettings) pre(r *matchResult, msg string) error {
+	if h == nil {
+		return nil
+	}
+	return runHook("pre_result", h.PreResult, r, msg)
+}
+
+// post runs the post_result hook, if configured. h may be nil.
+func (h *hookSettings) post(r *matchResult, msg string) error {
+	if h == nil {
+		return nil
+	}
+	return runHook("post_result", h.PostResult, r, msg)
+}
+
+// hooksCommand returns the 'gobeat hooks' command.
+func hooksCommand() cli.Command {
+	return cli.Command{
+		Name: "hooks",
+		Description: "`hooks` sets shell commands run before and after a result is " +
+			"recorded. The result is passed in GOBEAT_* environment variables, " +
+			"e.g. GOBEAT_WON and GOBEAT_OPPONENT.",
+		Usage: "hooks [--pre command] [--post command]",
+		Flags: []cli.Flag{
+			cli.StringFlag{Name: "pre", Usage: "command run before a result is posted"},
+			cli.StringFlag{Name: "post", Usage: "command run after a result is recorded"},
+			cli.BoolFlag{Name: "clear", Usage: "remove both hooks"},
+		},
+		Action: func(c *cli.Context) {
+			if c.Bool("clear") {
+				settings.Hooks = nil
+			} else if c.String("pre") == "" && c.String("post") == "" {
+				printHooks()
+				return
+			} else {
+				if settings.Hooks == nil {
+					settings.Hooks = new(hookSettings)
+				}
+				if c.String("pre") != "" {
+					settings.Hooks.PreResult = c.String("pre")
+				}
+				if c.String("post") != "" {
+					settings.Hooks.PostResult = c.String("post")
+				}
+			}
+			printHooks()
+
+			if err := settings.save(); err != nil {
+				printError(err)
+			}
+		},
+	}
+}
+
+// printHooks prints the configured hooks.
+func printHooks() {
+	h := settings.Hooks
+	if h == nil {
+		h = new(hookSettings)
+	}
+	fmt.Printf("pre_result:  %s\n", h.PreResult)
+	fmt.Printf("post_result: %s\n", h.PostResult)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHooks(t *testing.T) {
+	ts, posted := mockTarget(t)
+	defer ts.Close()
+	mockHistoryFile(t)
+
+	dir, err := ioutil.TempDir("", "gobeat_hooks")
+	if err != nil {
+		t.Fatalf("Could not create directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "out")
+
+	settings.Hooks = &hookSettings{
+		PostResult: `echo "$GOBEAT_OPPONENT $GOBEAT_WON" > ` + out,
+	}
+	r, err := newMatchResult("oleg", "21-15", true)
+	if err != nil {
+		t.Fatalf("Could not create result: %s", err)
+	}
+	if _, err := recordResult(r, nil); err != nil {
+		t.Fatalf("Expected a clean record: %s", err)
+	}
+	b, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatalf("Expected the post hook to run: %s", err)
+	}
+	if strings.TrimSpace(string(b)) != "oleg true" {
+		t.Fatalf("Expected result details in the environment, got %q", b)
+	}
+
+	settings.Hooks.PreResult = "exit 1"
+	n := len(posted())
+	if _, err := recordResult(r, nil); err == nil {
+		t.Fatal("Expected a failing pre hook to stop the result.")
+	}
+	if len(posted()) != n {
+		t.Fatal("Expected nothing to be posted after the pre hook failed.")
+	}
+}
@@ -0,0 +1,556 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codegangsta/cli"
+)
+
+// importer parses results exported from another application.
+type importer func(r io.Reader, game string) ([]*matchResult, error)
+
+// importers are the supported import formats, keyed by the name passed to
+// 'gobeat import --from'.
+var importers = map[string]importer{
+	"csv":       importCSV,
+	"challonge": importChallonge,
+}
+
+// importDateLayouts are the date formats accepted in imported files.
+var importDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	"01/02/2006",
+}
+
+// parseImportDate parses a date in any of importDateLayouts.
+func parseImportDate(s string) (time.Time, error) {
+	for _, layout := range importDateLayouts {
+		if t, err := time.Parse(layout, strings.TrimSpace(s)); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized date %q", s)
+}
+
+// importStream yields imported results one at a time, returning io.EOF after
+// the last.
+type importStream func() (*matchResult, error)
+
+// sliceStream returns a stream of results.
+func sliceStream(results []*matchResult) importStream {
+	return func() (*matchResult, error) {
+		if len(results) == 0 {
+			return nil, io.EOF
+		}
+		r := results[0]
+		results = results[1:]
+		return r, nil
+	}
+}
+
+// importCSV parses a generic Elo league CSV export. The first row must be a
+// header naming the columns, in any order: either "winner" and "loser" (with
+// optional "winner_score" and "loser_score"), or "player1" and "player2"
+// (with "score1" and "score2"). "date" is required and "game" is optional.
+func importCSV(r io.Reader, game string) ([]*matchResult, error) {
+	next, err := csvStream(r, game)
+	if err != nil {
+		return nil, err
+	}
+	var results []*matchResult
+	for {
+		m, err := next()
+		if err == io.EOF {
+			return results, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, m)
+	}
+}
+
+// csvStream returns a stream of the results in a CSV export (see importCSV),
+// reading r a row at a time so that large files need not fit in memory.
+func csvStream(r io.Reader, game string) (importStream, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	cr.ReuseRecord = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	cols := make(map[string]int)
+	for i, name := range header {
+		cols[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := cols["date"]; !ok {
+		return nil, fmt.Errorf("csv is missing a date column")
+	}
+
+	playerCol, opponentCol := "winner", "loser"
+	playerScoreCol, opponentScoreCol := "winner_score", "loser_score"
+	if _, ok := cols["winner"]; !ok {
+		playerCol, opponentCol = "player1", "player2"
+		playerScoreCol, opponentScoreCol = "score1", "score2"
+	}
+	for _, col := range []string{playerCol, opponentCol} {
+		if _, ok := cols[col]; !ok {
+			return nil, fmt.Errorf("csv is missing a %s column", col)
+		}
+	}
+
+	line := 1
+	return func() (*matchResult, error) {
+		line++
+		row, err := cr.Read()
+		if err != nil {
+			return nil, err
+		}
+		field := func(col string) string {
+			if i, ok := cols[col]; ok && i < len(row) {
+				return strings.TrimSpace(row[i])
+			}
+			return ""
+		}
+
+		date, err := parseImportDate(field("date"))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+		m := &matchResult{
+			Player:   field(playerCol),
+			Opponent: field(opponentCol),
+			Game:     game,
+			Won:      true,
+			Date:     date,
+		}
+		if g := field("game"); g != "" {
+			m.Game = g
+		}
+
+		pScore, oScore := field(playerScoreCol), field(opponentScoreCol)
+		if pScore != "" && oScore != "" {
+			m.Score = pScore + "-" + oScore
+			if playerCol == "player1" {
+				p, err1 := strconv.Atoi(pScore)
+				o, err2 := strconv.Atoi(oScore)
+				if err1 != nil || err2 != nil {
+					return nil, fmt.Errorf("line %d: scores must be numbers", line)
+				}
+				m.Won = p > o
+			}
+		}
+		return m, nil
+	}, nil
+}
+
+// challongeExport is the JSON returned by Challonge's tournament API with
+// participants and matches included.
+type challongeExport struct {
+	Tournament struct {
+		Participants []struct {
+			Participant struct {
+				ID   int    `json:"id"`
+				Name string `json:"name"`
+			} `json:"participant"`
+		} `json:"participants"`
+		Matches []struct {
+			Match struct {
+				State       string `json:"state"`
+				Player1ID   int    `json:"player1_id"`
+				Player2ID   int    `json:"player2_id"`
+				WinnerID    int    `json:"winner_id"`
+				ScoresCSV   string `json:"scores_csv"`
+				CompletedAt string `json:"completed_at"`
+			} `json:"match"`
+		} `json:"matches"`
+	} `json:"tournament"`
+}
+
+// importChallonge parses a Challonge tournament export. Only completed
+// matches are imported, from the point of view of player 1.
+func importChallonge(r io.Reader, game string) ([]*matchResult, error) {
+	var export challongeExport
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return nil, err
+	}
+
+	names := make(map[int]string)
+	for _, p := range export.Tournament.Participants {
+		names[p.Participant.ID] = p.Participant.Name
+	}
+
+	var results []*matchResult
+	for _, wrapped := range export.Tournament.Matches {
+		m := wrapped.Match
+		if m.State != "complete" {
+			continue
+		}
+		date, err := parseImportDate(m.CompletedAt)
+		if err != nil {
+			return nil, err
+		}
+		p1, ok1 := names[m.Player1ID]
+		p2, ok2 := names[m.Player2ID]
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("match references an unknown participant")
+		}
+		results = append(results, &matchResult{
+			Player:   p1,
+			Opponent: p2,
+			Game:     game,
+			Score:    m.ScoresCSV,
+			Won:      m.WinnerID == m.Player1ID,
+			Date:     date,
+		})
+	}
+	return results, nil
+}
+
+// matchKey identifies the match r records, ignoring its ID, so that
+// duplicates can be found.
+func matchKey(r *matchResult) string {
+	return strings.Join([]string{r.Date.UTC().Format(time.RFC3339Nano), r.Player,
+		r.Opponent, r.Game, r.Score}, "\x00")
+}
+
+// importBatch is how many rows an import reads between reporting progress and
+// saving a checkpoint to resume from.
+const importBatch = 5000
+
+// importRun configures an import.
+type importRun struct {
+	// Skip is how many rows to skip, because an interrupted import already
+	// added them.
+	Skip int
+
+	// DryRun counts what would be imported without changing the history.
+	DryRun bool
+
+	// Progress, if set, is called with the number of rows read every
+	// importBatch rows.
+	Progress func(rows int)
+
+	// Checkpoint, if set, is called with the number of rows read every
+	// importBatch rows, once everything up to them is in the history.
+	Checkpoint func(rows int) error
+}
+
+// importSummary reports what an import did, or would do.
+type importSummary struct {
+	// Rows is how many rows were read, including those skipped.
+	Rows int
+
+	Added      int
+	Duplicates int
+
+	// First and Last are the dates of the earliest and latest results read.
+	First, Last time.Time
+}
+
+// importFrom adds the results from next to the history, skipping any already
+// recorded, and keeps the history in date order.
+func (h *gobeatHistory) importFrom(next importStream, run *importRun) (*importSummary, error) {
+	seen := make(map[string]bool, len(h.Results))
+	for _, r := range h.Results {
+		seen[matchKey(r)] = true
+	}
+
+	s := new(importSummary)
+	for {
+		r, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return s, err
+		}
+		s.Rows++
+		if s.Rows <= run.Skip {
+			continue
+		}
+		if s.First.IsZero() || r.Date.Before(s.First) {
+			s.First = r.Date
+		}
+		if r.Date.After(s.Last) {
+			s.Last = r.Date
+		}
+
+		if key := matchKey(r); seen[key] {
+			s.Duplicates++
+		} else {
+			seen[key] = true
+			s.Added++
+			if !run.DryRun {
+				id, err := newResultID()
+				if err != nil {
+					return s, err
+				}
+				r.ID = id
+				r.Unsynced = true
+				h.add(r)
+			}
+		}
+
+		if s.Rows%importBatch != 0 {
+			continue
+		}
+		if run.Progress != nil {
+			run.Progress(s.Rows)
+		}
+		if run.Checkpoint != nil && !run.DryRun {
+			sort.Stable(byDate(h.Results))
+			if err := run.Checkpoint(s.Rows); err != nil {
+				return s, err
+			}
+		}
+	}
+	if !run.DryRun {
+		sort.Stable(byDate(h.Results))
+	}
+	return s, nil
+}
+
+// importResults adds results to the history, skipping any already recorded,
+// and keeps the history in date order. It returns how many were added.
+func (h *gobeatHistory) importResults(results []*matchResult) (int, error) {
+	s, err := h.importFrom(sliceStream(results), &importRun{})
+	return s.Added, err
+}
+
+const importCheckpointFile = ".gobeat_import"
+
+// importCheckpointPath is the full path to where the progress of an
+// interrupted import resides.
+var importCheckpointPath = filepath.Join(os.Getenv("HOME"), importCheckpointFile)
+
+// importCheckpoint is how far an import of a file got.
+type importCheckpoint struct {
+	// File, Size and ModTime identify the file being imported, so that a
+	// changed file is not resumed.
+	File    string    `json:"file"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+
+	// Rows is how many rows have been added to the history.
+	Rows int `json:"rows"`
+}
+
+// newImportCheckpoint returns a checkpoint for the file at path.
+func newImportCheckpoint(path string) (*importCheckpoint, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(abs)
+	if err != nil {
+		return nil, err
+	}
+	return &importCheckpoint{File: abs, Size: fi.Size(), ModTime: fi.ModTime()}, nil
+}
+
+// resumable returns how many rows of the file cp is for were already imported
+// by an interrupted import, or false if there is nothing to resume.
+func (cp *importCheckpoint) resumable() (int, bool, error) {
+	b, err := ioutil.ReadFile(importCheckpointPath)
+	if os.IsNotExist(err) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	saved := new(importCheckpoint)
+	if err := json.Unmarshal(b, saved); err != nil {
+		return 0, false, err
+	}
+	if saved.File != cp.File || saved.Size != cp.Size || !saved.ModTime.Equal(cp.ModTime) {
+		return 0, false, nil
+	}
+	return saved.Rows, true, nil
+}
+
+// save saves to disk the checkpoint in '~/.gobeat_import'.
+func (cp *importCheckpoint) save() error {
+	b, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(importCheckpointPath, b, 0644)
+}
+
+// clearImportCheckpoint removes the checkpoint once an import has finished.
+func clearImportCheckpoint() error {
+	if err := os.Remove(importCheckpointPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// importProgress returns a Progress function printing label and the rows read
+// so far to stderr, or nil if stderr is not a terminal.
+func importProgress(label string) func(rows int) {
+	if !isTerminal(os.Stderr) {
+		return nil
+	}
+	return func(rows int) {
+		fmt.Fprintf(os.Stderr, "\r\x1b[K%s: %d rows", label, rows)
+	}
+}
+
+// endProgress clears the line printed by progress, if any.
+func endProgress(progress func(rows int)) {
+	if progress != nil {
+		fmt.Fprint(os.Stderr, "\r\x1b[K")
+	}
+}
+
+// byDate sorts results from oldest to newest.
+type byDate []*matchResult
+
+func (s byDate) Len() int           { return len(s) }
+func (s byDate) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byDate) Less(i, j int) bool { return s[i].Date.Before(s[j].Date) }
+
+// importCommand returns the 'gobeat import' command.
+func importCommand() cli.Command {
+	return cli.Command{
+		Name:      "import",
+		ShortName: "im",
+		Description: "`import` adds results exported from another league app to " +
+			"the history, checking the whole file first. Formats: csv, challonge.",
+		Usage: "import --from [format] [--dry-run] [--resume] [file]",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "from",
+				Usage: "format of the file: csv or challonge",
+			},
+			cli.StringFlag{
+				Name:  "game",
+				Usage: "game the results are for, if the file doesn't say",
+			},
+			cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "check the file and summarize what would be imported, without importing",
+			},
+			cli.BoolFlag{
+				Name:  "resume",
+				Usage: "carry on an interrupted import of the same file",
+			},
+		},
+		Action: func(c *cli.Context) {
+			imp, ok := importers[c.String("from")]
+			if !ok {
+				printError(fmt.Errorf("unknown import format %q.", c.String("from")))
+			}
+			if len(c.Args()) == 0 {
+				printError(fmt.Errorf("missing file to import."))
+			}
+			game := c.String("game")
+			if game == "" {
+				game = settings.Game
+			}
+
+			path := c.Args().First()
+			f, err := os.Open(path)
+			if err != nil {
+				printError(err)
+			}
+			defer f.Close()
+			// CSV is read a row at a time; other formats are small enough to
+			// parse whole.
+			open := func() (importStream, error) {
+				if _, err := f.Seek(0, io.SeekStart); err != nil {
+					return nil, err
+				}
+				if c.String("from") == "csv" {
+					return csvStream(f, game)
+				}
+				results, err := imp(f, game)
+				return sliceStream(results), err
+			}
+
+			cp, err := newImportCheckpoint(path)
+			if err != nil {
+				printError(err)
+			}
+			run := new(importRun)
+			if c.Bool("resume") {
+				rows, ok, err := cp.resumable()
+				if err != nil {
+					printError(err)
+				}
+				if !ok {
+					printError(fmt.Errorf("no interrupted import of %s to resume.", path))
+				}
+				run.Skip = rows
+			}
+
+			h, err := retrieveHistory()
+			if err != nil {
+				printError(err)
+			}
+
+			// Check the whole file first, so that a bad row near the end
+			// doesn't leave it half imported.
+			next, err := open()
+			if err != nil {
+				printError(err)
+			}
+			check := &importRun{Skip: run.Skip, DryRun: true, Progress: importProgress("Checking")}
+			dry, err := h.importFrom(next, check)
+			endProgress(check.Progress)
+			if err != nil {
+				printError(err)
+			}
+			if c.Bool("dry-run") {
+				fmt.Printf("Would import %d results (%d already recorded) from %d rows",
+					dry.Added, dry.Duplicates, dry.Rows-run.Skip)
+				if dry.Added+dry.Duplicates > 0 {
+					fmt.Printf(", dated %s to %s", dry.First.Format("2006-01-02"),
+						dry.Last.Format("2006-01-02"))
+				}
+				fmt.Println()
+				return
+			}
+
+			if next, err = open(); err != nil {
+				printError(err)
+			}
+			run.Progress = importProgress("Importing")
+			run.Checkpoint = func(rows int) error {
+				if err := h.save(); err != nil {
+					return err
+				}
+				cp.Rows = rows
+				return cp.save()
+			}
+			s, err := h.importFrom(next, run)
+			endProgress(run.Progress)
+			if err != nil {
+				printError(err)
+			}
+			if err := h.save(); err != nil {
+				printError(err)
+			}
+			if err := clearImportCheckpoint(); err != nil {
+				printError(err)
+			}
+			fmt.Printf("Imported %d results (%d already recorded)\n", s.Added,
+				s.Duplicates)
+		},
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestImportCSVWinnerLoser(t *testing.T) {
+	in := "Date,Winner,Loser,Winner_Score,Loser_Score\n" +
+		"2014-04-24,alex,oleg,21,15\n"
+	results, err := importCSV(strings.NewReader(in), "ping pong")
+	if err != nil {
+		t.Fatalf("Expected csv to import cleanly: %s", err)
+	}
+	r := results[0]
+	if r.Player != "alex" || r.Opponent != "oleg" || !r.Won || r.Score != "21-15" {
+		t.Fatalf("Got unexpected result %+v", r)
+	}
+}
+
+func TestImportCSVPlayers(t *testing.T) {
+	in := "player1,player2,score1,score2,date,game\n" +
+		"alex,oleg,15,21,04/24/2014,foosball\n"
+	results, err := importCSV(strings.NewReader(in), "ping pong")
+	if err != nil {
+		t.Fatalf("Expected csv to import cleanly: %s", err)
+	}
+	if r := results[0]; r.Won || r.Game != "foosball" {
+		t.Fatalf("Expected a foosball loss for player 1, got %+v", r)
+	}
+
+	if _, err := importCSV(strings.NewReader("player1,player2\n"), ""); err == nil {
+		t.Fatal("Expected a missing date column to be rejected.")
+	}
+}
+
+func TestImportChallonge(t *testing.T) {
+	in := `{"tournament": {
+		"participants": [
+			{"participant": {"id": 1, "name": "alex"}},
+			{"participant": {"id": 2, "name": "oleg"}}
+		],
+		"matches": [
+			{"match": {"state": "complete", "player1_id": 1, "player2_id": 2,
+				"winner_id": 2, "scores_csv": "19-21",
+				"completed_at": "2014-04-24T12:00:00-07:00"}},
+			{"match": {"state": "open", "player1_id": 1, "player2_id": 2}}
+		]
+	}}`
+	results, err := importChallonge(strings.NewReader(in), "ping pong")
+	if err != nil {
+		t.Fatalf("Expected challonge export to import cleanly: %s", err)
+	}
+	if len(results) != 1 || results[0].Won || results[0].Score != "19-21" {
+		t.Fatalf("Expected one completed loss, got %+v", results)
+	}
+}
+
+func TestImportResultsSkipsDuplicates(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	h := mockHistoryFile(t)
+	in := "date,winner,loser\n2014-04-25,alex,oleg\n2014-04-24,oleg,alex\n"
+
+	for i := 0; i < 2; i++ {
+		results, err := importCSV(strings.NewReader(in), "ping pong")
+		if err != nil {
+			t.Fatalf("Expected csv to import cleanly: %s", err)
+		}
+		if _, err := h.importResults(results); err != nil {
+			t.Fatalf("Expected results to import cleanly: %s", err)
+		}
+	}
+	if len(h.Results) != 2 {
+		t.Fatalf("Expected duplicates to be skipped, got %d results", len(h.Results))
+	}
+	if h.Results[0].Player != "oleg" {
+		t.Fatal("Expected imported results to be kept in date order.")
+	}
+	if !h.Results[0].Unsynced {
+		t.Fatal("Expected imported results to be left for 'gobeat sync' to push.")
+	}
+}
+
+func TestImportFrom(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	h := mockHistoryFile(t)
+	var in strings.Builder
+	in.WriteString("date,winner,loser\n")
+	for i := 0; i < importBatch+2; i++ {
+		fmt.Fprintf(&in, "%s,alex,oleg\n", time.Date(2014, 1, 1, 0, 0, i, 0, time.UTC).Format(time.RFC3339))
+	}
+	in.WriteString("2014-01-01T00:00:00Z,alex,oleg\n")
+
+	next, err := csvStream(strings.NewReader(in.String()), "ping pong")
+	if err != nil {
+		t.Fatalf("Expected csv to open cleanly: %s", err)
+	}
+	s, err := h.importFrom(next, &importRun{DryRun: true})
+	if err != nil || s.Added != importBatch+2 || s.Duplicates != 1 || len(h.Results) != 0 {
+		t.Fatalf("Expected a dry run to count without importing, got %+v (%v)", s, err)
+	}
+
+	var checkpoints []int
+	next, _ = csvStream(strings.NewReader(in.String()), "ping pong")
+	s, err = h.importFrom(next, &importRun{Skip: 2, Checkpoint: func(rows int) error {
+		checkpoints = append(checkpoints, rows)
+		return nil
+	}})
+	// The repeat of the first row is new, as the first row was skipped.
+	if err != nil || s.Added != importBatch+1 || len(h.Results) != importBatch+1 {
+		t.Fatalf("Expected the skipped rows to be left out, got %+v (%v)", s, err)
+	}
+	if len(checkpoints) != 1 || checkpoints[0] != importBatch {
+		t.Fatalf("Expected a checkpoint after each batch, got %v", checkpoints)
+	}
+
+	next, _ = csvStream(strings.NewReader("date,winner,loser\nyesterday,alex,oleg\n"), "")
+	if _, err := h.importFrom(next, &importRun{DryRun: true}); err == nil ||
+		!strings.Contains(err.Error(), "line 2") {
+		t.Fatalf("Expected the bad line to be reported, got %v", err)
+	}
+}
+
+func TestImportCheckpoint(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	f, err := ioutil.TempFile("", "gobeatimport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("date,winner,loser\n")
+	f.Close()
+	defer os.Remove(f.Name())
+
+	cp, err := newImportCheckpoint(f.Name())
+	if err != nil {
+		t.Fatalf("Could not create checkpoint: %s", err)
+	}
+	if _, ok, err := cp.resumable(); ok || err != nil {
+		t.Fatalf("Expected nothing to resume, got %v", err)
+	}
+	cp.Rows = 5000
+	if err := cp.save(); err != nil {
+		t.Fatalf("Could not save checkpoint: %s", err)
+	}
+	if rows, ok, _ := cp.resumable(); !ok || rows != 5000 {
+		t.Fatalf("Expected to resume from row 5000, got %d", rows)
+	}
+	other := *cp
+	other.Size++
+	if _, ok, _ := other.resumable(); ok {
+		t.Fatal("Expected a changed file not to be resumed.")
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/codegangsta/cli"
+)
+
+// ircTimeout bounds how long an IRC announcement may take.
+const ircTimeout = 30 * time.Second
+
+// credentialIRC names the IRC SASL password in the credential store.
+const credentialIRC = "irc"
+
+// ircSettings configures announcing results to an IRC channel.
+type ircSettings struct {
+	// Server is the host:port of the IRC server.
+	Server string `json:"server"`
+
+	// TLS is whether to connect with TLS.
+	TLS bool `json:"tls,omitempty"`
+
+	// Channel is the channel to announce in, e.g. "#pong".
+	Channel string `json:"channel"`
+
+	// Nick is the nickname gobeat connects as.
+	Nick string `json:"nick"`
+
+	// SASLUser and SASLPassword, if set, authenticate with SASL PLAIN. The
+	// password is kept in the credential store, not with the settings.
+	SASLUser     string `json:"sasl_user,omitempty"`
+	SASLPassword string `json:"-"`
+}
+
+// ircClient is a short-lived IRC connection used to send one announcement.
+type ircClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// send writes a single IRC line.
+func (c *ircClient) send(format string, args ...interface{}) error {
+	_, err := fmt.Fprintf(c.conn, format+"\r\n", args...)
+	return err
+}
+
+// waitFor reads lines, answering pings, until one has a command in cmds. It
+// returns the matching line's command and parameters.
+func (c *ircClient) waitFor(cmds ...string) (string, []string, error) {
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return "", nil, err
+		}
+		cmd, params := parseIRCLine(strings.TrimRight(line, "\r\n"))
+		if cmd == "PING" {
+			if err := c.send("PONG :%s", strings.Join(params, " ")); err != nil {
+				return "", nil, err
+			}
+			continue
+		}
+		if cmd == "ERROR" || cmd == "433" || cmd == "904" || cmd == "905" {
+			return "", nil, fmt.Errorf("irc server refused: %s", line)
+		}
+		for _, want := range cmds {
+			if cmd == want {
+				return cmd, params, nil
+			}
+		}
+	}
+}
+
+// parseIRCLine splits a line into its command and parameters, dropping any
+// prefix.
+func parseIRCLine(line string) (string, []string) {
+	if strings.HasPrefix(line, ":") {
+		if i := strings.Index(line, " "); i >= 0 {
+			line = line[i+1:]
+		} else {
+			return "", nil
+		}
+	}
+	var trailing string
+	hasTrailing := false
+	if i := strings.Index(line, " :"); i >= 0 {
+		trailing, hasTrailing = line[i+2:], true
+		line = line[:i]
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return "", nil
+	}
+	params := fields[1:]
+	if hasTrailing {
+		params = append(params, trailing)
+	}
+	return strings.ToUpper(fields[0]), params
+}
+
+// announceIRC connects to the configured server, registers (authenticating
+// with SASL if configured), joins the channel, sends msg and quits.
+func announceIRC(cfg *ircSettings, msg string) error {
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: ircTimeout}
+	if cfg.TLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", cfg.Server, nil)
+	} else {
+		conn, err = dialer.Dial("tcp", cfg.Server)
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(ircTimeout))
+	c := &ircClient{conn: conn, r: bufio.NewReader(conn)}
+
+	sasl := cfg.SASLUser != ""
+	if sasl {
+		if err := c.send("CAP REQ :sasl"); err != nil {
+			return err
+		}
+	}
+	if err := c.send("NICK %s", cfg.Nick); err != nil {
+		return err
+	}
+	if err := c.send("USER %s 0 * :gobeat", cfg.Nick); err != nil {
+		return err
+	}
+
+	if sasl {
+		if _, params, err := c.waitFor("CAP"); err != nil {
+			return err
+		} else if len(params) < 2 || strings.ToUpper(params[1]) != "ACK" {
+			return fmt.Errorf("irc server does not support sasl")
+		}
+		if err := c.send("AUTHENTICATE PLAIN"); err != nil {
+			return err
+		}
+		if _, _, err := c.waitFor("AUTHENTICATE"); err != nil {
+			return err
+		}
+		creds := cfg.SASLUser + "\x00" + cfg.SASLUser + "\x00" + cfg.SASLPassword
+		if err := c.send("AUTHENTICATE %s",
+			base64.StdEncoding.EncodeToString([]byte(creds))); err != nil {
+			return err
+		}
+		if _, _, err := c.waitFor("903"); err != nil {
+			return err
+		}
+		if err := c.send("CAP END"); err != nil {
+			return err
+		}
+	}
+
+	if _, _, err := c.waitFor("001"); err != nil {
+		return err
+	}
+	if err := c.send("JOIN %s", cfg.Channel); err != nil {
+		return err
+	}
+	if _, _, err := c.waitFor("366"); err != nil {
+		return err
+	}
+	for _, line := range strings.Split(msg, "\n") {
+		if err := c.send("PRIVMSG %s :%s", cfg.Channel, line); err != nil {
+			return err
+		}
+	}
+	return c.send("QUIT :gobeat")
+}
+
+// ircCommand returns the 'gobeat irc' command.
+func ircCommand() cli.Command {
+	return cli.Command{
+		Name:        "irc",
+		Description: "`irc` configures announcing results to an IRC channel.",
+		Usage:       "irc [--server host:port] [--channel #channel] [--nick nick]",
+		Flags: []cli.Flag{
+			cli.StringFlag{Name: "server", Usage: "IRC server as host:port"},
+			cli.BoolFlag{Name: "tls", Usage: "connect with TLS"},
+			cli.StringFlag{Name: "channel", Usage: "channel to announce in"},
+			cli.StringFlag{Name: "nick", Usage: "nickname to use"},
+			cli.StringFlag{Name: "sasl-user", Usage: "SASL PLAIN account name"},
+			cli.StringFlag{Name: "sasl-password", Usage: "SASL PLAIN password"},
+			cli.BoolFlag{Name: "off", Usage: "stop announcing to IRC"},
+		},
+		Action: func(c *cli.Context) {
+			if c.Bool("off") {
+				settings.IRC = nil
+				fmt.Println("Stopped announcing to IRC")
+				if err := storeCredential(credentialIRC, ""); err != nil {
+					printError(err)
+				}
+				if err := settings.save(); err != nil {
+					printError(err)
+				}
+				return
+			}
+			if c.String("server") == "" {
+				if settings.IRC == nil {
+					fmt.Println("Not announcing to IRC")
+				} else {
+					fmt.Printf("Announcing to %s on %s as %s\n", settings.IRC.Channel,
+						settings.IRC.Server, settings.IRC.Nick)
+				}
+				return
+			}
+
+			cfg := &ircSettings{
+				Server:       c.String("server"),
+				TLS:          c.Bool("tls"),
+				Channel:      c.String("channel"),
+				Nick:         c.String("nick"),
+				SASLUser:     c.String("sasl-user"),
+				SASLPassword: c.String("sasl-password"),
+			}
+			if cfg.Channel == "" {
+				printError(fmt.Errorf("missing channel."))
+			}
+			if !strings.HasPrefix(cfg.Channel, "#") {
+				cfg.Channel = "#" + cfg.Channel
+			}
+			if cfg.Nick == "" {
+				cfg.Nick = "gobeat"
+			}
+			if err := storeCredential(credentialIRC, cfg.SASLPassword); err != nil {
+				printError(err)
+			}
+			settings.IRC = cfg
+			fmt.Printf("Announcing to %s on %s as %s\n", cfg.Channel, cfg.Server,
+				cfg.Nick)
+
+			if err := settings.save(); err != nil {
+				printError(err)
+			}
+		},
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestParseIRCLine(t *testing.T) {
+	cmd, params := parseIRCLine(":irc.example.com 001 gobeat :Welcome to IRC")
+	if cmd != "001" || len(params) != 2 || params[1] != "Welcome to IRC" {
+		t.Fatalf("Got unexpected parse %s %v", cmd, params)
+	}
+	if cmd, params := parseIRCLine("PING :12345"); cmd != "PING" || params[0] != "12345" {
+		t.Fatalf("Got unexpected parse %s %v", cmd, params)
+	}
+}
+
+func TestAnnounceIRC(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not listen: %s", err)
+	}
+	defer l.Close()
+
+	lines := make(chan []string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		var got []string
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				break
+			}
+			line = strings.TrimRight(line, "\r\n")
+			got = append(got, line)
+			switch {
+			case strings.HasPrefix(line, "CAP REQ"):
+				conn.Write([]byte(":irc CAP * ACK :sasl\r\n"))
+			case line == "AUTHENTICATE PLAIN":
+				conn.Write([]byte("AUTHENTICATE +\r\n"))
+			case strings.HasPrefix(line, "AUTHENTICATE "):
+				conn.Write([]byte(":irc 903 gobeat :SASL successful\r\n"))
+			case line == "CAP END":
+				conn.Write([]byte("PING :abc\r\n:irc 001 gobeat :Welcome\r\n"))
+			case strings.HasPrefix(line, "JOIN"):
+				conn.Write([]byte(":irc 366 gobeat #pong :End of NAMES\r\n"))
+			}
+			if strings.HasPrefix(line, "QUIT") {
+				break
+			}
+		}
+		lines <- got
+	}()
+
+	cfg := &ircSettings{Server: l.Addr().String(), Channel: "#pong", Nick: "gobeat",
+		SASLUser: "alex", SASLPassword: "hunter2"}
+	if err := announceIRC(cfg, "alex beat oleg at ping pong with score 21-15"); err != nil {
+		t.Fatalf("Expected a clean announcement: %s", err)
+	}
+
+	got := strings.Join(<-lines, "\n")
+	creds := base64.StdEncoding.EncodeToString([]byte("alex\x00alex\x00hunter2"))
+	for _, want := range []string{"AUTHENTICATE " + creds, "PONG :abc",
+		"JOIN #pong", "PRIVMSG #pong :alex beat oleg at ping pong with score 21-15"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("Expected %q to be sent, got:\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/codegangsta/cli"
+)
+
+// Keys understood while scoring a match live.
+const (
+	liveKeyMine   = 'a'
+	liveKeyTheirs = 'o'
+	liveKeyUndo   = 'u'
+	liveKeyQuit   = 'q'
+)
+
+// liveMatch is the running score of a game being scored point by point.
+type liveMatch struct {
+	def    *gameDef
+	Mine   int
+	Theirs int
+
+	// points records who won each point so far, for undo.
+	points []bool
+}
+
+// newLiveMatch starts a game of def, with any head start from handicap (see
+// rosterEntry.Handicap).
+func newLiveMatch(def *gameDef, handicap int) (*liveMatch, error) {
+	if def.Points <= 0 {
+		return nil, fmt.Errorf("%s has no points target; set one with 'gobeat game define --points'.",
+			settings.Game)
+	}
+	m := &liveMatch{def: def}
+	if handicap > 0 {
+		m.Mine = handicap
+	} else {
+		m.Theirs = -handicap
+	}
+	return m, nil
+}
+
+// point awards the next point to the current user if mine, or else to their
+// opponent.
+func (m *liveMatch) point(mine bool) {
+	if mine {
+		m.Mine++
+	} else {
+		m.Theirs++
+	}
+	m.points = append(m.points, mine)
+}
+
+// undo takes back the last point, if any.
+func (m *liveMatch) undo() {
+	if len(m.points) == 0 {
+		return
+	}
+	if m.points[len(m.points)-1] {
+		m.Mine--
+	} else {
+		m.Theirs--
+	}
+	m.points = m.points[:len(m.points)-1]
+}
+
+// over returns whether the game has been won, and if so whether the current
+// user won it.
+func (m *liveMatch) over() (done, won bool) {
+	winBy := m.def.WinBy
+	if winBy < 1 {
+		winBy = 1
+	}
+	if m.Mine >= m.def.Points && m.Mine-m.Theirs >= winBy {
+		return true, true
+	}
+	if m.Theirs >= m.def.Points && m.Theirs-m.Mine >= winBy {
+		return true, false
+	}
+	return false, false
+}
+
+// score returns the score from the current user's point of view.
+func (m *liveMatch) score() string {
+	return fmt.Sprintf("%d-%d", m.Mine, m.Theirs)
+}
+
+// scoreLive reads key presses from in, redrawing the running score against
+// opponent on out, until the game is won. It returns whether the current user
+// won. Unknown keys, including newlines, are ignored so that keys may also be
+// entered a line at a time.
+func scoreLive(in io.Reader, out io.Writer, m *liveMatch, opponent string) (bool, error) {
+	fmt.Fprintf(out, "Scoring %s against %s: %c for your point, %c for theirs, "+
+		"%c to undo, %c to give up\n", settings.Game, opponent, liveKeyMine,
+		liveKeyTheirs, liveKeyUndo, liveKeyQuit)
+	draw := func() {
+		fmt.Fprintf(out, "\r\x1b[K%s %d - %d %s", settings.User, m.Mine, m.Theirs,
+			opponent)
+	}
+	draw()
+
+	r := bufio.NewReader(in)
+	for {
+		b, err := r.ReadByte()
+		if err == io.EOF {
+			fmt.Fprintln(out)
+			return false, fmt.Errorf("match abandoned at %s.", m.score())
+		}
+		if err != nil {
+			return false, err
+		}
+		switch b {
+		case liveKeyMine:
+			m.point(true)
+		case liveKeyTheirs:
+			m.point(false)
+		case liveKeyUndo:
+			m.undo()
+		case liveKeyQuit:
+			fmt.Fprintln(out)
+			return false, fmt.Errorf("match abandoned at %s.", m.score())
+		default:
+			continue
+		}
+		draw()
+		if done, won := m.over(); done {
+			fmt.Fprintln(out)
+			return won, nil
+		}
+	}
+}
+
+// rawInput puts the terminal f into cbreak mode without echo, so that each key
+// press is read as it is made. It returns a function restoring the previous
+// mode. Input that is not a terminal is left alone.
+func rawInput(f *os.File) (func(), error) {
+	if !isTerminal(f) {
+		return func() {}, nil
+	}
+	stty := func(args ...string) (string, error) {
+		cmd := exec.Command("stty", args...)
+		cmd.Stdin = f
+		out, err := cmd.Output()
+		return strings.TrimSpace(string(out)), err
+	}
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, fmt.Errorf("could not read terminal mode: %s", err)
+	}
+	if _, err := stty("cbreak", "-echo"); err != nil {
+		return nil, fmt.Errorf("could not set terminal mode: %s", err)
+	}
+	return func() { stty(saved) }, nil
+}
+
+// liveCommand returns the 'gobeat live' command.
+func liveCommand() cli.Command {
+	return cli.Command{
+		Name:      "live",
+		ShortName: "l",
+		Description: "`live` scores a game against an opponent point by point, and " +
+			"posts the result with how long it took when the game is won.",
+		Usage: "live [--copy] [opponent]",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "tags",
+				Usage: "comma-separated hashtags overriding the configured ones",
+			},
+			cli.StringFlag{
+				Name:  "note",
+				Usage: "a note to remember the match by",
+			},
+			cli.BoolFlag{
+				Name:  "copy",
+				Usage: "copy the announcement to the clipboard once posted",
+			},
+		},
+		Action: func(c *cli.Context) {
+			if len(c.Args()) == 0 {
+				printError(fmt.Errorf("missing opponent name."))
+			}
+			opponent := c.Args().First()
+			m, err := newLiveMatch(settings.gameDef(settings.Game),
+				settings.handicap(opponent))
+			if err != nil {
+				printError(err)
+			}
+
+			restore, err := rawInput(os.Stdin)
+			if err != nil {
+				printError(err)
+			}
+			// Put the terminal back even if interrupted mid-game.
+			sigs := make(chan os.Signal, 1)
+			signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+			go func() {
+				<-sigs
+				restore()
+				fmt.Println()
+				os.Exit(1)
+			}()
+			start := time.Now()
+			won, err := scoreLive(os.Stdin, os.Stdout, m, opponent)
+			restore()
+			signal.Stop(sigs)
+			if err != nil {
+				printError(err)
+			}
+
+			r, err := newMatchResult(opponent, m.score(), won)
+			if err != nil {
+				printError(err)
+			}
+			if err := r.applyHandicap(); err != nil {
+				printError(err)
+			}
+			r.setDuration(time.Since(start))
+			r.Note = c.String("note")
+			rec := postRecordedResult(r, resultHashtags(c.String("tags")))
+			if c.Bool("copy") {
+				copyAnnouncement(rec.Message)
+			}
+		},
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestLiveMatch(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	if _, err := newLiveMatch(settings.gameDef("pool"), 0); err == nil {
+		t.Fatal("Expected games without a points target to be refused.")
+	}
+
+	m, err := newLiveMatch(settings.gameDef("ping pong"), 0)
+	if err != nil {
+		t.Fatalf("Could not start match: %s", err)
+	}
+	for i := 0; i < 10; i++ {
+		m.point(true)
+		m.point(false)
+	}
+	m.point(true)
+	if done, _ := m.over(); done {
+		t.Fatalf("Expected 11-10 not to win when win by 2, at %s", m.score())
+	}
+	m.undo()
+	m.point(false)
+	m.point(false)
+	if done, won := m.over(); !done || won {
+		t.Fatalf("Expected a loss at %s", m.score())
+	}
+
+	m, err = newLiveMatch(settings.gameDef("ping pong"), -5)
+	if err != nil {
+		t.Fatalf("Could not start match: %s", err)
+	}
+	if m.score() != "0-5" {
+		t.Fatalf("Expected the opponent's head start, got %s", m.score())
+	}
+}
+
+func TestScoreLive(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	m, err := newLiveMatch(settings.gameDef("foosball"), 0)
+	if err != nil {
+		t.Fatalf("Could not start match: %s", err)
+	}
+
+	var out bytes.Buffer
+	keys := "o\nxu" + strings.Repeat("a", 10) + "o"
+	won, err := scoreLive(strings.NewReader(keys), &out, m, "oleg")
+	if err != nil {
+		t.Fatalf("Expected the game to finish: %s", err)
+	}
+	if !won || m.score() != "10-0" {
+		t.Fatalf("Expected a 10-0 win, got %s", m.score())
+	}
+	if !strings.Contains(out.String(), "alex 10 - 0 oleg") {
+		t.Fatalf("Expected the running score to be drawn, got %q", out.String())
+	}
+
+	m, _ = newLiveMatch(settings.gameDef("foosball"), 0)
+	if _, err := scoreLive(strings.NewReader("aaq"), &out, m, "oleg"); err == nil {
+		t.Fatal("Expected quitting to abandon the match.")
+	}
+}
+
+func TestLiveCopy(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("fake clipboard command is a shell script")
+	}
+	ts, posted := mockTarget(t)
+	defer ts.Close()
+	mockHistoryFile(t)
+	settings.Game = "foosball"
+
+	dir := t.TempDir()
+	copied := filepath.Join(dir, "copied")
+	script := "#!/bin/sh\ncat > " + copied + "\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "wl-copy"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	keys := filepath.Join(dir, "keys")
+	if err := ioutil.WriteFile(keys, []byte(strings.Repeat("a", 10)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	in, err := os.Open(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	stdin, stdout := os.Stdin, os.Stdout
+	defer func() { os.Stdin, os.Stdout = stdin, stdout }()
+	os.Stdin = in
+
+	if err := setupCliApp().Run([]string{"gobeat", "--quiet", "live", "oleg", "--copy"}); err != nil {
+		t.Fatalf("Expected the match to be scored: %s", err)
+	}
+	if len(posted()) != 1 {
+		t.Fatalf("Expected the result to be posted, got %v", posted())
+	}
+	if b, _ := ioutil.ReadFile(copied); string(b) != posted()[0] {
+		t.Fatalf("Expected the announcement on the clipboard, got %q", b)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"testing"
+)
+
+func TestCliHandler(t *testing.T) {
+	defer func() { logger = newLogger(os.Stderr, slog.LevelInfo, "text") }()
+
+	var buf bytes.Buffer
+	if err := configureLogger(&buf, "info", "text"); err != nil {
+		t.Fatalf("Expected the logger to be configured: %s", err)
+	}
+	logger.Debug("hidden")
+	logger.Info("Starting Telegram bot...")
+	logger.With("target", "foo.gov").Error("no target set.", "failures", 3)
+	want := "Starting Telegram bot...\nError: no target set. target=foo.gov failures=3\n"
+	if buf.String() != want {
+		t.Fatalf("Expected %q, got %q", want, buf.String())
+	}
+
+	if err := configureLogger(&buf, "loud", "text"); err == nil {
+		t.Fatal("Expected an unknown level to be rejected.")
+	}
+}
+
+func TestJSONLogs(t *testing.T) {
+	defer func() { logger = newLogger(os.Stderr, slog.LevelInfo, "text") }()
+
+	var buf bytes.Buffer
+	if err := configureLogger(&buf, "debug", "json"); err != nil {
+		t.Fatalf("Expected the logger to be configured: %s", err)
+	}
+	logger.Debug("retrying delivery", "attempt", 2)
+	var rec map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatalf("Expected a JSON record, got %q", buf.String())
+	}
+	if rec["level"] != "DEBUG" || rec["msg"] != "retrying delivery" || rec["attempt"] != 2.0 {
+		t.Fatalf("Expected the record's fields, got %v", rec)
+	}
+}
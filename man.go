@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/codegangsta/cli"
+)
+
+// manSection is the section gobeat's man pages belong to.
+const manSection = "1"
+
+// roffEscape escapes s for use as roff text.
+func roffEscape(s string) string {
+	s = strings.Replace(s, `\`, `\e`, -1)
+	s = strings.Replace(s, "-", `\-`, -1)
+	s = strings.Replace(s, "`", "", -1)
+	// Lines starting with a dot or quote would be read as requests.
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		l = strings.TrimSpace(l)
+		if strings.HasPrefix(l, ".") || strings.HasPrefix(l, "'") {
+			l = `\&` + l
+		}
+		lines[i] = l
+	}
+	return strings.Join(lines, "\n")
+}
+
+// flagHelp splits the help text of f into its names and usage.
+func flagHelp(f cli.Flag) (names, usage string) {
+	parts := strings.SplitN(f.String(), "\t", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+// writeFlags writes an OPTIONS section describing flags.
+func writeFlags(w io.Writer, flags []cli.Flag) {
+	if len(flags) == 0 {
+		return
+	}
+	fmt.Fprintln(w, ".SH OPTIONS")
+	for _, f := range flags {
+		names, usage := flagHelp(f)
+		fmt.Fprintf(w, ".TP\n.B %s\n%s\n", roffEscape(names), roffEscape(usage))
+	}
+}
+
+// writeCommandList writes a section listing commands, with the man page each
+// is described in if page is set.
+func writeCommandList(w io.Writer, section, prefix string, cmds []cli.Command, page bool) {
+	if len(cmds) == 0 {
+		return
+	}
+	fmt.Fprintf(w, ".SH %s\n", section)
+	for _, c := range cmds {
+		name := c.Name
+		if c.ShortName != "" {
+			name += ", " + c.ShortName
+		}
+		fmt.Fprintf(w, ".TP\n.B %s\n%s\n", roffEscape(name), roffEscape(c.Description))
+		if page {
+			fmt.Fprintf(w, "See \\fB%s\\fR(%s).\n", roffEscape(prefix+"-"+c.Name), manSection)
+		}
+	}
+}
+
+// writeManHeader writes the title and NAME sections of a page.
+func writeManHeader(w io.Writer, name, summary string, date time.Time) {
+	fmt.Fprintf(w, ".TH %s %s %q\n", strings.ToUpper(roffEscape(name)), manSection,
+		date.Format("2006-01-02"))
+	fmt.Fprintf(w, ".SH NAME\n%s \\- %s\n", roffEscape(name),
+		roffEscape(strings.Join(strings.Fields(summary), " ")))
+}
+
+// appManPage writes the man page for app itself.
+func appManPage(w io.Writer, app *cli.App, date time.Time) {
+	writeManHeader(w, app.Name, app.Usage, date)
+	fmt.Fprintf(w, ".SH SYNOPSIS\n.B %s\n\\fIcommand\\fR [\\fIoptions\\fR] [\\fIarguments\\fR]\n",
+		roffEscape(app.Name))
+	writeFlags(w, app.Flags)
+	writeCommandList(w, "COMMANDS", app.Name, app.Commands, true)
+	if app.Author != "" {
+		fmt.Fprintf(w, ".SH AUTHOR\n%s\n", roffEscape(app.Author))
+	}
+}
+
+// commandManPage writes the man page for one of app's commands.
+func commandManPage(w io.Writer, app *cli.App, c cli.Command, date time.Time) {
+	writeManHeader(w, app.Name+"-"+c.Name, c.Description, date)
+	fmt.Fprintf(w, ".SH SYNOPSIS\n.B %s\n%s\n", roffEscape(app.Name),
+		roffEscape(c.Usage))
+	fmt.Fprintf(w, ".SH DESCRIPTION\n%s\n", roffEscape(c.Description))
+	writeFlags(w, c.Flags)
+	writeCommandList(w, "SUBCOMMANDS", app.Name, c.Subcommands, false)
+	fmt.Fprintf(w, ".SH SEE ALSO\n\\fB%s\\fR(%s)\n", roffEscape(app.Name), manSection)
+}
+
+// writeManPages writes a page for app and each of its commands to dir,
+// returning the paths written.
+func writeManPages(app *cli.App, dir string, date time.Time) ([]string, error) {
+	var paths []string
+	write := func(name string, page func(io.Writer)) error {
+		var buf bytes.Buffer
+		page(&buf)
+		p := filepath.Join(dir, name+"."+manSection)
+		if err := ioutil.WriteFile(p, buf.Bytes(), 0644); err != nil {
+			return err
+		}
+		paths = append(paths, p)
+		return nil
+	}
+
+	if err := write(app.Name, func(w io.Writer) { appManPage(w, app, date) }); err != nil {
+		return paths, err
+	}
+	for _, c := range app.Commands {
+		c := c
+		err := write(app.Name+"-"+c.Name, func(w io.Writer) {
+			commandManPage(w, app, c, date)
+		})
+		if err != nil {
+			return paths, err
+		}
+	}
+	return paths, nil
+}
+
+// manCommand returns the 'gobeat man' command.
+func manCommand() cli.Command {
+	return cli.Command{
+		Name: "man",
+		Description: "`man` prints the gobeat man page, or with --dir writes man " +
+			"pages for gobeat and each of its commands.",
+		Usage: "man [--dir path]",
+		Flags: []cli.Flag{
+			cli.StringFlag{Name: "dir", Usage: "directory to write every man page to"},
+		},
+		Action: func(c *cli.Context) {
+			if c.String("dir") == "" {
+				appManPage(os.Stdout, c.App, time.Now())
+				return
+			}
+			paths, err := writeManPages(c.App, c.String("dir"), time.Now())
+			if err != nil {
+				printError(err)
+			}
+			fmt.Printf("Wrote %d man pages to %s\n", len(paths), c.String("dir"))
+		},
+	}
+}
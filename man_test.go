@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRoffEscape(t *testing.T) {
+	if s := roffEscape("`result` --lost"); s != `result \-\-lost` {
+		t.Fatalf("Expected dashes escaped and backticks removed, got %q", s)
+	}
+	if s := roffEscape(".hidden"); s != `\&.hidden` {
+		t.Fatalf("Expected leading dots escaped, got %q", s)
+	}
+}
+
+func TestManPages(t *testing.T) {
+	app := setupCliApp()
+	date := time.Date(2014, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	var buf bytes.Buffer
+	appManPage(&buf, app, date)
+	page := buf.String()
+	if !strings.HasPrefix(page, `.TH GOBEAT 1 "2014-06-01"`) {
+		t.Fatalf("Expected a title line, got %q", page)
+	}
+	if !strings.Contains(page, ".B result, r\n") {
+		t.Fatal("Expected the result command to be listed.")
+	}
+
+	dir, err := ioutil.TempDir("", "gobeat_man")
+	if err != nil {
+		t.Fatalf("Could not create directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	paths, err := writeManPages(app, dir, date)
+	if err != nil {
+		t.Fatalf("Expected man pages to be written: %s", err)
+	}
+	if len(paths) != len(app.Commands)+1 {
+		t.Fatalf("Expected a page for gobeat and each command, got %d", len(paths))
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "gobeat-result.1"))
+	if err != nil {
+		t.Fatalf("Expected a page for result: %s", err)
+	}
+	if !strings.Contains(string(b), `\-\-lost`) {
+		t.Fatal("Expected the result page to describe its flags.")
+	}
+}
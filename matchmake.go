@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/codegangsta/cli"
+)
+
+// credentialSlack names the Slack incoming webhook URL matchmaking
+// suggestions are posted to in the credential store.
+const credentialSlack = "slack"
+
+// staleAfter is how long since a pair last played at which a pairing gets
+// full credit for being overdue.
+const staleAfter = 30 * 24 * time.Hour
+
+// rivalryBonus is added to the interest of a pairing with a rival.
+const rivalryBonus = 0.5
+
+// suggestionCount is how many pairings matchmaking prints.
+const suggestionCount = 3
+
+// pairing is a possible match and how interesting it would be.
+type pairing struct {
+	A, B string
+
+	// Chance is A's chance of beating B going by their ratings.
+	Chance float64
+
+	// LastPlayed is when A and B last played each other, or zero if never.
+	LastPlayed time.Time
+
+	// Rivals is whether A and B are rivals.
+	Rivals bool
+
+	// Interest scores the pairing: closer ratings, a longer wait since they
+	// last played and an active rivalry all make a pairing more interesting.
+	Interest float64
+}
+
+// describe explains the pairing as of now, naming the players with name.
+func (p *pairing) describe(now time.Time, name func(string) string) string {
+	reasons := []string{fmt.Sprintf("%.0f%%-%.0f%% odds", 100*p.Chance, 100*(1-p.Chance))}
+	if p.LastPlayed.IsZero() {
+		reasons = append(reasons, "never played")
+	} else {
+		reasons = append(reasons,
+			fmt.Sprintf("last played %d days ago", int(now.Sub(p.LastPlayed)/(24*time.Hour))))
+	}
+	if p.Rivals {
+		reasons = append(reasons, "rivals")
+	}
+	return fmt.Sprintf("%s vs %s (%s)", name(p.A), name(p.B), strings.Join(reasons, ", "))
+}
+
+// matchmake returns every pairing of the current user and the players on the
+// roster in the current game as of now, most interesting first.
+func (h *gobeatHistory) matchmake(now time.Time) []*pairing {
+	players := append([]string{settings.User}, settings.rosterNames()...)
+	rs := h.standings(settings.Game, now)
+
+	last := make(map[[2]string]time.Time)
+	key := func(a, b string) [2]string {
+		if a > b {
+			a, b = b, a
+		}
+		return [2]string{a, b}
+	}
+	for _, r := range h.Results {
+		if r.Game == settings.Game && !r.doubles() {
+			last[key(r.Player, r.Opponent)] = r.Date
+		}
+	}
+
+	var out []*pairing
+	for i, a := range players {
+		for _, b := range players[i+1:] {
+			if a == b {
+				continue
+			}
+			p := &pairing{
+				A:          a,
+				B:          b,
+				Chance:     eloExpected(rs.get(a), rs.get(b)),
+				LastPlayed: last[key(a, b)],
+				Rivals:     a == settings.User && settings.isRival(b),
+			}
+			p.Interest = 1 - 2*math.Abs(p.Chance-0.5)
+			if p.LastPlayed.IsZero() {
+				p.Interest++
+			} else {
+				p.Interest += math.Min(float64(now.Sub(p.LastPlayed))/float64(staleAfter), 1)
+			}
+			if p.Rivals {
+				p.Interest += rivalryBonus
+			}
+			out = append(out, p)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Interest > out[j].Interest })
+	return out
+}
+
+// postSlack posts text to a Slack incoming webhook.
+func postSlack(webhook, text string) error {
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+	client := http.Client{Timeout: settings.timeout()}
+	resp, err := client.Post(webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("on slack post: got code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// matchmakeCommand returns the 'gobeat matchmake' command.
+func matchmakeCommand() cli.Command {
+	return cli.Command{
+		Name:      "matchmake",
+		ShortName: "mm",
+		Description: "`matchmake` suggests the most interesting pairings from you and " +
+			"the roster: close ratings, a long wait since they last played, or a rivalry.",
+		Usage: "matchmake [--slack] [--slack-webhook url]",
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "slack",
+				Usage: "post the best suggestion to Slack",
+			},
+			cli.StringFlag{
+				Name:  "slack-webhook",
+				Usage: "Slack incoming webhook URL to post to, saved for next time",
+			},
+		},
+		Action: func(c *cli.Context) {
+			if webhook := c.String("slack-webhook"); webhook != "" {
+				if err := storeCredential(credentialSlack, webhook); err != nil {
+					printError(err)
+				}
+			}
+
+			h, err := retrieveHistory()
+			if err != nil {
+				printError(err)
+			}
+			now := time.Now()
+			pairings := h.matchmake(now)
+			if len(pairings) == 0 {
+				printError(fmt.Errorf("add players with 'gobeat roster add' to get suggestions."))
+			}
+			fmt.Println(bold("Suggested " + settings.Game + " matches"))
+			for i, p := range pairings {
+				if i == suggestionCount {
+					break
+				}
+				fmt.Printf("%3d. %s\n", i+1, p.describe(now, func(name string) string { return name }))
+			}
+
+			if c.Bool("slack") {
+				webhook, err := credential(credentialSlack)
+				if err != nil {
+					printError(err)
+				}
+				if webhook == "" {
+					printError(fmt.Errorf("no slack webhook set; use --slack-webhook."))
+				}
+				msg := fmt.Sprintf("Suggested %s match: %s", settings.Game,
+					pairings[0].describe(now, settings.publicPlayer))
+				if err := postSlack(webhook, msg); err != nil {
+					printError(err)
+				}
+				fmt.Println("Posted the suggestion to Slack")
+			}
+		},
+	}
+}
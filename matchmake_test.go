@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatchmake(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	h := mockHistoryFile(t)
+	settings.rosterEntry("oleg")
+	settings.rosterEntry("ivan")
+	now := time.Now()
+	asIs := func(name string) string { return name }
+	for i := 0; i < 5; i++ {
+		h.add(&matchResult{Player: "alex", Opponent: "ivan", Game: "ping pong",
+			Won: true, Date: now})
+	}
+
+	pairings := h.matchmake(now)
+	if len(pairings) != 3 {
+		t.Fatalf("Expected every pairing of three players, got %d", len(pairings))
+	}
+	if best := pairings[0]; best.A != "alex" || best.B != "oleg" {
+		t.Fatalf("Expected the pairing that never played to be closest and overdue, got %s",
+			best.describe(now, asIs))
+	}
+	if last := pairings[2]; last.A != "alex" || last.B != "ivan" {
+		t.Fatalf("Expected the lopsided, recent pairing last, got %s", last.describe(now, asIs))
+	}
+	settings.OpponentNames = opponentNamesInitials
+	got := pairings[0].describe(now, settings.publicPlayer)
+	if !strings.HasPrefix(got, "alex vs O. (") {
+		t.Fatalf("Expected the opponent to be named as in announcements, got %s", got)
+	}
+	settings.OpponentNames = ""
+
+	settings.rosterEntry("ivan").Rival = true
+	if p := h.matchmake(now)[2]; !p.Rivals || p.Interest <= rivalryBonus {
+		t.Fatalf("Expected a rivalry bonus, got %+v", p)
+	}
+}
+
+func TestPostSlack(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	var got map[string]string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Fatalf("Expected a JSON body: %s", err)
+		}
+	}))
+	defer ts.Close()
+
+	if err := postSlack(ts.URL, "alex vs oleg"); err != nil {
+		t.Fatalf("Expected a clean post: %s", err)
+	}
+	if got["text"] != "alex vs oleg" {
+		t.Fatalf("Expected the suggestion as text, got %v", got)
+	}
+}
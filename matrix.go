@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/codegangsta/cli"
+)
+
+// credentialMatrix names the Matrix access token in the credential store.
+const credentialMatrix = "matrix"
+
+// matrixSettings configures announcing results to a Matrix room.
+type matrixSettings struct {
+	// Homeserver is the base URL of the homeserver, e.g.
+	// "https://matrix.example.com".
+	Homeserver string `json:"homeserver"`
+
+	// AccessToken authenticates the account gobeat posts as. It is kept in
+	// the credential store, not with the settings.
+	AccessToken string `json:"-"`
+
+	// RoomID is the room to announce in, e.g. "!abc123:example.com".
+	RoomID string `json:"room_id"`
+}
+
+// announceMatrix sends msg to the configured room as a text message under
+// the transaction ID txn. A send repeated with the same txn is ignored, so
+// retries must reuse it.
+func announceMatrix(cfg *matrixSettings, txn, msg string) error {
+	u := strings.TrimRight(cfg.Homeserver, "/") + "/_matrix/client/v3/rooms/" +
+		url.PathEscape(cfg.RoomID) + "/send/m.room.message/" + url.PathEscape(txn)
+
+	body, err := json.Marshal(map[string]string{
+		"msgtype": "m.text",
+		"body":    msg,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("PUT", u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+cfg.AccessToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := http.Client{Timeout: settings.timeout()}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := rateLimited("matrix send", resp); err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("on matrix send: got code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// matrixCommand returns the 'gobeat matrix' command.
+func matrixCommand() cli.Command {
+	return cli.Command{
+		Name:        "matrix",
+		Description: "`matrix` configures announcing results to a Matrix room.",
+		Usage:       "matrix [--homeserver url] [--token token] [--room id]",
+		Flags: []cli.Flag{
+			cli.StringFlag{Name: "homeserver", Usage: "homeserver base URL"},
+			cli.StringFlag{Name: "token", Usage: "access token to post with"},
+			cli.StringFlag{Name: "room", Usage: "ID of the room to announce in"},
+			cli.BoolFlag{Name: "off", Usage: "stop announcing to Matrix"},
+		},
+		Action: func(c *cli.Context) {
+			if c.Bool("off") {
+				settings.Matrix = nil
+				if err := storeCredential(credentialMatrix, ""); err != nil {
+					printError(err)
+				}
+				fmt.Println("Stopped announcing to Matrix")
+			} else if c.String("homeserver") == "" {
+				if settings.Matrix == nil {
+					fmt.Println("Not announcing to Matrix")
+				} else {
+					fmt.Printf("Announcing to %s on %s\n", settings.Matrix.RoomID,
+						settings.Matrix.Homeserver)
+				}
+				return
+			} else {
+				cfg := &matrixSettings{
+					Homeserver:  c.String("homeserver"),
+					AccessToken: c.String("token"),
+					RoomID:      c.String("room"),
+				}
+				if cfg.AccessToken == "" || cfg.RoomID == "" {
+					printError(fmt.Errorf("missing access token and room."))
+				}
+				if _, err := url.Parse(cfg.Homeserver); err != nil {
+					printError(err)
+				}
+				if err := storeCredential(credentialMatrix, cfg.AccessToken); err != nil {
+					printError(err)
+				}
+				settings.Matrix = cfg
+				fmt.Printf("Announcing to %s on %s\n", cfg.RoomID, cfg.Homeserver)
+			}
+
+			if err := settings.save(); err != nil {
+				printError(err)
+			}
+		},
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAnnounceMatrix(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PUT" || !strings.HasPrefix(r.URL.EscapedPath(),
+			"/_matrix/client/v3/rooms/%21pong:example.com/send/m.room.message/") {
+			t.Fatalf("Unexpected request %s %s", r.Method, r.URL.EscapedPath())
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			t.Fatal("Expected the access token to be sent.")
+		}
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatalf("Expected a JSON event: %s", err)
+		}
+		if body["msgtype"] != "m.text" || body["body"] != "alex beat oleg" {
+			t.Fatalf("Got unexpected event %v", body)
+		}
+		w.Write([]byte(`{"event_id": "$1"}`))
+	}
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+
+	cfg := &matrixSettings{Homeserver: ts.URL + "/", AccessToken: "secret",
+		RoomID: "!pong:example.com"}
+	if err := announceMatrix(cfg, "1", "alex beat oleg"); err != nil {
+		t.Fatalf("Expected a clean announcement: %s", err)
+	}
+}
+
+func TestMatrixRetriesReuseTransaction(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	var paths []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if len(paths) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{"event_id": "$1"}`))
+	}))
+	defer ts.Close()
+
+	cfg := &matrixSettings{Homeserver: ts.URL, AccessToken: "secret", RoomID: "!pong:example.com"}
+	if deliveries := deliver([]notifier{cfg}, "alex beat oleg"); deliveries[0].Err != nil {
+		t.Fatalf("Expected the retry to be delivered: %s", deliveries[0].Err)
+	}
+	if len(paths) != 2 || paths[0] != paths[1] {
+		t.Fatalf("Expected the retry to reuse the transaction ID, got %q", paths)
+	}
+	deliver([]notifier{cfg}, "alex beat oleg")
+	if len(paths) != 3 || paths[2] == paths[0] {
+		t.Fatalf("Expected a new message to get a new transaction ID, got %q", paths)
+	}
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/codegangsta/cli"
+)
+
+// maxMessageLength is the longest announcement gobeat will produce, matching
+// the Twitter character limit.
+const maxMessageLength = 140
+
+// streakThreshold is the win streak at which announcements switch to the
+// "streak" template.
+const streakThreshold = 3
+
+// defaultTemplates are the text/template announcement templates used when
+// none are configured, keyed by name.
+var defaultTemplates = map[string]string{
+	"win": emojiTemplate + upsetTemplate + "{{.User}} beat {{.Opponent}} at {{.Game}} with score " +
+		"{{.Score}}" + durationTemplate + handicapTemplate + seriesTemplate,
+	"streak": emojiTemplate + upsetTemplate + "{{.User}} extends their streak to {{.Streak}}! Beat " +
+		"{{.Opponent}} at {{.Game}} with score {{.Score}}" + durationTemplate +
+		handicapTemplate + seriesTemplate,
+	"loss": emojiTemplate + upsetTemplate + "{{.Opponent}} beat {{.User}} at {{.Game}} with score " +
+		"{{.Score}}" + durationTemplate + handicapTemplate + seriesTemplate,
+	"milestone": emojiTemplate + upsetTemplate + "{{.Milestone}} {{.User}} beat {{.Opponent}} at " +
+		"{{.Game}} with score {{.Score}}" + durationTemplate + handicapTemplate +
+		seriesTemplate,
+}
+
+// emojiTemplate leads with the game's emoji, if it has one.
+const emojiTemplate = "{{if .Emoji}}{{.Emoji}} {{end}}"
+
+// upsetTemplate calls out an upset, if this was one.
+const upsetTemplate = "{{if .Upset}}Upset alert! {{end}}"
+
+// durationTemplate describes how long the match took, if known.
+const durationTemplate = "{{if .Duration}} {{.Duration}}{{end}}"
+
+// handicapTemplate mentions who spotted whom points, if anyone.
+const handicapTemplate = "{{if .Handicap}} ({{.Handicap}}){{end}}"
+
+// seriesTemplate mentions the rivalry series score, if any.
+const seriesTemplate = "{{if .Series}}, series now {{.Series}}{{end}}"
+
+// announcement holds the fields available to announcement templates.
+type announcement struct {
+	User     string
+	Opponent string
+	Game     string
+	Score    string
+	Won      bool
+
+	// Emoji is the game's emoji, if it has one.
+	Emoji string
+
+	// Doubles is whether this was a doubles match, in which case User and
+	// Opponent name both members of each team.
+	Doubles bool
+
+	// Streak is User's current win streak, including this result.
+	Streak int
+
+	// Milestone describes any milestones reached with this result. It is
+	// empty when there are none or milestones are turned off.
+	Milestone string
+
+	// Minutes is how long the match took in whole minutes, or zero if
+	// unknown.
+	Minutes int
+
+	// Duration describes how long the match took, e.g. "in a grueling
+	// 48-minute battle". It is empty when the duration is unknown.
+	Duration string
+
+	// Handicap describes who spotted whom points, e.g. "@OlegK spotted alex
+	// 5". It is empty when there was no handicap.
+	Handicap string
+
+	// Upset is whether the winner was a big underdog going by the ratings.
+	// It is always false unless upsets are announced.
+	Upset bool
+
+	// Series is User's all-time score against a rival Opponent, e.g. "14-13".
+	// It is empty when Opponent is not a rival.
+	Series string
+}
+
+// newAnnouncement builds the announcement for r. The opponent is mentioned by
+// handle when they are on the roster, or by initials or pseudonym if the
+// privacy setting says so. h should already contain r; it may be nil when no
+// history is available.
+func newAnnouncement(r *matchResult, h *gobeatHistory) *announcement {
+	a := &announcement{
+		User:     r.Player,
+		Opponent: settings.publicName(r.Opponent),
+		Doubles:  r.doubles(),
+		Game:     r.Game,
+		Score:    r.Score,
+		Won:      r.Won,
+		Emoji:    settings.gameDef(r.Game).Emoji,
+	}
+	if r.Partner != "" {
+		a.User += " & " + settings.mention(r.Partner)
+	}
+	if r.OpponentPartner != "" {
+		a.Opponent += " & " + settings.publicName(r.OpponentPartner)
+	}
+	if d := r.duration(); d > 0 {
+		a.Minutes, a.Duration = describeDuration(d)
+	}
+	switch {
+	case r.Handicap > 0:
+		a.Handicap = fmt.Sprintf("%s spotted %s %d", a.Opponent, a.User, r.Handicap)
+	case r.Handicap < 0:
+		a.Handicap = fmt.Sprintf("%s spotted %s %d", a.User, a.Opponent, -r.Handicap)
+	}
+	if h != nil {
+		a.Streak = h.streak(r.Player)
+		if settings.Milestones != milestonesOff {
+			a.Milestone = strings.Join(h.milestones(r.Player), " ")
+		}
+		if settings.UpsetAlerts {
+			a.Upset = h.isUpset(r)
+		}
+		if settings.isRival(r.Opponent) {
+			wins, losses := h.series(r.Player, r.Opponent)
+			a.Series = fmt.Sprintf("%d-%d", wins, losses)
+		}
+	}
+	return a
+}
+
+// describeDuration returns d in whole minutes, at least one, and a phrase
+// describing a match that long.
+func describeDuration(d time.Duration) (int, string) {
+	minutes := int((d + time.Minute/2) / time.Minute)
+	if minutes < 1 {
+		minutes = 1
+	}
+	switch {
+	case minutes < 10:
+		return minutes, fmt.Sprintf("in a quick %d-minute game", minutes)
+	case minutes >= 30:
+		return minutes, fmt.Sprintf("in a grueling %d-minute battle", minutes)
+	default:
+		return minutes, fmt.Sprintf("in a %d-minute match", minutes)
+	}
+}
+
+// templateName returns the name of the template used to render a.
+func (a *announcement) templateName() string {
+	switch {
+	case a.Milestone != "" && settings.Milestones == milestonesSubstitute:
+		return "milestone"
+	case !a.Won:
+		return "loss"
+	case a.Streak >= streakThreshold:
+		return "streak"
+	default:
+		return "win"
+	}
+}
+
+// formatResult formats the body posted to the server. Milestones are appended
+// unless the "milestone" template was used. Hashtags are appended only while
+// they fit within maxMessageLength, so they are the first thing dropped from a
+// long message.
+func formatResult(a *announcement, tags []string) (string, error) {
+	name := a.templateName()
+	tmpl, err := template.New(name).Parse(settings.template(name))
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, a); err != nil {
+		return "", err
+	}
+	if a.Milestone != "" && name != "milestone" {
+		buf.WriteString(" " + a.Milestone)
+	}
+	return appendHashtags(buf.String(), tags), nil
+}
+
+// appendHashtags appends each tag to msg that still fits within
+// maxMessageLength. Tags that do not fit are skipped.
+func appendHashtags(msg string, tags []string) string {
+	length := utf8.RuneCountInString(msg)
+	for _, tag := range tags {
+		n := utf8.RuneCountInString(tag) + 1
+		if length+n > maxMessageLength {
+			continue
+		}
+		msg += " " + tag
+		length += n
+	}
+	return msg
+}
+
+// resultHashtags returns the hashtags for an announcement. A non-empty flag
+// value (comma-separated) takes precedence over the configured hashtags, which
+// in turn take precedence over the defaults for the current game.
+func resultHashtags(flag string) []string {
+	if flag != "" {
+		return normalizeHashtags(strings.Split(flag, ","))
+	}
+	if len(settings.Hashtags) > 0 {
+		return settings.Hashtags
+	}
+	if tag := settings.gameDef(settings.Game).Hashtag; tag != "" {
+		return []string{tag}
+	}
+	return nil
+}
+
+// normalizeHashtags trims whitespace from tags, drops empty ones and ensures
+// the remainder start with '#'.
+func normalizeHashtags(tags []string) []string {
+	var out []string
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		tag = strings.TrimLeft(tag, "#")
+		if tag == "" {
+			continue
+		}
+		out = append(out, "#"+tag)
+	}
+	return out
+}
+
+// template returns the configured announcement template called name, falling
+// back to the default.
+func (g *gobeatSettings) template(name string) string {
+	if t, ok := g.Templates[name]; ok && t != "" {
+		return t
+	}
+	return defaultTemplates[name]
+}
+
+// templateCommand returns the 'gobeat template' command.
+func templateCommand() cli.Command {
+	return cli.Command{
+		Name:      "template",
+		ShortName: "tm",
+		Description: "`template` shows or sets the announcement templates. Templates " +
+			"use text/template syntax with the fields .User, .Opponent, .Game, " +
+			".Score, .Won, .Emoji, .Doubles, .Streak, .Milestone, .Minutes, .Duration, " +
+			".Handicap, .Upset and .Series.",
+		Usage: "template [name] [text]",
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "reset",
+				Usage: "restore the default for the named template",
+			},
+		},
+		Action: func(c *cli.Context) {
+			if len(c.Args()) == 0 {
+				names := make([]string, 0, len(defaultTemplates))
+				for name := range defaultTemplates {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				for _, name := range names {
+					fmt.Printf("%s\t%s\n", name, settings.template(name))
+				}
+				return
+			}
+
+			name := c.Args().First()
+			if _, ok := defaultTemplates[name]; !ok {
+				printError(fmt.Errorf("unknown template %q.", name))
+			}
+
+			if c.Bool("reset") {
+				delete(settings.Templates, name)
+			} else if len(c.Args()) == 1 {
+				fmt.Printf("%s\t%s\n", name, settings.template(name))
+				return
+			} else {
+				text := strings.Join(c.Args().Tail(), " ")
+				if _, err := template.New(name).Parse(text); err != nil {
+					printError(err)
+				}
+				if settings.Templates == nil {
+					settings.Templates = make(map[string]string)
+				}
+				settings.Templates[name] = text
+			}
+			fmt.Printf("Set %s template to %s\n", name, settings.template(name))
+
+			if err := settings.save(); err != nil {
+				printError(err)
+			}
+		},
+	}
+}
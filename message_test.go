@@ -0,0 +1,105 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatResultHashtags(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+
+	msg := mockFormatResult(t, &announcement{User: "alex", Opponent: "oleg",
+		Game: "ping pong", Score: "21-15", Won: true}, []string{"#OfficePong"})
+	if msg != "alex beat oleg at ping pong with score 21-15 #OfficePong" {
+		t.Fatalf("Expected hashtag to be appended, got %q", msg)
+	}
+}
+
+func TestFormatResultEmoji(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+
+	msg := mockFormatResult(t, &announcement{User: "alex", Opponent: "oleg",
+		Game: "darts", Emoji: "🎯", Score: "301-250", Won: true}, nil)
+	if msg != "🎯 alex beat oleg at darts with score 301-250" {
+		t.Fatalf("Expected the default template to lead with the emoji, got %q", msg)
+	}
+}
+
+func TestFormatResultTemplates(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	a := &announcement{User: "alex", Opponent: "oleg", Game: "ping pong",
+		Score: "21-15", Won: true, Streak: 7}
+
+	msg := mockFormatResult(t, a, nil)
+	if !strings.HasPrefix(msg, "alex extends their streak to 7!") {
+		t.Fatalf("Expected streak announcement, got %q", msg)
+	}
+
+	a.Won = false
+	msg = mockFormatResult(t, a, nil)
+	if msg != "oleg beat alex at ping pong with score 21-15" {
+		t.Fatalf("Expected loss announcement, got %q", msg)
+	}
+
+	settings.Templates = map[string]string{"loss": "{{.User}} lost"}
+	msg = mockFormatResult(t, a, nil)
+	if msg != "alex lost" {
+		t.Fatalf("Expected configured template, got %q", msg)
+	}
+}
+
+func TestFormatResultDuration(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	r := &matchResult{Player: "alex", Opponent: "oleg", Game: "ping pong",
+		Score: "21-15", Won: true}
+	r.setDuration(48*time.Minute + 10*time.Second)
+
+	a := newAnnouncement(r, nil)
+	if a.Minutes != 48 {
+		t.Fatalf("Expected 48 minutes, got %d", a.Minutes)
+	}
+	msg := mockFormatResult(t, a, nil)
+	if msg != "🏓 alex beat oleg at ping pong with score 21-15 in a grueling 48-minute battle" {
+		t.Fatalf("Expected the duration to be described, got %q", msg)
+	}
+	if _, d := describeDuration(20 * time.Second); d != "in a quick 1-minute game" {
+		t.Fatalf("Expected short matches to round up to a minute, got %q", d)
+	}
+}
+
+func TestAppendHashtagsDropsLongTags(t *testing.T) {
+	msg := strings.Repeat("a", maxMessageLength-5)
+	out := appendHashtags(msg, []string{"#toolong", "#ok"})
+	if out != msg+" #ok" {
+		t.Fatalf("Expected only the short tag to fit, got %q", out)
+	}
+}
+
+func TestResultHashtags(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+
+	tags := resultHashtags("")
+	if len(tags) != 1 || tags[0] != "#OfficePong" {
+		t.Fatalf("Expected ping pong defaults, got %v", tags)
+	}
+
+	settings.Hashtags = []string{"#gophercon"}
+	tags = resultHashtags("")
+	if len(tags) != 1 || tags[0] != "#gophercon" {
+		t.Fatalf("Expected configured hashtags, got %v", tags)
+	}
+
+	tags = resultHashtags("pong, #win,")
+	if len(tags) != 2 || tags[0] != "#pong" || tags[1] != "#win" {
+		t.Fatalf("Expected flag hashtags to be normalized, got %v", tags)
+	}
+}
+
+func mockFormatResult(t *testing.T, a *announcement, tags []string) string {
+	msg, err := formatResult(a, tags)
+	if err != nil {
+		t.Fatalf("Expected result to format cleanly: %s", err)
+	}
+	return msg
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/codegangsta/cli"
+)
+
+// Milestone modes control how milestone messaging is included in
+// announcements.
+const (
+	// milestonesAppend appends milestones to the usual announcement.
+	milestonesAppend = "append"
+
+	// milestonesSubstitute uses the "milestone" template instead of the usual
+	// one when a milestone is reached.
+	milestonesSubstitute = "substitute"
+
+	// milestonesOff disables milestone messaging.
+	milestonesOff = "off"
+)
+
+// milestones returns descriptions of the milestones player reached with their
+// most recent result in h, e.g. "100th career win!", for announcements.
+// Pruned results count toward the career totals.
+func (h *gobeatHistory) milestones(player string) []string {
+	var last *matchResult
+	pruned := h.Pruned.record(player)
+	wins, matches := pruned.Wins, pruned.Wins+pruned.Losses
+	for _, r := range h.Results {
+		if r.Player != player {
+			continue
+		}
+		matches++
+		if r.Won {
+			wins++
+		}
+		last = r
+	}
+	if last == nil {
+		return nil
+	}
+
+	var out []string
+	if last.Won && isWinMilestone(wins) {
+		out = append(out, fmt.Sprintf("%s career win!", ordinal(wins)))
+	}
+	if isMatchMilestone(matches) {
+		out = append(out, fmt.Sprintf("%s match!", ordinal(matches)))
+	}
+	if last.Won && h.isFirstWinAgainst(last) {
+		out = append(out, fmt.Sprintf("First ever win against %s!",
+			settings.publicName(last.Opponent)))
+	}
+	return out
+}
+
+// isFirstWinAgainst reports whether r is its player's first win against its
+// opponent after having played them before, including in pruned results.
+func (h *gobeatHistory) isFirstWinAgainst(r *matchResult) bool {
+	pruned := h.Pruned.series(r.Player, r.Opponent)
+	if pruned.Wins > 0 {
+		return false
+	}
+	played := pruned.Losses > 0
+	for _, prev := range h.Results {
+		if prev == r {
+			break
+		}
+		if prev.Player != r.Player || prev.Opponent != r.Opponent {
+			continue
+		}
+		if prev.Won {
+			return false
+		}
+		played = true
+	}
+	return played
+}
+
+// isWinMilestone reports whether a career win count is worth celebrating.
+func isWinMilestone(n int) bool {
+	return n == 10 || n == 25 || n == 50 || (n > 0 && n%100 == 0)
+}
+
+// isMatchMilestone reports whether a career match count is worth
+// celebrating.
+func isMatchMilestone(n int) bool {
+	return n > 0 && n%100 == 0
+}
+
+// ordinal formats n as an English ordinal, e.g. 1st, 12th, 103rd.
+func ordinal(n int) string {
+	suffix := "th"
+	switch n % 10 {
+	case 1:
+		suffix = "st"
+	case 2:
+		suffix = "nd"
+	case 3:
+		suffix = "rd"
+	}
+	if n%100 >= 11 && n%100 <= 13 {
+		suffix = "th"
+	}
+	return fmt.Sprintf("%d%s", n, suffix)
+}
+
+// milestonesCommand returns the 'gobeat milestones' command.
+func milestonesCommand() cli.Command {
+	return cli.Command{
+		Name:      "milestones",
+		ShortName: "m",
+		Description: "`milestones` sets how milestones (e.g., 100th career win) " +
+			"are announced: append, substitute or off.",
+		Usage: "milestones [append|substitute|off]",
+		Action: func(c *cli.Context) {
+			if len(c.Args()) == 0 {
+				fmt.Printf("Current milestones mode: %s\n",
+					settings.Milestones)
+				return
+			}
+
+			mode := strings.ToLower(c.Args().First())
+			switch mode {
+			case milestonesAppend, milestonesSubstitute, milestonesOff:
+			default:
+				printError(fmt.Errorf("unknown milestones mode %q.", mode))
+			}
+			settings.Milestones = mode
+			fmt.Printf("Set milestones mode to %s\n", settings.Milestones)
+
+			if err := settings.save(); err != nil {
+				printError(err)
+			}
+		},
+	}
+}
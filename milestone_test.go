@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+func TestMilestones(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	h := mockHistoryFile(t)
+
+	for i := 0; i < 98; i++ {
+		h.add(&matchResult{Player: "alex", Opponent: "ivan", Won: true})
+	}
+	h.add(&matchResult{Player: "alex", Opponent: "oleg", Won: false})
+	h.add(&matchResult{Player: "alex", Opponent: "oleg", Won: true})
+
+	m := h.milestones("alex")
+	if len(m) != 2 {
+		t.Fatalf("Expected two milestones, got %v", m)
+	}
+	if m[0] != "100th match!" || m[1] != "First ever win against oleg!" {
+		t.Fatalf("Got unexpected milestones %v", m)
+	}
+
+	settings.OpponentNames = opponentNamesPseudonyms
+	if m := h.milestones("alex"); m[1] != "First ever win against "+settings.pseudonym("oleg")+"!" {
+		t.Fatalf("Expected the opponent to be named by pseudonym, got %v", m)
+	}
+}
+
+func TestOrdinal(t *testing.T) {
+	for n, want := range map[int]string{1: "1st", 2: "2nd", 3: "3rd", 4: "4th",
+		11: "11th", 12: "12th", 13: "13th", 101: "101st", 112: "112th"} {
+		if got := ordinal(n); got != want {
+			t.Fatalf("Expected ordinal(%d) to be %s, got %s", n, want, got)
+		}
+	}
+}
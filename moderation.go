@@ -0,0 +1,325 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/codegangsta/cli"
+)
+
+// pendingResultsPath is where the server lists results held for moderation,
+// relative to the target. Leagues that moderate results answer new ones with
+// 202 Accepted and only announce them once a moderator approves them.
+const pendingResultsPath = resultsPath + "/pending"
+
+// errNotModerator is returned when the server won't let the user moderate.
+var errNotModerator = fmt.Errorf("only the league's moderators can review pending results.")
+
+// errAwaitingApproval is returned by postResult when the target is holding a
+// result for moderation. The result counts as delivered, though not yet
+// announced.
+var errAwaitingApproval = fmt.Errorf("result is awaiting approval by a league moderator")
+
+const awaitingFile = ".gobeat_awaiting"
+
+// awaitingPath is the full path to the IDs of results the target is holding
+// for moderation, kept apart from the history so that flushes made while a
+// result is being recorded can add to it.
+var awaitingPath = filepath.Join(os.Getenv("HOME"), awaitingFile)
+
+// awaitingMu serializes changes to the results awaiting approval between
+// posts made concurrently.
+var awaitingMu sync.Mutex
+
+// retrieveAwaiting loads the IDs of results awaiting approval, oldest first.
+func retrieveAwaiting() ([]string, error) {
+	b, err := ioutil.ReadFile(awaitingPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var out []string
+	if err := json.Unmarshal(b, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// saveAwaiting saves to disk the IDs in '~/.gobeat_awaiting'.
+func saveAwaiting(ids []string) error {
+	if len(ids) == 0 {
+		if err := os.Remove(awaitingPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	b, err := json.Marshal(ids)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(awaitingPath, b, 0644)
+}
+
+// awaitApproval notes that the target is holding result id for moderation.
+// It is safe to call concurrently.
+func awaitApproval(id string) error {
+	awaitingMu.Lock()
+	defer awaitingMu.Unlock()
+	ids, err := retrieveAwaiting()
+	if err != nil {
+		return err
+	}
+	for _, cur := range ids {
+		if cur == id {
+			return nil
+		}
+	}
+	return saveAwaiting(append(ids, id))
+}
+
+// How a moderator has dealt with a result held for moderation.
+const (
+	reviewPending  = "pending"
+	reviewApproved = "approved"
+	reviewRejected = "rejected"
+)
+
+// resultReview is what the target says of a result held for moderation.
+type resultReview struct {
+	Status string `json:"status"`
+
+	// Reason is why the result was rejected, if the moderator said.
+	Reason string `json:"reason,omitempty"`
+}
+
+// reviewStatus asks the target u how result id has been moderated. A result
+// the target no longer has was rejected.
+func reviewStatus(u *url.URL, id string) (*resultReview, error) {
+	resp, err := sendTargetRequest(u, "GET", resultsPath+"/"+url.PathEscape(id), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusGone:
+		return &resultReview{Status: reviewRejected}, nil
+	default:
+		return nil, fmt.Errorf("on result status: got code %d", resp.StatusCode)
+	}
+
+	rv := new(resultReview)
+	if err := json.NewDecoder(resp.Body).Decode(rv); err != nil {
+		return nil, fmt.Errorf("invalid result status: %s", err)
+	}
+	return rv, nil
+}
+
+// rejection is a result a moderator rejected, and why.
+type rejection struct {
+	Result *matchResult
+	Reason string
+}
+
+// checkApprovals asks the target u about each result awaiting approval. Those
+// that were rejected are removed from the history, and returned; approved
+// ones are no longer asked about.
+func checkApprovals(u *url.URL) ([]*rejection, error) {
+	awaitingMu.Lock()
+	defer awaitingMu.Unlock()
+	ids, err := retrieveAwaiting()
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	h, err := retrieveHistory()
+	if err != nil {
+		return nil, err
+	}
+
+	var left []string
+	var rejected []*rejection
+	for i, id := range ids {
+		rv, err := reviewStatus(u, id)
+		if err != nil {
+			// Asked about again next time.
+			left = append(left, ids[i:]...)
+			break
+		}
+		switch rv.Status {
+		case reviewApproved:
+		case reviewRejected:
+			if r := h.find(id); r != nil {
+				h.remove(id)
+				rejected = append(rejected, &rejection{Result: r, Reason: rv.Reason})
+			}
+		default:
+			left = append(left, id)
+		}
+	}
+	if len(rejected) > 0 {
+		if err := h.save(); err != nil {
+			return nil, err
+		}
+	}
+	return rejected, saveAwaiting(left)
+}
+
+// reportRejections prints the results moderators have rejected since last
+// asked, which are removed from the history. Failing to ask only warns.
+func reportRejections() {
+	if settings.TargetURL == "" {
+		return
+	}
+	u, err := settings.URL()
+	if err != nil {
+		logger.Warn("could not check on results awaiting approval", "err", err)
+		return
+	}
+	rejected, err := checkApprovals(u)
+	if err != nil {
+		logger.Warn("could not check on results awaiting approval", "err", err)
+		return
+	}
+	for _, rj := range rejected {
+		reason := ""
+		if rj.Reason != "" {
+			reason = ": " + rj.Reason
+		}
+		fmt.Printf("A moderator rejected %s%s\n", formatHistoryLine(rj.Result), reason)
+	}
+}
+
+// pendingResults returns the results the target is holding for moderation,
+// oldest first.
+func pendingResults(u *url.URL) ([]*matchResult, error) {
+	resp, err := sendTargetRequest(u, "GET", pendingResultsPath, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return nil, errNotModerator
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("the server does not moderate results.")
+	default:
+		return nil, fmt.Errorf("on pending results: got code %d", resp.StatusCode)
+	}
+
+	var out []*matchResult
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("invalid pending results: %s", err)
+	}
+	return out, nil
+}
+
+// reviewResult approves or rejects the pending result id on the target,
+// giving reason for a rejection if it is not empty. An approved result is
+// announced by the server.
+func reviewResult(u *url.URL, id string, approve bool, reason string) error {
+	action, query := "approve", url.Values(nil)
+	if !approve {
+		action = "reject"
+		if reason != "" {
+			query = url.Values{"reason": {reason}}
+		}
+	}
+	resp, err := sendTargetRequest(u, "POST",
+		resultsPath+"/"+url.PathEscape(id)+"/"+action, query, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusAccepted, http.StatusNoContent:
+		return nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return errNotModerator
+	case http.StatusNotFound, http.StatusConflict:
+		return fmt.Errorf("no pending result with ID %s; see 'gobeat approve'.", id)
+	}
+	return fmt.Errorf("on %s: got code %d", action, resp.StatusCode)
+}
+
+// reviewResults approves or rejects each result in ids, stopping at the first
+// failure.
+func reviewResults(ids []string, approve bool, reason string) {
+	if len(ids) == 0 {
+		printError(fmt.Errorf("missing result ID; see 'gobeat approve'."))
+	}
+	u, err := settings.URL()
+	if err != nil {
+		printError(err)
+	}
+	for _, id := range ids {
+		if err := reviewResult(u, id, approve, reason); err != nil {
+			printError(err)
+		}
+		if approve {
+			fmt.Printf("Approved %s\n", id)
+		} else {
+			fmt.Printf("Rejected %s\n", id)
+		}
+	}
+}
+
+// approveCommand returns the 'gobeat approve' command.
+func approveCommand() cli.Command {
+	return cli.Command{
+		Name: "approve",
+		Description: "`approve` lets a moderator approve results the server is holding " +
+			"for moderation, which are announced once approved. Without an ID it lists " +
+			"the pending results.",
+		Usage: "approve [id...]",
+		Action: func(c *cli.Context) {
+			if len(c.Args()) > 0 {
+				reviewResults(c.Args(), true, "")
+				return
+			}
+			u, err := settings.URL()
+			if err != nil {
+				printError(err)
+			}
+			pending, err := pendingResults(u)
+			if err != nil {
+				printError(err)
+			}
+			if len(pending) == 0 {
+				fmt.Println("No results awaiting approval.")
+				return
+			}
+			for _, r := range pending {
+				fmt.Println(formatHistoryLine(r))
+			}
+		},
+	}
+}
+
+// rejectCommand returns the 'gobeat reject' command.
+func rejectCommand() cli.Command {
+	return cli.Command{
+		Name: "reject",
+		Description: "`reject` lets a moderator reject results the server is holding " +
+			"for moderation, so they are never announced.",
+		Usage: "reject [--reason text] id...",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "reason",
+				Usage: "why the result was rejected, passed on to whoever recorded it",
+			},
+		},
+		Action: func(c *cli.Context) {
+			reviewResults(c.Args(), false, c.String("reason"))
+		},
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPendingResults(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" || r.URL.Path != pendingResultsPath {
+			t.Fatalf("Expected a GET of %s, got %s %s", pendingResultsPath, r.Method, r.URL.Path)
+		}
+		json.NewEncoder(w).Encode([]*matchResult{
+			{ID: "abc", Player: "alex", Opponent: "oleg", Score: "21-15", Won: true},
+		})
+	}))
+	defer ts.Close()
+	mockSettingsFile(t, ts.URL)
+
+	pending, err := pendingResults(mustParse(t, ts.URL))
+	if err != nil {
+		t.Fatalf("Expected the pending results: %s", err)
+	}
+	if len(pending) != 1 || pending[0].ID != "abc" {
+		t.Fatalf("Expected the pending result abc, got %v", pending)
+	}
+}
+
+func TestReviewResult(t *testing.T) {
+	var got string
+	status := http.StatusNoContent
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			t.Fatalf("Expected a POST, got %s", r.Method)
+		}
+		got = r.URL.Path + "?" + r.URL.RawQuery
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+	mockSettingsFile(t, ts.URL)
+	u := mustParse(t, ts.URL)
+
+	if err := reviewResult(u, "abc", true, ""); err != nil {
+		t.Fatalf("Expected the result to be approved: %s", err)
+	}
+	if got != resultsPath+"/abc/approve?" {
+		t.Fatalf("Expected an approval of abc, got %q", got)
+	}
+	if err := reviewResult(u, "abc", false, "wrong score"); err != nil {
+		t.Fatalf("Expected the result to be rejected: %s", err)
+	}
+	if got != resultsPath+"/abc/reject?reason=wrong+score" {
+		t.Fatalf("Expected a rejection of abc with a reason, got %q", got)
+	}
+
+	status = http.StatusForbidden
+	if err := reviewResult(u, "abc", true, ""); err != errNotModerator {
+		t.Fatalf("Expected only moderators to review results, got %v", err)
+	}
+	status = http.StatusNotFound
+	if err := reviewResult(u, "abc", true, ""); err == nil {
+		t.Fatal("Expected an unknown result not to be approved.")
+	}
+}
+
+func TestPostResultAwaitingModeration(t *testing.T) {
+	review := `{"status": "pending"}`
+	var posts int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			w.Write([]byte(review))
+			return
+		}
+		posts++
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer ts.Close()
+	mockSettingsFile(t, ts.URL)
+	mockHistoryFile(t)
+	settings.CelebrateAchievements = true
+	u := mustParse(t, ts.URL)
+
+	if err := postResult(u, "", "alex beat oleg", true); err != errAwaitingApproval {
+		t.Fatalf("Expected the post to be held for moderation, got %v", err)
+	}
+	posts = 0
+
+	r, err := newMatchResult("oleg", "21-15", true)
+	if err != nil {
+		t.Fatalf("Could not create result: %s", err)
+	}
+	rec, err := recordResult(r, nil)
+	if err != nil {
+		t.Fatalf("Expected a result held for moderation to count as delivered: %s", err)
+	}
+	if !rec.AwaitingApproval || !rec.Deliveries[0].Held || posts != 1 {
+		t.Fatalf("Expected the result to await approval, without celebrating achievements, "+
+			"got %+v after %d posts", rec.Deliveries, posts)
+	}
+
+	// Held results are asked about until a moderator decides.
+	if rejected, err := checkApprovals(u); err != nil || len(rejected) != 0 {
+		t.Fatalf("Expected nothing rejected yet, got %v (%v)", rejected, err)
+	}
+	review = `{"status": "rejected", "reason": "wrong score"}`
+	rejected, err := checkApprovals(u)
+	if err != nil || len(rejected) != 1 || rejected[0].Reason != "wrong score" {
+		t.Fatalf("Expected the result to be rejected, got %v (%v)", rejected, err)
+	}
+	h, err := retrieveHistory()
+	if err != nil {
+		t.Fatalf("Could not retrieve history: %s", err)
+	}
+	if h.find(r.ID) != nil {
+		t.Fatal("Expected the rejected result to be removed from the history.")
+	}
+	if ids, _ := retrieveAwaiting(); len(ids) != 0 {
+		t.Fatalf("Expected nothing left awaiting approval, got %v", ids)
+	}
+}
+
+func TestFlushAwaitingModeration(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer ts.Close()
+	mockSettingsFile(t, ts.URL)
+	if err := queuePost("1", "oleg", "alex beat oleg", true); err != nil {
+		t.Fatalf("Could not queue post: %s", err)
+	}
+
+	if n, err := flushPending(mustParse(t, ts.URL), 1); err != nil || n != 1 {
+		t.Fatalf("Expected the held result to count as posted, got %d (%v)", n, err)
+	}
+	if ids, _ := retrieveAwaiting(); len(ids) != 1 || ids[0] != "1" {
+		t.Fatalf("Expected the result to await approval, got %v", ids)
+	}
+}
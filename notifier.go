@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+)
+
+// notifier is a destination that result announcements are delivered to.
+type notifier interface {
+	// name identifies the destination in delivery reports.
+	name() string
+
+	// notify delivers msg to the destination.
+	notify(msg string) error
+}
+
+// targetNotifier posts announcements to the configured target server.
+type targetNotifier struct {
+	u *url.URL
+
+	// quiet asks the target to record results without announcing them.
+	quiet bool
+
+	// id is the result announced, if the announcement is for one.
+	id string
+}
+
+func (t *targetNotifier) name() string { return "target " + t.u.String() }
+
+// notify posts msg once any announcements queued before it are posted, so
+// that the target receives them in order.
+func (t *targetNotifier) notify(msg string) error {
+	if _, err := flushPending(t.u, 1); err != nil {
+		return err
+	}
+	return guardedPost(t.u, t.id, msg, !t.quiet)
+}
+
+func (cfg *ircSettings) name() string            { return "IRC " + cfg.Channel }
+func (cfg *ircSettings) notify(msg string) error { return announceIRC(cfg, msg) }
+
+func (cfg *telegramSettings) name() string            { return "Telegram " + cfg.ChatID }
+func (cfg *telegramSettings) notify(msg string) error { return announceTelegram(cfg, msg) }
+
+func (cfg *matrixSettings) name() string { return "Matrix " + cfg.RoomID }
+
+func (cfg *matrixSettings) notify(msg string) error {
+	m, err := cfg.message()
+	if err != nil {
+		return err
+	}
+	return m.notify(msg)
+}
+
+// matrixMessage delivers one message to a Matrix room. Its transaction ID is
+// made once, so that the homeserver ignores a retry of a send it already took.
+type matrixMessage struct {
+	*matrixSettings
+	txn string
+}
+
+// message returns a notifier for one new message to the room.
+func (cfg *matrixSettings) message() (*matrixMessage, error) {
+	txn, err := newResultID()
+	if err != nil {
+		return nil, err
+	}
+	return &matrixMessage{matrixSettings: cfg, txn: txn}, nil
+}
+
+func (m *matrixMessage) notify(msg string) error {
+	return announceMatrix(m.matrixSettings, m.txn, msg)
+}
+
+// notifiers returns every configured destination, starting with the target.
+func (g *gobeatSettings) notifiers() ([]notifier, error) {
+	var out []notifier
+	if g.TargetURL != "" {
+		u, err := g.URL()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, &targetNotifier{u: u})
+	}
+	if g.IRC != nil {
+		out = append(out, g.IRC)
+	}
+	if g.Telegram != nil && g.Telegram.ChatID != "" {
+		out = append(out, g.Telegram)
+	}
+	if g.Matrix != nil {
+		out = append(out, g.Matrix)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no target or other destinations configured")
+	}
+	return out, nil
+}
+
+// forResult returns the notifiers to deliver the announcement of r to, with
+// the targets told its ID. An unannounced result is only delivered to the
+// targets, asked to record it quietly.
+func forResult(notifiers []notifier, r *matchResult) []notifier {
+	var out []notifier
+	for _, n := range notifiers {
+		if t, ok := n.(*targetNotifier); ok {
+			out = append(out, &targetNotifier{u: t.u, quiet: r.Unannounced, id: r.ID})
+		} else if !r.Unannounced {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// delivery is the outcome of delivering an announcement to one destination.
+type delivery struct {
+	// Destination is the notifier's name.
+	Destination string
+
+	// Err is nil if the announcement was delivered.
+	Err error
+
+	// Queued is whether the announcement was queued to be delivered later.
+	Queued bool
+
+	// Held is whether the target is holding the result until a moderator
+	// approves it. It counts as delivered.
+	Held bool
+}
+
+// deliver sends msg to every notifier concurrently, retrying failures as
+// configured, and reports how each delivery went in the same order as
+// notifiers.
+func deliver(notifiers []notifier, msg string) []delivery {
+	out := make([]delivery, len(notifiers))
+	retries, backoff := settings.retries(), settings.backoff()
+	var wg sync.WaitGroup
+	for i, n := range notifiers {
+		wg.Add(1)
+		go func(i int, n notifier) {
+			defer wg.Done()
+			// Retries of a Matrix message reuse its transaction ID.
+			if cfg, ok := n.(*matrixSettings); ok {
+				m, err := cfg.message()
+				if err != nil {
+					out[i] = delivery{Destination: n.name(), Err: err}
+					return
+				}
+				n = m
+			}
+			out[i] = delivery{
+				Destination: n.name(),
+				Err:         notifyWithRetries(n, msg, retries, backoff),
+			}
+			if out[i].Err == errAwaitingApproval {
+				out[i].Err, out[i].Held = nil, true
+			}
+		}(i, n)
+	}
+	wg.Wait()
+	return out
+}
+
+// delivered reports whether any delivery succeeded or was queued.
+func delivered(deliveries []delivery) bool {
+	for _, d := range deliveries {
+		if d.Err == nil || d.Queued {
+			return true
+		}
+	}
+	return false
+}
+
+// printDeliveries prints how each delivery went.
+func printDeliveries(deliveries []delivery) {
+	for _, d := range deliveries {
+		if d.Queued {
+			fmt.Printf("  %s: %s, result queued\n", d.Destination, d.Err)
+		} else if d.Err != nil {
+			fmt.Printf("  %s: failed: %s\n", d.Destination, d.Err)
+		} else if d.Held {
+			fmt.Printf("  %s: awaiting approval\n", d.Destination)
+		} else {
+			fmt.Printf("  %s: ok\n", d.Destination)
+		}
+	}
+}
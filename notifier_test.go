@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// mockNotifier records announcements, failing if err is set.
+type mockNotifier struct {
+	label string
+	err   error
+	got   []string
+}
+
+func (m *mockNotifier) name() string { return m.label }
+func (m *mockNotifier) notify(msg string) error {
+	m.got = append(m.got, msg)
+	return m.err
+}
+
+func TestDeliver(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	ok := &mockNotifier{label: "ok"}
+	broken := &mockNotifier{label: "broken", err: fmt.Errorf("down")}
+
+	deliveries := deliver([]notifier{ok, broken}, "alex beat oleg")
+	if len(deliveries) != 2 || deliveries[0].Destination != "ok" ||
+		deliveries[1].Err == nil {
+		t.Fatalf("Expected per-destination status in order, got %v", deliveries)
+	}
+	if len(ok.got) != 1 || len(broken.got) != 1+defaultRetries {
+		t.Fatal("Expected every destination to be tried, and failures retried.")
+	}
+	if !delivered(deliveries) {
+		t.Fatal("Expected a partial delivery to count as delivered.")
+	}
+	if delivered(deliveries[1:]) {
+		t.Fatal("Expected a failed delivery not to count as delivered.")
+	}
+}
+
+func TestNotifiers(t *testing.T) {
+	mockSettingsFile(t, "")
+	if _, err := settings.notifiers(); err == nil {
+		t.Fatal("Expected an error with nowhere to deliver to.")
+	}
+
+	settings.TargetURL = "http://foo.gov"
+	settings.Matrix = &matrixSettings{RoomID: "!pong:example.com"}
+	n, err := settings.notifiers()
+	if err != nil {
+		t.Fatalf("Expected notifiers: %s", err)
+	}
+	if len(n) != 2 || n[0].name() != "target http://foo.gov" ||
+		n[1].name() != "Matrix !pong:example.com" {
+		t.Fatalf("Expected the target then Matrix, got %v", n)
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/codegangsta/cli"
+)
+
+const outboxFile = ".gobeat_outbox"
+
+// outboxPath is the full path to where drafted results reside until they are
+// sent or discarded.
+var outboxPath = filepath.Join(os.Getenv("HOME"), outboxFile)
+
+// draft is a result composed with 'gobeat result --draft', waiting in the
+// outbox for review.
+type draft struct {
+	// Result is the drafted result. It is only added to the history once
+	// sent.
+	Result *matchResult `json:"result"`
+
+	// Tags are the hashtags given with the result, if any.
+	Tags []string `json:"tags,omitempty"`
+
+	// Message is the announcement as it would have been sent when drafted.
+	// It is composed afresh when sent, so streaks and milestones are up to
+	// date.
+	Message string `json:"message"`
+}
+
+// retrieveOutbox loads the drafts in the outbox, oldest first.
+func retrieveOutbox() ([]*draft, error) {
+	b, err := ioutil.ReadFile(outboxPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var out []*draft
+	if err := json.Unmarshal(b, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// saveOutbox saves to disk the drafts in '~/.gobeat_outbox'.
+func saveOutbox(drafts []*draft) error {
+	if len(drafts) == 0 {
+		if err := os.Remove(outboxPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	b, err := json.Marshal(drafts)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(outboxPath, b, 0644)
+}
+
+// saveDraft composes the announcement for r as it stands and adds it to the
+// outbox instead of sending it.
+func saveDraft(r *matchResult, tags []string) (*draft, error) {
+	h, err := retrieveHistory()
+	if err != nil {
+		return nil, err
+	}
+	// Composed as if r were recorded, without saving the history.
+	h.add(r)
+	msg, err := formatResult(newAnnouncement(r, h), tags)
+	if err != nil {
+		return nil, err
+	}
+
+	drafts, err := retrieveOutbox()
+	if err != nil {
+		return nil, err
+	}
+	d := &draft{Result: r, Tags: tags, Message: msg}
+	return d, saveOutbox(append(drafts, d))
+}
+
+// takeDraft removes the draft for result id from the outbox and returns it,
+// or nil if there is none.
+func takeDraft(id string) (*draft, error) {
+	drafts, err := retrieveOutbox()
+	if err != nil {
+		return nil, err
+	}
+	for i, d := range drafts {
+		if d.Result.ID == id {
+			return d, saveOutbox(append(drafts[:i], drafts[i+1:]...))
+		}
+	}
+	return nil, nil
+}
+
+// sendDraft records and announces the draft for result id, as if it had just
+// been entered with 'gobeat result'. It leaves the outbox once recorded in the
+// history, so a draft that could not be delivered anywhere stays put.
+func sendDraft(id string) (*recordedResult, error) {
+	drafts, err := retrieveOutbox()
+	if err != nil {
+		return nil, err
+	}
+	var d *draft
+	for _, cur := range drafts {
+		if cur.Result.ID == id {
+			d = cur
+		}
+	}
+	if d == nil {
+		return nil, fmt.Errorf("no draft with ID %s.", id)
+	}
+
+	rec, err := recordResult(d.Result, d.Tags)
+	h, herr := retrieveHistory()
+	if herr != nil {
+		return rec, herr
+	}
+	if h.find(id) != nil {
+		if _, terr := takeDraft(id); terr != nil {
+			return rec, terr
+		}
+	}
+	return rec, err
+}
+
+// formatDraftLine formats a draft for the outbox listing.
+func formatDraftLine(d *draft) string {
+	return fmt.Sprintf("%s  %s  %s", d.Result.ID, d.Result.Date.Format("2006-01-02 15:04"),
+		d.Message)
+}
+
+// outboxCommand returns the 'gobeat outbox' command and its subcommands.
+func outboxCommand() cli.Command {
+	list := func(c *cli.Context) {
+		drafts, err := retrieveOutbox()
+		if err != nil {
+			printError(err)
+		}
+		if len(drafts) == 0 {
+			fmt.Println("Outbox is empty.")
+			return
+		}
+		for _, d := range drafts {
+			fmt.Println(formatDraftLine(d))
+		}
+	}
+
+	return cli.Command{
+		Name: "outbox",
+		Description: "`outbox` lists results drafted with 'gobeat result --draft', " +
+			"which are only recorded and announced once sent.",
+		Usage:  "outbox [list|send|discard]",
+		Action: list,
+		Subcommands: []cli.Command{
+			cli.Command{
+				Name:        "list",
+				Description: "`outbox list` lists drafted results and their announcements.",
+				Usage:       "outbox list",
+				Action:      list,
+			},
+			cli.Command{
+				Name:        "send",
+				Description: "`outbox send` records and announces drafted results.",
+				Usage:       "outbox send [--all] [id...]",
+				Flags: []cli.Flag{
+					cli.BoolFlag{
+						Name:  "all",
+						Usage: "send every draft, oldest first",
+					},
+				},
+				Action: func(c *cli.Context) {
+					ids := []string(c.Args())
+					if c.Bool("all") {
+						drafts, err := retrieveOutbox()
+						if err != nil {
+							printError(err)
+						}
+						ids = nil
+						for _, d := range drafts {
+							ids = append(ids, d.Result.ID)
+						}
+					}
+					if len(ids) == 0 {
+						printError(fmt.Errorf("missing draft ID; see 'gobeat outbox list'."))
+					}
+					for _, id := range ids {
+						rec, err := sendDraft(id)
+						if rec != nil {
+							printDeliveries(rec.Deliveries)
+						}
+						if err != nil {
+							printError(err)
+						}
+						fmt.Printf("Sent %s\n", formatHistoryLine(rec.Result))
+					}
+				},
+			},
+			cli.Command{
+				Name:        "discard",
+				Description: "`outbox discard` throws away drafted results without recording them.",
+				Usage:       "outbox discard [id...]",
+				Action: func(c *cli.Context) {
+					if len(c.Args()) == 0 {
+						printError(fmt.Errorf("missing draft ID; see 'gobeat outbox list'."))
+					}
+					for _, id := range c.Args() {
+						d, err := takeDraft(id)
+						if err != nil {
+							printError(err)
+						}
+						if d == nil {
+							printError(fmt.Errorf("no draft with ID %s.", id))
+						}
+						fmt.Printf("Discarded %s\n", formatDraftLine(d))
+					}
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import "testing"
+
+func TestOutbox(t *testing.T) {
+	ts, posted := mockTarget(t)
+	defer ts.Close()
+	h := mockHistoryFile(t)
+
+	r, err := newMatchResult("oleg", "21-15", true)
+	if err != nil {
+		t.Fatalf("Could not create result: %s", err)
+	}
+	d, err := saveDraft(r, nil)
+	if err != nil {
+		t.Fatalf("Could not draft result: %s", err)
+	}
+	if d.Message != "🏓 alex beat oleg at ping pong with score 21-15" {
+		t.Fatalf("Expected the draft's announcement, got %q", d.Message)
+	}
+	if len(posted()) != 0 {
+		t.Fatalf("Expected nothing to be posted for a draft, got %v", posted())
+	}
+	if h, _ = retrieveHistory(); len(h.Results) != 0 {
+		t.Fatal("Expected a draft not to be recorded.")
+	}
+
+	other, err := newMatchResult("dana", "21-19", false)
+	if err != nil {
+		t.Fatalf("Could not create result: %s", err)
+	}
+	if _, err := saveDraft(other, nil); err != nil {
+		t.Fatalf("Could not draft result: %s", err)
+	}
+	drafts, err := retrieveOutbox()
+	if err != nil || len(drafts) != 2 {
+		t.Fatalf("Expected 2 drafts in the outbox, got %d (%v)", len(drafts), err)
+	}
+
+	if _, err := sendDraft(r.ID); err != nil {
+		t.Fatalf("Expected the draft to be sent: %s", err)
+	}
+	if len(posted()) != 1 || posted()[0] != d.Message {
+		t.Fatalf("Expected the draft to be posted, got %v", posted())
+	}
+	if h, _ = retrieveHistory(); len(h.Results) != 1 || h.Results[0].ID != r.ID {
+		t.Fatal("Expected a sent draft to be recorded.")
+	}
+
+	if d, err := takeDraft(other.ID); err != nil || d == nil {
+		t.Fatalf("Expected the other draft to be discarded: %v", err)
+	}
+	if drafts, _ := retrieveOutbox(); len(drafts) != 0 {
+		t.Fatalf("Expected an empty outbox, got %d drafts", len(drafts))
+	}
+	if _, err := sendDraft(other.ID); err == nil {
+		t.Fatal("Expected a discarded draft not to be sent.")
+	}
+}
+
+func TestSendDraftKeepsUndelivered(t *testing.T) {
+	mockSettingsFile(t, "http://127.0.0.1:1")
+	mockHistoryFile(t)
+	settings.Retries = new(int)
+
+	r, err := newMatchResult("oleg", "21-15", true)
+	if err != nil {
+		t.Fatalf("Could not create result: %s", err)
+	}
+	if _, err := saveDraft(r, nil); err != nil {
+		t.Fatalf("Could not draft result: %s", err)
+	}
+	// The target is down, so the result is queued and recorded.
+	if _, err := sendDraft(r.ID); err != nil {
+		t.Fatalf("Expected the result to be queued: %s", err)
+	}
+	if drafts, _ := retrieveOutbox(); len(drafts) != 0 {
+		t.Fatal("Expected a queued draft to leave the outbox.")
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/codegangsta/cli"
+)
+
+// pluginPath is the directory holding plugin executables.
+var pluginPath = filepath.Join(os.Getenv("HOME"), ".gobeat.d", "plugins")
+
+// Plugin hooks, passed to each plugin as its only argument.
+const (
+	// hookPrePost runs before a result is delivered. A plugin exiting with a
+	// non-zero status stops the result from being recorded.
+	hookPrePost = "pre-post"
+
+	// hookPostPost runs once a result has been recorded.
+	hookPostPost = "post-post"
+)
+
+// pluginEvent is the JSON document written to a plugin's stdin.
+type pluginEvent struct {
+	// Hook is the hook being run.
+	Hook string `json:"hook"`
+
+	// Result is the result being recorded.
+	Result *matchResult `json:"result"`
+
+	// Message is the announcement for Result.
+	Message string `json:"message"`
+
+	// Deliveries maps each destination to "ok" or why delivery failed. Only
+	// set for post-post hooks.
+	Deliveries map[string]string `json:"deliveries,omitempty"`
+
+	// Achievements are the achievements earned with Result.
+	Achievements []*achievement `json:"achievements,omitempty"`
+}
+
+// plugins returns the paths of every executable in pluginPath, sorted by name
+// so they run in a predictable order.
+func plugins() ([]string, error) {
+	infos, err := ioutil.ReadDir(pluginPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var out []string
+	for _, fi := range infos {
+		if fi.Mode().IsRegular() && fi.Mode().Perm()&0111 != 0 {
+			out = append(out, filepath.Join(pluginPath, fi.Name()))
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// runPlugins runs every plugin for ev.Hook in turn, stopping at the first one
+// that fails.
+func runPlugins(ev *pluginEvent) error {
+	paths, err := plugins()
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		var stderr bytes.Buffer
+		cmd := exec.Command(p, ev.Hook)
+		cmd.Stdin = bytes.NewReader(b)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			msg := strings.TrimSpace(stderr.String())
+			if msg == "" {
+				msg = err.Error()
+			}
+			return fmt.Errorf("%s plugin %s failed: %s", ev.Hook,
+				filepath.Base(p), msg)
+		}
+	}
+	return nil
+}
+
+// deliveryReport summarises deliveries for a plugin event.
+func deliveryReport(deliveries []delivery) map[string]string {
+	out := make(map[string]string, len(deliveries))
+	for _, d := range deliveries {
+		if d.Err != nil {
+			out[d.Destination] = d.Err.Error()
+		} else {
+			out[d.Destination] = "ok"
+		}
+	}
+	return out
+}
+
+// pluginsCommand lists the installed plugins.
+func pluginsCommand() cli.Command {
+	return cli.Command{
+		Name: "plugins",
+		Description: "`plugins` lists the executables in ~/.gobeat.d/plugins. Each " +
+			"is run with the hook (pre-post or post-post) as its argument and " +
+			"the result as JSON on stdin.",
+		Usage: "plugins",
+		Action: func(c *cli.Context) {
+			paths, err := plugins()
+			if err != nil {
+				printError(err)
+			}
+			if len(paths) == 0 {
+				fmt.Printf("No plugins installed in %s.\n", pluginPath)
+				return
+			}
+			for _, p := range paths {
+				fmt.Println(filepath.Base(p))
+			}
+		},
+	}
+}
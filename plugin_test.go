@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// mockPluginDir points pluginPath at an empty temporary directory.
+func mockPluginDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "gobeat_plugins")
+	if err != nil {
+		t.Fatalf("Could not create plugin directory: %s", err)
+	}
+	pluginPath = dir
+	return dir
+}
+
+// mockPlugin installs a shell script plugin named name.
+func mockPlugin(t *testing.T, dir, name, script string) {
+	p := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(p, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatalf("Could not write plugin: %s", err)
+	}
+}
+
+func TestPlugins(t *testing.T) {
+	dir := mockPluginDir(t)
+	defer os.RemoveAll(dir)
+
+	mockPlugin(t, dir, "lights", "exit 0\n")
+	if err := ioutil.WriteFile(filepath.Join(dir, "README"), nil, 0644); err != nil {
+		t.Fatalf("Could not write file: %s", err)
+	}
+	paths, err := plugins()
+	if err != nil {
+		t.Fatalf("Expected plugins to list cleanly: %s", err)
+	}
+	if len(paths) != 1 || filepath.Base(paths[0]) != "lights" {
+		t.Fatalf("Expected only executables to be plugins, got %v", paths)
+	}
+}
+
+func TestRecordResultPlugins(t *testing.T) {
+	ts, posted := mockTarget(t)
+	defer ts.Close()
+	mockHistoryFile(t)
+	dir := mockPluginDir(t)
+	defer os.RemoveAll(dir)
+
+	out := filepath.Join(dir, "events")
+	mockPlugin(t, dir, "record", "cat >> "+out+"\necho >> "+out+"\n")
+
+	r, err := newMatchResult("oleg", "21-15", true)
+	if err != nil {
+		t.Fatalf("Could not create result: %s", err)
+	}
+	if _, err := recordResult(r, nil); err != nil {
+		t.Fatalf("Expected a clean record: %s", err)
+	}
+
+	b, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatalf("Expected the plugin to run: %s", err)
+	}
+	var hooks []string
+	dec := json.NewDecoder(bytes.NewReader(b))
+	for dec.More() {
+		var ev pluginEvent
+		if err := dec.Decode(&ev); err != nil {
+			t.Fatalf("Expected JSON events: %s", err)
+		}
+		if ev.Result.ID != r.ID {
+			t.Fatalf("Expected the result in the event, got %v", ev.Result)
+		}
+		hooks = append(hooks, ev.Hook)
+	}
+	if len(hooks) != 2 || hooks[0] != hookPrePost || hooks[1] != hookPostPost {
+		t.Fatalf("Expected pre-post then post-post, got %v", hooks)
+	}
+
+	mockPlugin(t, dir, "veto", "echo no >&2\nexit 1\n")
+	r, err = newMatchResult("oleg", "21-15", true)
+	if err != nil {
+		t.Fatalf("Could not create result: %s", err)
+	}
+	n := len(posted())
+	if _, err := recordResult(r, nil); err == nil {
+		t.Fatal("Expected a failing pre-post plugin to stop the result.")
+	}
+	if len(posted()) != n {
+		t.Fatal("Expected nothing to be posted after a veto.")
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/codegangsta/cli"
+)
+
+// headToHeadWeight is how many matches the ratings-based prediction counts
+// for when combined with a head-to-head record, so that a short record only
+// nudges the prediction.
+const headToHeadWeight = 10
+
+// upsetThreshold is the pre-match win probability below which a win is an
+// upset.
+const upsetThreshold = 0.25
+
+// prediction is the chance of a player beating an opponent.
+type prediction struct {
+	// Ratings is the win probability from the players' current ratings alone.
+	Ratings float64
+
+	// Record is the player's singles record against the opponent.
+	Record record
+
+	// Probability combines Ratings with Record.
+	Probability float64
+}
+
+// predict estimates player's chance of beating opponent in the current game
+// as of now, from their ratings and head-to-head record.
+func (h *gobeatHistory) predict(player, opponent string, now time.Time) *prediction {
+	rs := h.standings(settings.Game, now)
+	p := &prediction{Ratings: eloExpected(rs.get(player), rs.get(opponent))}
+	if r, ok := h.headToHead()[player][opponent]; ok {
+		p.Record = *r
+	}
+	played := float64(p.Record.Wins + p.Record.Losses)
+	p.Probability = (float64(p.Record.Wins) + headToHeadWeight*p.Ratings) /
+		(played + headToHeadWeight)
+	return p
+}
+
+// isUpset returns whether the winner of m had less than upsetThreshold chance
+// of winning going by the ratings before it. Doubles results are never upsets.
+func (h *gobeatHistory) isUpset(m *matchResult) bool {
+	before := h.ratingsBefore(m)
+	if before == nil || m.doubles() {
+		return false
+	}
+	winner, loser := m.Player, m.Opponent
+	if !m.Won {
+		winner, loser = loser, winner
+	}
+	return eloExpected(before.get(winner), before.get(loser)) < upsetThreshold
+}
+
+// predictCommand returns the 'gobeat predict' command.
+func predictCommand() cli.Command {
+	return cli.Command{
+		Name:      "predict",
+		ShortName: "p",
+		Description: "`predict` estimates your chance of beating an opponent in the " +
+			"current game from ratings and your head-to-head record.",
+		Usage: "predict [opponent]",
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "upsets",
+				Usage: "call out big upsets in announcements",
+			},
+			cli.BoolFlag{
+				Name:  "no-upsets",
+				Usage: "stop calling out upsets",
+			},
+		},
+		Action: func(c *cli.Context) {
+			if c.Bool("upsets") || c.Bool("no-upsets") {
+				settings.UpsetAlerts = c.Bool("upsets")
+				if settings.UpsetAlerts {
+					fmt.Println("Announcing upsets")
+				} else {
+					fmt.Println("Not announcing upsets")
+				}
+
+				if err := settings.save(); err != nil {
+					printError(err)
+				}
+				return
+			}
+			if len(c.Args()) == 0 {
+				printError(fmt.Errorf("missing opponent name."))
+			}
+			opponent := c.Args().First()
+
+			h, err := retrieveHistory()
+			if err != nil {
+				printError(err)
+			}
+			p := h.predict(settings.User, opponent, time.Now())
+			fmt.Printf("%s has a %.0f%% chance of beating %s at %s\n", settings.User,
+				100*p.Probability, opponent, settings.Game)
+			fmt.Printf("  Ratings:      %.0f%%\n", 100*p.Ratings)
+			fmt.Printf("  Head-to-head: %d-%d\n", p.Record.Wins, p.Record.Losses)
+		},
+	}
+}
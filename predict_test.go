@@ -0,0 +1,57 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPredict(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	h := mockHistoryFile(t)
+	if p := h.predict("alex", "oleg", time.Now()); p.Probability != 0.5 {
+		t.Fatalf("Expected an even chance between new players, got %f", p.Probability)
+	}
+
+	for i := 0; i < 10; i++ {
+		h.add(&matchResult{Player: "alex", Opponent: "oleg", Game: "ping pong",
+			Won: true})
+	}
+	p := h.predict("alex", "oleg", time.Now())
+	if p.Record.Wins != 10 || p.Ratings <= 0.5 {
+		t.Fatalf("Expected the record and ratings to favor alex, got %+v", p)
+	}
+	if want := (10 + headToHeadWeight*p.Ratings) / 20; math.Abs(p.Probability-want) > 1e-9 {
+		t.Fatalf("Expected %f, got %f", want, p.Probability)
+	}
+	if q := h.predict("oleg", "alex", time.Now()); math.Abs(q.Probability+p.Probability-1) > 1e-9 {
+		t.Fatalf("Expected predictions to be symmetric, got %f and %f", p.Probability,
+			q.Probability)
+	}
+}
+
+func TestUpsetAlert(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	h := mockHistoryFile(t)
+	for i := 0; i < 30; i++ {
+		h.add(&matchResult{Player: "alex", Opponent: "ivan", Game: "ping pong",
+			Won: true})
+	}
+	upset := &matchResult{Player: "alex", Opponent: "ivan", Game: "ping pong",
+		Score: "15-21", Won: false}
+	h.add(upset)
+	if !h.isUpset(upset) {
+		t.Fatal("Expected a loss to a much lower rated player to be an upset.")
+	}
+
+	msg := mockFormatResult(t, newAnnouncement(upset, h), nil)
+	if strings.HasPrefix(msg, "🏓 Upset alert!") {
+		t.Fatal("Expected upsets to be off by default.")
+	}
+	settings.UpsetAlerts = true
+	msg = mockFormatResult(t, newAnnouncement(upset, h), nil)
+	if !strings.HasPrefix(msg, "🏓 Upset alert! ivan beat alex") {
+		t.Fatalf("Expected an upset alert, got %q", msg)
+	}
+}
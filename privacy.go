@@ -0,0 +1,163 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/codegangsta/cli"
+)
+
+// How opponents are named in announcements.
+const (
+	// opponentNamesFull names opponents as usual, by handle if they have one.
+	opponentNamesFull = "full"
+
+	// opponentNamesInitials names opponents by their initials, e.g. "O.K.".
+	opponentNamesInitials = "initials"
+
+	// opponentNamesPseudonyms names each opponent by a pseudonym of their
+	// own, e.g. "Player 3fa2".
+	opponentNamesPseudonyms = "pseudonyms"
+)
+
+// credentialPseudonym names the pseudonym key in the credential store.
+const credentialPseudonym = "pseudonym"
+
+// initials returns the initials of name, e.g. "O.K." for "oleg kovalenko".
+func initials(name string) string {
+	var out strings.Builder
+	parts := strings.FieldsFunc(name, func(r rune) bool {
+		return unicode.IsSpace(r) || r == '.' || r == '_' || r == '-' || r == '@'
+	})
+	for _, part := range parts {
+		for _, r := range part {
+			out.WriteRune(unicode.ToUpper(r))
+			out.WriteByte('.')
+			break
+		}
+	}
+	if out.Len() == 0 {
+		return name
+	}
+	return out.String()
+}
+
+// pseudonym returns name's pseudonym, derived from the pseudonym key so it
+// is the same in every announcement.
+func (g *gobeatSettings) pseudonym(name string) string {
+	mac := hmac.New(sha256.New, []byte(g.PseudonymKey))
+	mac.Write([]byte(name))
+	return "Player " + hex.EncodeToString(mac.Sum(nil))[:4]
+}
+
+// setPseudonymKey loads the pseudonym key from the credential store,
+// generating and storing one the first time pseudonyms are used.
+func (g *gobeatSettings) setPseudonymKey() error {
+	key, err := credential(credentialPseudonym)
+	if err != nil {
+		return err
+	}
+	if key == "" {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+		key = hex.EncodeToString(b)
+		if err := storeCredential(credentialPseudonym, key); err != nil {
+			return err
+		}
+	}
+	g.PseudonymKey = key
+	return nil
+}
+
+// publicName returns how opponent name is referred to in announcements. The
+// history and stats always keep their real name.
+func (g *gobeatSettings) publicName(name string) string {
+	switch g.OpponentNames {
+	case opponentNamesInitials:
+		return initials(name)
+	case opponentNamesPseudonyms:
+		return g.pseudonym(name)
+	}
+	return g.mention(name)
+}
+
+// publicPlayer returns how player name is referred to in announcements: the
+// current user as usual and anyone else as an opponent.
+func (g *gobeatSettings) publicPlayer(name string) string {
+	if name == g.User {
+		return name
+	}
+	return g.publicName(name)
+}
+
+// privacyCommand returns the 'gobeat privacy' command.
+func privacyCommand() cli.Command {
+	return cli.Command{
+		Name: "privacy",
+		Description: "`privacy` sets how opponents are named in announcements: in " +
+			"full, by initials, or by pseudonyms. The local history and stats always " +
+			"keep real names. --no-post makes results unannounced by default.",
+		Usage: "privacy [full|initials|pseudonyms] [--no-post|--post]",
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "no-post",
+				Usage: "record results without announcing them unless 'gobeat result --post' is given",
+			},
+			cli.BoolFlag{
+				Name:  "post",
+				Usage: "announce results again by default",
+			},
+		},
+		Action: func(c *cli.Context) {
+			if c.Bool("no-post") || c.Bool("post") {
+				settings.NoPost = c.Bool("no-post")
+				if settings.NoPost {
+					fmt.Println("Recording results without announcing them by default")
+				} else {
+					fmt.Println("Announcing results by default")
+				}
+				if len(c.Args()) == 0 {
+					if err := settings.save(); err != nil {
+						printError(err)
+					}
+					return
+				}
+			}
+			if len(c.Args()) == 0 {
+				mode := settings.OpponentNames
+				if mode == "" {
+					mode = opponentNamesFull
+				}
+				fmt.Printf("Opponents are named in announcements by: %s\n", mode)
+				return
+			}
+
+			mode := strings.ToLower(c.Args().First())
+			switch mode {
+			case opponentNamesFull, opponentNamesInitials:
+			case opponentNamesPseudonyms:
+				if err := settings.setPseudonymKey(); err != nil {
+					printError(err)
+				}
+			default:
+				printError(fmt.Errorf("unknown privacy mode %q; use full, initials or pseudonyms.", mode))
+			}
+			settings.OpponentNames = mode
+			if mode == opponentNamesFull {
+				settings.OpponentNames = ""
+			}
+			fmt.Printf("Set opponent names in announcements to %s\n", mode)
+
+			if err := settings.save(); err != nil {
+				printError(err)
+			}
+		},
+	}
+}
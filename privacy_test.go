@@ -0,0 +1,114 @@
+package main
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestInitials(t *testing.T) {
+	for name, want := range map[string]string{
+		"oleg":           "O.",
+		"oleg kovalenko": "O.K.",
+		"@oleg_k":        "O.K.",
+		"ádám":           "Á.",
+		"":               "",
+	} {
+		if got := initials(name); got != want {
+			t.Fatalf("Expected the initials of %q to be %q, got %q", name, want, got)
+		}
+	}
+}
+
+func TestPublicName(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	settings.Roster = map[string]*rosterEntry{"oleg": {Handle: "@OlegK"}}
+
+	if got := settings.publicName("oleg"); got != "@OlegK" {
+		t.Fatalf("Expected oleg to be mentioned by handle, got %q", got)
+	}
+
+	settings.OpponentNames = opponentNamesInitials
+	if got := settings.publicName("oleg"); got != "O." {
+		t.Fatalf("Expected oleg's initials, got %q", got)
+	}
+
+	settings.OpponentNames = opponentNamesPseudonyms
+	settings.PseudonymKey = "secret"
+	p := settings.publicName("oleg")
+	if !strings.HasPrefix(p, "Player ") || strings.Contains(p, "oleg") {
+		t.Fatalf("Expected a pseudonym, got %q", p)
+	}
+	if settings.publicName("oleg") != p || settings.publicName("dana") == p {
+		t.Fatal("Expected each opponent to keep a pseudonym of their own.")
+	}
+	settings.PseudonymKey = "another secret"
+	if settings.publicName("oleg") == p {
+		t.Fatal("Expected pseudonyms to depend on the key.")
+	}
+}
+
+func TestAnnouncementPrivacy(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	settings.OpponentNames = opponentNamesInitials
+	r := &matchResult{Player: "alex", Opponent: "oleg kovalenko", Game: "ping pong",
+		Score: "21-15", Won: true, Handicap: 3}
+
+	a := newAnnouncement(r, nil)
+	if a.Opponent != "O.K." || strings.Contains(a.Handicap, "oleg") {
+		t.Fatalf("Expected the opponent to be named by initials, got %q and %q",
+			a.Opponent, a.Handicap)
+	}
+	if r.Opponent != "oleg kovalenko" {
+		t.Fatal("Expected the result to keep the real name.")
+	}
+}
+
+func TestPseudonymKeyStored(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	settings.OpponentNames = opponentNamesPseudonyms
+	if err := settings.setPseudonymKey(); err != nil {
+		t.Fatalf("Expected a pseudonym key: %s", err)
+	}
+	key := settings.PseudonymKey
+	if err := settings.save(); err != nil {
+		t.Fatalf("Could not save settings: %s", err)
+	}
+	b, err := ioutil.ReadFile(gobeatPath)
+	if err != nil {
+		t.Fatalf("Could not read settings: %s", err)
+	}
+	if key == "" || strings.Contains(string(b), key) {
+		t.Fatalf("Expected the pseudonym key to be kept out of the settings, got %s", b)
+	}
+	if s, err := retrieveSettings(); err != nil || s.PseudonymKey != key {
+		t.Fatal("Expected the pseudonym key from the store.")
+	}
+}
+
+func TestMigratePseudonymKey(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	old := `{"target_url":"foo.gov","user":"alex","opponent_names":"pseudonyms",` +
+		`"pseudonym_key":"s3cret"}`
+	if err := ioutil.WriteFile(gobeatPath, []byte(old), 0644); err != nil {
+		t.Fatalf("Could not write settings: %s", err)
+	}
+
+	s, err := retrieveSettings()
+	if err != nil {
+		t.Fatalf("Could not retrieve settings: %s", err)
+	}
+	if s.PseudonymKey != "s3cret" {
+		t.Fatalf("Expected the old pseudonym key to be kept, got %q", s.PseudonymKey)
+	}
+	if key, _ := credential(credentialPseudonym); key != "s3cret" {
+		t.Fatalf("Expected the pseudonym key to be moved to the store, got %q", key)
+	}
+	b, err := ioutil.ReadFile(gobeatPath)
+	if err != nil {
+		t.Fatalf("Could not read settings: %s", err)
+	}
+	if strings.Contains(string(b), "s3cret") {
+		t.Fatalf("Expected the pseudonym key to be removed from the settings, got %s", b)
+	}
+}
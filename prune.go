@@ -0,0 +1,391 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/codegangsta/cli"
+)
+
+// historySummary is what the history keeps of results once they have been
+// pruned: enough to carry records, streaks and ratings on from where the
+// pruned results left off.
+type historySummary struct {
+	// Before is the date every pruned result is older than.
+	Before time.Time `json:"before"`
+
+	// Count is how many results have been pruned.
+	Count int `json:"count"`
+
+	// Streaks are the runs of wins each player had going at the end of the
+	// results they recorded, as stats counts them.
+	Streaks map[string]*prunedStreak `json:"streaks"`
+
+	// Games summarizes the pruned results of each game.
+	Games map[string]*gameSummary `json:"games"`
+}
+
+// prunedStreak is a player's current and best run of wins.
+type prunedStreak struct {
+	Current int `json:"current"`
+	Best    int `json:"best"`
+}
+
+// gameSummary summarizes the pruned results of a single game.
+type gameSummary struct {
+	// Records are each player's records in the results they recorded.
+	Records map[string]*record `json:"records"`
+
+	// Singles are each player's singles records counting both sides, as the
+	// standings do, and Runs the singles wins they had going.
+	Singles map[string]*record `json:"singles"`
+	Runs    map[string]int     `json:"runs"`
+
+	// HeadToHead is every player's singles record against every other player,
+	// keyed by player and then opponent.
+	HeadToHead map[string]map[string]*record `json:"head_to_head"`
+
+	// Series are each player's records against each opponent in the results
+	// they recorded, as rivalry series and first wins are counted, keyed by
+	// player and then opponent.
+	Series map[string]map[string]*record `json:"series,omitempty"`
+
+	// Ratings are the singles and doubles ratings after the last pruned
+	// result, before any idling.
+	Ratings        ratings `json:"ratings"`
+	DoublesRatings ratings `json:"doubles_ratings,omitempty"`
+
+	// RatingStates and DoublesRatingStates are every player's full state
+	// behind those ratings, in RatingSystem for singles, so that rating
+	// carries on exactly as if nothing had been pruned. Summaries from
+	// before they were kept only have the ratings.
+	RatingSystem        string                  `json:"rating_system,omitempty"`
+	RatingStates        map[string]*ratingState `json:"rating_states,omitempty"`
+	DoublesRatingStates map[string]*ratingState `json:"doubles_rating_states,omitempty"`
+
+	// LastPlayed is when each player last played singles and doubles.
+	LastPlayed        map[string]time.Time `json:"last_played"`
+	LastPlayedDoubles map[string]time.Time `json:"last_played_doubles,omitempty"`
+}
+
+// game returns the summary of game, or nil if s is nil or none of its results
+// were pruned.
+func (s *historySummary) game(game string) *gameSummary {
+	if s == nil {
+		return nil
+	}
+	return s.Games[game]
+}
+
+// streak returns player's run of wins at the end of the pruned results.
+func (s *historySummary) streak(player string) *prunedStreak {
+	if s == nil || s.Streaks[player] == nil {
+		return new(prunedStreak)
+	}
+	return s.Streaks[player]
+}
+
+// record returns player's record across the pruned results they recorded.
+func (s *historySummary) record(player string) *record {
+	rec := new(record)
+	if s == nil {
+		return rec
+	}
+	for _, g := range s.Games {
+		if r := g.Records[player]; r != nil {
+			rec.Wins += r.Wins
+			rec.Losses += r.Losses
+		}
+	}
+	return rec
+}
+
+// series returns player's record against opponent across the pruned results
+// they recorded.
+func (s *historySummary) series(player, opponent string) *record {
+	rec := new(record)
+	if s == nil {
+		return rec
+	}
+	for _, g := range s.Games {
+		if r := g.Series[player][opponent]; r != nil {
+			rec.Wins += r.Wins
+			rec.Losses += r.Losses
+		}
+	}
+	return rec
+}
+
+// playedDoubles reports whether player has any pruned doubles results.
+func (s *historySummary) playedDoubles(player string) bool {
+	if s == nil {
+		return false
+	}
+	for _, g := range s.Games {
+		if _, ok := g.LastPlayedDoubles[player]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// seed starts rs off with the singles or doubles ratings of game at the end
+// of the pruned results: exactly, from the full states if they were kept for
+// the same rating system, or otherwise from the ratings alone.
+func (g *gameSummary) seed(rs ratingSystem, game string, doubles bool) {
+	states, ratings := g.RatingStates, g.Ratings
+	if doubles {
+		states, ratings = g.DoublesRatingStates, g.DoublesRatings
+	} else if g.RatingSystem != ratingSystemName(game) {
+		states = nil
+	}
+	if states != nil {
+		for name, s := range states {
+			rs.restore(name, s)
+		}
+		return
+	}
+	for name, rating := range ratings {
+		rs.seed(name, rating)
+	}
+}
+
+// lastPlayed returns when each player last played singles or doubles.
+func (g *gameSummary) lastPlayed(doubles bool) map[string]time.Time {
+	if doubles {
+		return g.LastPlayedDoubles
+	}
+	return g.LastPlayed
+}
+
+// newGameSummary returns an empty gameSummary.
+func newGameSummary() *gameSummary {
+	return &gameSummary{
+		Records:           make(map[string]*record),
+		Singles:           make(map[string]*record),
+		Runs:              make(map[string]int),
+		HeadToHead:        make(map[string]map[string]*record),
+		Series:            make(map[string]map[string]*record),
+		Ratings:           make(ratings),
+		LastPlayed:        make(map[string]time.Time),
+		LastPlayedDoubles: make(map[string]time.Time),
+	}
+}
+
+// getRecord returns the record for key in m, adding it if necessary.
+func getRecord(m map[string]*record, key string) *record {
+	r, ok := m[key]
+	if !ok {
+		r = new(record)
+		m[key] = r
+	}
+	return r
+}
+
+// summarize returns the summary of results, ordered from oldest to newest,
+// carried on from the summary already in h.
+func (h *gobeatHistory) summarize(results []*matchResult, before time.Time) *historySummary {
+	old := &gobeatHistory{Results: results, Pruned: h.Pruned}
+	s := &historySummary{
+		Before:  before,
+		Count:   len(results),
+		Streaks: make(map[string]*prunedStreak),
+		Games:   make(map[string]*gameSummary),
+	}
+	if h.Pruned != nil {
+		s.Count += h.Pruned.Count
+		if h.Pruned.Before.After(before) {
+			s.Before = h.Pruned.Before
+		}
+		for name, st := range h.Pruned.Streaks {
+			copied := *st
+			s.Streaks[name] = &copied
+		}
+		for game, g := range h.Pruned.Games {
+			sum := newGameSummary()
+			for name, r := range g.Records {
+				*getRecord(sum.Records, name) = *r
+			}
+			for name, r := range g.Singles {
+				*getRecord(sum.Singles, name) = *r
+			}
+			for name, n := range g.Runs {
+				sum.Runs[name] = n
+			}
+			for player, opponents := range g.HeadToHead {
+				sum.HeadToHead[player] = make(map[string]*record)
+				for opponent, r := range opponents {
+					*getRecord(sum.HeadToHead[player], opponent) = *r
+				}
+			}
+			for player, opponents := range g.Series {
+				sum.Series[player] = make(map[string]*record)
+				for opponent, r := range opponents {
+					*getRecord(sum.Series[player], opponent) = *r
+				}
+			}
+			for name, date := range g.LastPlayed {
+				sum.LastPlayed[name] = date
+			}
+			for name, date := range g.LastPlayedDoubles {
+				sum.LastPlayedDoubles[name] = date
+			}
+			s.Games[game] = sum
+		}
+	}
+
+	for _, r := range results {
+		g, ok := s.Games[r.Game]
+		if !ok {
+			g = newGameSummary()
+			s.Games[r.Game] = g
+		}
+		getRecord(g.Records, r.Player).add(r.Won)
+		if g.Series[r.Player] == nil {
+			g.Series[r.Player] = make(map[string]*record)
+		}
+		getRecord(g.Series[r.Player], r.Opponent).add(r.Won)
+		st, ok := s.Streaks[r.Player]
+		if !ok {
+			st = new(prunedStreak)
+			s.Streaks[r.Player] = st
+		}
+		if r.Won {
+			st.Current++
+			if st.Current > st.Best {
+				st.Best = st.Current
+			}
+		} else {
+			st.Current = 0
+		}
+
+		if r.doubles() {
+			for _, name := range r.players() {
+				g.LastPlayedDoubles[name] = r.Date
+			}
+			continue
+		}
+		winner, loser := r.Player, r.Opponent
+		if !r.Won {
+			winner, loser = loser, winner
+		}
+		getRecord(g.Singles, winner).Wins++
+		getRecord(g.Singles, loser).Losses++
+		g.Runs[winner]++
+		g.Runs[loser] = 0
+		for _, pair := range [][2]string{{winner, loser}, {loser, winner}} {
+			if g.HeadToHead[pair[0]] == nil {
+				g.HeadToHead[pair[0]] = make(map[string]*record)
+			}
+			getRecord(g.HeadToHead[pair[0]], pair[1]).add(pair[0] == winner)
+		}
+		for _, name := range r.players() {
+			g.LastPlayed[name] = r.Date
+		}
+	}
+
+	for game, g := range s.Games {
+		rs := old.replay(game, nil)
+		g.Ratings, g.RatingStates = rs.ratings(), rs.states()
+		g.RatingSystem = ratingSystemName(game)
+		if len(g.LastPlayedDoubles) > 0 {
+			rs := old.replayDoubles(game)
+			g.DoublesRatings, g.DoublesRatingStates = rs.ratings(), rs.states()
+		}
+	}
+	return s
+}
+
+// prune removes the results older than before from h, returning them oldest
+// first, and folds them into h's summary.
+func (h *gobeatHistory) prune(before time.Time) []*matchResult {
+	var pruned, kept []*matchResult
+	for _, r := range h.Results {
+		if r.Date.Before(before) {
+			pruned = append(pruned, r)
+		} else {
+			kept = append(kept, r)
+		}
+	}
+	if len(pruned) == 0 {
+		return nil
+	}
+	h.Pruned = h.summarize(pruned, before)
+	h.Results = kept
+	return pruned
+}
+
+// writeArchive writes results to a new gzipped file at path in the same form
+// as the history file. It refuses to overwrite an existing file.
+func writeArchive(path string, results []*matchResult) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		if os.IsExist(err) {
+			return fmt.Errorf("%s already exists; choose a new archive file.", path)
+		}
+		return err
+	}
+	gz := gzip.NewWriter(f)
+	if err := json.NewEncoder(gz).Encode(&gobeatHistory{Results: results}); err != nil {
+		f.Close()
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// historyPruneCommand returns the 'gobeat history prune' command.
+func historyPruneCommand() cli.Command {
+	return cli.Command{
+		Name: "prune",
+		Description: "`history prune` moves old results out of the history into a " +
+			"gzipped archive, keeping a summary so records, streaks and ratings carry on.",
+		Usage: "history prune --before 2022-01-01 --archive old.json.gz",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "before",
+				Usage: "prune results older than this date, e.g. 2022-01-01",
+			},
+			cli.StringFlag{
+				Name:  "archive",
+				Usage: "gzipped file to write the pruned results to",
+			},
+		},
+		Action: func(c *cli.Context) {
+			if c.String("before") == "" {
+				printError(fmt.Errorf("missing --before date."))
+			}
+			before, err := time.ParseInLocation(filterDateFormat, c.String("before"), time.Local)
+			if err != nil {
+				printError(fmt.Errorf("--before must be a date like 2022-01-01."))
+			}
+			if c.String("archive") == "" {
+				printError(fmt.Errorf("missing --archive file; pruned results are only kept there."))
+			}
+
+			h, err := retrieveHistory()
+			if err != nil {
+				printError(err)
+			}
+			pruned := h.prune(before)
+			if len(pruned) == 0 {
+				fmt.Printf("No results before %s.\n", c.String("before"))
+				return
+			}
+			if err := writeArchive(c.String("archive"), pruned); err != nil {
+				printError(err)
+			}
+			if err := h.save(); err != nil {
+				printError(err)
+			}
+			fmt.Printf("Archived %d results before %s to %s, %d remain\n", len(pruned),
+				c.String("before"), c.String("archive"), len(h.Results))
+		},
+	}
+}
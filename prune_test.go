@@ -0,0 +1,200 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// mockDatedHistory returns a history of singles results a day apart, starting
+// on 2021-12-01, along with a doubles result.
+func mockDatedHistory() *gobeatHistory {
+	h := new(gobeatHistory)
+	start := time.Date(2021, 12, 1, 12, 0, 0, 0, time.Local)
+	players := [][2]string{{"alex", "oleg"}, {"oleg", "dana"}, {"dana", "alex"}}
+	for i := 0; i < 60; i++ {
+		p := players[i%len(players)]
+		h.add(&matchResult{Player: p[0], Opponent: p[1], Won: i%4 != 1,
+			Score: "21-15", Game: "ping-pong", Date: start.Add(time.Duration(i) * 24 * time.Hour)})
+		if i == 0 {
+			h.add(&matchResult{Player: "alex", Partner: "dana", Opponent: "oleg",
+				OpponentPartner: "sam", Won: true, Game: "ping-pong", Date: start.Add(time.Hour)})
+		}
+	}
+	return h
+}
+
+func TestPruneKeepsAggregates(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	settings.Game = "ping-pong"
+	now := time.Date(2022, 3, 1, 0, 0, 0, 0, time.Local)
+	full := mockDatedHistory()
+	h := mockDatedHistory()
+
+	first := time.Date(2022, 1, 1, 0, 0, 0, 0, time.Local)
+	if pruned := h.prune(first); len(pruned) != 32 {
+		t.Fatalf("Expected 32 results pruned, got %d", len(pruned))
+	}
+	// Pruning in two steps should come to the same summary.
+	if pruned := h.prune(first.Add(10 * 24 * time.Hour)); len(pruned) != 10 {
+		t.Fatalf("Expected 10 more results pruned, got %d", len(pruned))
+	}
+	if h.Pruned.Count != 42 || len(h.Results) != 19 {
+		t.Fatalf("Expected 42 pruned and 19 kept, got %d and %d", h.Pruned.Count, len(h.Results))
+	}
+
+	for _, player := range []string{"alex", "oleg", "dana"} {
+		want, got := full.stats(player), h.stats(player)
+		if got.Wins != want.Wins || got.Losses != want.Losses ||
+			got.Streak != want.Streak || got.BestStreak != want.BestStreak {
+			t.Fatalf("Expected %s's stats %+v, got %+v", player, want, got)
+		}
+		if got.Rating != want.Rating {
+			t.Fatalf("Expected %s's rating %s, got %s", player, want.Rating, got.Rating)
+		}
+		if got.DoublesRating == "" {
+			t.Fatalf("Expected %s to keep a doubles rating", player)
+		}
+		if !reflect.DeepEqual(full.statsReport(player, now).Games, h.statsReport(player, now).Games) {
+			t.Fatalf("Expected %s's record by game to be kept", player)
+		}
+	}
+	if !reflect.DeepEqual(full.headToHead(), h.headToHead()) {
+		t.Fatal("Expected head-to-head records to be kept.")
+	}
+
+	want, got := full.leaderboard("ping-pong", now), h.leaderboard("ping-pong", now)
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d leaderboard rows, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if got[i].Player != want[i].Player || got[i].Wins != want[i].Wins ||
+			got[i].Losses != want[i].Losses || got[i].Streak != want[i].Streak ||
+			math.Abs(got[i].Rating-want[i].Rating) > 1e-9 {
+			t.Fatalf("Expected leaderboard row %+v, got %+v", want[i], got[i])
+		}
+	}
+}
+
+func TestPruneNothing(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	h := mockDatedHistory()
+	if pruned := h.prune(time.Date(2020, 1, 1, 0, 0, 0, 0, time.Local)); pruned != nil {
+		t.Fatalf("Expected nothing pruned, got %d results", len(pruned))
+	}
+	if h.Pruned != nil {
+		t.Fatal("Expected no summary when nothing was pruned.")
+	}
+}
+
+func TestWriteArchive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "old.json.gz")
+	results := mockDatedHistory().Results[:3]
+	if err := writeArchive(path, results); err != nil {
+		t.Fatalf("Could not write archive: %s", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Could not open archive: %s", err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("Expected a gzipped archive: %s", err)
+	}
+	var archived gobeatHistory
+	if err := json.NewDecoder(gz).Decode(&archived); err != nil {
+		t.Fatalf("Could not decode archive: %s", err)
+	}
+	if len(archived.Results) != 3 || archived.Results[2].Opponent != results[2].Opponent {
+		t.Fatalf("Expected the 3 results in the archive, got %d", len(archived.Results))
+	}
+
+	if err := writeArchive(path, results); err == nil {
+		t.Fatal("Expected an existing archive not to be overwritten.")
+	}
+}
+
+func TestPruneKeepsMilestonesAndSeries(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	start := time.Date(2021, 12, 1, 12, 0, 0, 0, time.Local)
+	results := func() *gobeatHistory {
+		h := new(gobeatHistory)
+		add := func(opponent string, won bool) {
+			h.add(&matchResult{Player: "alex", Opponent: opponent, Won: won, Score: "21-15",
+				Game: "ping pong", Date: start.Add(time.Duration(len(h.Results)) * 24 * time.Hour)})
+		}
+		add("oleg", false)
+		add("oleg", true)
+		for i := 0; i < 8; i++ {
+			add("dana", true)
+		}
+		return h
+	}
+	full, h := results(), results()
+	if pruned := h.prune(start.Add(30 * 24 * time.Hour)); len(pruned) != 10 {
+		t.Fatalf("Expected every result pruned, got %d", len(pruned))
+	}
+
+	for _, opponent := range []string{"dana", "oleg"} {
+		r := &matchResult{Player: "alex", Opponent: opponent, Won: true, Score: "21-15",
+			Game: "ping pong", Date: start.Add(40 * 24 * time.Hour)}
+		full.add(r)
+		copied := *r
+		h.add(&copied)
+
+		if want, got := full.milestones("alex"), h.milestones("alex"); !reflect.DeepEqual(want, got) {
+			t.Fatalf("Expected milestones %q after pruning, got %q", want, got)
+		}
+		wantWins, wantLosses := full.series("alex", opponent)
+		if wins, losses := h.series("alex", opponent); wins != wantWins || losses != wantLosses {
+			t.Fatalf("Expected a %d-%d series against %s, got %d-%d",
+				wantWins, wantLosses, opponent, wins, losses)
+		}
+	}
+	if got := h.milestones("alex"); len(got) != 0 {
+		t.Fatalf("Expected no first win against oleg again, got %q", got)
+	}
+	if wins, losses := h.series("alex", "oleg"); wins != 2 || losses != 1 {
+		t.Fatalf("Expected a 2-1 series against oleg, got %d-%d", wins, losses)
+	}
+}
+
+func TestPruneKeepsRatingStates(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	for _, system := range []string{ratingSystemElo, ratingSystemGlicko2} {
+		settings.RatingSystems = map[string]string{"ping-pong": system}
+		full, h := mockDatedHistory(), mockDatedHistory()
+		for _, hist := range []*gobeatHistory{full, h} {
+			last := hist.Results[len(hist.Results)-1].Date
+			hist.add(&matchResult{Player: "oleg", Partner: "sam", Opponent: "alex",
+				OpponentPartner: "dana", Won: true, Game: "ping-pong", Date: last.Add(time.Hour)})
+		}
+		h.prune(time.Date(2022, 1, 1, 0, 0, 0, 0, time.Local))
+
+		// Carry the summary through the history file, as a later run would.
+		b, err := json.Marshal(h)
+		if err != nil {
+			t.Fatalf("Could not encode history: %s", err)
+		}
+		h = new(gobeatHistory)
+		if err := json.Unmarshal(b, h); err != nil {
+			t.Fatalf("Could not decode history: %s", err)
+		}
+
+		if want, got := full.replay("ping-pong", nil).states(),
+			h.replay("ping-pong", nil).states(); !reflect.DeepEqual(want, got) {
+			t.Fatalf("Expected %s singles ratings to carry on exactly after pruning", system)
+		}
+		if want, got := full.replayDoubles("ping-pong").states(),
+			h.replayDoubles("ping-pong").states(); !reflect.DeepEqual(want, got) {
+			t.Fatal("Expected doubles ratings to carry on exactly after pruning.")
+		}
+	}
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/codegangsta/cli"
+)
+
+// ratingMean is the rating every player starts at and inactive players decay
+// toward.
+const ratingMean = 1500
+
+// Names of the available rating systems.
+const (
+	ratingSystemElo     = "elo"
+	ratingSystemGlicko2 = "glicko2"
+)
+
+// ratingSystem computes player ratings from results, one at a time.
+type ratingSystem interface {
+	// get returns name's rating, or ratingMean if they have not played.
+	get(name string) float64
+
+	// apply updates the ratings of both players in m.
+	apply(m *matchResult)
+
+	// idle accounts for name having not played for d, decaying their rating
+	// toward the mean per decay, which may be nil.
+	idle(name string, d time.Duration, decay *ratingDecay)
+
+	// describe formats name's rating for display.
+	describe(name string) string
+
+	// ratings returns a snapshot of every player's rating.
+	ratings() ratings
+
+	// seed starts name off at rating, as carried over from pruned results
+	// summarized before their full states were kept.
+	seed(name string, rating float64)
+
+	// states returns a snapshot of every player's full state, for carrying
+	// their ratings on exactly once the results behind them are pruned.
+	states() map[string]*ratingState
+
+	// restore sets name's full state, as returned by states.
+	restore(name string, s *ratingState)
+}
+
+// ratingState is a player's full state in a rating system, in the system's
+// own units: Elo only has a rating, in Mu; Glicko-2 has its mu, phi and sigma;
+// TrueSkill has the mean and uncertainty of the skill estimate, in Mu and
+// Sigma.
+type ratingState struct {
+	Mu    float64 `json:"mu"`
+	Phi   float64 `json:"phi,omitempty"`
+	Sigma float64 `json:"sigma,omitempty"`
+}
+
+// newRatingSystem returns an empty rating system of the given name.
+func newRatingSystem(name string) (ratingSystem, error) {
+	switch name {
+	case "", ratingSystemElo:
+		return newEloSystem(), nil
+	case ratingSystemGlicko2:
+		return newGlicko2System(), nil
+	}
+	return nil, fmt.Errorf("unknown rating system %q", name)
+}
+
+// handicapPointRating is how many rating points each point of handicap is
+// worth when handicap ratings are on.
+const handicapPointRating = 20
+
+// handicapBonus returns how many rating points m.Player is treated as having
+// over their actual rating, for the head start they were given. It is
+// negative if they gave one, and zero unless 'gobeat rating --handicaps' is
+// on.
+func handicapBonus(m *matchResult) float64 {
+	if !settings.HandicapRatings {
+		return 0
+	}
+	return float64(m.Handicap * handicapPointRating)
+}
+
+// ratings maps player names to their rating.
+type ratings map[string]float64
+
+// get returns name's rating, or ratingMean if they have not played.
+func (r ratings) get(name string) float64 {
+	if v, ok := r[name]; ok {
+		return v
+	}
+	return ratingMean
+}
+
+// week is the period over which rating decay is measured.
+const week = 7 * 24 * time.Hour
+
+// ratingDecay configures how the ratings of inactive players drift back toward
+// ratingMean.
+type ratingDecay struct {
+	// Weeks is how many weeks a player may go without playing before their
+	// rating starts to decay.
+	Weeks int `json:"weeks"`
+
+	// Rate is the fraction of the distance to the mean lost for every further
+	// week of inactivity.
+	Rate float64 `json:"rate"`
+}
+
+// decay moves rating toward the mean according to how long the player has been
+// idle. A nil ratingDecay leaves the rating unchanged.
+func (d *ratingDecay) decay(rating float64, idle time.Duration) float64 {
+	return ratingMean + (rating-ratingMean)*d.factor(idle)
+}
+
+// factor returns the fraction of a player's distance from the mean that
+// remains after being idle. A nil ratingDecay always returns 1.
+func (d *ratingDecay) factor(idle time.Duration) float64 {
+	if d == nil || d.Rate <= 0 {
+		return 1
+	}
+	weeks := int(idle/week) - d.Weeks
+	if weeks <= 0 {
+		return 1
+	}
+	return math.Pow(1-d.Rate, float64(weeks))
+}
+
+// ratingSystemName returns the name of the rating system used for game, as
+// ratingSystemFor picks it.
+func ratingSystemName(game string) string {
+	name := settings.RatingSystems[game]
+	if _, err := newRatingSystem(name); err != nil || name == "" {
+		return ratingSystemElo
+	}
+	return name
+}
+
+// ratingSystemFor returns an empty rating system of the kind configured for
+// game, which is its own league.
+func ratingSystemFor(game string) ratingSystem {
+	rs, err := newRatingSystem(settings.RatingSystems[game])
+	if err != nil {
+		// Settings are validated when set, so fall back rather than fail.
+		rs = newEloSystem()
+	}
+	return rs
+}
+
+// replay recomputes singles ratings for game by applying each of its singles
+// results in h in order. Before a result is applied, both players are idled
+// for any inactivity since their previous match. If fn is non-nil it is called
+// with each result and the rating system just before the result was applied;
+// fn must not modify it.
+func (h *gobeatHistory) replay(game string,
+	fn func(m *matchResult, before ratingSystem)) ratingSystem {
+
+	return h.replayInto(ratingSystemFor(game), game, false, fn, nil)
+}
+
+// replayDoubles recomputes doubles ratings for game, as replay does for
+// singles. Doubles always use the team-aware trueskillSystem.
+func (h *gobeatHistory) replayDoubles(game string) ratingSystem {
+	return h.replayInto(newTrueskillSystem(), game, true, nil, nil)
+}
+
+// replayInto applies game's singles or doubles results in h to rs, calling
+// before and after (if non-nil) around each result.
+func (h *gobeatHistory) replayInto(rs ratingSystem, game string, doubles bool,
+	before, after func(m *matchResult, rs ratingSystem)) ratingSystem {
+
+	decay := settings.Decay[game]
+	last := make(map[string]time.Time)
+	if g := h.Pruned.game(game); g != nil {
+		g.seed(rs, game, doubles)
+		for name, date := range g.lastPlayed(doubles) {
+			last[name] = date
+		}
+	}
+	for _, m := range h.Results {
+		if m.Game != game || m.doubles() != doubles {
+			continue
+		}
+		for _, name := range m.players() {
+			if prev, ok := last[name]; ok {
+				rs.idle(name, m.Date.Sub(prev), decay)
+			}
+		}
+
+		if before != nil {
+			before(m, rs)
+		}
+		rs.apply(m)
+		if after != nil {
+			after(m, rs)
+		}
+		for _, name := range m.players() {
+			last[name] = m.Date
+		}
+	}
+	return rs
+}
+
+// ratingPoint is a player's rating just after a match.
+type ratingPoint struct {
+	Date   time.Time
+	Rating float64
+}
+
+// ratingHistory returns player's singles rating in game after each of their
+// matches, oldest first.
+func (h *gobeatHistory) ratingHistory(player, game string) []ratingPoint {
+	var points []ratingPoint
+	h.replayInto(ratingSystemFor(game), game, false, nil,
+		func(m *matchResult, rs ratingSystem) {
+			if m.Player == player || m.Opponent == player {
+				points = append(points, ratingPoint{m.Date, rs.get(player)})
+			}
+		})
+	return points
+}
+
+// ratingsBefore returns the singles ratings in m's game just before m was
+// applied. It is nil for doubles results.
+func (h *gobeatHistory) ratingsBefore(m *matchResult) ratings {
+	var before ratings
+	h.replay(m.Game, func(cur *matchResult, rs ratingSystem) {
+		if cur == m {
+			before = rs.ratings()
+		}
+	})
+	return before
+}
+
+// standings returns the singles rating system for game as of now, after
+// idling every player up to now.
+func (h *gobeatHistory) standings(game string, now time.Time) ratingSystem {
+	return h.idleUntil(h.replay(game, nil), game, false, now)
+}
+
+// doublesStandings returns the doubles rating system for game as of now.
+func (h *gobeatHistory) doublesStandings(game string, now time.Time) ratingSystem {
+	return h.idleUntil(h.replayDoubles(game), game, true, now)
+}
+
+// idleUntil idles every player in rs from their last singles or doubles match
+// in game until now.
+func (h *gobeatHistory) idleUntil(rs ratingSystem, game string, doubles bool,
+	now time.Time) ratingSystem {
+
+	last := make(map[string]time.Time)
+	if g := h.Pruned.game(game); g != nil {
+		for name, date := range g.lastPlayed(doubles) {
+			last[name] = date
+		}
+	}
+	for _, m := range h.Results {
+		if m.Game != game || m.doubles() != doubles {
+			continue
+		}
+		for _, name := range m.players() {
+			last[name] = m.Date
+		}
+	}
+	for name, date := range last {
+		rs.idle(name, now.Sub(date), settings.Decay[game])
+	}
+	return rs
+}
+
+// ratingCommand returns the 'gobeat rating' command.
+func ratingCommand() cli.Command {
+	return cli.Command{
+		Name:        "rating",
+		ShortName:   "ra",
+		Description: "`rating` prints a player's rating in the current game.",
+		Usage:       "rating [player]",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "system",
+				Usage: "set the rating system for the current game: elo or glicko2",
+			},
+			cli.BoolFlag{
+				Name:  "handicaps",
+				Usage: "account for handicaps, so a player given points gains less for winning",
+			},
+			cli.BoolFlag{
+				Name:  "no-handicaps",
+				Usage: "rate handicapped matches like any other",
+			},
+			cli.BoolFlag{
+				Name:  "chart",
+				Usage: "draw the rating over time as a terminal chart",
+			},
+			cli.StringFlag{
+				Name:  "png",
+				Usage: "write the rating over time as a PNG chart to this file",
+			},
+		},
+		Action: func(c *cli.Context) {
+			if system := c.String("system"); system != "" {
+				if _, err := newRatingSystem(system); err != nil {
+					printError(err)
+				}
+				if settings.RatingSystems == nil {
+					settings.RatingSystems = make(map[string]string)
+				}
+				settings.RatingSystems[settings.Game] = system
+				fmt.Printf("Set rating system for %s to %s\n", settings.Game, system)
+
+				if err := settings.save(); err != nil {
+					printError(err)
+				}
+				return
+			}
+			if c.Bool("handicaps") || c.Bool("no-handicaps") {
+				settings.HandicapRatings = c.Bool("handicaps")
+				if settings.HandicapRatings {
+					fmt.Println("Handicapped matches now count for less")
+				} else {
+					fmt.Println("Handicapped matches now count the same as any other")
+				}
+
+				if err := settings.save(); err != nil {
+					printError(err)
+				}
+				return
+			}
+
+			player := settings.User
+			if len(c.Args()) > 0 {
+				player = c.Args().First()
+			}
+
+			h, err := retrieveHistory()
+			if err != nil {
+				printError(err)
+			}
+			rs := h.standings(settings.Game, time.Now())
+			fmt.Printf("%s's %s rating: %s\n", player, settings.Game,
+				rs.describe(player))
+
+			if c.Bool("chart") || c.String("png") != "" {
+				points := h.ratingHistory(player, settings.Game)
+				if len(points) == 0 {
+					printError(fmt.Errorf("%s has no %s results to chart.", player,
+						settings.Game))
+				}
+				if c.Bool("chart") {
+					fmt.Print(renderASCIIChart(points, chartWidth, chartHeight))
+				}
+				if path := c.String("png"); path != "" {
+					if err := writePNGChart(path, points); err != nil {
+						printError(err)
+					}
+					fmt.Printf("Wrote rating chart to %s\n", path)
+				}
+			}
+			if h.playedDoubles(player) {
+				rs = h.doublesStandings(settings.Game, time.Now())
+				fmt.Printf("%s's %s doubles rating: %s\n", player, settings.Game,
+					rs.describe(player))
+			}
+		},
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEloRatings(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	h := mockHistoryFile(t)
+	h.add(&matchResult{Player: "alex", Opponent: "oleg", Game: "ping pong",
+		Won: true})
+
+	r := h.replay("ping pong", nil)
+	if r.get("alex") != ratingMean+eloK/2 || r.get("oleg") != ratingMean-eloK/2 {
+		t.Fatalf("Expected even players to move by half of K, got %v", r.ratings())
+	}
+	if r.get("ivan") != ratingMean {
+		t.Fatal("Expected unknown players to have the initial rating.")
+	}
+	if h.replay("foosball", nil).get("alex") != ratingMean {
+		t.Fatal("Expected ratings to be computed per game.")
+	}
+}
+
+func TestHandicapRatings(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	h := mockHistoryFile(t)
+	h.add(&matchResult{Player: "alex", Opponent: "oleg", Game: "ping pong",
+		Won: true, Handicap: 5})
+
+	if r := h.replay("ping pong", nil); r.get("alex") != ratingMean+eloK/2 {
+		t.Fatalf("Expected handicaps to be ignored by default, got %v", r.ratings())
+	}
+	settings.HandicapRatings = true
+	if r := h.replay("ping pong", nil); r.get("alex") >= ratingMean+eloK/2 {
+		t.Fatalf("Expected a handicapped win to count for less, got %v", r.ratings())
+	}
+}
+
+func TestEloExpected(t *testing.T) {
+	if e := eloExpected(1800, 1400); math.Abs(e-0.909) > 0.001 {
+		t.Fatalf("Expected a 400 point favorite to win ~91%%, got %f", e)
+	}
+}
+
+func TestRatingsBefore(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	h := mockHistoryFile(t)
+	first := &matchResult{Player: "alex", Opponent: "oleg", Won: true}
+	second := &matchResult{Player: "alex", Opponent: "oleg", Won: false}
+	h.add(first)
+	h.add(second)
+
+	if r := h.ratingsBefore(first); r.get("alex") != ratingMean {
+		t.Fatalf("Expected initial rating before first match, got %v", r)
+	}
+	if r := h.ratingsBefore(second); r.get("alex") != ratingMean+eloK/2 {
+		t.Fatalf("Expected rating after first match, got %v", r)
+	}
+}
+
+func TestReplayGlicko2(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	settings.RatingSystems = map[string]string{"ping pong": ratingSystemGlicko2}
+	h := mockHistoryFile(t)
+	h.add(&matchResult{Player: "alex", Opponent: "oleg", Game: "ping pong",
+		Won: true})
+
+	if _, ok := h.replay("ping pong", nil).(*glicko2System); !ok {
+		t.Fatal("Expected the configured rating system to be used.")
+	}
+}
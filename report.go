@@ -0,0 +1,264 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/codegangsta/cli"
+)
+
+// reportRecentLength is how many recent results report pages list.
+const reportRecentLength = 20
+
+// reportFuncs are the functions available to report templates.
+var reportFuncs = template.FuncMap{
+	"date":      func(t time.Time) string { return t.Format("2006-01-02") },
+	"team":      func(r *matchResult) string { return strings.Join(r.team(), " & ") },
+	"opponents": func(r *matchResult) string { return strings.Join(r.opponentTeam(), " & ") },
+	"slug":      slug,
+	"inc":       func(i int) int { return i + 1 },
+	"winRate":   func(s *playerStats) float64 { return s.winRate() },
+}
+
+// reportLayout wraps every page of the HTML report.
+const reportLayout = `{{define "top"}}<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; max-width: 50em; margin: 2em auto; color: #222; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 2em; }
+th, td { text-align: left; padding: 0.3em 0.6em; border-bottom: 1px solid #ddd; }
+.W { color: #2a2; } .L { color: #c22; }
+</style></head><body>
+<p><a href="{{.Root}}index.html">{{.Game}} league</a></p>
+<h1>{{.Title}}</h1>
+{{end}}
+{{define "results"}}<table>
+<tr><th>Date</th><th></th><th>Players</th><th>Score</th><th>Game</th></tr>
+{{range .}}<tr><td>{{date .Date}}</td><td class="{{if .Won}}W">W{{else}}L">L{{end}}</td>
+<td>{{team .}} vs {{opponents .}}</td><td>{{.Score}}</td><td>{{.Game}}</td></tr>
+{{end}}</table>{{end}}
+{{define "bottom"}}<p><small>Generated by gobeat on {{.Generated.Format "2006-01-02 15:04"}}</small></p>
+</body></html>
+{{end}}`
+
+// reportIndex is the report's front page: the leaderboard and recent results.
+const reportIndex = `{{template "top" .}}
+<h2>Standings</h2>
+<table>
+<tr><th></th><th>Player</th><th>Rating</th><th>Record</th><th>Streak</th></tr>
+{{range $i, $row := .Standings}}<tr><td>{{inc $i}}</td>
+<td><a href="players/{{slug $row.Player}}.html">{{$row.Player}}</a></td>
+<td>{{printf "%.0f" $row.Rating}}</td><td>{{$row.Wins}}-{{$row.Losses}}</td><td>{{$row.Streak}}</td></tr>
+{{end}}</table>
+<h2>Recent results</h2>
+{{template "results" .Recent}}
+{{template "bottom" .}}`
+
+// reportPlayer is a player's page: their stats, rating chart and recent
+// results.
+const reportPlayer = `{{template "top" .}}
+<table>
+<tr><th>Record</th><td>{{.Stats.Wins}}-{{.Stats.Losses}} ({{printf "%.1f" (winRate .Stats)}}%)</td></tr>
+<tr><th>Streak</th><td>{{.Stats.Streak}} (best {{.Stats.BestStreak}})</td></tr>
+<tr><th>Rating</th><td>{{.Stats.Rating}}</td></tr>
+{{if .Stats.Form}}<tr><th>Form</th><td>{{.Stats.Form}}</td></tr>{{end}}
+</table>
+{{if .Chart}}<p><img src="{{.Chart}}" alt="Rating over time"></p>{{end}}
+<h2>Recent results</h2>
+{{template "results" .Recent}}
+{{template "bottom" .}}`
+
+// reportPage holds the fields available to report templates.
+type reportPage struct {
+	Title     string
+	Game      string
+	Generated time.Time
+
+	// Root is the relative path from the page to the top of the report.
+	Root string
+
+	Standings []*leaderboardRow
+	Recent    []*matchResult
+
+	// Stats and Chart are set on player pages. Chart is the relative path to
+	// their rating chart, if they have one.
+	Stats *playerStats
+	Chart string
+}
+
+// slug returns a version of name safe to use as a file name.
+func slug(name string) string {
+	s := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return '-'
+	}, name)
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// latest returns the last n results player took part in, newest first, or
+// the last n results of all if player is empty.
+func (h *gobeatHistory) latest(player string, n int) []*matchResult {
+	var out []*matchResult
+	for i := len(h.Results) - 1; i >= 0 && len(out) < n; i-- {
+		r := h.Results[i]
+		if player == "" {
+			out = append(out, r)
+			continue
+		}
+		for _, name := range r.players() {
+			if name == player {
+				out = append(out, r)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// writeHTMLReport writes a static site for the current game to dir: an index
+// with the standings and recent results, and a page with stats and a rating
+// chart for each player. Pages only link to each other by relative paths, so
+// dir can be served from anywhere.
+func writeHTMLReport(h *gobeatHistory, dir string, now time.Time) error {
+	tmpl := template.Must(template.New("layout").Funcs(reportFuncs).Parse(reportLayout))
+	template.Must(tmpl.New("index").Parse(reportIndex))
+	template.Must(tmpl.New("player").Parse(reportPlayer))
+
+	for _, sub := range []string{"players", "charts"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return err
+		}
+	}
+	write := func(path, name string, page *reportPage) error {
+		f, err := os.Create(filepath.Join(dir, path))
+		if err != nil {
+			return err
+		}
+		if err := tmpl.ExecuteTemplate(f, name, page); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+
+	standings := h.leaderboard(settings.Game, now)
+	err := write("index.html", "index", &reportPage{
+		Title:     settings.Game + " standings",
+		Game:      settings.Game,
+		Generated: now,
+		Standings: standings,
+		Recent:    h.latest("", reportRecentLength),
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, row := range standings {
+		page := &reportPage{
+			Title:     row.Player,
+			Game:      settings.Game,
+			Generated: now,
+			Root:      "../",
+			Stats:     h.stats(row.Player),
+			Recent:    h.latest(row.Player, reportRecentLength),
+		}
+		if points := h.ratingHistory(row.Player, settings.Game); len(points) > 0 {
+			chart := filepath.Join("charts", slug(row.Player)+".png")
+			if err := writePNGChart(filepath.Join(dir, chart), points); err != nil {
+				return err
+			}
+			page.Chart = "../" + filepath.ToSlash(chart)
+		}
+		if err := write(filepath.Join("players", slug(row.Player)+".html"), "player", page); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// markdownCell escapes s for use in a Markdown table cell.
+func markdownCell(s string) string {
+	return strings.Replace(s, "|", "\\|", -1)
+}
+
+// writeMarkdownReport writes the standings and recent results for the current
+// game to w as Markdown tables.
+func writeMarkdownReport(h *gobeatHistory, w io.Writer, now time.Time) error {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "# %s standings\n\n", markdownCell(settings.Game))
+	fmt.Fprintln(&buf, "| # | Player | Rating | Record | Streak |")
+	fmt.Fprintln(&buf, "|--:|--------|-------:|-------:|-------:|")
+	for i, row := range h.leaderboard(settings.Game, now) {
+		fmt.Fprintf(&buf, "| %d | %s | %.0f | %d-%d | %d |\n", i+1, markdownCell(row.Player),
+			row.Rating, row.Wins, row.Losses, row.Streak)
+	}
+
+	fmt.Fprint(&buf, "\n## Recent results\n\n")
+	fmt.Fprintln(&buf, "| Date | | Players | Score | Game |")
+	fmt.Fprintln(&buf, "|------|-|---------|------:|------|")
+	for _, r := range h.latest("", reportRecentLength) {
+		result := "L"
+		if r.Won {
+			result = "W"
+		}
+		fmt.Fprintf(&buf, "| %s | %s | %s vs %s | %s | %s |\n", r.Date.Format("2006-01-02"),
+			result, markdownCell(strings.Join(r.team(), " & ")),
+			markdownCell(strings.Join(r.opponentTeam(), " & ")), markdownCell(r.Score),
+			markdownCell(r.Game))
+	}
+	fmt.Fprintf(&buf, "\n_Generated by gobeat on %s._\n", now.Format("2006-01-02 15:04"))
+	_, err := io.WriteString(w, buf.String())
+	return err
+}
+
+// reportCommand returns the 'gobeat report' command.
+func reportCommand() cli.Command {
+	return cli.Command{
+		Name: "report",
+		Description: "`report` generates a league report for the current game from the " +
+			"local history.",
+		Usage: "report --html dir | --markdown",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "html",
+				Usage: "write a static site with standings, player pages and charts to this directory",
+			},
+			cli.BoolFlag{
+				Name:  "markdown",
+				Usage: "print the standings and recent results as Markdown tables",
+			},
+		},
+		Action: func(c *cli.Context) {
+			if c.String("html") == "" && !c.Bool("markdown") {
+				printError(fmt.Errorf("missing output; use --html dir or --markdown."))
+			}
+			h, err := retrieveHistory()
+			if err != nil {
+				printError(err)
+			}
+			if c.Bool("markdown") {
+				if err := writeMarkdownReport(h, os.Stdout, time.Now()); err != nil {
+					printError(err)
+				}
+			}
+			if dir := c.String("html"); dir != "" {
+				if err := writeHTMLReport(h, dir, time.Now()); err != nil {
+					printError(err)
+				}
+				// Kept off stdout when it carries the Markdown report.
+				fmt.Fprintf(os.Stderr, "Wrote report to %s\n", dir)
+			}
+		},
+	}
+}
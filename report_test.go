@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSlug(t *testing.T) {
+	if s := slug("Oleg K."); s != "oleg-k-" {
+		t.Fatalf("Expected a lowercase slug, got %q", s)
+	}
+}
+
+func TestWriteHTMLReport(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	h := mockHistoryFile(t)
+	now := time.Now()
+	h.add(&matchResult{Player: "alex", Opponent: "oleg", Game: settings.Game, Won: true,
+		Score: "21-15", Date: now.AddDate(0, 0, -1)})
+	h.add(&matchResult{Player: "alex", Opponent: "<ivan>", Game: settings.Game, Won: false,
+		Score: "19-21", Date: now})
+
+	dir, err := ioutil.TempDir("", "gobeatreport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := writeHTMLReport(h, dir, now); err != nil {
+		t.Fatalf("Expected the report to be written, got %s", err)
+	}
+
+	index, err := ioutil.ReadFile(filepath.Join(dir, "index.html"))
+	if err != nil {
+		t.Fatalf("Expected an index page, got %s", err)
+	}
+	if !strings.Contains(string(index), `href="players/oleg.html"`) {
+		t.Fatal("Expected the index to link to player pages.")
+	}
+	if strings.Contains(string(index), "<ivan>") {
+		t.Fatal("Expected names to be escaped.")
+	}
+	player, err := ioutil.ReadFile(filepath.Join(dir, "players", "alex.html"))
+	if err != nil {
+		t.Fatalf("Expected a page for alex, got %s", err)
+	}
+	if !strings.Contains(string(player), "1-1") || !strings.Contains(string(player), "../charts/alex.png") {
+		t.Fatalf("Expected alex's record and chart, got %s", player)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "charts", "alex.png")); err != nil {
+		t.Fatalf("Expected a chart for alex, got %s", err)
+	}
+}
+
+func TestWriteMarkdownReport(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	h := mockHistoryFile(t)
+	now := time.Now()
+	h.add(&matchResult{Player: "alex", Opponent: "ol|eg", Game: settings.Game, Won: true,
+		Score: "21-15", Date: now})
+
+	var buf bytes.Buffer
+	if err := writeMarkdownReport(h, &buf, now); err != nil {
+		t.Fatalf("Expected the report to be written, got %s", err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "| 1 | alex | ") {
+		t.Fatalf("Expected alex to lead the standings, got %s", out)
+	}
+	if !strings.Contains(out, "| W | alex vs ol\\|eg | 21-15 |") {
+		t.Fatalf("Expected the result with pipes escaped, got %s", out)
+	}
+}
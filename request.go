@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codegangsta/cli"
+)
+
+// Request defaults, used when the settings leave them unset.
+const (
+	defaultTimeout = 30 * time.Second
+	defaultRetries = 2
+	defaultBackoff = time.Second
+)
+
+// maxRetryWait is the longest a retry waits when a destination asks to be
+// left alone; anything longer is left to the queue.
+const maxRetryWait = time.Minute
+
+// errRateLimited is returned when a destination turned down a request with a
+// 429 or 503 and said how long to wait before trying again.
+type errRateLimited struct {
+	op   string
+	code int
+	wait time.Duration
+}
+
+func (e *errRateLimited) Error() string {
+	return fmt.Sprintf("on %s: got code %d, retry after %s", e.op, e.code, e.wait)
+}
+
+// rateLimited returns an errRateLimited for op if resp turned it down and
+// said how long to wait, or else nil.
+func rateLimited(op string, resp *http.Response) error {
+	if resp.StatusCode != http.StatusTooManyRequests &&
+		resp.StatusCode != http.StatusServiceUnavailable {
+		return nil
+	}
+	wait, ok := retryAfter(resp.Header, time.Now())
+	if !ok {
+		return nil
+	}
+	return &errRateLimited{op: op, code: resp.StatusCode, wait: wait}
+}
+
+// retryAfter returns how long after now a rate limited response asks to wait,
+// going by its Retry-After header or else its X-RateLimit-Reset header. Either
+// may be a number of seconds; Retry-After may also be an HTTP date, and
+// X-RateLimit-Reset a Unix time.
+func retryAfter(h http.Header, now time.Time) (time.Duration, bool) {
+	at := func(t time.Time) (time.Duration, bool) {
+		if d := t.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	if v := strings.TrimSpace(h.Get("Retry-After")); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			return time.Duration(n) * time.Second, true
+		}
+		if t, err := http.ParseTime(v); err == nil {
+			return at(t)
+		}
+	}
+	if v := strings.TrimSpace(h.Get("X-RateLimit-Reset")); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			return 0, false
+		}
+		// Small values are a number of seconds rather than a time.
+		if n < 1000000000 {
+			return time.Duration(n) * time.Second, true
+		}
+		return at(time.Unix(n, 0))
+	}
+	return 0, false
+}
+
+// timeout returns how long requests to destinations may take.
+func (g *gobeatSettings) timeout() time.Duration {
+	d, err := time.ParseDuration(g.Timeout)
+	if err != nil || d <= 0 {
+		return defaultTimeout
+	}
+	return d
+}
+
+// retries returns how many times a failed delivery is retried.
+func (g *gobeatSettings) retries() int {
+	if g.Retries == nil || *g.Retries < 0 {
+		return defaultRetries
+	}
+	return *g.Retries
+}
+
+// backoff returns how long to wait before the first retry.
+func (g *gobeatSettings) backoff() time.Duration {
+	d, err := time.ParseDuration(g.Backoff)
+	if err != nil || d < 0 {
+		return defaultBackoff
+	}
+	return d
+}
+
+// targetTransport returns the transport for requests to the target u. A
+// unix:// target is reached over the Unix domain socket at its path.
+func targetTransport(u *url.URL) http.RoundTripper {
+	if u.Scheme != "unix" {
+		return http.DefaultTransport
+	}
+	socket := u.Path
+	return &http.Transport{
+		Dial: func(network, addr string) (net.Conn, error) {
+			return net.DialTimeout("unix", socket, settings.timeout())
+		},
+	}
+}
+
+// targetClient returns a client for requests to the target u, with the
+// configured timeout, and the URL to make them to. A unix:// target is reached
+// over the Unix domain socket at its path.
+func targetClient(u *url.URL) (*http.Client, string) {
+	client := &http.Client{Timeout: settings.timeout(), Transport: targetTransport(u)}
+	if u.Scheme != "unix" {
+		return client, u.String()
+	}
+	// The host is never dialled, but requests need one.
+	return client, "http://unix/"
+}
+
+// targetURL returns the URL of path p relative to the target u, for a client
+// from targetClient.
+func targetURL(u *url.URL, p string) *url.URL {
+	if u.Scheme == "unix" {
+		return &url.URL{Scheme: "http", Host: "unix", Path: p}
+	}
+	return resultsFeedURL(u, p)
+}
+
+// newTargetRequest returns an authorized, signed request to the target u at
+// path relative to it, along with the client to make it with. query may be
+// nil.
+func newTargetRequest(u *url.URL, method, p string, query url.Values,
+	body []byte) (*http.Client, *http.Request, error) {
+
+	client, _ := targetClient(u)
+	target := targetURL(u, p).String()
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, target, r)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := authorizeTarget(req); err != nil {
+		return nil, nil, err
+	}
+	if err := signRequest(req, body, time.Now()); err != nil {
+		return nil, nil, err
+	}
+	return client, req, nil
+}
+
+// requestFlags are the flags shared by commands that configure or make
+// requests to destinations.
+func requestFlags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{Name: "timeout", Usage: "how long to wait on each destination, e.g. 10s"},
+		cli.StringFlag{Name: "retries", Usage: "how many times to retry a failed delivery; 0 disables retries"},
+		cli.StringFlag{Name: "backoff", Usage: "how long to wait before the first retry, e.g. 1s"},
+		cli.StringSliceFlag{
+			Name:  "header",
+			Value: &cli.StringSlice{},
+			Usage: "'Name: value' header sent to the target, repeatable; an empty value removes it",
+		},
+	}
+}
+
+// parseHeader splits a "Name: value" header.
+func parseHeader(h string) (name, value string, err error) {
+	parts := strings.SplitN(h, ":", 2)
+	name = strings.TrimSpace(parts[0])
+	if len(parts) != 2 || name == "" {
+		return "", "", fmt.Errorf("header %q must be 'Name: value'.", h)
+	}
+	return http.CanonicalHeaderKey(name), strings.TrimSpace(parts[1]), nil
+}
+
+// applyRequestFlags copies any request flags given to c into the settings,
+// reporting whether there were any.
+func applyRequestFlags(c *cli.Context) (bool, error) {
+	changed := false
+	if t := c.String("timeout"); t != "" {
+		if d, err := time.ParseDuration(t); err != nil || d <= 0 {
+			return false, fmt.Errorf("invalid timeout %q.", t)
+		}
+		settings.Timeout = t
+		changed = true
+	}
+	if r := c.String("retries"); r != "" {
+		n, err := strconv.Atoi(r)
+		if err != nil || n < 0 {
+			return false, fmt.Errorf("invalid retries %q.", r)
+		}
+		settings.Retries = &n
+		changed = true
+	}
+	if b := c.String("backoff"); b != "" {
+		if d, err := time.ParseDuration(b); err != nil || d < 0 {
+			return false, fmt.Errorf("invalid backoff %q.", b)
+		}
+		settings.Backoff = b
+		changed = true
+	}
+	for _, h := range c.StringSlice("header") {
+		name, value, err := parseHeader(h)
+		if err != nil {
+			return false, err
+		}
+		if value == "" {
+			delete(settings.Headers, name)
+		} else {
+			if settings.Headers == nil {
+				settings.Headers = map[string]string{}
+			}
+			settings.Headers[name] = value
+		}
+		changed = true
+	}
+	return changed, nil
+}
+
+// notifyWithRetries delivers msg to n, retrying up to retries times after a
+// failure with exponential backoff, or after as long as a rate limited
+// destination asked. The last error is returned. Nothing is retried while the
+// target's circuit breaker is open, or if the destination asked to wait longer
+// than maxRetryWait.
+func notifyWithRetries(n notifier, msg string, retries int, backoff time.Duration) error {
+	err := n.notify(msg)
+	for i := 0; err != nil && i < retries; i++ {
+		if _, ok := err.(*errBreakerOpen); ok || err == errAwaitingApproval {
+			break
+		}
+		wait := backoff << uint(i)
+		if rl, ok := err.(*errRateLimited); ok {
+			if rl.wait > maxRetryWait {
+				break
+			}
+			if rl.wait > wait {
+				wait = rl.wait
+			}
+		}
+		logger.Debug("retrying delivery", "destination", n.name(),
+			"attempt", i+2, "wait", wait, "err", err)
+		time.Sleep(wait)
+		err = n.notify(msg)
+	}
+	return err
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestSettings(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	settings.Backoff = ""
+	if settings.retries() != defaultRetries || settings.backoff() != defaultBackoff {
+		t.Fatal("Expected the default retry policy.")
+	}
+
+	none := 0
+	settings.Retries = &none
+	settings.Backoff = "250ms"
+	if settings.retries() != 0 {
+		t.Fatal("Expected 0 to disable retries rather than use the default.")
+	}
+	if settings.backoff() != 250*time.Millisecond {
+		t.Fatalf("Expected the configured backoff, got %s", settings.backoff())
+	}
+}
+
+func TestNotifyWithRetries(t *testing.T) {
+	n := &mockNotifier{label: "broken", err: fmt.Errorf("down")}
+	if err := notifyWithRetries(n, "alex beat oleg", 0, time.Millisecond); err == nil {
+		t.Fatal("Expected the failure to be returned.")
+	}
+	if len(n.got) != 1 {
+		t.Fatalf("Expected no retries, got %d attempts", len(n.got))
+	}
+
+	n.got = nil
+	if err := notifyWithRetries(n, "alex beat oleg", 3, time.Millisecond); err == nil {
+		t.Fatal("Expected the failure to be returned.")
+	}
+	if len(n.got) != 4 {
+		t.Fatalf("Expected three retries, got %d attempts", len(n.got))
+	}
+}
+
+func TestUnixTarget(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gobeat_unix")
+	if err != nil {
+		t.Fatalf("Could not create directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "gobeat.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("Could not listen on %s: %s", socket, err)
+	}
+	got := make(chan string, 1)
+	go http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		got <- string(b)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer l.Close()
+
+	mockSettingsFile(t, "unix://"+socket)
+	u, err := settings.URL()
+	if err != nil {
+		t.Fatalf("Could not parse target: %s", err)
+	}
+	if err := postResult(u, "", "alex beat oleg", true); err != nil {
+		t.Fatalf("Expected a clean post over the socket: %s", err)
+	}
+	if msg := <-got; msg != "alex beat oleg" {
+		t.Fatalf("Expected the announcement to arrive, got %q", msg)
+	}
+}
+
+func TestHeaders(t *testing.T) {
+	got := make(chan http.Header, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got <- r.Header
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer ts.Close()
+	mockSettingsFile(t, ts.URL)
+	stdout := os.Stdout
+	defer func() { os.Stdout = stdout }()
+
+	args := []string{"gobeat", "--quiet", "target", "--header", "x-tenant: pong",
+		"--header", "X-Trace: 1"}
+	if err := setupCliApp().Run(args); err != nil {
+		t.Fatalf("Expected the headers to be set: %s", err)
+	}
+	if settings.Headers["X-Tenant"] != "pong" || settings.Headers["X-Trace"] != "1" {
+		t.Fatalf("Expected both headers to be configured, got %v", settings.Headers)
+	}
+
+	if err := postResult(mustParse(t, ts.URL), "", "alex beat oleg", true); err != nil {
+		t.Fatalf("Expected a clean post: %s", err)
+	}
+	h := <-got
+	if h.Get("X-Tenant") != "pong" {
+		t.Fatalf("Expected the header to be sent, got %v", h)
+	}
+	if !strings.HasPrefix(h.Get("User-Agent"), "gobeat/"+version+" (") {
+		t.Fatalf("Expected gobeat's User-Agent, got %q", h.Get("User-Agent"))
+	}
+
+	if _, _, err := parseHeader("no colon"); err == nil {
+		t.Fatal("Expected a header without a colon to be rejected.")
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2014, 6, 1, 10, 32, 0, 0, time.UTC)
+	for _, c := range []struct {
+		name, value string
+		want        time.Duration
+	}{
+		{"Retry-After", "30", 30 * time.Second},
+		{"Retry-After", now.Add(time.Minute).Format(http.TimeFormat), time.Minute},
+		{"X-RateLimit-Reset", "5", 5 * time.Second},
+		{"X-RateLimit-Reset", fmt.Sprint(now.Add(15 * time.Minute).Unix()), 15 * time.Minute},
+		{"X-RateLimit-Reset", fmt.Sprint(now.Add(-time.Minute).Unix()), 0},
+	} {
+		h := http.Header{}
+		h.Set(c.name, c.value)
+		if got, ok := retryAfter(h, now); !ok || got != c.want {
+			t.Fatalf("Expected %s: %s to wait %s, got %s", c.name, c.value, c.want, got)
+		}
+	}
+	if _, ok := retryAfter(http.Header{}, now); ok {
+		t.Fatal("Expected no wait without rate limit headers.")
+	}
+}
+
+func TestNotifyWithRetriesRateLimited(t *testing.T) {
+	n := &mockNotifier{label: "limited", err: &errRateLimited{op: "request", code: 429,
+		wait: 2 * time.Millisecond}}
+	start := time.Now()
+	if err := notifyWithRetries(n, "alex beat oleg", 1, 0); err == nil {
+		t.Fatal("Expected the failure to be returned.")
+	}
+	if len(n.got) != 2 || time.Since(start) < 2*time.Millisecond {
+		t.Fatalf("Expected a retry after the requested wait, got %d attempts", len(n.got))
+	}
+
+	n.got = nil
+	n.err = &errRateLimited{op: "request", code: 429, wait: time.Hour}
+	notifyWithRetries(n, "alex beat oleg", 3, time.Millisecond)
+	if len(n.got) != 1 {
+		t.Fatalf("Expected no retries when asked to wait long, got %d attempts", len(n.got))
+	}
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/codegangsta/cli"
+)
+
+// resultsPath is where the server serves each result by ID, relative to the
+// target.
+const resultsPath = "/results"
+
+// What the server should do with the tweet of a deleted result.
+const (
+	tweetKeep     = "keep"
+	tweetDelete   = "delete"
+	tweetAnnotate = "annotate"
+)
+
+// recordedResult is what happened when a result was recorded.
+type recordedResult struct {
+	// Result is the recorded result.
+	Result *matchResult
+
+	// Message is the announcement that was delivered.
+	Message string
+
+	// Deliveries report how delivering Message to each destination went.
+	Deliveries []delivery
+
+	// Achievements are the achievements newly earned with the result.
+	Achievements []*achievement
+
+	// AwaitingApproval is whether the target is holding the result until a
+	// league moderator approves it.
+	AwaitingApproval bool
+}
+
+// recordResult adds r to the history and delivers its announcement (with
+// tags) to every configured destination, followed by any achievements it
+// earned if those are celebrated. An unannounced result is only sent to the
+// target, to be recorded quietly. The history is saved as long as at least
+// one destination received the announcement. Hooks and plugins are run
+// before and after delivery. It is shared by every way of submitting a
+// result, from the command line to chat bots.
+func recordResult(r *matchResult, tags []string) (*recordedResult, error) {
+	all, err := settings.notifiers()
+	if err != nil {
+		return nil, err
+	}
+	notifiers := forResult(all, r)
+
+	if settings.AutoSync && settings.TargetURL != "" {
+		// Count results from other machines toward streaks and milestones.
+		if u, err := settings.URL(); err == nil {
+			_, conflicts, err := pullHistory(u, newestWins)
+			if err != nil {
+				logger.Warn("could not pull results", "err", err)
+			}
+			for _, c := range conflicts {
+				logger.Info("settled sync conflict", "id", c.Local.ID, "kept_local", c.KeptLocal)
+			}
+		}
+	}
+	h, err := retrieveHistory()
+	if err != nil {
+		return nil, err
+	}
+	h.add(r)
+	earned := h.evaluateAchievements(r)
+
+	msg, err := formatResult(newAnnouncement(r, h), tags)
+	if err != nil {
+		return nil, err
+	}
+	if err := settings.Hooks.pre(r, msg); err != nil {
+		return nil, err
+	}
+	if err := runPlugins(&pluginEvent{
+		Hook:         hookPrePost,
+		Result:       r,
+		Message:      msg,
+		Achievements: earned,
+	}); err != nil {
+		return nil, err
+	}
+
+	r.Message = msg
+	rec := &recordedResult{
+		Result:       r,
+		Message:      msg,
+		Deliveries:   deliver(notifiers, msg),
+		Achievements: earned,
+	}
+	// Announcements the target missed are queued for 'gobeat flush' or the
+	// next result. Either way the target has the result under its ID, or
+	// will.
+	for i, n := range notifiers {
+		if _, ok := n.(*targetNotifier); ok {
+			if rec.Deliveries[i].Err != nil {
+				if err := queuePost(r.ID, strings.Join(r.opponentTeam(), " & "), msg,
+					!r.Unannounced); err != nil {
+					return rec, err
+				}
+				rec.Deliveries[i].Queued = true
+			}
+			r.Identified = true
+		}
+		if rec.Deliveries[i].Held && !rec.AwaitingApproval {
+			if err := awaitApproval(r.ID); err != nil {
+				return rec, err
+			}
+			rec.AwaitingApproval = true
+		}
+	}
+	r.Unsynced = !r.Identified
+	// An unannounced result with no target to record it on is only kept
+	// locally.
+	if len(notifiers) > 0 && !delivered(rec.Deliveries) {
+		return rec, fmt.Errorf("could not deliver result to any destination")
+	}
+	if err := h.save(); err != nil {
+		return rec, err
+	}
+
+	// Achievements are only celebrated once their result is announced.
+	if settings.CelebrateAchievements && !r.Unannounced && !rec.AwaitingApproval {
+		for _, a := range earned {
+			deliver(all, formatAchievement(r.Player, a))
+		}
+	}
+
+	if err := settings.Hooks.post(r, msg); err != nil {
+		return rec, fmt.Errorf("result recorded, but %s", err)
+	}
+	if err := runPlugins(&pluginEvent{
+		Hook:         hookPostPost,
+		Result:       r,
+		Message:      msg,
+		Deliveries:   deliveryReport(rec.Deliveries),
+		Achievements: earned,
+	}); err != nil {
+		return rec, fmt.Errorf("result recorded, but %s", err)
+	}
+	return rec, nil
+}
+
+// postRecordedResult records r for a command, printing how delivery went and
+// any achievements earned. It exits on failure.
+func postRecordedResult(r *matchResult, tags []string) *recordedResult {
+	reportRejections()
+	spin := startSpinner("Posting result")
+	rec, err := recordResult(r, tags)
+	spin.stop()
+	if rec != nil {
+		printDeliveries(rec.Deliveries)
+	}
+	if err != nil {
+		printError(err)
+	}
+
+	if r.Unannounced {
+		fmt.Println("Recorded result without announcing it.")
+	} else if rec.AwaitingApproval {
+		fmt.Println("Result is awaiting approval by a league moderator, and is " +
+			"announced once approved.")
+	} else if r.Won {
+		fmt.Println("Successfully posted result. Congratulations!")
+	} else {
+		fmt.Println("Successfully posted result. Better luck next time.")
+	}
+	for _, a := range rec.Achievements {
+		fmt.Printf("Achievement unlocked: %s\n",
+			achievementTitles([]*achievement{a}))
+	}
+	return rec
+}
+
+// updateRemoteResult asks the target to replace its record of r, keyed by its
+// ID, with the corrected result and announcement.
+func updateRemoteResult(u *url.URL, r *matchResult) error {
+	if !r.Identified {
+		return fmt.Errorf("the server can't find result %s, as it was posted before "+
+			"results carried their IDs; correct it with --local.", r.ID)
+	}
+	p := resultsPath + "/" + url.PathEscape(r.ID)
+	resp, err := doTargetRequest(u, func() (*http.Client, *http.Request, error) {
+		client, req, err := newTargetRequest(u, "PUT", p, nil, []byte(r.Message))
+		if err == nil && r.Unannounced {
+			req.Header.Set(announceHeader, "false")
+		}
+		return client, req, err
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusAccepted, http.StatusNoContent:
+		return nil
+	case http.StatusNotFound:
+		return fmt.Errorf("the server has no record of result %s; correct it with --local.", r.ID)
+	}
+	return fmt.Errorf("on correction: got code %d", resp.StatusCode)
+}
+
+// correctResult applies edit to the result with id and checks the corrected
+// score against the rules of its game. Ratings need no updating, as they are
+// always replayed from the history. The corrected announcement replaces the
+// original if that is still waiting to be posted to the target; otherwise,
+// if remote is true, the target is asked to update its record of the result.
+// Other destinations are not told, as they can't update what they were sent.
+// The history is only saved once the target has agreed.
+func correctResult(id string, edit func(r *matchResult), remote bool) (*recordedResult, error) {
+	h, err := retrieveHistory()
+	if err != nil {
+		return nil, err
+	}
+	r := h.find(id)
+	if r == nil {
+		return nil, fmt.Errorf("no result with ID %s.", id)
+	}
+	edit(r)
+	if err := settings.gameDef(r.Game).validate(r.Score, r.Won); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	r.Updated = &now
+
+	msg, err := formatResult(newAnnouncement(r, h), nil)
+	if err != nil {
+		return nil, err
+	}
+	r.Message = msg
+	rec := &recordedResult{Result: r, Message: msg}
+	requeued, err := requeuePost(id, msg)
+	if err != nil {
+		return nil, err
+	}
+	if !requeued && remote && settings.TargetURL != "" {
+		u, err := settings.URL()
+		if err != nil {
+			return nil, err
+		}
+		if err := updateRemoteResult(u, r); err != nil {
+			return nil, err
+		}
+	}
+	return rec, h.save()
+}
+
+// editCommand returns the 'gobeat edit' command.
+func editCommand() cli.Command {
+	return cli.Command{
+		Name: "edit",
+		Description: "`edit` corrects a recorded result by ID, here and on the " +
+			"server. Chat destinations are not sent the correction.",
+		Usage: "edit [--score score] [--game game] [--opponent name] " +
+			"[--won|--lost] [--local] [id]",
+		Flags: []cli.Flag{
+			cli.BoolFlag{Name: "local", Usage: "only correct the result in the local history"},
+			cli.StringFlag{Name: "score", Usage: "the correct score"},
+			cli.StringFlag{Name: "game", Usage: "the game that was actually played"},
+			cli.StringFlag{Name: "opponent", Usage: "who was actually played"},
+			cli.BoolFlag{Name: "won", Usage: "the match was won"},
+			cli.BoolFlag{Name: "lost", Usage: "the match was lost"},
+		},
+		Action: func(c *cli.Context) {
+			if len(c.Args()) == 0 {
+				printError(fmt.Errorf("missing result ID; see 'gobeat history'."))
+			}
+			if c.Bool("won") && c.Bool("lost") {
+				printError(fmt.Errorf("a match cannot be both won and lost."))
+			}
+
+			rec, err := correctResult(c.Args().First(), func(r *matchResult) {
+				if c.String("score") != "" {
+					r.Score = c.String("score")
+				}
+				if c.String("game") != "" {
+					r.Game = c.String("game")
+				}
+				if c.String("opponent") != "" {
+					r.Opponent = c.String("opponent")
+				}
+				if c.Bool("won") || c.Bool("lost") {
+					r.Won = c.Bool("won")
+				}
+			}, !c.Bool("local"))
+			if err != nil {
+				printError(err)
+			}
+			fmt.Printf("Corrected result: %s\n", formatHistoryLine(rec.Result))
+		},
+	}
+}
+
+// deleteRemoteResult asks the target to delete result id, and to do as tweet
+// says with its tweet. An identified result, posted along with its ID, that
+// the target never received counts as deleted; the target can't find any
+// other by ID.
+func deleteRemoteResult(u *url.URL, id, tweet string, identified bool) error {
+	resp, err := sendTargetRequest(u, "DELETE", resultsPath+"/"+url.PathEscape(id),
+		url.Values{"tweet": {tweet}}, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusAccepted, http.StatusNoContent:
+		return nil
+	case http.StatusNotFound:
+		if identified {
+			return nil
+		}
+		return fmt.Errorf("the server can't find result %s, as it was posted before "+
+			"results carried their IDs; delete it with --local.", id)
+	}
+	return fmt.Errorf("on delete: got code %d", resp.StatusCode)
+}
+
+// deleteResult removes the result with id from the history, along with any
+// achievements earned with it. An announcement still queued for it is
+// dropped; otherwise, if remote is true, the target is asked to delete it
+// too. The history is only changed once the target has agreed.
+func deleteResult(id string, remote bool, tweet string) (*matchResult, error) {
+	h, err := retrieveHistory()
+	if err != nil {
+		return nil, err
+	}
+	r := h.find(id)
+	if r == nil {
+		return nil, fmt.Errorf("no result with ID %s.", id)
+	}
+
+	p, err := retrievePending()
+	if err != nil {
+		return nil, err
+	}
+	var kept []*pendingPost
+	for _, post := range p {
+		if post.ResultID != id {
+			kept = append(kept, post)
+		}
+	}
+	if len(kept) < len(p) {
+		// The target never saw the result, so has nothing to delete.
+		if err := savePending(kept); err != nil {
+			return nil, err
+		}
+	} else if remote && settings.TargetURL != "" {
+		u, err := settings.URL()
+		if err != nil {
+			return nil, err
+		}
+		if err := deleteRemoteResult(u, id, tweet, r.Identified); err != nil {
+			return nil, err
+		}
+	}
+
+	h.remove(id)
+	return r, h.save()
+}
+
+// deleteCommand returns the 'gobeat delete' command.
+func deleteCommand() cli.Command {
+	return cli.Command{
+		Name:      "delete",
+		ShortName: "rm",
+		Description: "`delete` deletes a recorded result by ID, here and on " +
+			"the server.",
+		Usage: "delete [--local] [--tweet keep|delete|annotate] [id]",
+		Flags: []cli.Flag{
+			cli.BoolFlag{Name: "local", Usage: "only delete the result from the local history"},
+			cli.StringFlag{
+				Name:  "tweet",
+				Value: tweetKeep,
+				Usage: "what the server should do with the tweet: keep, delete or annotate",
+			},
+		},
+		Action: func(c *cli.Context) {
+			if len(c.Args()) == 0 {
+				printError(fmt.Errorf("missing result ID; see 'gobeat history'."))
+			}
+			switch c.String("tweet") {
+			case tweetKeep, tweetDelete, tweetAnnotate:
+			default:
+				printError(fmt.Errorf("unknown tweet action %q.", c.String("tweet")))
+			}
+
+			r, err := deleteResult(c.Args().First(), !c.Bool("local"), c.String("tweet"))
+			if err != nil {
+				printError(err)
+			}
+			fmt.Printf("Deleted result: %s\n", formatHistoryLine(r))
+		},
+	}
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRecordResult(t *testing.T) {
+	ts, posted := mockTarget(t)
+	defer ts.Close()
+	mockHistoryFile(t)
+	settings.CelebrateAchievements = true
+
+	r, err := newMatchResult("oleg", "21-15", true)
+	if err != nil {
+		t.Fatalf("Could not create result: %s", err)
+	}
+	rec, err := recordResult(r, nil)
+	if err != nil {
+		t.Fatalf("Expected a clean record: %s", err)
+	}
+	if len(rec.Achievements) != 1 || len(posted()) != 2 {
+		t.Fatalf("Expected the result and first win to be posted, got %v", posted())
+	}
+	if posted()[0] != rec.Message {
+		t.Fatalf("Expected the announcement to be posted, got %q", posted()[0])
+	}
+
+	h, err := retrieveHistory()
+	if err != nil {
+		t.Fatalf("Could not retrieve history: %s", err)
+	}
+	if len(h.Results) != 1 || h.Results[0].ID != r.ID {
+		t.Fatal("Expected the result to be saved to history.")
+	}
+}
+
+func TestRecordUnannouncedResult(t *testing.T) {
+	var announce []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		announce = append(announce, r.Header.Get(announceHeader))
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer ts.Close()
+	mockSettingsFile(t, ts.URL)
+	mockHistoryFile(t)
+	settings.CelebrateAchievements = true
+	settings.NoPost = true
+
+	r, err := newMatchResult("oleg", "21-15", true)
+	if err != nil {
+		t.Fatalf("Could not create result: %s", err)
+	}
+	if !r.Unannounced {
+		t.Fatal("Expected the default to leave the result unannounced.")
+	}
+	if _, err := recordResult(r, nil); err != nil {
+		t.Fatalf("Expected a clean record: %s", err)
+	}
+	if len(announce) != 1 || announce[0] != "false" {
+		t.Fatalf("Expected only the result to be sent, without announcing it, got %v", announce)
+	}
+
+	// With no target, the result is only kept locally.
+	settings.TargetURL = ""
+	settings.IRC = &ircSettings{Server: "127.0.0.1:1", Channel: "#pong"}
+	r, err = newMatchResult("oleg", "21-17", true)
+	if err != nil {
+		t.Fatalf("Could not create result: %s", err)
+	}
+	rec, err := recordResult(r, nil)
+	if err != nil || len(rec.Deliveries) != 0 {
+		t.Fatalf("Expected the result to be recorded without deliveries: %v", err)
+	}
+	h, err := retrieveHistory()
+	if err != nil {
+		t.Fatalf("Could not retrieve history: %s", err)
+	}
+	if len(h.Results) != 2 || !h.Results[1].Unannounced {
+		t.Fatal("Expected both results to be saved as unannounced.")
+	}
+}
+
+func TestCorrectResult(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatalf("Expected body to read cleanly: %s", err)
+		}
+		mu.Lock()
+		requests = append(requests, r.Method+" "+r.URL.Path+" "+string(b))
+		mu.Unlock()
+		if r.Method == "PUT" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer ts.Close()
+	mockSettingsFile(t, ts.URL)
+	mockHistoryFile(t)
+
+	r, err := newMatchResult("oleg", "21-8", true)
+	if err != nil {
+		t.Fatalf("Could not create result: %s", err)
+	}
+	if _, err := recordResult(r, nil); err != nil {
+		t.Fatalf("Expected a clean record: %s", err)
+	}
+	rec, err := correctResult(r.ID, func(r *matchResult) { r.Score = "21-18" }, true)
+	if err != nil {
+		t.Fatalf("Expected a clean correction: %s", err)
+	}
+	want := "PUT " + resultsPath + "/" + r.ID + " 🏓 alex beat oleg at ping pong with score 21-18"
+	if len(requests) != 2 || requests[1] != want || !strings.HasSuffix(want, rec.Message) {
+		t.Fatalf("Expected the target's record to be updated, not a second post, got %v", requests)
+	}
+	h, err := retrieveHistory()
+	if err != nil {
+		t.Fatalf("Could not retrieve history: %s", err)
+	}
+	if h.find(r.ID).Score != "21-18" {
+		t.Fatal("Expected the corrected score to be saved.")
+	}
+
+	// A result posted without its ID can only be corrected locally.
+	h.find(r.ID).Identified = false
+	if err := h.save(); err != nil {
+		t.Fatalf("Could not save history: %s", err)
+	}
+	if _, err := correctResult(r.ID, func(r *matchResult) { r.Score = "21-19" }, true); err == nil {
+		t.Fatal("Expected a result the target can't find to be refused.")
+	}
+	if _, err := correctResult(r.ID, func(r *matchResult) { r.Score = "21-19" }, false); err != nil {
+		t.Fatalf("Expected a clean local correction: %s", err)
+	}
+	if len(requests) != 2 {
+		t.Fatalf("Expected nothing more sent to the target, got %v", requests)
+	}
+
+	if _, err := correctResult("nope", func(r *matchResult) {}, true); err == nil {
+		t.Fatal("Expected an unknown ID to be refused.")
+	}
+}
+
+func TestCorrectQueuedResult(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	h := mockHistoryFile(t)
+	r := &matchResult{ID: "1", Player: "alex", Opponent: "oleg", Game: "ping pong",
+		Score: "21-8", Won: true}
+	h.add(r)
+	if err := h.save(); err != nil {
+		t.Fatalf("Could not save history: %s", err)
+	}
+	if err := queuePost(r.ID, "oleg", "alex beat oleg at ping pong with score 21-8", true); err != nil {
+		t.Fatalf("Could not queue post: %s", err)
+	}
+
+	// Nothing is delivered: the queued announcement is corrected in place.
+	if _, err := correctResult(r.ID, func(r *matchResult) { r.Score = "21-18" }, true); err != nil {
+		t.Fatalf("Expected a clean correction: %s", err)
+	}
+	p, err := retrievePending()
+	if err != nil {
+		t.Fatalf("Could not retrieve pending posts: %s", err)
+	}
+	if len(p) != 1 || p[0].Message != "🏓 alex beat oleg at ping pong with score 21-18" {
+		t.Fatalf("Expected the queued announcement to be corrected, got %+v", p)
+	}
+}
+
+func TestDeleteResult(t *testing.T) {
+	var deleted string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" {
+			t.Fatalf("Expected a DELETE, got %s", r.Method)
+		}
+		deleted = r.URL.Path + "?" + r.URL.RawQuery
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+	mockSettingsFile(t, ts.URL)
+	h := mockHistoryFile(t)
+	h.add(&matchResult{ID: "1", Player: "alex", Opponent: "oleg", Won: true})
+	h.add(&matchResult{ID: "2", Player: "alex", Opponent: "oleg", Won: true})
+	h.Achievements = map[string][]*achievement{"alex": {{Name: "first-win", ResultID: "1"}}}
+	if err := h.save(); err != nil {
+		t.Fatalf("Could not save history: %s", err)
+	}
+
+	h.Results[0].Identified, h.Results[1].Identified = true, true
+	if _, err := deleteResult("1", true, tweetDelete); err != nil {
+		t.Fatalf("Expected a clean delete: %s", err)
+	}
+	if deleted != resultsPath+"/1?tweet=delete" {
+		t.Fatalf("Expected the server to be asked to delete the result, got %q", deleted)
+	}
+	h, err := retrieveHistory()
+	if err != nil {
+		t.Fatalf("Could not retrieve history: %s", err)
+	}
+	if len(h.Results) != 1 || h.find("1") != nil || len(h.Achievements["alex"]) != 0 {
+		t.Fatal("Expected the result and its achievements to be removed.")
+	}
+
+	// A queued result is dropped from the queue instead.
+	deleted = ""
+	if err := queuePost("2", "oleg", "alex beat oleg", true); err != nil {
+		t.Fatalf("Could not queue post: %s", err)
+	}
+	if _, err := deleteResult("2", true, tweetKeep); err != nil {
+		t.Fatalf("Expected a clean delete: %s", err)
+	}
+	if p, _ := retrievePending(); deleted != "" || len(p) != 0 {
+		t.Fatalf("Expected only the queued post to be dropped, got %q and %v", deleted, p)
+	}
+}
+
+func TestDeleteUnidentifiedResult(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+	mockSettingsFile(t, ts.URL)
+	h := mockHistoryFile(t)
+	h.add(&matchResult{ID: "1", Player: "alex", Opponent: "oleg", Won: true})
+	h.add(&matchResult{ID: "2", Player: "alex", Opponent: "oleg", Won: true, Identified: true})
+	if err := h.save(); err != nil {
+		t.Fatalf("Could not save history: %s", err)
+	}
+
+	// The target could never have found a result posted without its ID.
+	if _, err := deleteResult("1", true, tweetKeep); err == nil {
+		t.Fatal("Expected a result posted without its ID not to count as deleted.")
+	}
+	if _, err := deleteResult("2", true, tweetKeep); err != nil {
+		t.Fatalf("Expected a result the target never received to count as deleted: %s", err)
+	}
+	h, err := retrieveHistory()
+	if err != nil {
+		t.Fatalf("Could not retrieve history: %s", err)
+	}
+	if len(h.Results) != 1 || h.find("1") == nil {
+		t.Fatal("Expected only the identified result to be removed.")
+	}
+}
+
+func TestPostResultID(t *testing.T) {
+	var mu sync.Mutex
+	var ids []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ids = append(ids, r.Header.Get(resultIDHeader))
+		mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer ts.Close()
+	mockSettingsFile(t, ts.URL)
+	mockHistoryFile(t)
+
+	if err := queuePost("1", "oleg", "alex beat oleg", true); err != nil {
+		t.Fatalf("Could not queue post: %s", err)
+	}
+	if _, err := flushPending(mustParse(t, ts.URL), 1); err != nil {
+		t.Fatalf("Expected the queue to flush: %s", err)
+	}
+
+	r, err := newMatchResult("oleg", "21-17", true)
+	if err != nil {
+		t.Fatalf("Could not create result: %s", err)
+	}
+	if _, err := recordResult(r, nil); err != nil {
+		t.Fatalf("Expected a clean record: %s", err)
+	}
+	if len(ids) != 2 || ids[0] != "1" || ids[1] != r.ID {
+		t.Fatalf("Expected both posts to carry their result's ID, got %v", ids)
+	}
+
+	h, err := retrieveHistory()
+	if err != nil {
+		t.Fatalf("Could not retrieve history: %s", err)
+	}
+	if !h.find(r.ID).Identified {
+		t.Fatal("Expected the result to be marked as posted with its ID.")
+	}
+}
+
+func TestRecordWithoutTarget(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"event_id": "$1"}`))
+	}))
+	defer ts.Close()
+	mockSettingsFile(t, "")
+	settings.Matrix = &matrixSettings{Homeserver: ts.URL, RoomID: "!pong:example.com"}
+	mockHistoryFile(t)
+	r, err := newMatchResult("oleg", "21-15", true)
+	if err != nil {
+		t.Fatalf("Could not create result: %s", err)
+	}
+	if _, err := recordResult(r, nil); err != nil {
+		t.Fatalf("Expected the result to be kept locally: %s", err)
+	}
+	h, err := retrieveHistory()
+	if err != nil {
+		t.Fatalf("Could not retrieve history: %s", err)
+	}
+	if got := h.find(r.ID); got.Identified || !got.Unsynced {
+		t.Fatal("Expected a result no target received to be left for 'gobeat sync'.")
+	}
+}
+
+// mockTarget starts a result server recording every body posted to it, and
+// points the settings at it. posted returns the bodies so far.
+func mockTarget(t *testing.T) (ts *httptest.Server, posted func() []string) {
+	var mu sync.Mutex
+	var bodies []string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatalf("Expected body to read cleanly: %s", err)
+		}
+		mu.Lock()
+		bodies = append(bodies, string(b))
+		mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+	}
+	ts = httptest.NewServer(http.HandlerFunc(handler))
+	mockSettingsFile(t, ts.URL)
+
+	return ts, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), bodies...)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/codegangsta/cli"
+)
+
+// series returns player's all-time wins and losses against opponent,
+// including in pruned results.
+func (h *gobeatHistory) series(player, opponent string) (wins, losses int) {
+	pruned := h.Pruned.series(player, opponent)
+	wins, losses = pruned.Wins, pruned.Losses
+	for _, r := range h.Results {
+		if r.Player != player || r.Opponent != opponent {
+			continue
+		}
+		if r.Won {
+			wins++
+		} else {
+			losses++
+		}
+	}
+	return wins, losses
+}
+
+// rivals returns the names of everyone the current user has a rivalry with,
+// in sorted order.
+func (g *gobeatSettings) rivals() []string {
+	var out []string
+	for _, name := range g.rosterNames() {
+		if g.Roster[name].Rival {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+// isRival reports whether the current user has a rivalry with name.
+func (g *gobeatSettings) isRival(name string) bool {
+	e, ok := g.Roster[name]
+	return ok && e.Rival
+}
+
+// rivalryCommand returns the 'gobeat rivalry' command and its subcommands.
+func rivalryCommand() cli.Command {
+	return cli.Command{
+		Name:        "rivalry",
+		ShortName:   "rv",
+		Description: "`rivalry` manages rivalries, whose series score is included in announcements.",
+		Usage:       "rivalry [add|remove|show]",
+		Action: func(c *cli.Context) {
+			showRivalries(settings.rivals())
+		},
+		Subcommands: []cli.Command{
+			cli.Command{
+				Name:        "add",
+				Description: "`rivalry add` declares a rivalry with a player.",
+				Usage:       "rivalry add [opponent]",
+				Action: func(c *cli.Context) {
+					if len(c.Args()) == 0 {
+						printError(fmt.Errorf("missing opponent name."))
+					}
+					name := c.Args().First()
+
+					settings.rosterEntry(name).Rival = true
+					fmt.Printf("%s is now your rival\n", name)
+
+					if err := settings.save(); err != nil {
+						printError(err)
+					}
+				},
+			},
+			cli.Command{
+				Name:        "remove",
+				ShortName:   "rm",
+				Description: "`rivalry remove` ends a rivalry with a player.",
+				Usage:       "rivalry remove [opponent]",
+				Action: func(c *cli.Context) {
+					if len(c.Args()) == 0 {
+						printError(fmt.Errorf("missing opponent name."))
+					}
+					name := c.Args().First()
+					if !settings.isRival(name) {
+						printError(fmt.Errorf("%s is not your rival.", name))
+					}
+
+					settings.Roster[name].Rival = false
+					fmt.Printf("%s is no longer your rival\n", name)
+
+					if err := settings.save(); err != nil {
+						printError(err)
+					}
+				},
+			},
+			cli.Command{
+				Name:        "show",
+				Description: "`rivalry show` prints the all-time score of rivalries.",
+				Usage:       "rivalry show [opponent]",
+				Action: func(c *cli.Context) {
+					if len(c.Args()) == 0 {
+						showRivalries(settings.rivals())
+					} else {
+						showRivalries(c.Args())
+					}
+				},
+			},
+		},
+	}
+}
+
+// showRivalries prints the current user's series score against each name.
+func showRivalries(names []string) {
+	if len(names) == 0 {
+		fmt.Println("No rivalries declared.")
+		return
+	}
+
+	h, err := retrieveHistory()
+	if err != nil {
+		printError(err)
+	}
+	for _, name := range names {
+		wins, losses := h.series(settings.User, name)
+		fmt.Printf("%s vs %s: %d-%d\n", settings.User, name, wins, losses)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestSeries(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	h := mockHistoryFile(t)
+
+	for _, won := range []bool{true, false, true} {
+		h.add(&matchResult{Player: "alex", Opponent: "oleg", Won: won})
+	}
+	h.add(&matchResult{Player: "alex", Opponent: "ivan", Won: true})
+
+	wins, losses := h.series("alex", "oleg")
+	if wins != 2 || losses != 1 {
+		t.Fatalf("Expected series of 2-1, got %d-%d", wins, losses)
+	}
+}
+
+func TestRivalryAnnouncement(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	h := mockHistoryFile(t)
+	settings.rosterEntry("oleg").Rival = true
+
+	h.add(&matchResult{Player: "alex", Opponent: "oleg", Won: true})
+	r := &matchResult{Player: "alex", Opponent: "oleg", Game: "ping pong",
+		Score: "21-15", Won: true}
+	h.add(r)
+
+	msg := mockFormatResult(t, newAnnouncement(r, h), nil)
+	if msg != "🏓 alex beat oleg at ping pong with score 21-15, series now 2-0" {
+		t.Fatalf("Expected series in announcement, got %q", msg)
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/codegangsta/cli"
+)
+
+// rosterEntry holds what gobeat knows about a player it has been told about.
+type rosterEntry struct {
+	// Handle is the player's social handle (e.g., @oleg), mentioned in
+	// announcements in place of their name so they get notified.
+	Handle string `json:"handle,omitempty"`
+
+	// Rival is whether the current user has declared a rivalry with this
+	// player. Set with the 'gobeat rivalry' command.
+	Rival bool `json:"rival,omitempty"`
+
+	// Handicap is how many points this player spots the current user at the
+	// start of a game, or if negative, how many the current user spots them.
+	// Set with the 'gobeat roster handicap' command.
+	Handicap int `json:"handicap,omitempty"`
+}
+
+// rosterCommand returns the 'gobeat roster' command and its subcommands.
+func rosterCommand() cli.Command {
+	return cli.Command{
+		Name:        "roster",
+		ShortName:   "ro",
+		Description: "`roster` manages the players gobeat knows about.",
+		Usage:       "roster [add|remove|handicap]",
+		Action: func(c *cli.Context) {
+			if len(settings.Roster) == 0 {
+				fmt.Println("Roster is empty.")
+				return
+			}
+			for _, name := range settings.rosterNames() {
+				e := settings.Roster[name]
+				rival := ""
+				if e.Rival {
+					rival = "rival"
+				}
+				handicap := ""
+				if e.Handicap != 0 {
+					handicap = fmt.Sprintf("handicap %+d", e.Handicap)
+				}
+				fmt.Printf("%s\t%s\t%s\t%s\n", name, e.Handle, rival, handicap)
+			}
+		},
+		Subcommands: []cli.Command{
+			cli.Command{
+				Name:        "add",
+				Description: "`roster add` maps a player's name to their handle.",
+				Usage:       "roster add [name] [handle]",
+				Action: func(c *cli.Context) {
+					if len(c.Args()) < 2 {
+						printError(fmt.Errorf("missing player name and handle."))
+					}
+					name := c.Args().First()
+					handle := normalizeHandle(c.Args().Get(1))
+
+					settings.rosterEntry(name).Handle = handle
+					fmt.Printf("Added %s as %s\n", name, handle)
+
+					if err := settings.save(); err != nil {
+						printError(err)
+					}
+				},
+			},
+			cli.Command{
+				Name:        "remove",
+				ShortName:   "rm",
+				Description: "`roster remove` removes a player from the roster.",
+				Usage:       "roster remove [name]",
+				Action: func(c *cli.Context) {
+					if len(c.Args()) == 0 {
+						printError(fmt.Errorf("missing player name."))
+					}
+					name := c.Args().First()
+					if _, ok := settings.Roster[name]; !ok {
+						printError(fmt.Errorf("%s is not on the roster.", name))
+					}
+
+					delete(settings.Roster, name)
+					fmt.Printf("Removed %s\n", name)
+
+					if err := settings.save(); err != nil {
+						printError(err)
+					}
+				},
+			},
+			cli.Command{
+				Name: "handicap",
+				Description: "`roster handicap` sets how many points a player spots you; " +
+					"negative if you spot them, 0 to clear it.",
+				Usage: "roster handicap [name] [points]",
+				Action: func(c *cli.Context) {
+					if len(c.Args()) < 2 {
+						printError(fmt.Errorf("missing player name and points."))
+					}
+					name := c.Args().First()
+					points, err := strconv.Atoi(c.Args().Get(1))
+					if err != nil {
+						printError(fmt.Errorf("points must be an integer."))
+					}
+
+					settings.rosterEntry(name).Handicap = points
+					switch {
+					case points > 0:
+						fmt.Printf("%s spots you %d points\n", name, points)
+					case points < 0:
+						fmt.Printf("You spot %s %d points\n", name, -points)
+					default:
+						fmt.Printf("Cleared handicap with %s\n", name)
+					}
+
+					if err := settings.save(); err != nil {
+						printError(err)
+					}
+				},
+			},
+		},
+	}
+}
+
+// normalizeHandle ensures a handle starts with a single '@'.
+func normalizeHandle(handle string) string {
+	return "@" + strings.TrimLeft(strings.TrimSpace(handle), "@")
+}
+
+// rosterEntry returns the roster entry for name, creating it if necessary.
+func (g *gobeatSettings) rosterEntry(name string) *rosterEntry {
+	if g.Roster == nil {
+		g.Roster = make(map[string]*rosterEntry)
+	}
+	e, ok := g.Roster[name]
+	if !ok {
+		e = new(rosterEntry)
+		g.Roster[name] = e
+	}
+	return e
+}
+
+// handicap returns how many points name spots the current user, negative if
+// the current user spots them.
+func (g *gobeatSettings) handicap(name string) int {
+	if e, ok := g.Roster[name]; ok {
+		return e.Handicap
+	}
+	return 0
+}
+
+// applyHandicap records the current user's handicap against r's opponent on
+// r, checking that the score allows for it: whoever was spotted points cannot
+// have finished with fewer.
+func (r *matchResult) applyHandicap() error {
+	r.Handicap = settings.handicap(r.Opponent)
+	mine, theirs, ok := parsePoints(r.Score)
+	if r.Handicap == 0 || !ok {
+		return nil
+	}
+	if r.Handicap > 0 && mine < r.Handicap {
+		return fmt.Errorf("%s spots you %d points, so you scored at least %d.",
+			r.Opponent, r.Handicap, r.Handicap)
+	}
+	if r.Handicap < 0 && theirs < -r.Handicap {
+		return fmt.Errorf("you spot %s %d points, so they scored at least %d.",
+			r.Opponent, -r.Handicap, -r.Handicap)
+	}
+	return nil
+}
+
+// rosterNames returns the names on the roster in sorted order.
+func (g *gobeatSettings) rosterNames() []string {
+	names := make([]string, 0, len(g.Roster))
+	for name := range g.Roster {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// mention returns how a player is referred to in announcements: their handle
+// if one is on the roster, otherwise their name.
+func (g *gobeatSettings) mention(name string) string {
+	if e, ok := g.Roster[name]; ok && e.Handle != "" {
+		return e.Handle
+	}
+	return name
+}
@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+func TestMention(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+
+	if settings.mention("oleg") != "oleg" {
+		t.Fatal("Expected players off the roster to be mentioned by name.")
+	}
+
+	settings.rosterEntry("oleg").Handle = normalizeHandle("@@oleg_k")
+	if settings.mention("oleg") != "@oleg_k" {
+		t.Fatalf("Expected handle mention, got %q", settings.mention("oleg"))
+	}
+
+	msg := mockFormatResult(t, newAnnouncement(&matchResult{Player: "alex",
+		Opponent: "oleg", Game: "ping pong", Score: "21-15", Won: true}, nil), nil)
+	if msg != "🏓 alex beat @oleg_k at ping pong with score 21-15" {
+		t.Fatalf("Expected announcement to mention handle, got %q", msg)
+	}
+}
+
+func TestHandicap(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	settings.rosterEntry("oleg").Handicap = 5
+
+	r, err := newMatchResult("oleg", "21-18", true)
+	if err != nil {
+		t.Fatalf("Could not create result: %s", err)
+	}
+	if err := r.applyHandicap(); err != nil || r.Handicap != 5 {
+		t.Fatalf("Expected the handicap to be recorded, got %d (%v)", r.Handicap, err)
+	}
+	msg, err := formatResult(newAnnouncement(r, nil), nil)
+	if err != nil {
+		t.Fatalf("Expected result to format cleanly: %s", err)
+	}
+	if msg != "🏓 alex beat oleg at ping pong with score 21-18 (oleg spotted alex 5)" {
+		t.Fatalf("Expected the handicap to be announced, got %q", msg)
+	}
+
+	r, err = newMatchResult("oleg", "3-21", false)
+	if err != nil {
+		t.Fatalf("Could not create result: %s", err)
+	}
+	if err := r.applyHandicap(); err == nil {
+		t.Fatal("Expected a score below the head start to be rejected.")
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/codegangsta/cli"
+)
+
+// defaultGrace is how long a bot has to finish up once asked to stop.
+const defaultGrace = 10 * time.Second
+
+// shutdownSignals returns a channel receiving SIGINT and SIGTERM.
+func shutdownSignals() <-chan os.Signal {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
+	return c
+}
+
+// graceFlag is the flag setting how long a bot has to shut down.
+func graceFlag() cli.Flag {
+	return cli.StringFlag{
+		Name:  "grace",
+		Value: defaultGrace.String(),
+		Usage: "how long to finish up after SIGINT or SIGTERM before exiting",
+	}
+}
+
+// runUntilShutdown runs work until it returns or a signal arrives. On a
+// signal, stop is closed so that work can finish what it is doing, and it has
+// grace to return. Results queued while the target was down are then flushed
+// in whatever time remains.
+func runUntilShutdown(signals <-chan os.Signal, grace time.Duration, work func(stop <-chan struct{}) error) error {
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() { done <- work(stop) }()
+
+	select {
+	case err := <-done:
+		return err
+	case sig := <-signals:
+		logger.Info("Shutting down...", "signal", sig.String(), "grace", grace)
+		close(stop)
+	}
+
+	deadline := time.After(grace)
+	select {
+	case <-done:
+	case <-deadline:
+		logger.Warn("gave up waiting for in-flight work")
+		return nil
+	}
+
+	flushed := make(chan struct{})
+	go func() {
+		defer close(flushed)
+		if settings.TargetURL == "" {
+			return
+		}
+		u, err := settings.URL()
+		if err != nil {
+			return
+		}
+		if n, err := flushPending(u, 1); err != nil {
+			logger.Warn("could not flush queued results", "posted", n, "err", err)
+		}
+	}()
+	select {
+	case <-flushed:
+	case <-deadline:
+		logger.Warn("gave up flushing queued results")
+	}
+	return nil
+}
+
+// graceDuration parses the grace flag.
+func graceDuration(c *cli.Context) time.Duration {
+	d, err := time.ParseDuration(c.String("grace"))
+	if err != nil || d < 0 {
+		return defaultGrace
+	}
+	return d
+}
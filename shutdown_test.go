@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRunUntilShutdown(t *testing.T) {
+	mockSettingsFile(t, "")
+
+	// Work that returns by itself is left alone.
+	err := runUntilShutdown(nil, time.Second, func(stop <-chan struct{}) error {
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Expected a clean run: %s", err)
+	}
+
+	// On a signal, work is asked to stop and given time to finish.
+	signals := make(chan os.Signal, 1)
+	signals <- syscall.SIGTERM
+	finished := false
+	err = runUntilShutdown(signals, time.Second, func(stop <-chan struct{}) error {
+		<-stop
+		finished = true
+		return nil
+	})
+	if err != nil || !finished {
+		t.Fatal("Expected work to finish after being asked to stop.")
+	}
+
+	// Work ignoring the request is abandoned after the grace period.
+	signals <- syscall.SIGINT
+	start := time.Now()
+	runUntilShutdown(signals, 50*time.Millisecond, func(stop <-chan struct{}) error {
+		select {}
+	})
+	if time.Since(start) > time.Second {
+		t.Fatal("Expected shutdown to give up after the grace period.")
+	}
+}
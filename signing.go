@@ -0,0 +1,51 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// credentialSigning names the secret results are signed with in the
+// credential store.
+const credentialSigning = "signing"
+
+// Headers carrying a request's signature.
+const (
+	timestampHeader = "X-Gobeat-Timestamp"
+	nonceHeader     = "X-Gobeat-Nonce"
+	signatureHeader = "X-Gobeat-Signature"
+)
+
+// signature returns the hex HMAC-SHA256 of timestamp, nonce and body, joined
+// by dots, keyed with secret.
+func signature(secret, timestamp, nonce string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + nonce + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signRequest signs body, the body of req, if a signing secret is stored, so
+// the target can tell the result came from a configured client. Each request
+// gets a fresh nonce, so that a server remembering recent nonces can reject a
+// captured request being replayed.
+func signRequest(req *http.Request, body []byte, now time.Time) error {
+	secret, err := credential(credentialSigning)
+	if err != nil || secret == "" {
+		return err
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	timestamp, nonce := strconv.FormatInt(now.Unix(), 10), hex.EncodeToString(b)
+	req.Header.Set(timestampHeader, timestamp)
+	req.Header.Set(nonceHeader, nonce)
+	req.Header.Set(signatureHeader, "sha256="+signature(secret, timestamp, nonce, body))
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSignature(t *testing.T) {
+	want := "a5f6426ce959df65e013dc16c1f74dbaeae3d1e5864a9efefbae1ec09db6560b"
+	got := signature("s3cret", "1401616320", "0123abcd", []byte("alex beat oleg"))
+	if got != want {
+		t.Fatalf("Expected %s, got %s", want, got)
+	}
+	if signature("s3cret", "1", "n", []byte("a")) == signature("s3cret", "1", "m", []byte("a")) {
+		t.Fatal("Expected the nonce to be signed.")
+	}
+}
+
+func TestSignedPost(t *testing.T) {
+	got := make(chan http.Header, 2)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got <- r.Header
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer ts.Close()
+	mockSettingsFile(t, ts.URL)
+	if err := storeCredential(credentialSigning, "s3cret"); err != nil {
+		t.Fatalf("Could not store secret: %s", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := postResult(mustParse(t, ts.URL), "", "alex beat oleg", true); err != nil {
+			t.Fatalf("Expected a clean post: %s", err)
+		}
+	}
+	first, second := <-got, <-got
+	stamp, nonce := first.Get(timestampHeader), first.Get(nonceHeader)
+	want := "sha256=" + signature("s3cret", stamp, nonce, []byte("alex beat oleg"))
+	if stamp == "" || nonce == "" || first.Get(signatureHeader) != want {
+		t.Fatalf("Expected a signature over the body, got %v", first)
+	}
+	if second.Get(nonceHeader) == nonce {
+		t.Fatal("Expected every request to get a fresh nonce.")
+	}
+}
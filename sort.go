@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/codegangsta/cli"
+)
+
+// Sort orders for --order.
+const (
+	orderAsc  = "asc"
+	orderDesc = "desc"
+)
+
+// sortKey is a way of ordering a list for --sort.
+type sortKey struct {
+	name string
+
+	// asc is whether the key sorts ascending unless --order says otherwise.
+	asc bool
+}
+
+// sortFlags returns the --sort and --order flags for a list sortable by keys,
+// the first of which is the default.
+func sortFlags(keys []sortKey) []cli.Flag {
+	var names []string
+	for _, k := range keys {
+		names = append(names, k.name)
+	}
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:  "sort",
+			Value: keys[0].name,
+			Usage: "sort by " + strings.Join(names, ", "),
+		},
+		cli.StringFlag{
+			Name:  "order",
+			Usage: "asc or desc, overriding the sort's natural order",
+		},
+	}
+}
+
+// parseSort returns the key named by --sort and whether to sort ascending.
+func parseSort(c *cli.Context, keys []sortKey) (string, bool, error) {
+	var key *sortKey
+	for i := range keys {
+		if keys[i].name == c.String("sort") {
+			key = &keys[i]
+		}
+	}
+	if key == nil {
+		return "", false, fmt.Errorf("unknown sort %q.", c.String("sort"))
+	}
+	switch c.String("order") {
+	case "":
+		return key.name, key.asc, nil
+	case orderAsc:
+		return key.name, true, nil
+	case orderDesc:
+		return key.name, false, nil
+	}
+	return "", false, fmt.Errorf("unknown order %q; use asc or desc.", c.String("order"))
+}
+
+// sortBy stably sorts slice by less, or by its reverse if not asc, so that
+// ties keep their order either way.
+func sortBy(slice interface{}, asc bool, less func(i, j int) bool) {
+	sort.SliceStable(slice, func(i, j int) bool {
+		if asc {
+			return less(i, j)
+		}
+		return less(j, i)
+	})
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// spinnerFrames are drawn in turn while waiting.
+var spinnerFrames = []string{"|", "/", "-", `\`}
+
+// spinnerInterval is how often the spinner is redrawn.
+const spinnerInterval = 100 * time.Millisecond
+
+// spinner shows that a slow operation is in progress, with its elapsed time.
+type spinner struct {
+	w     io.Writer
+	label string
+	start time.Time
+	done  chan struct{}
+	idle  chan struct{}
+}
+
+// startSpinner draws a spinner labelled label on stdout until stop is called.
+// It draws nothing unless stdout is a terminal.
+func startSpinner(label string) *spinner {
+	s := &spinner{
+		w:     os.Stdout,
+		label: label,
+		start: time.Now(),
+		done:  make(chan struct{}),
+		idle:  make(chan struct{}),
+	}
+	if !isTerminal(os.Stdout) {
+		close(s.idle)
+		return s
+	}
+	go s.run()
+	return s
+}
+
+// run redraws the spinner until stopped, then clears it.
+func (s *spinner) run() {
+	defer close(s.idle)
+	t := time.NewTicker(spinnerInterval)
+	defer t.Stop()
+	for i := 0; ; i++ {
+		fmt.Fprintf(s.w, "\r%s %s (%.1fs)", spinnerFrames[i%len(spinnerFrames)],
+			s.label, time.Since(s.start).Seconds())
+		select {
+		case <-s.done:
+			fmt.Fprint(s.w, "\r\x1b[K")
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// stop clears the spinner so the final status can be printed in its place.
+func (s *spinner) stop() {
+	close(s.done)
+	<-s.idle
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSpinner(t *testing.T) {
+	// Test output is not a terminal, so stopping returns straight away.
+	startSpinner("Posting result").stop()
+
+	var buf bytes.Buffer
+	s := &spinner{
+		w:     &buf,
+		label: "Posting result",
+		start: time.Now(),
+		done:  make(chan struct{}),
+		idle:  make(chan struct{}),
+	}
+	go s.run()
+	time.Sleep(2 * spinnerInterval)
+	s.stop()
+
+	out := buf.String()
+	if !strings.Contains(out, "Posting result (") {
+		t.Fatalf("Expected the label and elapsed time, got %q", out)
+	}
+	if !strings.HasSuffix(out, "\r\x1b[K") {
+		t.Fatalf("Expected the spinner to be cleared, got %q", out)
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/codegangsta/cli"
+)
+
+// standing is a player's position in the standings.
+type standing struct {
+	Player string
+	Rating float64
+}
+
+// sortedStandings returns r ordered from highest to lowest rating.
+func sortedStandings(r ratings) []standing {
+	out := make([]standing, 0, len(r))
+	for name, rating := range r {
+		out = append(out, standing{Player: name, Rating: rating})
+	}
+	sort.Sort(byRating(out))
+	return out
+}
+
+// byRating sorts standings from highest to lowest rating, then by name.
+type byRating []standing
+
+func (s byRating) Len() int      { return len(s) }
+func (s byRating) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byRating) Less(i, j int) bool {
+	if s[i].Rating != s[j].Rating {
+		return s[i].Rating > s[j].Rating
+	}
+	return s[i].Player < s[j].Player
+}
+
+// leaderboardRow is a player's standing along with their record.
+type leaderboardRow struct {
+	standing
+	Wins   int
+	Losses int
+	Streak int
+}
+
+// winRate returns the percentage of matches won.
+func (l *leaderboardRow) winRate() float64 {
+	if l.Wins+l.Losses == 0 {
+		return 0
+	}
+	return 100 * float64(l.Wins) / float64(l.Wins+l.Losses)
+}
+
+// leaderboardSortKeys are the orders the standings can be listed in.
+var leaderboardSortKeys = []sortKey{
+	{name: "rating"},
+	{name: "wins"},
+	{name: "win-rate"},
+	{name: "streak"},
+	{name: "name", asc: true},
+}
+
+// leaderboard returns everyone's singles standing in game as of now, with
+// their record and current streak in it, from highest to lowest rating.
+func (h *gobeatHistory) leaderboard(game string, now time.Time) []*leaderboardRow {
+	var rows []*leaderboardRow
+	byName := make(map[string]*leaderboardRow)
+	for _, s := range sortedStandings(h.standings(game, now).ratings()) {
+		row := &leaderboardRow{standing: s}
+		rows = append(rows, row)
+		byName[s.Player] = row
+	}
+
+	run := make(map[string]int)
+	if g := h.Pruned.game(game); g != nil {
+		for name, rec := range g.Singles {
+			if row := byName[name]; row != nil {
+				row.Wins, row.Losses = rec.Wins, rec.Losses
+			}
+		}
+		for name, n := range g.Runs {
+			run[name] = n
+		}
+	}
+	for _, r := range h.Results {
+		if r.Game != game || r.doubles() {
+			continue
+		}
+		winner, loser := r.Player, r.Opponent
+		if !r.Won {
+			winner, loser = loser, winner
+		}
+		byName[winner].Wins++
+		byName[loser].Losses++
+		run[winner]++
+		run[loser] = 0
+	}
+	for _, row := range rows {
+		row.Streak = run[row.Player]
+	}
+	return rows
+}
+
+// sortLeaderboard orders rows by key, ascending if asc. Ties keep their order
+// by rating.
+func sortLeaderboard(rows []*leaderboardRow, key string, asc bool) {
+	var less func(i, j int) bool
+	switch key {
+	case "rating":
+		less = func(i, j int) bool { return rows[i].Rating < rows[j].Rating }
+	case "wins":
+		less = func(i, j int) bool { return rows[i].Wins < rows[j].Wins }
+	case "win-rate":
+		less = func(i, j int) bool { return rows[i].winRate() < rows[j].winRate() }
+	case "streak":
+		less = func(i, j int) bool { return rows[i].Streak < rows[j].Streak }
+	case "name":
+		less = func(i, j int) bool { return rows[i].Player < rows[j].Player }
+	default:
+		return
+	}
+	sortBy(rows, asc, less)
+}
+
+// standingsCommand returns the 'gobeat standings' command.
+func standingsCommand() cli.Command {
+	return cli.Command{
+		Name:      "standings",
+		ShortName: "st",
+		Description: "`standings` recomputes everyone's rating in the current game " +
+			"from the full history and prints them from highest to lowest, or as sorted.",
+		Usage: "standings [--sort key] [--order asc|desc]",
+		Flags: sortFlags(leaderboardSortKeys),
+		Action: func(c *cli.Context) {
+			key, asc, err := parseSort(c, leaderboardSortKeys)
+			if err != nil {
+				printError(err)
+			}
+			h, err := retrieveHistory()
+			if err != nil {
+				printError(err)
+			}
+			if len(h.Results) == 0 {
+				fmt.Println("No results recorded yet.")
+				return
+			}
+
+			rows := h.leaderboard(settings.Game, time.Now())
+			sortLeaderboard(rows, key, asc)
+			fmt.Println(bold("Standings for " + settings.Game))
+			for i, row := range rows {
+				fmt.Printf("%3d. %-20s %.0f  %d-%d (%.0f%%)  streak %d\n", i+1, row.Player,
+					row.Rating, row.Wins, row.Losses, row.winRate(), row.Streak)
+			}
+		},
+	}
+}
+
+// decayCommand returns the 'gobeat decay' command.
+func decayCommand() cli.Command {
+	return cli.Command{
+		Name:      "decay",
+		ShortName: "d",
+		Description: "`decay` sets how the ratings of players who stop playing the " +
+			"current game drift back toward the mean.",
+		Usage: "decay [weeks] [rate]",
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "off",
+				Usage: "disable rating decay for the current game",
+			},
+		},
+		Action: func(c *cli.Context) {
+			if c.Bool("off") {
+				delete(settings.Decay, settings.Game)
+				fmt.Printf("Disabled rating decay for %s\n", settings.Game)
+			} else if len(c.Args()) == 0 {
+				d, ok := settings.Decay[settings.Game]
+				if !ok {
+					fmt.Printf("Rating decay is off for %s\n", settings.Game)
+				} else {
+					fmt.Printf("Ratings for %s decay by %.0f%% a week after %d weeks\n",
+						settings.Game, d.Rate*100, d.Weeks)
+				}
+				return
+			} else {
+				if len(c.Args()) < 2 {
+					printError(fmt.Errorf("missing weeks and rate."))
+				}
+				weeks, err := strconv.Atoi(c.Args().First())
+				if err != nil || weeks < 0 {
+					printError(fmt.Errorf("weeks must be a non-negative integer."))
+				}
+				rate, err := strconv.ParseFloat(c.Args().Get(1), 64)
+				if err != nil || rate <= 0 || rate > 1 {
+					printError(fmt.Errorf("rate must be between 0 and 1."))
+				}
+
+				if settings.Decay == nil {
+					settings.Decay = make(map[string]*ratingDecay)
+				}
+				settings.Decay[settings.Game] = &ratingDecay{Weeks: weeks, Rate: rate}
+				fmt.Printf("Ratings for %s now decay by %.0f%% a week after %d weeks\n",
+					settings.Game, rate*100, weeks)
+			}
+
+			if err := settings.save(); err != nil {
+				printError(err)
+			}
+		},
+	}
+}
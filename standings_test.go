@@ -0,0 +1,78 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestStandingsDecay(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	h := mockHistoryFile(t)
+
+	start := time.Date(2014, 4, 24, 12, 0, 0, 0, time.UTC)
+	h.add(&matchResult{Player: "alex", Opponent: "oleg", Game: "ping pong",
+		Won: true, Date: start})
+
+	now := start.Add(6 * week)
+	before := h.standings("ping pong", now).get("alex")
+	if before != ratingMean+eloK/2 {
+		t.Fatalf("Expected no decay without settings, got %f", before)
+	}
+
+	settings.Decay = map[string]*ratingDecay{"ping pong": {Weeks: 4, Rate: 0.5}}
+	after := h.standings("ping pong", now).get("alex")
+	if math.Abs(after-(ratingMean+eloK/8)) > 1e-9 {
+		t.Fatalf("Expected two weeks of decay toward the mean, got %f", after)
+	}
+}
+
+func TestSortedStandings(t *testing.T) {
+	s := sortedStandings(ratings{"oleg": 1400, "alex": 1600, "ivan": 1600})
+	if s[0].Player != "alex" || s[1].Player != "ivan" || s[2].Player != "oleg" {
+		t.Fatalf("Expected standings by rating then name, got %v", s)
+	}
+}
+
+func TestLeaderboard(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	h := mockHistoryFile(t)
+	for _, r := range []*matchResult{
+		{Player: "alex", Opponent: "oleg", Won: true},
+		{Player: "alex", Opponent: "oleg", Won: true},
+		{Player: "alex", Opponent: "ivan", Won: false},
+		{Player: "oleg", Opponent: "ivan", Won: true},
+		{Player: "alex", Opponent: "oleg", Game: "foosball", Won: false},
+	} {
+		if r.Game == "" {
+			r.Game = "ping pong"
+		}
+		h.add(r)
+	}
+
+	rows := h.leaderboard("ping pong", time.Now())
+	if len(rows) != 3 || rows[0].Player != "alex" {
+		t.Fatalf("Expected the highest rated first, got %+v", rows)
+	}
+	if rows[0].Wins != 2 || rows[0].Losses != 1 || rows[0].Streak != 0 {
+		t.Fatalf("Expected alex at 2-1 with no streak, got %+v", rows[0])
+	}
+
+	sortLeaderboard(rows, "streak", false)
+	if rows[0].Player != "oleg" || rows[0].Streak != 1 {
+		t.Fatalf("Expected the longest streak first, got %+v", rows[0])
+	}
+	sortLeaderboard(rows, "name", true)
+	if rows[0].Player != "alex" || rows[2].Player != "oleg" {
+		t.Fatalf("Expected alphabetical order, got %+v", rows)
+	}
+}
+
+func BenchmarkLeaderboard(b *testing.B) {
+	mockSettingsFile(b, "foo.gov")
+	h := mockLargeHistory(b, benchmarkHistorySize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.leaderboard(settings.Game, time.Now())
+	}
+}
@@ -0,0 +1,569 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/codegangsta/cli"
+)
+
+// formLength is how many recent matches the form sparkline covers.
+const formLength = 20
+
+// Sparkline bars for wins and losses.
+const (
+	sparkWin  = "▇"
+	sparkLoss = "▂"
+)
+
+// sparkline renders results as a compact W/L sparkline, oldest first.
+func sparkline(results []*matchResult) string {
+	var buf bytes.Buffer
+	for _, r := range results {
+		if r.Won {
+			buf.WriteString(sparkWin)
+		} else {
+			buf.WriteString(sparkLoss)
+		}
+	}
+	return buf.String()
+}
+
+// recent returns player's last n results, oldest first. If opponent is
+// non-empty only results against them are considered.
+func (h *gobeatHistory) recent(player, opponent string, n int) []*matchResult {
+	var out []*matchResult
+	for i := len(h.Results) - 1; i >= 0 && len(out) < n; i-- {
+		r := h.Results[i]
+		if r.Player != player || (opponent != "" && r.Opponent != opponent) {
+			continue
+		}
+		out = append(out, r)
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out
+}
+
+// playerStats summarizes a player's results.
+type playerStats struct {
+	Player       string
+	Wins         int
+	Losses       int
+	Streak       int
+	BestStreak   int
+	Rating       string
+	Achievements []*achievement
+
+	// Form is a sparkline of Player's last formLength results.
+	Form string
+
+	// DoublesRating is empty if Player has not played doubles.
+	DoublesRating string
+
+	// Margins is nil if none of Player's results have a numeric score.
+	Margins *marginStats
+}
+
+// stats computes the statistics for player from the history.
+func (h *gobeatHistory) stats(player string) *playerStats {
+	s := &playerStats{
+		Player:       player,
+		Streak:       h.streak(player),
+		Rating:       h.unfiltered().standings(settings.Game, time.Now()).describe(player),
+		Achievements: h.Achievements[player],
+		Form:         sparkline(h.recent(player, "", formLength)),
+		Margins:      h.margins(player, ""),
+	}
+	if h.playedDoubles(player) {
+		s.DoublesRating = h.unfiltered().doublesStandings(settings.Game, time.Now()).describe(player)
+	}
+
+	rec, st := h.Pruned.record(player), h.Pruned.streak(player)
+	s.Wins, s.Losses, s.BestStreak = rec.Wins, rec.Losses, st.Best
+	run := st.Current
+	for _, r := range h.Results {
+		if r.Player != player {
+			continue
+		}
+		if r.Won {
+			s.Wins++
+			run++
+			if run > s.BestStreak {
+				s.BestStreak = run
+			}
+		} else {
+			s.Losses++
+			run = 0
+		}
+	}
+	return s
+}
+
+// winRate returns the percentage of matches won.
+func (s *playerStats) winRate() float64 {
+	if s.Wins+s.Losses == 0 {
+		return 0
+	}
+	return 100 * float64(s.Wins) / float64(s.Wins+s.Losses)
+}
+
+// statsCommand returns the 'gobeat stats' command.
+func statsCommand() cli.Command {
+	return cli.Command{
+		Name:      "stats",
+		ShortName: "s",
+		Description: "`stats` prints a player's record, streaks, rating and achievements, " +
+			"optionally counting only some results; ratings always count them all.",
+		Usage: "stats [--by week|month] [filters] [player]",
+		Flags: append([]cli.Flag{
+			cli.StringFlag{
+				Name:  "output",
+				Value: "text",
+				Usage: "output format: text or json",
+			},
+			cli.StringFlag{
+				Name:  "by",
+				Usage: "break the stats down by week or month",
+			},
+		}, filterFlags()...),
+		Action: func(c *cli.Context) {
+			player := settings.User
+			if len(c.Args()) > 0 {
+				player = c.Args().First()
+			}
+
+			f, err := parseFilter(c)
+			if err != nil {
+				printError(err)
+			}
+			h, err := retrieveHistory()
+			if err != nil {
+				printError(err)
+			}
+			h = h.filter(f)
+
+			if by := c.String("by"); by != "" {
+				periods, err := h.periodStats(player, by)
+				if err != nil {
+					printError(err)
+				}
+				switch c.String("output") {
+				case "text":
+					printPeriodStats(periods)
+				case "json":
+					b, err := json.MarshalIndent(periods, "", "  ")
+					if err != nil {
+						printError(err)
+					}
+					fmt.Println(string(b))
+				default:
+					printError(fmt.Errorf("unknown output format %q.", c.String("output")))
+				}
+				return
+			}
+
+			switch c.String("output") {
+			case "text":
+				printStats(h.stats(player))
+			case "json":
+				b, err := json.MarshalIndent(h.statsReport(player, time.Now()), "", "  ")
+				if err != nil {
+					printError(err)
+				}
+				fmt.Println(string(b))
+			default:
+				printError(fmt.Errorf("unknown output format %q.", c.String("output")))
+			}
+		},
+	}
+}
+
+// printStats prints s for the stats command.
+func printStats(s *playerStats) {
+	fmt.Println(bold("Stats for " + s.Player))
+	fmt.Printf("  Record:       %s-%s (%.1f%%)\n", outcome(true, strconv.Itoa(s.Wins)),
+		outcome(false, strconv.Itoa(s.Losses)), s.winRate())
+	fmt.Printf("  Streak:       %d (best %d)\n", s.Streak, s.BestStreak)
+	if s.Form != "" {
+		fmt.Printf("  Form:         %s\n", s.Form)
+	}
+	fmt.Printf("  Rating:       %s\n", s.Rating)
+	if s.DoublesRating != "" {
+		fmt.Printf("  Doubles:      %s\n", s.DoublesRating)
+	}
+	if len(s.Achievements) > 0 {
+		fmt.Printf("  Achievements: %s\n", achievementTitles(s.Achievements))
+	}
+	printMargins(s.Margins, "  ")
+}
+
+// closestLength is how many of the closest matches margin statistics list.
+const closestLength = 3
+
+// margin returns the point difference of r's score, or false if the score is
+// not two point totals.
+func (r *matchResult) margin() (int, bool) {
+	a, b, ok := parsePoints(r.Score)
+	if !ok {
+		return 0, false
+	}
+	if a < b {
+		return b - a, true
+	}
+	return a - b, true
+}
+
+// blowout returns whether the winner of r scored at least twice as many
+// points as the loser.
+func (r *matchResult) blowout() bool {
+	a, b, ok := parsePoints(r.Score)
+	if !ok {
+		return false
+	}
+	if a < b {
+		a, b = b, a
+	}
+	return a > b && a >= 2*b
+}
+
+// marginStats summarizes the point differentials of a player's results.
+type marginStats struct {
+	// AvgWin and AvgLoss are the average margins of victory and defeat.
+	AvgWin  float64 `json:"average_win_margin"`
+	AvgLoss float64 `json:"average_loss_margin"`
+
+	// BlowoutWins and BlowoutLosses count matches won or lost with at least
+	// twice the loser's points.
+	BlowoutWins   int `json:"blowout_wins"`
+	BlowoutLosses int `json:"blowout_losses"`
+
+	// Closest are the closestLength matches with the smallest margins, most
+	// recent first among equal margins.
+	Closest []*matchResult `json:"closest"`
+}
+
+// margins computes the margin statistics of player's results with numeric
+// scores, or nil if there are none. If opponent is non-empty only results
+// against them are considered.
+func (h *gobeatHistory) margins(player, opponent string) *marginStats {
+	s := new(marginStats)
+	var wins, losses, winPoints, lossPoints int
+	// closest holds the closestLength narrowest results so far, rather than
+	// sorting every scored result.
+	type scoredResult struct {
+		r      *matchResult
+		margin int
+	}
+	var closest []scoredResult
+	for i := len(h.Results) - 1; i >= 0; i-- {
+		r := h.Results[i]
+		if r.Player != player || (opponent != "" && r.Opponent != opponent) {
+			continue
+		}
+		d, ok := r.margin()
+		if !ok {
+			continue
+		}
+		if len(closest) < closestLength || d < closest[len(closest)-1].margin {
+			// After any as close, which are more recent.
+			at := sort.Search(len(closest), func(i int) bool { return closest[i].margin > d })
+			closest = append(closest, scoredResult{})
+			copy(closest[at+1:], closest[at:])
+			closest[at] = scoredResult{r, d}
+			if len(closest) > closestLength {
+				closest = closest[:closestLength]
+			}
+		}
+		if r.Won {
+			wins++
+			winPoints += d
+			if r.blowout() {
+				s.BlowoutWins++
+			}
+		} else {
+			losses++
+			lossPoints += d
+			if r.blowout() {
+				s.BlowoutLosses++
+			}
+		}
+	}
+	if len(closest) == 0 {
+		return nil
+	}
+	if wins > 0 {
+		s.AvgWin = float64(winPoints) / float64(wins)
+	}
+	if losses > 0 {
+		s.AvgLoss = float64(lossPoints) / float64(losses)
+	}
+	for _, c := range closest {
+		s.Closest = append(s.Closest, c.r)
+	}
+	return s
+}
+
+// printMargins prints s, if non-nil, with each line indented by indent.
+func printMargins(s *marginStats, indent string) {
+	if s == nil {
+		return
+	}
+	fmt.Printf("%sMargins:      won by %.1f, lost by %.1f on average\n", indent,
+		s.AvgWin, s.AvgLoss)
+	fmt.Printf("%sBlowouts:     %s-%s\n", indent,
+		outcome(true, strconv.Itoa(s.BlowoutWins)),
+		outcome(false, strconv.Itoa(s.BlowoutLosses)))
+	fmt.Printf("%sClosest:\n", indent)
+	for _, r := range s.Closest {
+		fmt.Printf("%s  %s\n", indent, formatHistoryLine(r))
+	}
+}
+
+// Periods stats can be broken down by.
+const (
+	periodWeek  = "week"
+	periodMonth = "month"
+)
+
+// periodOf returns the name of the period of kind by containing t: an ISO
+// week like "2024-W03" or a month like "2024-01".
+func periodOf(t time.Time, by string) string {
+	if by == periodWeek {
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	}
+	return t.Format("2006-01")
+}
+
+// periodStat summarizes a player's results in one week or month.
+type periodStat struct {
+	Period  string  `json:"period"`
+	Played  int     `json:"played"`
+	Wins    int     `json:"wins"`
+	Losses  int     `json:"losses"`
+	WinRate float64 `json:"win_rate"`
+
+	// RatingChange is how much the player's rating in the current game moved
+	// over the period.
+	RatingChange float64 `json:"rating_change"`
+}
+
+// periodStats breaks player's results down by week or month, oldest first.
+// Periods without results are left out.
+func (h *gobeatHistory) periodStats(player, by string) ([]*periodStat, error) {
+	if by != periodWeek && by != periodMonth {
+		return nil, fmt.Errorf("unknown period %q; use week or month.", by)
+	}
+
+	var out []*periodStat
+	index := make(map[string]*periodStat)
+	get := func(period string) *periodStat {
+		p, ok := index[period]
+		if !ok {
+			p = &periodStat{Period: period}
+			index[period] = p
+			out = append(out, p)
+		}
+		return p
+	}
+	for _, r := range h.Results {
+		if r.Player != player {
+			continue
+		}
+		p := get(periodOf(r.Date, by))
+		p.Played++
+		if r.Won {
+			p.Wins++
+		} else {
+			p.Losses++
+		}
+	}
+
+	prev := float64(ratingMean)
+	for _, pt := range h.unfiltered().ratingHistory(player, settings.Game) {
+		if p, ok := index[periodOf(pt.Date, by)]; ok {
+			p.RatingChange += pt.Rating - prev
+		}
+		prev = pt.Rating
+	}
+	for _, p := range out {
+		p.WinRate = 100 * float64(p.Wins) / float64(p.Played)
+	}
+	return out, nil
+}
+
+// printPeriodStats prints periods as a table for the stats command.
+func printPeriodStats(periods []*periodStat) {
+	fmt.Println(bold(fmt.Sprintf("%-10s %6s %9s %8s %7s", "Period", "Played", "Record",
+		"Win rate", "Rating")))
+	for _, p := range periods {
+		fmt.Printf("%-10s %6d %9s %7.1f%% %+7.0f\n", p.Period, p.Played,
+			fmt.Sprintf("%d-%d", p.Wins, p.Losses), p.WinRate, p.RatingChange)
+	}
+}
+
+// record is a win-loss record.
+type record struct {
+	Wins   int `json:"wins"`
+	Losses int `json:"losses"`
+}
+
+// add counts a result in the record.
+func (r *record) add(won bool) {
+	if won {
+		r.Wins++
+	} else {
+		r.Losses++
+	}
+}
+
+// gameRatings are a player's ratings in a single game.
+type gameRatings struct {
+	Singles float64  `json:"singles"`
+	Doubles *float64 `json:"doubles,omitempty"`
+}
+
+// statsReport is the machine-readable form of the stats command's output.
+type statsReport struct {
+	Player       string                 `json:"player"`
+	Wins         int                    `json:"wins"`
+	Losses       int                    `json:"losses"`
+	WinRate      float64                `json:"win_rate"`
+	Streak       int                    `json:"streak"`
+	BestStreak   int                    `json:"best_streak"`
+	Achievements []*achievement         `json:"achievements"`
+	Ratings      map[string]gameRatings `json:"ratings"`
+
+	// Games splits Player's record by game.
+	Games map[string]*record `json:"games"`
+
+	// Margins is omitted if none of Player's results have a numeric score.
+	Margins *marginStats `json:"margins,omitempty"`
+
+	// HeadToHead is every player's record against every other player in
+	// singles, keyed by player and then opponent.
+	HeadToHead map[string]map[string]*record `json:"head_to_head"`
+}
+
+// statsReport computes the full statistics report for player as of now.
+func (h *gobeatHistory) statsReport(player string, now time.Time) *statsReport {
+	s := h.stats(player)
+	rep := &statsReport{
+		Player:       player,
+		Wins:         s.Wins,
+		Losses:       s.Losses,
+		WinRate:      s.winRate(),
+		Streak:       s.Streak,
+		BestStreak:   s.BestStreak,
+		Achievements: s.Achievements,
+		Ratings:      make(map[string]gameRatings),
+		Games:        make(map[string]*record),
+		Margins:      s.Margins,
+		HeadToHead:   h.headToHead(),
+	}
+	if rep.Achievements == nil {
+		rep.Achievements = []*achievement{}
+	}
+
+	if h.Pruned != nil {
+		for game, g := range h.Pruned.Games {
+			if rec := g.Records[player]; rec != nil {
+				copied := *rec
+				rep.Games[game] = &copied
+			}
+		}
+	}
+	for _, r := range h.Results {
+		if r.Player != player {
+			continue
+		}
+		g, ok := rep.Games[r.Game]
+		if !ok {
+			g = new(record)
+			rep.Games[r.Game] = g
+		}
+		g.add(r.Won)
+	}
+	for game := range rep.Games {
+		gr := gameRatings{Singles: h.unfiltered().standings(game, now).get(player)}
+		if h.playedDoubles(player) {
+			d := h.unfiltered().doublesStandings(game, now).get(player)
+			gr.Doubles = &d
+		}
+		rep.Ratings[game] = gr
+	}
+	return rep
+}
+
+// headToHead returns every player's singles record against every other
+// player, keyed by player and then opponent.
+func (h *gobeatHistory) headToHead() map[string]map[string]*record {
+	m := make(map[string]map[string]*record)
+	get := func(player, opponent string) *record {
+		if m[player] == nil {
+			m[player] = make(map[string]*record)
+		}
+		r, ok := m[player][opponent]
+		if !ok {
+			r = new(record)
+			m[player][opponent] = r
+		}
+		return r
+	}
+	if h.Pruned != nil {
+		for _, g := range h.Pruned.Games {
+			for player, opponents := range g.HeadToHead {
+				for opponent, rec := range opponents {
+					r := get(player, opponent)
+					r.Wins += rec.Wins
+					r.Losses += rec.Losses
+				}
+			}
+		}
+	}
+	for _, r := range h.Results {
+		if r.doubles() {
+			continue
+		}
+		get(r.Player, r.Opponent).add(r.Won)
+		get(r.Opponent, r.Player).add(!r.Won)
+	}
+	return m
+}
+
+// versusCommand returns the 'gobeat versus' command.
+func versusCommand() cli.Command {
+	return cli.Command{
+		Name:        "versus",
+		ShortName:   "vs",
+		Description: "`versus` prints your head-to-head record against an opponent.",
+		Usage:       "versus [opponent]",
+		Action: func(c *cli.Context) {
+			if len(c.Args()) == 0 {
+				printError(fmt.Errorf("missing opponent name."))
+			}
+			opponent := c.Args().First()
+
+			h, err := retrieveHistory()
+			if err != nil {
+				printError(err)
+			}
+			wins, losses := h.series(settings.User, opponent)
+			if wins+losses == 0 {
+				fmt.Printf("%s has not played %s yet.\n", settings.User, opponent)
+				return
+			}
+			fmt.Printf("%s: %s-%s\n", bold(settings.User+" vs "+opponent),
+				outcome(true, strconv.Itoa(wins)), outcome(false, strconv.Itoa(losses)))
+			fmt.Printf("  Form:         %s\n",
+				sparkline(h.recent(settings.User, opponent, formLength)))
+			printMargins(h.margins(settings.User, opponent), "  ")
+		},
+	}
+}
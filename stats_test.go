@@ -0,0 +1,138 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	h := mockHistoryFile(t)
+	for _, won := range []bool{true, true, true, false, true} {
+		h.add(&matchResult{Player: "alex", Opponent: "oleg", Won: won})
+	}
+	h.add(&matchResult{Player: "oleg", Opponent: "alex", Won: true})
+
+	s := h.stats("alex")
+	if s.Wins != 4 || s.Losses != 1 {
+		t.Fatalf("Expected a 4-1 record, got %d-%d", s.Wins, s.Losses)
+	}
+	if s.Streak != 1 || s.BestStreak != 3 {
+		t.Fatalf("Expected streak 1 (best 3), got %d (best %d)", s.Streak,
+			s.BestStreak)
+	}
+	if s.winRate() != 80 {
+		t.Fatalf("Expected an 80%% win rate, got %f", s.winRate())
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	h := mockHistoryFile(t)
+	for i := 0; i < formLength; i++ {
+		h.add(&matchResult{Player: "alex", Opponent: "ivan", Won: false})
+	}
+	for _, won := range []bool{true, false, true} {
+		h.add(&matchResult{Player: "alex", Opponent: "oleg", Won: won})
+	}
+
+	if form := sparkline(h.recent("alex", "oleg", formLength)); form != "▇▂▇" {
+		t.Fatalf("Expected head-to-head form, got %q", form)
+	}
+	recent := h.recent("alex", "", formLength)
+	if len(recent) != formLength || !recent[formLength-1].Won {
+		t.Fatal("Expected form to cover the most recent matches, oldest first.")
+	}
+}
+
+func TestStatsReport(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	h := mockHistoryFile(t)
+	h.add(&matchResult{Player: "alex", Opponent: "oleg", Game: "ping pong", Won: true})
+	h.add(&matchResult{Player: "alex", Opponent: "oleg", Game: "foosball", Won: false})
+	h.add(&matchResult{Player: "oleg", Opponent: "ivan", Game: "ping pong", Won: true})
+
+	rep := h.statsReport("alex", time.Now())
+	if rep.Games["ping pong"].Wins != 1 || rep.Games["foosball"].Losses != 1 {
+		t.Fatalf("Expected per-game splits, got %v", rep.Games)
+	}
+	if rep.Ratings["ping pong"].Singles <= ratingMean {
+		t.Fatal("Expected a per-game rating for the win.")
+	}
+	if r := rep.HeadToHead["oleg"]["alex"]; r.Wins != 1 || r.Losses != 1 {
+		t.Fatalf("Expected the head-to-head matrix to be mirrored, got %+v", r)
+	}
+	if r := rep.HeadToHead["ivan"]["oleg"]; r.Losses != 1 {
+		t.Fatalf("Expected other players in the matrix, got %+v", r)
+	}
+}
+
+func TestMargins(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	h := mockHistoryFile(t)
+	if h.margins("alex", "") != nil {
+		t.Fatal("Expected no margins without any scores.")
+	}
+	h.add(&matchResult{Player: "alex", Opponent: "oleg", Score: "21-5", Won: true})
+	h.add(&matchResult{Player: "alex", Opponent: "oleg", Score: "21-19", Won: true})
+	h.add(&matchResult{Player: "alex", Opponent: "ivan", Score: "15-21", Won: false})
+	h.add(&matchResult{Player: "alex", Opponent: "ivan", Score: "won", Won: true})
+
+	s := h.margins("alex", "")
+	if s.AvgWin != 9 || s.AvgLoss != 6 {
+		t.Fatalf("Expected margins of 9 and 6, got %.1f and %.1f", s.AvgWin, s.AvgLoss)
+	}
+	if s.BlowoutWins != 1 || s.BlowoutLosses != 0 {
+		t.Fatalf("Expected one blowout win, got %d-%d", s.BlowoutWins, s.BlowoutLosses)
+	}
+	if len(s.Closest) != 3 || s.Closest[0].Score != "21-19" {
+		t.Fatalf("Expected the closest match first, got %v", s.Closest)
+	}
+	if s := h.margins("alex", "ivan"); s.AvgWin != 0 || len(s.Closest) != 1 {
+		t.Fatalf("Expected margins against a single opponent, got %+v", s)
+	}
+}
+
+func TestPeriodStats(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	h := mockHistoryFile(t)
+	jan := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	h.add(&matchResult{Player: "alex", Opponent: "oleg", Game: "ping pong", Won: true, Date: jan})
+	h.add(&matchResult{Player: "alex", Opponent: "oleg", Game: "ping pong", Won: false,
+		Date: jan.AddDate(0, 0, 1)})
+	h.add(&matchResult{Player: "alex", Opponent: "oleg", Game: "ping pong", Won: true,
+		Date: jan.AddDate(0, 1, 0)})
+
+	periods, err := h.periodStats("alex", periodMonth)
+	if err != nil {
+		t.Fatalf("Could not compute period stats: %s", err)
+	}
+	if len(periods) != 2 || periods[0].Period != "2024-01" || periods[1].Period != "2024-02" {
+		t.Fatalf("Expected January and February, got %+v", periods)
+	}
+	if p := periods[0]; p.Played != 2 || p.WinRate != 50 {
+		t.Fatalf("Expected a 1-1 January, got %+v", p)
+	}
+	total := periods[0].RatingChange + periods[1].RatingChange
+	want := h.standings("ping pong", jan.AddDate(0, 2, 0)).get("alex") - ratingMean
+	if math.Abs(total-want) > 1e-9 {
+		t.Fatalf("Expected rating changes to add up to %f, got %f", want, total)
+	}
+
+	if periods, _ := h.periodStats("alex", periodWeek); periods[0].Period != "2024-W03" {
+		t.Fatalf("Expected ISO weeks, got %s", periods[0].Period)
+	}
+	if _, err := h.periodStats("alex", "fortnight"); err == nil {
+		t.Fatal("Expected an unknown period to be refused.")
+	}
+}
+
+func BenchmarkStatsReport(b *testing.B) {
+	mockSettingsFile(b, "foo.gov")
+	h := mockLargeHistory(b, benchmarkHistorySize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.statsReport(settings.User, time.Now())
+	}
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/codegangsta/cli"
+)
+
+const syncFile = ".gobeat_sync"
+
+// syncPath is the full path to how far the history has been pulled from the
+// target.
+var syncPath = filepath.Join(os.Getenv("HOME"), syncFile)
+
+// syncState is how far the history has been pulled from the target.
+type syncState struct {
+	// Pulled is when the target last sent results, by its clock, so that the
+	// next pull only asks for those it has received since.
+	Pulled time.Time `json:"pulled"`
+}
+
+// retrieveSyncState loads how far the history has been pulled. A history
+// never pulled has the zero state.
+func retrieveSyncState() (*syncState, error) {
+	s := new(syncState)
+	b, err := ioutil.ReadFile(syncPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// saveSyncState saves to disk the state in '~/.gobeat_sync'.
+func saveSyncState(s *syncState) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(syncPath, b, 0644)
+}
+
+// fetchResults returns the current user's results from the target u,
+// limited to those it received, changed or deleted after since unless that is
+// the zero time, along with the target's time of the response.
+func fetchResults(u *url.URL, since time.Time) ([]*syncedResult, time.Time, error) {
+	query := url.Values{"player": {settings.User}}
+	if !since.IsZero() {
+		query.Set("since", since.UTC().Format(time.RFC3339))
+	}
+	resp, err := sendTargetRequest(u, "GET", resultsPath, query, nil)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return nil, time.Time{}, fmt.Errorf("the server won't let you read results; see 'gobeat token use'.")
+	case http.StatusNotFound, http.StatusMethodNotAllowed:
+		return nil, time.Time{}, fmt.Errorf("the target does not support history sync.")
+	default:
+		return nil, time.Time{}, fmt.Errorf("on sync: got code %d", resp.StatusCode)
+	}
+
+	var out []*syncedResult
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, time.Time{}, fmt.Errorf("invalid results: %s", err)
+	}
+	// Go by the target's clock, so a skewed local one can't skip results.
+	at, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		at = time.Now()
+	}
+	return out, at, nil
+}
+
+// syncedResult is a result as the target lists it for a sync.
+type syncedResult struct {
+	matchResult
+
+	// Deleted is whether the result was deleted, as from another machine.
+	// Only its ID and when it was deleted, in Updated, are given.
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// Ways to settle a result whose local copy differs from the target's.
+const (
+	// conflictServer keeps the target's copy.
+	conflictServer = "server"
+
+	// conflictNewest keeps whichever copy was changed last, the target's if
+	// they were changed at once.
+	conflictNewest = "newest"
+
+	// conflictAsk shows both copies and asks which to keep.
+	conflictAsk = "ask"
+)
+
+// conflictPolicies are the ways sync conflicts can be settled.
+var conflictPolicies = []string{conflictServer, conflictNewest, conflictAsk}
+
+// conflictResolver decides whether to keep the local copy of a result over
+// the target's.
+type conflictResolver func(local *matchResult, remote *syncedResult) (keepLocal bool, err error)
+
+// newestWins keeps whichever copy of a result was changed last.
+func newestWins(local *matchResult, remote *syncedResult) (bool, error) {
+	return local.lastChanged().After(remote.lastChanged()), nil
+}
+
+// newConflictResolver returns the resolver for policy, asking on out and
+// reading answers from in for conflictAsk.
+func newConflictResolver(policy string, in io.Reader, out io.Writer) (conflictResolver, error) {
+	switch policy {
+	case conflictServer:
+		return func(*matchResult, *syncedResult) (bool, error) { return false, nil }, nil
+	case "", conflictNewest:
+		return newestWins, nil
+	case conflictAsk:
+		answers := bufio.NewReader(in)
+		return func(local *matchResult, remote *syncedResult) (bool, error) {
+			fmt.Fprintf(out, "Result %s differs here and on the server:\n", local.ID)
+			fmt.Fprintf(out, "  here:   %s\n", formatHistoryLine(local))
+			if remote.Deleted {
+				fmt.Fprintln(out, "  server: deleted")
+			} else {
+				fmt.Fprintf(out, "  server: %s\n", formatHistoryLine(&remote.matchResult))
+			}
+			ok, err := confirm(answers, out, "Keep the server's copy?")
+			return !ok, err
+		}, nil
+	}
+	return nil, fmt.Errorf("--conflicts must be one of %s.", strings.Join(conflictPolicies, ", "))
+}
+
+// syncConflict is a result whose local copy differed from the target's.
+type syncConflict struct {
+	Local  *matchResult
+	Remote *syncedResult
+
+	// KeptLocal is whether the local copy was kept, and sent to the target
+	// in place of its own.
+	KeptLocal bool
+}
+
+// pullHistory adds to the history the results the target u has received
+// since the last pull, such as those recorded on another machine, matched by
+// ID. A result changed or deleted on the target that differs from the local
+// copy is a conflict, settled by resolve; a local copy that is kept is sent
+// back to the target. It returns how many results were added and the
+// conflicts.
+func pullHistory(u *url.URL, resolve conflictResolver) (int, []*syncConflict, error) {
+	state, err := retrieveSyncState()
+	if err != nil {
+		return 0, nil, err
+	}
+	results, at, err := fetchResults(u, state.Pulled)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	h, err := retrieveHistory()
+	if err != nil {
+		return 0, nil, err
+	}
+	added, changed := 0, false
+	var conflicts []*syncConflict
+	for _, r := range results {
+		// Results are matched by ID, so one without can't be merged.
+		if r.ID == "" {
+			continue
+		}
+		local := h.find(r.ID)
+		if local == nil {
+			if !r.Deleted {
+				r.Identified = true
+				h.add(&r.matchResult)
+				added++
+			}
+			continue
+		}
+		if !r.Deleted && local.sameMatch(&r.matchResult) {
+			continue
+		}
+
+		keep, err := resolve(local, r)
+		if err != nil {
+			return added, conflicts, err
+		}
+		conflicts = append(conflicts, &syncConflict{Local: local, Remote: r, KeptLocal: keep})
+		changed = true
+		if keep {
+			local.Identified, local.Unsynced = true, false
+		} else if r.Deleted {
+			h.remove(r.ID)
+		} else {
+			r.Identified = true
+			*local = r.matchResult
+		}
+	}
+	if added > 0 || changed {
+		sort.Stable(byDate(h.Results))
+		if err := h.save(); err != nil {
+			return added, conflicts, err
+		}
+	}
+
+	for _, c := range conflicts {
+		if !c.KeptLocal {
+			continue
+		}
+		var err error
+		if c.Remote.Deleted {
+			err = postResult(u, c.Local.ID, c.Local.Message, false)
+		} else {
+			err = updateRemoteResult(u, c.Local)
+		}
+		if err != nil && err != errAwaitingApproval {
+			logger.Warn("could not send the kept copy of a result to the target",
+				"id", c.Local.ID, "err", err)
+		}
+	}
+	state.Pulled = at
+	return added, conflicts, saveSyncState(state)
+}
+
+// pushHistory records on the target u, unannounced, the current user's
+// results that never reached it, such as imported ones. If legacy is true, so
+// are results recorded before gobeat sent result IDs, which the target may
+// well have already. It returns how many were pushed and how many of those
+// are awaiting approval.
+func pushHistory(u *url.URL, legacy bool) (int, int, error) {
+	h, err := retrieveHistory()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	pushed, held := 0, 0
+	var pushErr error
+	for _, r := range h.Results {
+		if r.Identified || r.Player != settings.User || !r.Unsynced && !legacy {
+			continue
+		}
+		msg := r.Message
+		if msg == "" {
+			if msg, pushErr = formatResult(newAnnouncement(r, nil), nil); pushErr != nil {
+				break
+			}
+		}
+		err := postResult(u, r.ID, msg, false)
+		if err == errAwaitingApproval {
+			if err = awaitApproval(r.ID); err == nil {
+				held++
+			}
+		}
+		if err != nil {
+			pushErr = err
+			break
+		}
+		r.Identified, r.Unsynced = true, false
+		pushed++
+	}
+	// Save what was pushed even if a push failed, so it isn't sent again.
+	if pushed > 0 {
+		if err := h.save(); err != nil {
+			return pushed, held, err
+		}
+	}
+	return pushed, held, pushErr
+}
+
+// syncCommand returns the 'gobeat sync' command.
+func syncCommand() cli.Command {
+	return cli.Command{
+		Name: "sync",
+		Description: "`sync` keeps the history in step between machines through the " +
+			"server: results it received since the last sync are pulled, matched by " +
+			"ID, and local results that never reached it, such as imported ones, are " +
+			"recorded on it without being announced. Results posted before gobeat " +
+			"sent IDs can't be matched, so they are only pushed with --push-legacy. " +
+			"A result changed on both sides is settled by --conflicts: server keeps " +
+			"the server's copy, newest (the default) whichever was changed last, and " +
+			"ask shows both. With --auto, results are pulled before each one is " +
+			"recorded, keeping the newest copy.",
+		Usage: "sync [--pull|--push-legacy] [--conflicts server|newest|ask] | sync --auto|--no-auto",
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "pull",
+				Usage: "only pull results from the server",
+			},
+			cli.BoolFlag{
+				Name:  "push-legacy",
+				Usage: "also push results posted before gobeat sent result IDs, which the server may have",
+			},
+			cli.StringFlag{
+				Name:  "conflicts",
+				Usage: "how to settle results changed on both sides: " + strings.Join(conflictPolicies, ", "),
+			},
+			cli.BoolFlag{
+				Name:  "auto",
+				Usage: "pull results before recording each one",
+			},
+			cli.BoolFlag{
+				Name:  "no-auto",
+				Usage: "stop pulling results automatically",
+			},
+		},
+		Action: func(c *cli.Context) {
+			if c.Bool("auto") || c.Bool("no-auto") {
+				settings.AutoSync = c.Bool("auto")
+				if settings.AutoSync {
+					fmt.Println("Pulling results before recording each one")
+				} else {
+					fmt.Println("Not pulling results automatically")
+				}
+
+				if err := settings.save(); err != nil {
+					printError(err)
+				}
+				return
+			}
+
+			u, err := settings.URL()
+			if err != nil {
+				printError(err)
+			}
+			if u.String() == "" {
+				printError(fmt.Errorf("no target set."))
+			}
+			resolve, err := newConflictResolver(c.String("conflicts"), os.Stdin, os.Stdout)
+			if err != nil {
+				printError(err)
+			}
+			pulled, conflicts, err := pullHistory(u, resolve)
+			for _, conflict := range conflicts {
+				kept := "the server's"
+				if conflict.KeptLocal {
+					kept = "the local"
+				}
+				fmt.Printf("Result %s was changed both here and on the server; kept %s copy\n",
+					conflict.Local.ID, kept)
+			}
+			if err != nil {
+				printError(err)
+			}
+			fmt.Printf("Pulled %d results\n", pulled)
+			if c.Bool("pull") {
+				return
+			}
+			pushed, held, err := pushHistory(u, c.Bool("push-legacy"))
+			if pushed > 0 {
+				fmt.Printf("Pushed %d results\n", pushed)
+			}
+			if held > 0 {
+				fmt.Printf("%d are awaiting approval by a league moderator\n", held)
+			}
+			if err != nil {
+				printError(err)
+			}
+		},
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyncHistory(t *testing.T) {
+	at := time.Date(2014, 4, 24, 12, 0, 0, 0, time.UTC)
+	var queries []string
+	var posts []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == resultsPath:
+			queries = append(queries, r.URL.RawQuery)
+			w.Header().Set("Date", at.Format(http.TimeFormat))
+			w.Write([]byte(`[{"id":"1","player":"alex","opponent":"oleg","game":"ping pong",` +
+				`"score":"21-15","won":true,"date":"2014-04-20T12:00:00Z"},` +
+				`{"id":"9","player":"alex","opponent":"sam","game":"ping pong",` +
+				`"score":"21-19","won":true,"date":"2014-04-23T12:00:00Z"},` +
+				`{"player":"alex","opponent":"ivan","score":"21-3","won":true}]`))
+		case r.Method == "POST":
+			b, _ := ioutil.ReadAll(r.Body)
+			posts = append(posts, r.Header.Get(resultIDHeader)+" "+
+				r.Header.Get(announceHeader)+" "+string(b))
+			w.WriteHeader(http.StatusCreated)
+		default:
+			t.Errorf("Unexpected %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer ts.Close()
+	mockSettingsFile(t, ts.URL)
+	h := mockHistoryFile(t)
+	h.add(&matchResult{ID: "1", Player: "alex", Opponent: "oleg", Game: "ping pong",
+		Score: "21-15", Won: true, Identified: true, Date: at.AddDate(0, 0, -4)})
+	// Result 4 was posted before gobeat sent IDs, and 2 never reached the
+	// target.
+	h.add(&matchResult{ID: "4", Player: "alex", Opponent: "ivan", Game: "ping pong",
+		Score: "21-3", Won: true, Date: at.AddDate(0, 0, -3)})
+	h.add(&matchResult{ID: "2", Player: "alex", Opponent: "dana", Game: "ping pong",
+		Score: "21-8", Won: true, Unsynced: true, Date: at.AddDate(0, 0, -2)})
+	h.add(&matchResult{ID: "3", Player: "dana", Opponent: "sam", Game: "ping pong",
+		Score: "21-8", Won: true, Date: at.AddDate(0, 0, -1)})
+	if err := h.save(); err != nil {
+		t.Fatalf("Could not save history: %s", err)
+	}
+	u := mustParse(t, ts.URL)
+
+	added, _, err := pullHistory(u, newestWins)
+	if err != nil {
+		t.Fatalf("Expected a clean pull: %s", err)
+	}
+	if added != 1 {
+		t.Fatalf("Expected only the result from the other machine to be added, got %d", added)
+	}
+	h, err = retrieveHistory()
+	if err != nil {
+		t.Fatalf("Could not retrieve history: %s", err)
+	}
+	if r := h.find("9"); r == nil || !r.Identified || len(h.Results) != 5 {
+		t.Fatal("Expected the pulled result to be recorded as identified.")
+	}
+
+	pushed, held, err := pushHistory(u, false)
+	if err != nil || pushed != 1 || held != 0 {
+		t.Fatalf("Expected one result to be pushed, got %d (%v)", pushed, err)
+	}
+	want := "2 false 🏓 alex beat dana at ping pong with score 21-8"
+	if len(posts) != 1 || posts[0] != want {
+		t.Fatalf("Expected the unsent result to be recorded unannounced, got %q", posts)
+	}
+	if h, _ := retrieveHistory(); !h.find("2").Identified || h.find("2").Unsynced {
+		t.Fatal("Expected the pushed result to be marked identified.")
+	}
+	if _, _, err := pushHistory(u, false); err != nil || len(posts) != 1 {
+		t.Fatal("Expected nothing to be pushed twice.")
+	}
+	if pushed, _, err := pushHistory(u, true); err != nil || pushed != 1 ||
+		!strings.HasPrefix(posts[1], "4 false ") {
+		t.Fatalf("Expected the legacy result to be pushed when asked, got %q (%v)", posts, err)
+	}
+
+	if _, _, err := pullHistory(u, newestWins); err != nil {
+		t.Fatalf("Expected a clean pull: %s", err)
+	}
+	if len(queries) != 2 || queries[0] != "player=alex" ||
+		!strings.Contains(queries[1], "since=2014-04-24T12%3A00%3A00Z") {
+		t.Fatalf("Expected the second pull to start from the target's time, got %q", queries)
+	}
+}
+
+func TestSyncUnsupported(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	defer ts.Close()
+	mockSettingsFile(t, ts.URL)
+	mockHistoryFile(t)
+	if _, _, err := pullHistory(mustParse(t, ts.URL), newestWins); err == nil ||
+		!strings.Contains(err.Error(), "does not support") {
+		t.Fatalf("Expected sync to be unsupported, got %v", err)
+	}
+}
+
+func TestAutoSync(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			w.Write([]byte(`[{"id":"9","player":"alex","opponent":"sam","game":"ping pong",` +
+				`"score":"21-19","won":true,"date":"2014-04-23T12:00:00Z"}]`))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer ts.Close()
+	mockSettingsFile(t, ts.URL)
+	mockHistoryFile(t)
+	settings.AutoSync = true
+
+	r := &matchResult{ID: "1", Player: "alex", Opponent: "oleg", Game: "ping pong",
+		Score: "21-15", Won: true, Date: time.Now()}
+	if _, err := recordResult(r, nil); err != nil {
+		t.Fatalf("Expected the result to be recorded: %s", err)
+	}
+	h, err := retrieveHistory()
+	if err != nil {
+		t.Fatalf("Could not retrieve history: %s", err)
+	}
+	if len(h.Results) != 2 || h.find("9") == nil {
+		t.Fatal("Expected results from other machines to be pulled first.")
+	}
+}
+
+func TestSyncConflicts(t *testing.T) {
+	var puts []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			w.Write([]byte(`[{"id":"1","player":"alex","opponent":"oleg","game":"ping pong",` +
+				`"score":"21-19","won":true,"date":"2014-04-20T12:00:00Z",` +
+				`"updated_at":"2014-04-24T10:00:00Z"},` +
+				`{"id":"2","player":"alex","opponent":"dana","game":"ping pong",` +
+				`"score":"21-5","won":true,"date":"2014-04-21T12:00:00Z",` +
+				`"updated_at":"2014-04-24T10:00:00Z"},` +
+				`{"id":"3","deleted":true,"updated_at":"2014-04-24T10:00:00Z"},` +
+				`{"id":"4","player":"alex","opponent":"sam","game":"ping pong",` +
+				`"score":"21-8","won":true,"date":"2014-04-23T12:00:00Z"}]`))
+		case "PUT":
+			b, _ := ioutil.ReadAll(r.Body)
+			puts = append(puts, r.URL.Path+" "+string(b))
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("Unexpected %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer ts.Close()
+	mockSettingsFile(t, ts.URL)
+	h := mockHistoryFile(t)
+	day := func(d int) time.Time { return time.Date(2014, 4, d, 12, 0, 0, 0, time.UTC) }
+	edited := time.Date(2014, 4, 24, 11, 0, 0, 0, time.UTC)
+	h.add(&matchResult{ID: "1", Player: "alex", Opponent: "oleg", Game: "ping pong",
+		Score: "21-15", Won: true, Identified: true, Date: day(20)})
+	h.add(&matchResult{ID: "2", Player: "alex", Opponent: "dana", Game: "ping pong",
+		Score: "21-8", Won: true, Identified: true, Date: day(21), Updated: &edited,
+		Message: "alex beat dana 21-8"})
+	h.add(&matchResult{ID: "3", Player: "alex", Opponent: "ivan", Game: "ping pong",
+		Score: "21-3", Won: true, Identified: true, Date: day(22)})
+	h.add(&matchResult{ID: "4", Player: "alex", Opponent: "sam", Game: "ping pong",
+		Score: "21-8", Won: true, Identified: true, Date: day(23)})
+	if err := h.save(); err != nil {
+		t.Fatalf("Could not save history: %s", err)
+	}
+
+	added, conflicts, err := pullHistory(mustParse(t, ts.URL), newestWins)
+	if err != nil || added != 0 {
+		t.Fatalf("Expected a clean pull adding nothing, got %d (%v)", added, err)
+	}
+	if len(conflicts) != 3 || conflicts[0].KeptLocal || !conflicts[1].KeptLocal ||
+		conflicts[2].KeptLocal {
+		t.Fatalf("Expected the newest copy of 3 conflicting results to be kept, got %+v", conflicts)
+	}
+	h, err = retrieveHistory()
+	if err != nil {
+		t.Fatalf("Could not retrieve history: %s", err)
+	}
+	if len(h.Results) != 3 || h.find("3") != nil {
+		t.Fatal("Expected the result deleted on the server to be deleted here.")
+	}
+	if h.find("1").Score != "21-19" || h.find("2").Score != "21-8" {
+		t.Fatal("Expected the server's newer edit to win and the local one to stay.")
+	}
+	if len(puts) != 1 || puts[0] != resultsPath+"/2 alex beat dana 21-8" {
+		t.Fatalf("Expected the kept local copy to be sent to the server, got %q", puts)
+	}
+}
+
+func TestConflictResolver(t *testing.T) {
+	local := &matchResult{ID: "1", Player: "alex", Opponent: "oleg", Score: "21-15", Won: true}
+	remote := &syncedResult{matchResult: *local}
+	remote.Score = "21-19"
+
+	var out bytes.Buffer
+	resolve, err := newConflictResolver(conflictAsk, strings.NewReader("y\n"), &out)
+	if err != nil {
+		t.Fatalf("Expected ask to be a policy: %s", err)
+	}
+	if keep, err := resolve(local, remote); err != nil || keep {
+		t.Fatalf("Expected the server's copy to be chosen, got %v (%v)", keep, err)
+	}
+	if !strings.Contains(out.String(), "21-15") || !strings.Contains(out.String(), "21-19") {
+		t.Fatalf("Expected both copies to be shown, got %q", out.String())
+	}
+
+	resolve, _ = newConflictResolver(conflictServer, nil, nil)
+	if keep, _ := resolve(local, remote); keep {
+		t.Fatal("Expected the server's copy to win.")
+	}
+	if _, err := newConflictResolver("mine", nil, nil); err == nil {
+		t.Fatal("Expected an unknown policy to be rejected.")
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codegangsta/cli"
+)
+
+// telegramAPIURL is the base of the Telegram Bot API.
+var telegramAPIURL = "https://api.telegram.org"
+
+// telegramPollTimeout is how long each getUpdates long poll waits for
+// messages.
+const telegramPollTimeout = 30 * time.Second
+
+// credentialTelegram names the Telegram bot token in the credential store.
+const credentialTelegram = "telegram"
+
+const telegramFile = ".gobeat_telegram"
+
+// telegramPath is the full path to where the Telegram bot keeps the offset of
+// the next update to read.
+var telegramPath = filepath.Join(os.Getenv("HOME"), telegramFile)
+
+// telegramState is how far the Telegram bot has read its updates.
+type telegramState struct {
+	// Offset is the ID of the next update to read. Telegram only forgets
+	// earlier updates once they are polled for past, so without it a
+	// restarted bot would answer the last commands again.
+	Offset int `json:"offset"`
+}
+
+// retrieveTelegramOffset loads the offset of the next update to read, 0 if
+// the bot has never read any.
+func retrieveTelegramOffset() (int, error) {
+	s := new(telegramState)
+	b, err := ioutil.ReadFile(telegramPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	if err := json.Unmarshal(b, s); err != nil {
+		return 0, err
+	}
+	return s.Offset, nil
+}
+
+// saveTelegramOffset saves to disk the offset in '~/.gobeat_telegram'.
+func saveTelegramOffset(offset int) error {
+	b, err := json.Marshal(&telegramState{Offset: offset})
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(telegramPath, b, 0644)
+}
+
+// telegramSettings configures the Telegram bot and announcements.
+type telegramSettings struct {
+	// Token is the bot token from BotFather. It is kept in the credential
+	// store, not with the settings.
+	Token string `json:"-"`
+
+	// ChatID is the group chat the bot announces in and accepts commands
+	// from.
+	ChatID string `json:"chat_id"`
+}
+
+// telegramUpdate is the part of a Telegram update the bot uses.
+type telegramUpdate struct {
+	UpdateID int `json:"update_id"`
+	Message  *struct {
+		Text string `json:"text"`
+		Chat struct {
+			ID int64 `json:"id"`
+		} `json:"chat"`
+		From struct {
+			Username string `json:"username"`
+		} `json:"from"`
+	} `json:"message"`
+}
+
+// telegramCall calls a Bot API method with a JSON body, decoding the result
+// into v if it is non-nil.
+func telegramCall(cfg *telegramSettings, method string, body, v interface{}) error {
+	j, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	u := telegramAPIURL + "/bot" + url.PathEscape(cfg.Token) + "/" + method
+	client := http.Client{Timeout: telegramPollTimeout + 10*time.Second}
+	resp, err := client.Post(u, "application/json", bytes.NewReader(j))
+	if err != nil {
+		// The URL holds the token, so report only what went wrong.
+		if uerr, ok := err.(*url.Error); ok {
+			err = uerr.Err
+		}
+		return fmt.Errorf("on telegram %s: %s", method, err)
+	}
+	defer resp.Body.Close()
+
+	var out struct {
+		OK          bool            `json:"ok"`
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return fmt.Errorf("on telegram %s: got code %d", method, resp.StatusCode)
+	}
+	if !out.OK {
+		return fmt.Errorf("on telegram %s: %s", method, out.Description)
+	}
+	if v != nil {
+		return json.Unmarshal(out.Result, v)
+	}
+	return nil
+}
+
+// announceTelegram sends msg to the configured chat.
+func announceTelegram(cfg *telegramSettings, msg string) error {
+	return telegramCall(cfg, "sendMessage", map[string]string{
+		"chat_id": cfg.ChatID,
+		"text":    msg,
+	}, nil)
+}
+
+// pollTelegram fetches updates after offset, answers any commands sent in the
+// configured chat and returns the offset to poll from next. The offset is
+// saved before each command is answered, so none is answered twice.
+func pollTelegram(cfg *telegramSettings, offset int) (int, error) {
+	var updates []telegramUpdate
+	err := telegramCall(cfg, "getUpdates", map[string]interface{}{
+		"offset":          offset,
+		"timeout":         int(telegramPollTimeout / time.Second),
+		"allowed_updates": []string{"message"},
+	}, &updates)
+	if err != nil {
+		return offset, err
+	}
+
+	for _, u := range updates {
+		offset = u.UpdateID + 1
+		if err := saveTelegramOffset(offset); err != nil {
+			return offset, err
+		}
+		m := u.Message
+		if m == nil || strconv.FormatInt(m.Chat.ID, 10) != cfg.ChatID {
+			continue
+		}
+
+		// Commands in groups may be addressed as /result@gobeat_bot.
+		text := m.Text
+		if fields := strings.Fields(text); len(fields) > 0 {
+			if i := strings.Index(fields[0], "@"); i >= 0 {
+				text = fields[0][:i] + strings.TrimPrefix(text, fields[0])
+			}
+		}
+
+		reply, ok := handleBotCommand(botPlayer(m.From.Username), text, "/")
+		if !ok {
+			continue
+		}
+		// Recorded results are already announced to this chat.
+		if strings.HasPrefix(text, "/result ") && !strings.HasPrefix(reply, "Error") {
+			continue
+		}
+		if err := announceTelegram(cfg, reply); err != nil {
+			return offset, err
+		}
+	}
+	return offset, nil
+}
+
+// telegramCommand returns the 'gobeat telegram' command.
+func telegramCommand() cli.Command {
+	return cli.Command{
+		Name: "telegram",
+		Description: "`telegram` configures announcing results to a Telegram group, " +
+			"which 'gobeat bot telegram' also accepts commands from.",
+		Usage: "telegram [--token token] [--chat id]",
+		Flags: []cli.Flag{
+			cli.StringFlag{Name: "token", Usage: "bot token from BotFather"},
+			cli.StringFlag{Name: "chat", Usage: "ID of the group chat"},
+			cli.BoolFlag{Name: "off", Usage: "stop announcing to Telegram"},
+		},
+		Action: func(c *cli.Context) {
+			if c.Bool("off") {
+				settings.Telegram = nil
+				if err := storeCredential(credentialTelegram, ""); err != nil {
+					printError(err)
+				}
+				fmt.Println("Stopped announcing to Telegram")
+			} else if c.String("token") == "" && c.String("chat") == "" {
+				if settings.Telegram == nil {
+					fmt.Println("Not announcing to Telegram")
+				} else {
+					fmt.Printf("Announcing to Telegram chat %s\n", settings.Telegram.ChatID)
+				}
+				return
+			} else {
+				if settings.Telegram == nil {
+					settings.Telegram = new(telegramSettings)
+				}
+				if c.String("token") != "" {
+					if err := storeCredential(credentialTelegram, c.String("token")); err != nil {
+						printError(err)
+					}
+					settings.Telegram.Token = c.String("token")
+				}
+				if c.String("chat") != "" {
+					settings.Telegram.ChatID = c.String("chat")
+				}
+				fmt.Printf("Announcing to Telegram chat %s\n", settings.Telegram.ChatID)
+			}
+
+			if err := settings.save(); err != nil {
+				printError(err)
+			}
+		},
+	}
+}
+
+// telegramBotCommand returns the 'gobeat bot telegram' command.
+func telegramBotCommand() cli.Command {
+	return cli.Command{
+		Name: "telegram",
+		Description: "`bot telegram` accepts /result and /leaderboard from the " +
+			"configured Telegram group.",
+		Usage: "bot telegram [--grace duration]",
+		Flags: []cli.Flag{graceFlag()},
+		Action: func(c *cli.Context) {
+			cfg := settings.Telegram
+			if cfg == nil || cfg.Token == "" || cfg.ChatID == "" {
+				printError(fmt.Errorf("telegram is not configured; see 'gobeat telegram'."))
+			}
+
+			logger.Info("Starting Telegram bot...", "chat", cfg.ChatID)
+			err := runUntilShutdown(shutdownSignals(), graceDuration(c),
+				func(stop <-chan struct{}) error {
+					offset, err := retrieveTelegramOffset()
+					if err != nil {
+						return err
+					}
+					for {
+						select {
+						case <-stop:
+							return nil
+						default:
+						}
+						next, err := pollTelegram(cfg, offset)
+						if err != nil {
+							logger.Error("telegram poll failed", "err", err)
+							time.Sleep(5 * time.Second)
+						}
+						offset = next
+					}
+				})
+			if err != nil {
+				printError(err)
+			}
+		},
+	}
+}
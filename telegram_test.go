@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPollTelegram(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	h := mockHistoryFile(t)
+	h.add(&matchResult{Player: "alex", Opponent: "oleg", Game: "ping pong", Won: true})
+	if err := h.save(); err != nil {
+		t.Fatalf("Could not save history: %s", err)
+	}
+
+	var sent []map[string]string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/botsecret/getUpdates":
+			w.Write([]byte(`{"ok": true, "result": [
+				{"update_id": 7, "message": {"text": "/leaderboard@gobeat_bot",
+					"chat": {"id": -100}, "from": {"username": "oleg"}}},
+				{"update_id": 8, "message": {"text": "/leaderboard",
+					"chat": {"id": 42}, "from": {"username": "oleg"}}}
+			]}`))
+		case "/botsecret/sendMessage":
+			var body map[string]string
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Fatalf("Expected a JSON message: %s", err)
+			}
+			sent = append(sent, body)
+			w.Write([]byte(`{"ok": true, "result": {}}`))
+		default:
+			t.Fatalf("Unexpected request to %s", r.URL.Path)
+		}
+	}
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+	telegramAPIURL = ts.URL
+
+	cfg := &telegramSettings{Token: "secret", ChatID: "-100"}
+	offset, err := pollTelegram(cfg, 0)
+	if err != nil {
+		t.Fatalf("Expected a clean poll: %s", err)
+	}
+	if offset != 9 {
+		t.Fatalf("Expected to poll from after the last update, got %d", offset)
+	}
+	if saved, err := retrieveTelegramOffset(); err != nil || saved != 9 {
+		t.Fatalf("Expected the offset to be saved for a restart, got %d (%v)", saved, err)
+	}
+	if len(sent) != 1 || sent[0]["chat_id"] != "-100" ||
+		!strings.HasPrefix(sent[0]["text"], "ping pong leaderboard:") {
+		t.Fatalf("Expected one leaderboard reply in the group, got %v", sent)
+	}
+}
+
+func TestTelegramErrorHidesToken(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	telegramAPIURL = ts.URL
+	ts.Close()
+
+	err := announceTelegram(&telegramSettings{Token: "s3cret", ChatID: "-100"}, "hi")
+	if err == nil {
+		t.Fatal("Expected the announcement to fail.")
+	}
+	if strings.Contains(err.Error(), "s3cret") {
+		t.Fatalf("Expected the token to be kept out of errors, got %q", err)
+	}
+}
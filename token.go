@@ -0,0 +1,387 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codegangsta/cli"
+)
+
+// tokensPath is where the server manages API tokens, relative to the target.
+const tokensPath = "/tokens"
+
+// tokenRotatePath is where the target exchanges the token a request was
+// made with for a new one, relative to the target.
+const tokenRotatePath = tokensPath + "/rotate"
+
+// rotateHeader is set on a response when the target wants the token the
+// request was made with rotated. A request rejected with 401 Unauthorized is
+// retried with the new token; any other response stands.
+const rotateHeader = "X-Gobeat-Rotate-Token"
+
+// credentialToken names the API token sent to the target in the credential
+// store.
+const credentialToken = "token"
+
+// Token scopes, from least to most privileged.
+const (
+	// tokenScopeRead can only read results and standings, as a wall display
+	// needs.
+	tokenScopeRead = "read"
+
+	// tokenScopePost can also post results, as a bot needs.
+	tokenScopePost = "post"
+
+	// tokenScopeAdmin can do anything the user who created it can.
+	tokenScopeAdmin = "admin"
+)
+
+// tokenScopes are the scopes a token can be created with.
+var tokenScopes = []string{tokenScopeRead, tokenScopePost, tokenScopeAdmin}
+
+// apiToken is a token as the server describes it.
+type apiToken struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Scope   string    `json:"scope"`
+	Created time.Time `json:"created_at"`
+
+	// Expires is the zero time for a token that never expires.
+	Expires time.Time `json:"expires_at,omitempty"`
+
+	// Token is the secret itself. The server only returns it once, when the
+	// token is created.
+	Token string `json:"token,omitempty"`
+}
+
+// tokenRequest asks the target to create a token.
+type tokenRequest struct {
+	Name    string     `json:"name"`
+	Scope   string     `json:"scope"`
+	Expires *time.Time `json:"expires_at,omitempty"`
+}
+
+// parseExpiry parses when a token should expire, either a duration from now,
+// like 720h, or a date like 2025-01-01. An empty s never expires.
+func parseExpiry(s string, now time.Time) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil && d > 0 {
+		t := now.Add(d)
+		return &t, nil
+	}
+	t, err := time.ParseInLocation(filterDateFormat, s, time.Local)
+	if err != nil || !t.After(now) {
+		return nil, fmt.Errorf("--expires must be a duration like 720h or a future date like 2025-01-01.")
+	}
+	return &t, nil
+}
+
+// tokenStatus turns an unsuccessful response to a token request into an
+// error.
+func tokenStatus(op string, code int) error {
+	switch code {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("the server won't let you manage tokens; an admin token or login is needed.")
+	case http.StatusNotFound:
+		return fmt.Errorf("no such token; see 'gobeat token list'.")
+	}
+	return fmt.Errorf("on token %s: got code %d", op, code)
+}
+
+// createToken asks the target for a new token.
+func createToken(u *url.URL, tr *tokenRequest) (*apiToken, error) {
+	body, err := json.Marshal(tr)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := doTargetRequest(u, func() (*http.Client, *http.Request, error) {
+		client, req, err := newTargetRequest(u, "POST", tokensPath, nil, body)
+		if err == nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		return client, req, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return nil, tokenStatus("create", resp.StatusCode)
+	}
+
+	t := new(apiToken)
+	if err := json.NewDecoder(resp.Body).Decode(t); err != nil {
+		return nil, fmt.Errorf("invalid token: %s", err)
+	}
+	if t.Token == "" {
+		return nil, fmt.Errorf("the server did not return the new token.")
+	}
+	return t, nil
+}
+
+// listTokens returns the user's tokens from the target, without their
+// secrets.
+func listTokens(u *url.URL) ([]*apiToken, error) {
+	resp, err := sendTargetRequest(u, "GET", tokensPath, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, tokenStatus("list", resp.StatusCode)
+	}
+
+	var out []*apiToken
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("invalid tokens: %s", err)
+	}
+	return out, nil
+}
+
+// revokeToken asks the target to revoke the token with id.
+func revokeToken(u *url.URL, id string) error {
+	resp, err := sendTargetRequest(u, "DELETE", tokensPath+"/"+url.PathEscape(id), nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusAccepted, http.StatusNoContent:
+		return nil
+	}
+	return tokenStatus("revoke", resp.StatusCode)
+}
+
+// rotateMu serializes token rotations, so that requests made concurrently,
+// as by 'gobeat flush --workers', don't each rotate the token and leave a
+// revoked one stored.
+var rotateMu sync.Mutex
+
+// rotateToken exchanges the stored token for a new one from the target u and
+// stores it in its place, unless the stored token is no longer sent, which
+// was rotated in the meantime.
+func rotateToken(u *url.URL, sent string) error {
+	rotateMu.Lock()
+	defer rotateMu.Unlock()
+	if token, err := credential(credentialToken); err != nil || token != sent {
+		return err
+	}
+
+	client, req, err := newTargetRequest(u, "POST", tokenRotatePath, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return tokenStatus("rotate", resp.StatusCode)
+	}
+
+	t := new(apiToken)
+	if err := json.NewDecoder(resp.Body).Decode(t); err != nil {
+		return fmt.Errorf("invalid token: %s", err)
+	}
+	if t.Token == "" {
+		return fmt.Errorf("the server did not return the new token.")
+	}
+	logger.Info("rotated API token at the server's request")
+	return storeCredential(credentialToken, t.Token)
+}
+
+// doTargetRequest sends the request build returns to the target u. If the
+// target asks for the token the request was made with to be rotated, it is
+// rotated and, if the request was refused for it, the request is built
+// afresh with the new token and sent again.
+func doTargetRequest(u *url.URL,
+	build func() (*http.Client, *http.Request, error)) (*http.Response, error) {
+
+	client, req, err := build()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil || resp.Header.Get(rotateHeader) == "" {
+		return resp, err
+	}
+	auth := req.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		// Not authenticating with a token, so there is none to rotate.
+		return resp, nil
+	}
+	sent := strings.TrimPrefix(auth, "Bearer ")
+
+	if resp.StatusCode != http.StatusUnauthorized {
+		// The request went through; the token can be rotated after the fact.
+		if err := rotateToken(u, sent); err != nil {
+			logger.Warn("could not rotate API token", "err", err)
+		}
+		return resp, nil
+	}
+	resp.Body.Close()
+	if err := rotateToken(u, sent); err != nil {
+		return nil, fmt.Errorf("could not rotate API token: %s", err)
+	}
+	if client, req, err = build(); err != nil {
+		return nil, err
+	}
+	return client.Do(req)
+}
+
+// sendTargetRequest sends the request newTargetRequest builds from its
+// arguments, rotating the token if the target asks to.
+func sendTargetRequest(u *url.URL, method, p string, query url.Values,
+	body []byte) (*http.Response, error) {
+
+	return doTargetRequest(u, func() (*http.Client, *http.Request, error) {
+		return newTargetRequest(u, method, p, query, body)
+	})
+}
+
+// formatToken formats a token for the token listing.
+func formatToken(t *apiToken) string {
+	expires := "never expires"
+	if !t.Expires.IsZero() {
+		expires = "expires " + t.Expires.Format("2006-01-02 15:04")
+	}
+	return fmt.Sprintf("%s  %s  %s  created %s, %s", t.ID, t.Name, t.Scope,
+		t.Created.Format("2006-01-02"), expires)
+}
+
+// tokenCommand returns the 'gobeat token' command and its subcommands.
+func tokenCommand() cli.Command {
+	target := func() *url.URL {
+		u, err := settings.URL()
+		if err != nil {
+			printError(err)
+		}
+		return u
+	}
+
+	return cli.Command{
+		Name: "token",
+		Description: "`token` manages scoped API tokens on the server, so bots and " +
+			"wall displays can be given only the access they need.",
+		Usage: "token [create|list|revoke|use]",
+		Subcommands: []cli.Command{
+			cli.Command{
+				Name: "create",
+				Description: "`token create` creates a token and prints it. It is only " +
+					"shown once.",
+				Usage: "token create --scope read|post|admin [--expires 720h|2025-01-01] name",
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "scope",
+						Usage: "what the token may do: " + strings.Join(tokenScopes, ", "),
+					},
+					cli.StringFlag{
+						Name:  "expires",
+						Usage: "when the token expires, as a duration like 720h or a date",
+					},
+				},
+				Action: func(c *cli.Context) {
+					if len(c.Args()) == 0 {
+						printError(fmt.Errorf("missing token name, e.g. 'lobby display'."))
+					}
+					scope := strings.ToLower(c.String("scope"))
+					valid := false
+					for _, s := range tokenScopes {
+						valid = valid || s == scope
+					}
+					if !valid {
+						printError(fmt.Errorf("--scope must be one of %s.", strings.Join(tokenScopes, ", ")))
+					}
+					expires, err := parseExpiry(c.String("expires"), time.Now())
+					if err != nil {
+						printError(err)
+					}
+
+					t, err := createToken(target(), &tokenRequest{
+						Name:    strings.Join(c.Args(), " "),
+						Scope:   scope,
+						Expires: expires,
+					})
+					if err != nil {
+						printError(err)
+					}
+					fmt.Println(formatToken(t))
+					fmt.Println(t.Token)
+					fmt.Println("Keep the token safe; it won't be shown again.")
+				},
+			},
+			cli.Command{
+				Name:        "list",
+				Description: "`token list` lists your tokens.",
+				Usage:       "token list",
+				Action: func(c *cli.Context) {
+					tokens, err := listTokens(target())
+					if err != nil {
+						printError(err)
+					}
+					if len(tokens) == 0 {
+						fmt.Println("No tokens.")
+						return
+					}
+					for _, t := range tokens {
+						fmt.Println(formatToken(t))
+					}
+				},
+			},
+			cli.Command{
+				Name:        "revoke",
+				Description: "`token revoke` revokes tokens by ID, so they stop working at once.",
+				Usage:       "token revoke id...",
+				Action: func(c *cli.Context) {
+					if len(c.Args()) == 0 {
+						printError(fmt.Errorf("missing token ID; see 'gobeat token list'."))
+					}
+					u := target()
+					for _, id := range c.Args() {
+						if err := revokeToken(u, id); err != nil {
+							printError(err)
+						}
+						fmt.Printf("Revoked %s\n", id)
+					}
+				},
+			},
+			cli.Command{
+				Name: "use",
+				Description: "`token use` authenticates this installation to the target " +
+					"with a token, kept in the credential store.",
+				Usage: "token use token | token use --clear",
+				Flags: []cli.Flag{
+					cli.BoolFlag{
+						Name:  "clear",
+						Usage: "stop sending a token",
+					},
+				},
+				Action: func(c *cli.Context) {
+					if !c.Bool("clear") && len(c.Args()) == 0 {
+						printError(fmt.Errorf("missing token."))
+					}
+					secret := c.Args().First()
+					if c.Bool("clear") {
+						secret = ""
+					}
+					if err := storeCredential(credentialToken, secret); err != nil {
+						printError(err)
+					}
+					if c.Bool("clear") {
+						fmt.Println("No longer sending a token to the target")
+					} else {
+						fmt.Println("Sending the token to the target")
+					}
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseExpiry(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.Local)
+	if e, err := parseExpiry("", now); err != nil || e != nil {
+		t.Fatalf("Expected no expiry, got %v (%v)", e, err)
+	}
+	if e, err := parseExpiry("48h", now); err != nil || !e.Equal(now.Add(48*time.Hour)) {
+		t.Fatalf("Expected an expiry in 48 hours, got %v (%v)", e, err)
+	}
+	if e, err := parseExpiry("2025-01-01", now); err != nil || e.Year() != 2025 {
+		t.Fatalf("Expected an expiry on 2025-01-01, got %v (%v)", e, err)
+	}
+	for _, s := range []string{"2020-01-01", "-1h", "soon"} {
+		if _, err := parseExpiry(s, now); err == nil {
+			t.Fatalf("Expected %q to be an invalid expiry", s)
+		}
+	}
+}
+
+func TestTokens(t *testing.T) {
+	var created *tokenRequest
+	var revoked string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "POST" && r.URL.Path == tokensPath:
+			created = new(tokenRequest)
+			if err := json.NewDecoder(r.Body).Decode(created); err != nil {
+				t.Fatalf("Expected a token request: %s", err)
+			}
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(&apiToken{ID: "t1", Name: created.Name,
+				Scope: created.Scope, Token: "s3cret"})
+		case r.Method == "GET" && r.URL.Path == tokensPath:
+			json.NewEncoder(w).Encode([]*apiToken{{ID: "t1", Name: "lobby", Scope: "read"}})
+		case r.Method == "DELETE":
+			revoked = r.URL.Path
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Fatalf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer ts.Close()
+	mockSettingsFile(t, ts.URL)
+	u := mustParse(t, ts.URL)
+
+	tok, err := createToken(u, &tokenRequest{Name: "lobby", Scope: tokenScopeRead})
+	if err != nil {
+		t.Fatalf("Expected a token to be created: %s", err)
+	}
+	if tok.Token != "s3cret" || created.Scope != tokenScopeRead || created.Expires != nil {
+		t.Fatalf("Expected a read-only token without expiry, got %+v", created)
+	}
+
+	tokens, err := listTokens(u)
+	if err != nil || len(tokens) != 1 || tokens[0].ID != "t1" {
+		t.Fatalf("Expected the token to be listed, got %v (%v)", tokens, err)
+	}
+
+	if err := revokeToken(u, "t1"); err != nil || revoked != tokensPath+"/t1" {
+		t.Fatalf("Expected the token to be revoked, got %q (%v)", revoked, err)
+	}
+}
+
+func TestTokenAuthorization(t *testing.T) {
+	mockSettingsFile(t, "")
+	if err := storeCredential(credentialToken, "s3cret"); err != nil {
+		t.Fatalf("Could not store token: %s", err)
+	}
+	h, err := targetHeader()
+	if err != nil {
+		t.Fatalf("Expected the target headers: %s", err)
+	}
+	if h.Get("Authorization") != "Bearer s3cret" {
+		t.Fatalf("Expected the token to be sent, got %q", h.Get("Authorization"))
+	}
+
+	// Basic auth takes precedence.
+	if err := settings.setBasicAuth("alex:hunter2"); err != nil {
+		t.Fatalf("Could not set basic auth: %s", err)
+	}
+	if h, _ = targetHeader(); h.Get("Authorization") == "Bearer s3cret" {
+		t.Fatal("Expected basic auth to be sent instead of the token.")
+	}
+}
+
+func TestTokenRotation(t *testing.T) {
+	var rotations int
+	var posted []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		switch {
+		case r.URL.Path == tokenRotatePath:
+			if auth != "Bearer old" {
+				t.Fatalf("Expected the old token to be rotated, got %q", auth)
+			}
+			rotations++
+			json.NewEncoder(w).Encode(&apiToken{ID: "t1", Token: "new"})
+		case auth == "Bearer old":
+			w.Header().Set(rotateHeader, "true")
+			w.WriteHeader(http.StatusUnauthorized)
+		default:
+			posted = append(posted, auth)
+		}
+	}))
+	defer ts.Close()
+	mockSettingsFile(t, ts.URL)
+	if err := storeCredential(credentialToken, "old"); err != nil {
+		t.Fatalf("Could not store token: %s", err)
+	}
+
+	if err := postResult(mustParse(t, ts.URL), "", "I won!", true); err != nil {
+		t.Fatalf("Expected the post to be retried with the new token: %s", err)
+	}
+	if rotations != 1 || len(posted) != 1 || posted[0] != "Bearer new" {
+		t.Fatalf("Expected one rotation and one post with the new token, got %d and %v",
+			rotations, posted)
+	}
+	if token, err := credential(credentialToken); err != nil || token != "new" {
+		t.Fatalf("Expected the new token to be stored, got %q (%v)", token, err)
+	}
+
+	// Without a token in use there is nothing to rotate.
+	if err := storeCredential(credentialToken, ""); err != nil {
+		t.Fatalf("Could not clear token: %s", err)
+	}
+	if err := postResult(mustParse(t, ts.URL), "", "I won again!", true); err != nil {
+		t.Fatalf("Expected the post to go through: %s", err)
+	}
+	if rotations != 1 || len(posted) != 2 {
+		t.Fatalf("Expected no rotation without a token, got %d", rotations)
+	}
+}
+
+func TestConcurrentTokenRotation(t *testing.T) {
+	var mu sync.Mutex
+	var rotations, posts int
+	current := "old"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		auth := r.Header.Get("Authorization")
+		switch {
+		case auth == "Bearer "+current && r.URL.Path == tokenRotatePath:
+			rotations++
+			current = fmt.Sprintf("new%d", rotations)
+			json.NewEncoder(w).Encode(&apiToken{ID: "t1", Token: current})
+		case auth == "Bearer "+current && current != "old":
+			posts++
+		default:
+			// The old token wants rotating, and a rotated one is revoked.
+			w.Header().Set(rotateHeader, "true")
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer ts.Close()
+	mockSettingsFile(t, ts.URL)
+	if err := storeCredential(credentialToken, "old"); err != nil {
+		t.Fatalf("Could not store token: %s", err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 5)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = postResult(mustParse(t, ts.URL), "", "I won!", true)
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("Expected every post to go through with the new token: %s", err)
+		}
+	}
+	if rotations != 1 || posts != len(errs) {
+		t.Fatalf("Expected a single rotation and %d posts, got %d and %d", len(errs),
+			rotations, posts)
+	}
+	if token, _ := credential(credentialToken); token != "new1" {
+		t.Fatalf("Expected the rotated token to be stored, got %q", token)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	// trueskillMu is the skill estimate of a new player.
+	trueskillMu = 25.0
+
+	// trueskillSigma is the uncertainty of a new player's skill estimate.
+	trueskillSigma = trueskillMu / 3
+
+	// trueskillBeta is the performance variability within a single match.
+	trueskillBeta = trueskillSigma / 2
+
+	// trueskillTau is the uncertainty added before every match (and every idle
+	// week) so skill estimates keep adapting.
+	trueskillTau = trueskillSigma / 100
+)
+
+// trueskillRating is a player's skill estimate as a Gaussian.
+type trueskillRating struct {
+	mu    float64
+	sigma float64
+}
+
+// conservative returns the skill the player very likely has at least.
+func (r *trueskillRating) conservative() float64 {
+	return r.mu - 3*r.sigma
+}
+
+// trueskillSystem is a team-aware, TrueSkill-style rating system for doubles.
+// Individual skill estimates are updated from team results, with the change
+// shared out according to how uncertain each player's estimate is.
+type trueskillSystem struct {
+	players map[string]*trueskillRating
+}
+
+// newTrueskillSystem returns a TrueSkill rating system with no players.
+func newTrueskillSystem() *trueskillSystem {
+	return &trueskillSystem{players: make(map[string]*trueskillRating)}
+}
+
+// player returns name's skill estimate, creating it if necessary.
+func (t *trueskillSystem) player(name string) *trueskillRating {
+	r, ok := t.players[name]
+	if !ok {
+		r = &trueskillRating{mu: trueskillMu, sigma: trueskillSigma}
+		t.players[name] = r
+	}
+	return r
+}
+
+func (t *trueskillSystem) get(name string) float64 {
+	if r, ok := t.players[name]; ok {
+		return r.conservative()
+	}
+	return trueskillMu - 3*trueskillSigma
+}
+
+func (t *trueskillSystem) apply(m *matchResult) {
+	winners, losers := m.team(), m.opponentTeam()
+	if !m.Won {
+		winners, losers = losers, winners
+	}
+	t.applyTeams(winners, losers)
+}
+
+// applyTeams updates every player's skill estimate after winners beat losers.
+func (t *trueskillSystem) applyTeams(winners, losers []string) {
+	var w, l []*trueskillRating
+	for _, name := range winners {
+		w = append(w, t.player(name))
+	}
+	for _, name := range losers {
+		l = append(l, t.player(name))
+	}
+
+	var muW, muL, c2 float64
+	for _, r := range append(append([]*trueskillRating{}, w...), l...) {
+		r.sigma = math.Sqrt(r.sigma*r.sigma + trueskillTau*trueskillTau)
+		c2 += r.sigma*r.sigma + trueskillBeta*trueskillBeta
+	}
+	for _, r := range w {
+		muW += r.mu
+	}
+	for _, r := range l {
+		muL += r.mu
+	}
+
+	c := math.Sqrt(c2)
+	x := (muW - muL) / c
+	v := normPDF(x) / normCDF(x)
+	wf := v * (v + x)
+
+	update := func(r *trueskillRating, sign float64) {
+		s2 := r.sigma * r.sigma
+		r.mu += sign * s2 / c * v
+		r.sigma = math.Sqrt(s2 * math.Max(1-s2/c2*wf, 0.0001))
+	}
+	for _, r := range w {
+		update(r, 1)
+	}
+	for _, r := range l {
+		update(r, -1)
+	}
+}
+
+func (t *trueskillSystem) idle(name string, d time.Duration, decay *ratingDecay) {
+	r := t.player(name)
+	for i := 0; i < int(d/week) && r.sigma < trueskillSigma; i++ {
+		r.sigma = math.Min(math.Sqrt(r.sigma*r.sigma+trueskillTau*trueskillTau),
+			trueskillSigma)
+	}
+	r.mu = trueskillMu + (r.mu-trueskillMu)*decay.factor(d)
+}
+
+func (t *trueskillSystem) describe(name string) string {
+	r := t.player(name)
+	return fmt.Sprintf("%.1f (skill %.1f ± %.1f)", r.conservative(), r.mu,
+		r.sigma)
+}
+
+// seed keeps name's conservative rating, with the uncertainty of a new
+// player.
+func (t *trueskillSystem) seed(name string, rating float64) {
+	r := t.player(name)
+	r.mu = rating + 3*r.sigma
+}
+
+func (t *trueskillSystem) states() map[string]*ratingState {
+	out := make(map[string]*ratingState, len(t.players))
+	for name, r := range t.players {
+		out[name] = &ratingState{Mu: r.mu, Sigma: r.sigma}
+	}
+	return out
+}
+
+func (t *trueskillSystem) restore(name string, s *ratingState) {
+	*t.player(name) = trueskillRating{mu: s.Mu, sigma: s.Sigma}
+}
+
+func (t *trueskillSystem) ratings() ratings {
+	out := make(ratings, len(t.players))
+	for name, r := range t.players {
+		out[name] = r.conservative()
+	}
+	return out
+}
+
+// normPDF is the standard normal probability density function.
+func normPDF(x float64) float64 {
+	return math.Exp(-x*x/2) / math.Sqrt(2*math.Pi)
+}
+
+// normCDF is the standard normal cumulative distribution function.
+func normCDF(x float64) float64 {
+	return math.Erfc(-x/math.Sqrt2) / 2
+}
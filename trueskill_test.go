@@ -0,0 +1,51 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTrueskillDoubles(t *testing.T) {
+	ts := newTrueskillSystem()
+	ts.apply(&matchResult{Player: "alex", Partner: "bob", Opponent: "oleg",
+		OpponentPartner: "ivan", Won: true})
+
+	for _, name := range []string{"alex", "bob"} {
+		if r := ts.player(name); r.mu <= trueskillMu || r.sigma >= trueskillSigma {
+			t.Fatalf("Expected %s's skill to rise and firm up, got %+v", name, r)
+		}
+	}
+	for _, name := range []string{"oleg", "ivan"} {
+		if r := ts.player(name); r.mu >= trueskillMu {
+			t.Fatalf("Expected %s's skill to fall, got %+v", name, r)
+		}
+	}
+	if math.Abs(ts.player("alex").mu-ts.player("bob").mu) > 1e-9 {
+		t.Fatal("Expected equally uncertain partners to move equally.")
+	}
+}
+
+func TestTrueskillUncertainPartnerMovesMore(t *testing.T) {
+	ts := newTrueskillSystem()
+	ts.player("alex").sigma = 2
+	ts.applyTeams([]string{"alex", "bob"}, []string{"oleg", "ivan"})
+
+	if ts.player("bob").mu-trueskillMu <= ts.player("alex").mu-trueskillMu {
+		t.Fatal("Expected the less certain partner to gain more skill.")
+	}
+}
+
+func TestDoublesReplay(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	h := mockHistoryFile(t)
+	h.add(&matchResult{Player: "alex", Partner: "bob", Opponent: "oleg",
+		OpponentPartner: "ivan", Game: "ping pong", Won: true})
+
+	if h.replay("ping pong", nil).get("alex") != ratingMean {
+		t.Fatal("Expected doubles to be left out of singles ratings.")
+	}
+	if h.doublesStandings("ping pong", h.Results[0].Date).get("alex") <=
+		trueskillMu-3*trueskillSigma {
+		t.Fatal("Expected doubles to count toward doubles ratings.")
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/codegangsta/cli"
+)
+
+// resultsFeedPath is the server's WebSocket endpoint streaming new results.
+const resultsFeedPath = "/ws/results"
+
+// resultsEventsPath is the server's Server-Sent Events endpoint streaming the
+// same results, for networks that block WebSockets.
+const resultsEventsPath = "/events/results"
+
+// resultsFeedURL returns the URL of the results feed relative to target.
+func resultsFeedURL(target *url.URL, feedPath string) *url.URL {
+	u := *target
+	u.Path = path.Join(u.Path, feedPath)
+	return &u
+}
+
+// watchResults prints every result the target u sends over the WebSocket feed
+// until it closes the connection. Each message is a JSON encoded result.
+func watchResults(u *url.URL, out io.Writer) error {
+	return streamResults(u, func(msg []byte) error {
+		return printFeedResult(msg, out)
+	})
+}
+
+// watchEvents prints every result the target u sends over the Server-Sent
+// Events feed until it closes the stream.
+func watchEvents(u *url.URL, out io.Writer) error {
+	return streamEvents(u, func(msg []byte) error {
+		return printFeedResult(msg, out)
+	})
+}
+
+// feedClient returns a client for the live feeds of the target u. Feeds stay
+// open, so unlike targetClient it has no timeout.
+func feedClient(u *url.URL) *http.Client {
+	return &http.Client{Transport: targetTransport(u)}
+}
+
+// streamResults calls fn with every message the target u sends over the
+// WebSocket feed until it closes the connection.
+func streamResults(u *url.URL, fn func(msg []byte) error) error {
+	header, err := targetHeader()
+	if err != nil {
+		return err
+	}
+	conn, err := dialWebsocket(feedClient(u), targetURL(u, resultsFeedPath), header)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	for {
+		msg, err := conn.readMessage()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(msg); err != nil {
+			return err
+		}
+	}
+}
+
+// streamEvents calls fn with the data of every event the target u sends over
+// the Server-Sent Events feed until it closes the stream. Comments and other
+// fields are ignored.
+func streamEvents(u *url.URL, fn func(msg []byte) error) error {
+	req, err := http.NewRequest("GET", targetURL(u, resultsEventsPath).String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if err := authorizeTarget(req); err != nil {
+		return err
+	}
+
+	resp, err := feedClient(u).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("on event stream: got code %d", resp.StatusCode)
+	}
+
+	var data []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if len(data) > 0 {
+				msg := []byte(strings.Join(data, "\n"))
+				if err := fn(msg); err != nil {
+					return err
+				}
+			}
+			data = nil
+			continue
+		}
+		if strings.HasPrefix(line, "data:") {
+			line = strings.TrimPrefix(line, "data:")
+			data = append(data, strings.TrimPrefix(line, " "))
+		}
+	}
+	return scanner.Err()
+}
+
+// printFeedResult prints a JSON encoded result received from a live feed.
+func printFeedResult(msg []byte, out io.Writer) error {
+	r := new(matchResult)
+	if err := json.Unmarshal(msg, r); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(out, formatHistoryLine(r))
+	return err
+}
+
+// watchCommand returns the 'gobeat watch' command.
+func watchCommand() cli.Command {
+	return cli.Command{
+		Name:      "watch",
+		ShortName: "w",
+		Description: "`watch` prints results live as the server accepts them, from " +
+			"its " + resultsFeedPath + " WebSocket feed or, with --sse, its " +
+			resultsEventsPath + " event stream.",
+		Usage: "watch",
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "sse",
+				Usage: "use Server-Sent Events instead of a WebSocket",
+			},
+		},
+		Action: func(c *cli.Context) {
+			u, err := settings.URL()
+			if err != nil {
+				printError(err)
+			}
+			if u.String() == "" {
+				printError(fmt.Errorf("no target set."))
+			}
+			if c.Bool("sse") {
+				err = watchEvents(u, os.Stdout)
+			} else {
+				err = watchResults(u, os.Stdout)
+			}
+			if err != nil {
+				printError(err)
+			}
+		},
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWatchResults(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != resultsFeedPath {
+			t.Fatalf("Expected the results feed path, got %s", r.URL.Path)
+		}
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Fatalf("Could not hijack connection: %s", err)
+		}
+		defer conn.Close()
+
+		buf.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+			"Upgrade: websocket\r\nConnection: Upgrade\r\n" +
+			"Sec-WebSocket-Accept: " +
+			websocketAccept(r.Header.Get("Sec-WebSocket-Key")) + "\r\n\r\n")
+
+		msg := `{"id":"1","player":"alex","opponent":"oleg","game":"ping pong",` +
+			`"score":"21-15","won":true,"date":"2014-04-24T12:00:00Z"}`
+		// Send the result split across a text frame and a continuation.
+		buf.Write([]byte{wsText, byte(10)})
+		buf.WriteString(msg[:10])
+		buf.Write([]byte{0x80 | wsPing, 0})
+		buf.Write([]byte{0x80 | wsContinuation, byte(len(msg) - 10)})
+		buf.WriteString(msg[10:])
+		buf.Write([]byte{0x80 | wsClose, 0})
+		buf.Flush()
+
+		// Wait for the client's pong and close.
+		ws := &wsConn{r: buf.Reader, rw: conn}
+		for i := 0; i < 2; i++ {
+			if _, _, _, err := ws.readFrame(); err != nil {
+				t.Fatalf("Expected client frames: %s", err)
+			}
+		}
+	}
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Could not parse URL %s: %s", ts.URL, err)
+	}
+	var out bytes.Buffer
+	if err := watchResults(u, &out); err != nil {
+		t.Fatalf("Expected a clean watch: %s", err)
+	}
+	if !strings.Contains(out.String(), "alex vs oleg  21-15") {
+		t.Fatalf("Expected the result to be printed, got %q", out.String())
+	}
+}
+
+func TestWatchEvents(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != resultsEventsPath {
+			t.Fatalf("Expected the results events path, got %s", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(": keepalive\n\n" +
+			"event: result\n" +
+			`data: {"id":"1","player":"alex","opponent":"oleg",` + "\n" +
+			`data: "score":"21-15","won":true}` + "\n\n"))
+	}
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Could not parse URL %s: %s", ts.URL, err)
+	}
+	var out bytes.Buffer
+	if err := watchEvents(u, &out); err != nil {
+		t.Fatalf("Expected a clean watch: %s", err)
+	}
+	if strings.Count(out.String(), "\n") != 1 ||
+		!strings.Contains(out.String(), "alex vs oleg  21-15") {
+		t.Fatalf("Expected one result to be printed, got %q", out.String())
+	}
+}
+
+func TestWatchUnixTarget(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gobeat_unix")
+	if err != nil {
+		t.Fatalf("Could not create directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "gobeat.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("Could not listen on %s: %s", socket, err)
+	}
+	go http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != resultsEventsPath {
+			t.Errorf("Expected the results events path, got %s", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(`data: {"id":"1","player":"alex","opponent":"oleg",` +
+			`"score":"21-15","won":true}` + "\n\n"))
+	}))
+	defer l.Close()
+
+	mockSettingsFile(t, "unix://"+socket)
+	u, err := settings.URL()
+	if err != nil {
+		t.Fatalf("Could not parse target: %s", err)
+	}
+	var out bytes.Buffer
+	if err := watchEvents(u, &out); err != nil {
+		t.Fatalf("Expected a clean watch over the socket: %s", err)
+	}
+	if !strings.Contains(out.String(), "alex vs oleg  21-15") {
+		t.Fatalf("Expected the result to be printed, got %q", out.String())
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/codegangsta/cli"
+)
+
+// yearReview is a player's year in review.
+type yearReview struct {
+	Player string
+	Year   int
+	Wins   int
+	Losses int
+
+	// Rival is the opponent Player played most, and Record their record
+	// against them.
+	Rival  string
+	Record record
+
+	// Upset is Player's least likely win going by the ratings before it, and
+	// Chance their chance of winning it.
+	Upset  *matchResult
+	Chance float64
+
+	// Day is the day of the week Player played most, and DayCount how many
+	// matches they played on it.
+	Day      time.Weekday
+	DayCount int
+
+	// From, To and Peak trace Player's rating in the current game over the
+	// year. Rated is false if they played no rated matches in it.
+	From, To, Peak float64
+	Rated          bool
+}
+
+// inYear reports whether t falls in year, in local time.
+func inYear(t time.Time, year int) bool {
+	return t.In(time.Local).Year() == year
+}
+
+// review computes player's year in review for year.
+func (h *gobeatHistory) review(player string, year int) *yearReview {
+	y := &yearReview{Player: player, Year: year, Chance: 1}
+
+	opponents := make(map[string]*record)
+	days := make(map[time.Weekday]int)
+	games := make(map[string]bool)
+	for _, r := range h.Results {
+		if r.Player != player || !inYear(r.Date, year) {
+			continue
+		}
+		if r.Won {
+			y.Wins++
+		} else {
+			y.Losses++
+		}
+		if opponents[r.Opponent] == nil {
+			opponents[r.Opponent] = new(record)
+		}
+		opponents[r.Opponent].add(r.Won)
+		days[r.Date.In(time.Local).Weekday()]++
+		games[r.Game] = true
+	}
+
+	for name, rec := range opponents {
+		n, best := rec.Wins+rec.Losses, y.Record.Wins+y.Record.Losses
+		if n > best || (n == best && name < y.Rival) {
+			y.Rival, y.Record = name, *rec
+		}
+	}
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if days[day] > y.DayCount {
+			y.Day, y.DayCount = day, days[day]
+		}
+	}
+
+	for game := range games {
+		h.replay(game, func(m *matchResult, rs ratingSystem) {
+			if m.Player != player || !m.Won || !inYear(m.Date, year) {
+				return
+			}
+			if chance := eloExpected(rs.get(player), rs.get(m.Opponent)); chance < y.Chance {
+				y.Upset, y.Chance = m, chance
+			}
+		})
+	}
+
+	y.From = ratingMean
+	for _, pt := range h.ratingHistory(player, settings.Game) {
+		switch {
+		case pt.Date.In(time.Local).Year() < year:
+			y.From = pt.Rating
+		case inYear(pt.Date, year):
+			if !y.Rated || pt.Rating > y.Peak {
+				y.Peak = pt.Rating
+			}
+			y.To, y.Rated = pt.Rating, true
+		}
+	}
+	return y
+}
+
+// lines returns the review as a series of short posts, suitable for posting
+// as a thread, with opponents named by name.
+func (y *yearReview) lines(name func(string) string) []string {
+	played := y.Wins + y.Losses
+	if played == 0 {
+		return []string{fmt.Sprintf("%s didn't play any matches in %d.", y.Player, y.Year)}
+	}
+	out := []string{fmt.Sprintf("%s's %d wrapped: %d matches, %d-%d (%.0f%% won).",
+		y.Player, y.Year, played, y.Wins, y.Losses, 100*float64(y.Wins)/float64(played))}
+	out = append(out, fmt.Sprintf("Best rival: %s, played %d times, %d-%d.", name(y.Rival),
+		y.Record.Wins+y.Record.Losses, y.Record.Wins, y.Record.Losses))
+	if y.Upset != nil && y.Chance < 0.5 {
+		out = append(out, fmt.Sprintf("Biggest upset: beat %s %s on %s with a %.0f%% chance.",
+			name(y.Upset.Opponent), y.Upset.Score, y.Upset.Date.Format("Jan 2"), 100*y.Chance))
+	}
+	out = append(out, fmt.Sprintf("Favorite day to play: %ss, with %d matches.",
+		y.Day, y.DayCount))
+	if y.Rated {
+		out = append(out, fmt.Sprintf("%s rating: %.0f to %.0f (%+.0f), peaking at %.0f.",
+			settings.Game, y.From, y.To, y.To-y.From, y.Peak))
+	}
+	return out
+}
+
+// wrappedCommand returns the 'gobeat wrapped' command.
+func wrappedCommand() cli.Command {
+	return cli.Command{
+		Name: "wrapped",
+		Description: "`wrapped` sums up a year of results: matches played, your best " +
+			"rival, biggest upset, favorite day and rating trajectory.",
+		Usage: "wrapped [--player name] [--post] [year]",
+		Flags: []cli.Flag{
+			cli.StringFlag{Name: "player", Usage: "review this player instead of you"},
+			cli.BoolFlag{Name: "post", Usage: "post the review to every destination as a thread"},
+		},
+		Action: func(c *cli.Context) {
+			year := time.Now().Year()
+			if len(c.Args()) > 0 {
+				var err error
+				if year, err = strconv.Atoi(c.Args().First()); err != nil {
+					printError(fmt.Errorf("year must be a number like 2024."))
+				}
+			}
+			player := settings.User
+			if c.String("player") != "" {
+				player = c.String("player")
+			}
+
+			h, err := retrieveHistory()
+			if err != nil {
+				printError(err)
+			}
+			review := h.review(player, year)
+			for _, line := range review.lines(func(name string) string { return name }) {
+				fmt.Println(line)
+			}
+
+			if c.Bool("post") {
+				// Opponents are named in posts as in announcements.
+				lines := review.lines(settings.publicName)
+				notifiers, err := settings.notifiers()
+				if err != nil {
+					printError(err)
+				}
+				// Posted one at a time so that the thread stays in order.
+				for _, line := range lines {
+					deliveries := deliver(notifiers, line)
+					if !delivered(deliveries) {
+						printDeliveries(deliveries)
+						printError(fmt.Errorf("could not post the review to any destination."))
+					}
+				}
+				fmt.Println("Posted the review")
+			}
+		},
+	}
+}
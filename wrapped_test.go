@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReview(t *testing.T) {
+	mockSettingsFile(t, "foo.gov")
+	h := mockHistoryFile(t)
+	// Tuesdays in 2024, after a win in 2023 that sets the starting rating.
+	tue := time.Date(2024, 1, 2, 12, 0, 0, 0, time.Local)
+	h.add(&matchResult{Player: "alex", Opponent: "oleg", Game: "ping pong", Won: true,
+		Date: tue.AddDate(0, 0, -14)})
+	for i := 0; i < 5; i++ {
+		h.add(&matchResult{Player: "ivan", Opponent: "alex", Game: "ping pong", Won: true,
+			Date: tue.AddDate(0, 0, 7*i)})
+	}
+	h.add(&matchResult{Player: "alex", Opponent: "oleg", Game: "ping pong", Won: false,
+		Score: "15-21", Date: tue})
+	h.add(&matchResult{Player: "alex", Opponent: "ivan", Game: "ping pong", Won: true,
+		Score: "21-19", Date: tue.AddDate(0, 1, 0)})
+	h.add(&matchResult{Player: "alex", Opponent: "ivan", Game: "ping pong", Won: false,
+		Date: tue.AddDate(0, 0, 35)})
+
+	y := h.review("alex", 2024)
+	if y.Wins != 1 || y.Losses != 2 {
+		t.Fatalf("Expected a 1-2 year, got %d-%d", y.Wins, y.Losses)
+	}
+	if y.Rival != "ivan" || y.Record.Wins != 1 || y.Record.Losses != 1 {
+		t.Fatalf("Expected ivan as the best rival, got %s %+v", y.Rival, y.Record)
+	}
+	if y.Upset == nil || y.Upset.Opponent != "ivan" || y.Chance >= 0.5 {
+		t.Fatalf("Expected the win over ivan to be the upset, got %+v", y.Upset)
+	}
+	if y.Day != time.Tuesday || y.DayCount != 2 {
+		t.Fatalf("Expected Tuesdays, got %ss (%d)", y.Day, y.DayCount)
+	}
+	if y.From != ratingMean+eloK/2 || !y.Rated {
+		t.Fatalf("Expected the year to start from 2023's rating, got %f", y.From)
+	}
+
+	asIs := func(name string) string { return name }
+	lines := y.lines(asIs)
+	if !strings.HasPrefix(lines[0], "alex's 2024 wrapped: 3 matches, 1-2") {
+		t.Fatalf("Expected a summary first, got %q", lines[0])
+	}
+	settings.OpponentNames = opponentNamesInitials
+	for _, line := range y.lines(settings.publicName) {
+		if strings.Contains(line, "ivan") {
+			t.Fatalf("Expected opponents to be named by initials in posts, got %q", line)
+		}
+	}
+	if lines := h.review("alex", 2020).lines(asIs); len(lines) != 1 {
+		t.Fatalf("Expected a single line for an empty year, got %v", lines)
+	}
+}